@@ -1,24 +1,46 @@
 package courier
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"mime"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/courier/utils"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/pkg/errors"
 	"gopkg.in/h2non/filetype.v1"
 )
 
-const (
-	maxAttBodyReadBytes = 100 * 1024 * 1024
-)
+// key of a previous response to a fetch attachment request, by channel UUID and SHA-256 of the attachment URL
+const fetchedAttachmentKey = "fetched_attachment:%s:%s"
+
+// how much of an attachment we peek at to determine its type
+const attSniffBytes = 300
+
+// how much of an error response body we'll read to include in the channel log
+const maxAttErrorBodyBytes = 10 * 1024
+
+// prefix of placeholders for incoming attachments which are fetched after their message has been written
+const pendingAttachmentPrefix = "pending:"
+
+// error returned by the reader of an attachment body when it exceeds the maximum size
+var errAttachmentTooLarge = errors.New("attachment exceeds maximum size")
 
 type Attachment struct {
 	ContentType string `json:"content_type"`
@@ -38,7 +60,7 @@ type fetchAttachmentResponse struct {
 	LogUUID    ChannelLogUUID `json:"log_uuid"`
 }
 
-func fetchAttachment(ctx context.Context, b Backend, r *http.Request) (*fetchAttachmentResponse, error) {
+func fetchAttachment(ctx context.Context, b Backend, cfg *Config, r *http.Request) (*fetchAttachmentResponse, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "error reading request body")
@@ -57,9 +79,17 @@ func fetchAttachment(ctx context.Context, b Backend, r *http.Request) (*fetchAtt
 		return nil, errors.Wrap(err, "error getting channel")
 	}
 
+	// if this URL has been fetched recently, return the same attachment
+	dedupKey := fmt.Sprintf(fetchedAttachmentKey, ch.UUID(), sha256Hex(fa.URL))
+	if cfg.FetchDedupWindow > 0 {
+		if prev := getFetchedAttachment(b.RedisPool(), dedupKey); prev != nil {
+			return prev, nil
+		}
+	}
+
 	clog := NewChannelLogForAttachmentFetch(ch, GetHandler(ch.ChannelType()).RedactValues(ch))
 
-	attachment, err := FetchAndStoreAttachment(ctx, b, ch, fa.URL, clog)
+	attachment, err := FetchAndStoreAttachment(ctx, b, cfg, ch, fa.URL, clog)
 
 	// try to write channel log even if we have an error
 	clog.End()
@@ -71,10 +101,91 @@ func fetchAttachment(ctx context.Context, b Backend, r *http.Request) (*fetchAtt
 		return nil, err
 	}
 
-	return &fetchAttachmentResponse{Attachment: attachment, LogUUID: clog.UUID()}, nil
+	resp := &fetchAttachmentResponse{Attachment: attachment, LogUUID: clog.UUID()}
+
+	// remember successful fetches, unavailable attachments might become available if we try again
+	if cfg.FetchDedupWindow > 0 && attachment.ContentType != "unavailable" {
+		setFetchedAttachment(b.RedisPool(), dedupKey, resp, time.Duration(cfg.FetchDedupWindow)*time.Second)
+	}
+
+	return resp, nil
+}
+
+// looks up a previous response to a fetch attachment request
+func getFetchedAttachment(rp *redis.Pool, key string) *fetchAttachmentResponse {
+	rc := rp.Get()
+	defer rc.Close()
+
+	val, err := redis.Bytes(rc.Do("GET", key))
+	if err != nil {
+		if err != redis.ErrNil {
+			slog.Error("error looking up fetched attachment", "error", err)
+		}
+		return nil
+	}
+
+	resp := &fetchAttachmentResponse{}
+	if err := json.Unmarshal(val, resp); err != nil {
+		slog.Error("error unmarshalling fetched attachment", "error", err)
+		return nil
+	}
+	return resp
+}
+
+// records the response to a fetch attachment request so that repeats of it within the given window get the same response
+func setFetchedAttachment(rp *redis.Pool, key string, resp *fetchAttachmentResponse, window time.Duration) {
+	rc := rp.Get()
+	defer rc.Close()
+
+	if _, err := rc.Do("SET", key, jsonx.MustMarshal(resp), "EX", int(window/time.Second)); err != nil {
+		slog.Error("error recording fetched attachment", "error", err)
+	}
 }
 
-func FetchAndStoreAttachment(ctx context.Context, b Backend, channel Channel, attURL string, clog *ChannelLog) (*Attachment, error) {
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// PendingAttachment returns a placeholder for an incoming attachment which will be fetched in the background after its
+// message has been written, so that handlers don't need to make providers wait. The reference is either the URL of the
+// attachment or something the channel handler can resolve to a URL, e.g. a media ID.
+func PendingAttachment(ref string) string {
+	return pendingAttachmentPrefix + ref
+}
+
+// ParsePendingAttachment returns the reference in the given attachment if it's a pending attachment placeholder
+func ParsePendingAttachment(attachment string) (string, bool) {
+	return strings.CutPrefix(attachment, pendingAttachmentPrefix)
+}
+
+// FetchPendingAttachment fetches and stores the attachment with the given pending reference, first resolving it to a
+// URL using the channel handler if it isn't one already
+func FetchPendingAttachment(ctx context.Context, b Backend, cfg *Config, channel Channel, ref string, clog *ChannelLog) (*Attachment, error) {
+	attURL := ref
+
+	if !strings.HasPrefix(ref, "http://") && !strings.HasPrefix(ref, "https://") {
+		resolver, isResolver := GetHandler(channel.ChannelType()).(AttachmentResolver)
+		if !isResolver {
+			return nil, errors.Errorf("unable to resolve attachment reference for channel type %s", channel.ChannelType())
+		}
+
+		var err error
+		attURL, err = resolver.ResolveAttachment(ctx, channel, ref, clog)
+		if err != nil {
+			return nil, errors.Wrap(err, "error resolving attachment reference")
+		}
+	}
+
+	return FetchAndStoreAttachment(ctx, b, cfg, channel, attURL, clog)
+}
+
+// FetchAndStoreAttachment fetches the attachment at the given URL and streams it to backend storage, scanning it first
+// if the config has a scanner. If it can't be fetched or is larger than the configured maximum, an attachment with the
+// pseudo content type "unavailable" is returned.
+func FetchAndStoreAttachment(ctx context.Context, b Backend, cfg *Config, channel Channel, attURL string, clog *ChannelLog) (*Attachment, error) {
+	maxBytes := cfg.MaxAttachmentBytes
+
 	parsedURL, err := url.Parse(attURL)
 	if err != nil {
 		return nil, err
@@ -93,13 +204,13 @@ func FetchAndStoreAttachment(ctx context.Context, b Backend, channel Channel, at
 		return nil, errors.Wrap(err, "unable to create attachment request")
 	}
 
-	trace, err := httpx.DoTrace(b.HttpClient(true), attRequest, nil, b.HttpAccess(), maxAttBodyReadBytes)
+	trace, err := doAttachmentRequest(b.HttpClient(true), attRequest, b.HttpAccess())
 	if trace != nil {
 		clog.HTTP(trace)
 
 		// if we got a non-200 response, return the attachment with a pseudo content type which tells the caller
 		// to continue without the attachment
-		if trace.Response == nil || trace.Response.StatusCode/100 != 2 || err == httpx.ErrResponseSize || err == httpx.ErrAccessConfig {
+		if trace.Response == nil || trace.Response.StatusCode/100 != 2 || err == httpx.ErrAccessConfig {
 			return &Attachment{ContentType: "unavailable", URL: attURL}, nil
 		}
 	}
@@ -107,43 +218,234 @@ func FetchAndStoreAttachment(ctx context.Context, b Backend, channel Channel, at
 		return nil, err
 	}
 
-	mimeType := ""
-	extension := filepath.Ext(parsedURL.Path)
-	if extension != "" {
-		extension = extension[1:]
+	defer trace.Response.Body.Close()
+
+	// no point downloading something which tells us upfront that it's too big
+	if trace.Response.ContentLength > int64(maxBytes) {
+		clog.Error(ErrorAttachmentTooLarge(maxBytes))
+		return &Attachment{ContentType: "unavailable", URL: attURL}, nil
 	}
 
-	// first try getting our mime type from the first 300 bytes of our body
-	fileType, _ := filetype.Match(trace.ResponseBody[:300])
-	if fileType != filetype.Unknown {
-		mimeType = fileType.MIME.Value
-		extension = fileType.Extension
-	} else {
-		// if that didn't work, try from our extension
-		fileType = filetype.GetType(extension)
-		if fileType != filetype.Unknown {
-			mimeType = fileType.MIME.Value
-			extension = fileType.Extension
+	body := bufio.NewReaderSize(trace.Response.Body, attSniffBytes)
+	head, _ := body.Peek(attSniffBytes)
+
+	urlExtension := strings.TrimPrefix(filepath.Ext(parsedURL.Path), ".")
+
+	mimeType, extension, cerr := sniffAttachment(head, urlExtension, trace.Response.Header.Get("Content-Type"))
+	if cerr != nil {
+		clog.Error(cerr)
+		return &Attachment{ContentType: "unavailable", URL: attURL}, nil
+	}
+
+	reader := &attachmentReader{r: body, maxBytes: maxBytes}
+	var content io.Reader = reader
+
+	// if we're scanning attachments, we need all of it before we can decide whether to save it
+	if scanner, policy := cfg.AttachmentScanner(); scanner != nil {
+		f, err := os.CreateTemp("", "courier-scan-*")
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating attachment temp file")
 		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		_, err = io.Copy(f, reader)
+		if reader.exceeded {
+			clog.Error(ErrorAttachmentTooLarge(maxBytes))
+			return &Attachment{ContentType: "unavailable", URL: attURL}, nil
+		}
+		if reader.err != nil {
+			return nil, errors.Wrap(reader.err, "error reading attachment body")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error writing attachment temp file")
+		}
+
+		placeholder, err := scanAttachment(ctx, b, scanner, policy, channel, f, reader.bytes, mimeType, extension, attURL, clog)
+		if err != nil || placeholder != nil {
+			return placeholder, err
+		}
+		content = f
 	}
 
-	// we still don't know our mime type, use our content header instead
-	if mimeType == "" {
-		mimeType, _, _ = mime.ParseMediaType(trace.Response.Header.Get("Content-Type"))
+	storageURL, err := b.SaveAttachmentStream(ctx, channel, mimeType, content, extension)
+	if reader.exceeded {
+		clog.Error(ErrorAttachmentTooLarge(maxBytes))
+		return &Attachment{ContentType: "unavailable", URL: attURL}, nil
+	}
+	if reader.err != nil {
+		return nil, errors.Wrap(reader.err, "error reading attachment body")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Attachment{ContentType: mimeType, URL: storageURL, Size: reader.bytes}, nil
+}
+
+// media types which are text based, and so can legitimately be detected as text
+var textMediaTypes = map[string]bool{
+	"image/svg+xml": true,
+}
+
+// extensions for types which can be detected by the standard library but not by filetype
+var sniffedExtensions = map[string]string{
+	"text/plain":             "txt",
+	"text/xml":               "xml",
+	"application/pdf":        "pdf",
+	"application/postscript": "ps",
+}
+
+// determines the content type and extension of an attachment from the first bytes of its content, falling back to the
+// extension of its URL and then its content type header. If the content is clearly not what it claims to be, e.g. an
+// HTML error page served as an image, a channel error is returned instead.
+func sniffAttachment(head []byte, urlExtension, header string) (string, string, *ChannelError) {
+	// magic bytes are the most reliable indicator of type
+	if fileType, _ := filetype.Match(head); fileType != filetype.Unknown {
+		return fileType.MIME.Value, fileType.Extension, nil
+	}
+
+	// otherwise look at what the content resembles, e.g. text/html, text/plain or application/octet-stream
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+
+	// and what the URL or header claim it to be
+	declared, extension := "", urlExtension
+	if fileType := filetype.GetType(urlExtension); fileType != filetype.Unknown {
+		declared, extension = fileType.MIME.Value, fileType.Extension
+	} else {
+		declared, _, _ = mime.ParseMediaType(header)
+	}
+
+	// providers often return HTML error or login pages with a 200 status
+	if detected == "text/html" && urlExtension != "html" && urlExtension != "htm" {
+		return "", "", ErrorAttachmentHTMLResponse()
+	}
+
+	// media is binary, so unless it's text based, if content looks like text then it's not the media it claims to be
+	if strings.HasPrefix(detected, "text/") && !textMediaTypes[declared] && (strings.HasPrefix(declared, "image/") || strings.HasPrefix(declared, "audio/") || strings.HasPrefix(declared, "video/")) {
+		return "", "", ErrorAttachmentTypeMismatch(declared)
+	}
+
+	mimeType := declared
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = detected
+	}
+
+	if extension == "" {
+		extension = sniffedExtensions[mimeType]
 		if extension == "" {
-			extensions, err := mime.ExtensionsByType(mimeType)
-			if extensions == nil || err != nil {
-				extension = ""
-			} else {
+			if extensions, _ := mime.ExtensionsByType(mimeType); len(extensions) > 0 {
 				extension = extensions[0][1:]
 			}
 		}
 	}
 
-	storageURL, err := b.SaveAttachment(ctx, channel, mimeType, trace.ResponseBody, extension)
+	return mimeType, extension, nil
+}
+
+// what infected attachments are replaced with
+var infectedPlaceholder = []byte("This attachment was removed because it was found to contain malware.")
+
+// scans the given spooled attachment, and if it's infected, quarantines it and returns a placeholder attachment to be
+// used instead. Attachments which are too big to scan or which the scanner fails on are let through unless the scan
+// policy is to fail closed, in which case they're returned as unavailable. Otherwise the file is rewound ready to be
+// saved.
+func scanAttachment(ctx context.Context, b Backend, scanner AttachmentScanner, policy ScanPolicy, channel Channel, f *os.File, size int, contentType, extension, attURL string, clog *ChannelLog) (*Attachment, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "error rewinding attachment temp file")
+	}
+
+	var result *ScanResult
+	var err error
+
+	if policy.MaxBytes > 0 && size > policy.MaxBytes {
+		err = errors.Errorf("attachment of %d bytes exceeds scan limit of %d bytes", size, policy.MaxBytes)
+	} else {
+		result, err = scanner(ctx, f)
+	}
+
+	if err != nil {
+		slog.Error("error scanning attachment", "error", err, "channel_uuid", channel.UUID())
+		clog.Error(ErrorAttachmentNotScanned())
+
+		if policy.FailClosed {
+			return &Attachment{ContentType: "unavailable", URL: attURL}, nil
+		}
+	} else if result.Infected {
+		clog.Error(ErrorAttachmentInfected(result.Signature))
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, errors.Wrap(err, "error rewinding attachment temp file")
+		}
+		path, err := b.QuarantineAttachment(ctx, channel, contentType, f, extension)
+		if err != nil {
+			return nil, errors.Wrap(err, "error quarantining attachment")
+		}
+
+		slog.Warn("quarantined infected attachment", "signature", result.Signature, "path", path, "channel_uuid", channel.UUID())
+
+		placeholderURL, err := b.SaveAttachment(ctx, channel, "text/plain", infectedPlaceholder, "txt")
+		if err != nil {
+			return nil, err
+		}
+
+		return &Attachment{ContentType: "text/plain", URL: placeholderURL, Size: len(infectedPlaceholder)}, nil
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	return nil, errors.Wrap(err, "error rewinding attachment temp file")
+}
+
+// makes the given attachment request, returning a trace which doesn't include the response body. For successful
+// responses the body is left unread so that it can be streamed, otherwise some of it is read into the trace.
+func doAttachmentRequest(client *http.Client, request *http.Request, access *httpx.AccessConfig) (*httpx.Trace, error) {
+	requestTrace, err := httputil.DumpRequestOut(request, true)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Attachment{ContentType: mimeType, URL: storageURL, Size: len(trace.ResponseBody)}, nil
+	trace := &httpx.Trace{Request: request, RequestTrace: requestTrace, StartTime: dates.Now()}
+	defer func() { trace.EndTime = dates.Now() }()
+
+	trace.Response, err = httpx.Do(client, request, nil, access)
+	if err != nil {
+		return trace, err
+	}
+
+	trace.ResponseTrace, err = httputil.DumpResponse(trace.Response, false)
+	if err != nil {
+		trace.Response.Body.Close()
+		return trace, err
+	}
+
+	if trace.Response.StatusCode/100 != 2 {
+		defer trace.Response.Body.Close()
+
+		trace.ResponseBody, _ = io.ReadAll(io.LimitReader(trace.Response.Body, maxAttErrorBodyBytes))
+	}
+
+	return trace, nil
+}
+
+// reader for attachment bodies which counts the bytes read and errors if that exceeds the maximum
+type attachmentReader struct {
+	r        io.Reader
+	maxBytes int
+	bytes    int
+	exceeded bool
+	err      error
+}
+
+func (a *attachmentReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	a.bytes += n
+
+	if a.bytes > a.maxBytes {
+		a.exceeded = true
+		return n, errAttachmentTooLarge
+	}
+	if err != nil && err != io.EOF {
+		a.err = err
+	}
+	return n, err
 }
@@ -1,8 +1,12 @@
 package courier_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/nyaruka/courier"
@@ -10,6 +14,7 @@ import (
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFetchAndStoreAttachment(t *testing.T) {
@@ -19,6 +24,7 @@ func TestFetchAndStoreAttachment(t *testing.T) {
 	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
 		"http://mock.com/media/hello.jpg": {
 			httpx.NewMockResponse(200, nil, testJPG),
+			httpx.NewMockResponse(200, nil, testJPG),
 		},
 		"http://mock.com/media/hello.mp3": {
 			httpx.NewMockResponse(502, nil, []byte(`My gateways!`)),
@@ -36,13 +42,15 @@ func TestFetchAndStoreAttachment(t *testing.T) {
 
 	ctx := context.Background()
 	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+	cfg.MaxAttachmentBytes = 1024 * 1024
 
 	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
 	mb.AddChannel(mockChannel)
 
 	clog := courier.NewChannelLogForAttachmentFetch(mockChannel, []string{"sesame"})
 
-	att, err := courier.FetchAndStoreAttachment(ctx, mb, mockChannel, "http://mock.com/media/hello.jpg", clog)
+	att, err := courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.jpg", clog)
 	assert.NoError(t, err)
 	assert.Equal(t, "image/jpeg", att.ContentType)
 	assert.Equal(t, "https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.jpg", att.URL)
@@ -54,7 +62,7 @@ func TestFetchAndStoreAttachment(t *testing.T) {
 	assert.Equal(t, "http://mock.com/media/hello.jpg", clog.HTTPLogs()[0].URL)
 
 	// a non-200 response should return an unavailable attachment
-	att, err = courier.FetchAndStoreAttachment(ctx, mb, mockChannel, "http://mock.com/media/hello.mp3", clog)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.mp3", clog)
 	assert.NoError(t, err)
 	assert.Equal(t, &courier.Attachment{ContentType: "unavailable", URL: "http://mock.com/media/hello.mp3"}, att)
 
@@ -64,14 +72,273 @@ func TestFetchAndStoreAttachment(t *testing.T) {
 	assert.Len(t, mb.SavedAttachments(), 1)
 
 	// same for a connection error
-	att, err = courier.FetchAndStoreAttachment(ctx, mb, mockChannel, "http://mock.com/media/hello.pdf", clog)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.pdf", clog)
 	assert.NoError(t, err)
 	assert.Equal(t, &courier.Attachment{ContentType: "unavailable", URL: "http://mock.com/media/hello.pdf"}, att)
 
+	// as should an attachment which says upfront that it's larger than our maximum
+	cfg.MaxAttachmentBytes = 10000
+
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.Attachment{ContentType: "unavailable", URL: "http://mock.com/media/hello.jpg"}, att)
+	assert.Len(t, mb.SavedAttachments(), 1)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorAttachmentTooLarge(10000)}, clog.Errors())
+
 	// an actual error on our part should be returned as an error
+	cfg.MaxAttachmentBytes = 1024 * 1024
 	mb.SetStorageError(errors.New("boom"))
 
-	att, err = courier.FetchAndStoreAttachment(ctx, mb, mockChannel, "http://mock.com/media/hello.txt", clog)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.txt", clog)
 	assert.EqualError(t, err, "boom")
 	assert.Nil(t, att)
 }
+
+func TestPendingAttachments(t *testing.T) {
+	assert.Equal(t, "pending:1234", courier.PendingAttachment("1234"))
+	assert.Equal(t, "pending:http://mock.com/media/hello.jpg", courier.PendingAttachment("http://mock.com/media/hello.jpg"))
+
+	ref, isPending := courier.ParsePendingAttachment("pending:1234")
+	assert.True(t, isPending)
+	assert.Equal(t, "1234", ref)
+
+	_, isPending = courier.ParsePendingAttachment("image/jpeg:http://mock.com/media/hello.jpg")
+	assert.False(t, isPending)
+}
+
+func TestFetchPendingAttachment(t *testing.T) {
+	testJPG := test.ReadFile("test/testdata/test.jpg")
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/media/hello.jpg": {
+			httpx.NewMockResponse(200, nil, testJPG),
+		},
+		"http://mock.com/media/1234": {
+			httpx.NewMockResponse(200, nil, testJPG),
+		},
+	}))
+
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
+	otherChannel := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{})
+
+	clog := courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+
+	// URLs are fetched as is
+	att, err := courier.FetchPendingAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", att.ContentType)
+
+	// other references are resolved to URLs by the channel handler
+	att, err = courier.FetchPendingAttachment(ctx, mb, cfg, mockChannel, "1234", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", att.ContentType)
+	assert.Len(t, mb.SavedAttachments(), 2)
+	assert.Len(t, clog.HTTPLogs(), 2)
+	assert.Equal(t, "http://mock.com/media/1234", clog.HTTPLogs()[1].URL)
+
+	_, err = courier.FetchPendingAttachment(ctx, mb, cfg, mockChannel, "missing", clog)
+	assert.EqualError(t, err, "error resolving attachment reference: no such media")
+
+	// if the channel handler can't resolve references, that's an error
+	_, err = courier.FetchPendingAttachment(ctx, mb, cfg, otherChannel, "1234", clog)
+	assert.EqualError(t, err, "unable to resolve attachment reference for channel type NX")
+}
+
+func TestFetchAndStoreAttachmentStreaming(t *testing.T) {
+	testJPG := test.ReadFile("test/testdata/test.jpg")
+
+	// serve the attachment in chunks without a content length so its size isn't known until it's been read
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		for i := 0; i < len(testJPG); i += 4096 {
+			w.Write(testJPG[i:min(i+4096, len(testJPG))])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+	cfg.MaxAttachmentBytes = 1024 * 1024
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
+	mb.AddChannel(mockChannel)
+
+	clog := courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+
+	att, err := courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, server.URL+"/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", att.ContentType)
+	assert.Equal(t, 17301, att.Size)
+	assert.Len(t, mb.SavedAttachments(), 1)
+	assert.Equal(t, testJPG, mb.SavedAttachments()[0].Data)
+	assert.Len(t, clog.HTTPLogs(), 1)
+	assert.Len(t, clog.Errors(), 0)
+
+	// once we've read more than our maximum, we give up and the attachment is unavailable
+	cfg.MaxAttachmentBytes = 10000
+
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, server.URL+"/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.Attachment{ContentType: "unavailable", URL: server.URL + "/hello.jpg"}, att)
+	assert.Len(t, mb.SavedAttachments(), 1)
+	assert.Len(t, clog.HTTPLogs(), 2)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorAttachmentTooLarge(10000)}, clog.Errors())
+}
+
+func TestFetchAndStoreAttachmentScanning(t *testing.T) {
+	testJPG := test.ReadFile("test/testdata/test.jpg")
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/media/hello.jpg": {
+			httpx.NewMockResponse(200, nil, testJPG),
+			httpx.NewMockResponse(200, nil, testJPG),
+			httpx.NewMockResponse(200, nil, testJPG),
+		},
+		"http://mock.com/media/hello.exe": {
+			httpx.NewMockResponse(200, nil, []byte(eicar)),
+		},
+		"http://mock.com/media/big.txt": {
+			httpx.NewMockResponse(200, nil, bytes.Repeat([]byte(eicar), 500)),
+		},
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startMockClamd(t, l, 100*1024)
+
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+	cfg.MaxAttachmentBytes = 1024 * 1024
+	cfg.ClamdAddress = "tcp://" + l.Addr().String()
+	cfg.ClamdMaxBytes = 20000
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
+	mb.AddChannel(mockChannel)
+
+	// clean attachments are saved as normal
+	clog := courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+	att, err := courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", att.ContentType)
+	assert.Equal(t, 17301, att.Size)
+	assert.Len(t, mb.SavedAttachments(), 1)
+	assert.Equal(t, testJPG, mb.SavedAttachments()[0].Data)
+	assert.Len(t, mb.QuarantinedAttachments(), 0)
+	assert.Len(t, clog.Errors(), 0)
+
+	// infected attachments are quarantined and replaced with a placeholder
+	clog = courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.exe", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", att.ContentType)
+	assert.Len(t, mb.SavedAttachments(), 2)
+	assert.Equal(t, "text/plain", mb.SavedAttachments()[1].ContentType)
+	assert.Equal(t, "This attachment was removed because it was found to contain malware.", string(mb.SavedAttachments()[1].Data))
+	assert.Len(t, mb.QuarantinedAttachments(), 1)
+	assert.Equal(t, []byte(eicar), mb.QuarantinedAttachments()[0].Data)
+	assert.Equal(t, "exe", mb.QuarantinedAttachments()[0].Extension)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorAttachmentInfected("Eicar-Test-Signature")}, clog.Errors())
+
+	// attachments bigger than our scan limit aren't scanned but are let through
+	clog = courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/big.txt", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", att.ContentType)
+	assert.Len(t, mb.SavedAttachments(), 3)
+	assert.Len(t, mb.QuarantinedAttachments(), 1)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorAttachmentNotScanned()}, clog.Errors())
+
+	// if scanning fails, we let the attachment through but record that it wasn't scanned
+	l.Close()
+
+	clog = courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", att.ContentType)
+	assert.Len(t, mb.SavedAttachments(), 4)
+	assert.Equal(t, testJPG, mb.SavedAttachments()[3].Data)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorAttachmentNotScanned()}, clog.Errors())
+
+	// unless our policy is to fail closed, in which case it's unavailable
+	cfg.ScanFailClosed = true
+
+	clog = courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+	att, err = courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, "http://mock.com/media/hello.jpg", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.Attachment{ContentType: "unavailable", URL: "http://mock.com/media/hello.jpg"}, att)
+	assert.Len(t, mb.SavedAttachments(), 4)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorAttachmentNotScanned()}, clog.Errors())
+}
+
+func TestFetchAndStoreAttachmentSniffing(t *testing.T) {
+	testJPG := test.ReadFile("test/testdata/test.jpg")
+	errorPage := []byte("<!DOCTYPE html>\n<html><head><title>404 Not Found</title></head><body>Not Found</body></html>")
+	testSVG := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"></svg>`)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/media/1234":       {httpx.NewMockResponse(200, map[string]string{"Content-Type": "application/octet-stream"}, testJPG)},
+		"http://mock.com/media/hello.png":  {httpx.NewMockResponse(200, map[string]string{"Content-Type": "image/png"}, testJPG)},
+		"http://mock.com/media/hello.jpg":  {httpx.NewMockResponse(200, map[string]string{"Content-Type": "image/jpeg"}, errorPage)},
+		"http://mock.com/media/5678":       {httpx.NewMockResponse(200, map[string]string{"Content-Type": "image/jpeg"}, []byte(`Access denied`))},
+		"http://mock.com/media/hello":      {httpx.NewMockResponse(200, map[string]string{"Content-Type": "application/octet-stream"}, []byte(`Just some text`))},
+		"http://mock.com/media/hello.html": {httpx.NewMockResponse(200, map[string]string{"Content-Type": "text/html"}, errorPage)},
+		"http://mock.com/media/hello.xyz":  {httpx.NewMockResponse(200, map[string]string{"Content-Type": "audio/x-custom"}, []byte{0, 1, 2, 3, 4})},
+		"http://mock.com/media/hello.svg":  {httpx.NewMockResponse(200, map[string]string{"Content-Type": "image/svg+xml"}, testSVG)},
+		"http://mock.com/media/6789":       {httpx.NewMockResponse(200, map[string]string{"Content-Type": "image/svg+xml"}, []byte(`<svg width="10" height="10"></svg>`))},
+	}))
+
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+	cfg.MaxAttachmentBytes = 1024 * 1024
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
+	mb.AddChannel(mockChannel)
+
+	tcs := []struct {
+		url               string
+		expectedType      string
+		expectedExtension string
+		expectedError     *courier.ChannelError
+	}{
+		{url: "http://mock.com/media/1234", expectedType: "image/jpeg", expectedExtension: "jpg"},      // type corrected from content
+		{url: "http://mock.com/media/hello.png", expectedType: "image/jpeg", expectedExtension: "jpg"}, // and extension too
+		{url: "http://mock.com/media/hello.jpg", expectedType: "unavailable", expectedError: courier.ErrorAttachmentHTMLResponse()},
+		{url: "http://mock.com/media/5678", expectedType: "unavailable", expectedError: courier.ErrorAttachmentTypeMismatch("image/jpeg")},
+		{url: "http://mock.com/media/hello", expectedType: "text/plain", expectedExtension: "txt"},
+		{url: "http://mock.com/media/hello.html", expectedType: "text/html", expectedExtension: "html"},
+		{url: "http://mock.com/media/hello.xyz", expectedType: "audio/x-custom", expectedExtension: "xyz"},
+		{url: "http://mock.com/media/hello.svg", expectedType: "image/svg+xml", expectedExtension: "svg"}, // text based media
+		{url: "http://mock.com/media/6789", expectedType: "image/svg+xml", expectedExtension: "svg"},
+	}
+
+	for _, tc := range tcs {
+		mb.Reset()
+		clog := courier.NewChannelLogForAttachmentFetch(mockChannel, nil)
+
+		att, err := courier.FetchAndStoreAttachment(ctx, mb, cfg, mockChannel, tc.url, clog)
+		assert.NoError(t, err, "unexpected error for %s", tc.url)
+		assert.Equal(t, tc.expectedType, att.ContentType, "content type mismatch for %s", tc.url)
+
+		if tc.expectedError != nil {
+			assert.Equal(t, []*courier.ChannelError{tc.expectedError}, clog.Errors(), "errors mismatch for %s", tc.url)
+			assert.Len(t, mb.SavedAttachments(), 0, "attachment saved for %s", tc.url)
+		} else {
+			assert.Len(t, clog.Errors(), 0, "unexpected errors for %s", tc.url)
+			if assert.Len(t, mb.SavedAttachments(), 1, "attachment not saved for %s", tc.url) {
+				assert.Equal(t, tc.expectedType, mb.SavedAttachments()[0].ContentType, "saved content type mismatch for %s", tc.url)
+				assert.Equal(t, tc.expectedExtension, mb.SavedAttachments()[0].Extension, "saved extension mismatch for %s", tc.url)
+			}
+		}
+	}
+}
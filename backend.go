@@ -3,8 +3,10 @@ package courier
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/httpx"
@@ -67,6 +69,13 @@ type Backend interface {
 	// WriteChannelLog writes the passed in channel log to our backend
 	WriteChannelLog(context.Context, *ChannelLog) error
 
+	// GetChannelLog returns the channel log of the given channel with the given UUID, or nil if there's no such log
+	GetChannelLog(context.Context, Channel, ChannelLogUUID) (*StoredChannelLog, error)
+
+	// QueryChannelLogs returns the most recent channel logs of the given channel which match the given query, and the
+	// UUIDs of any logs which couldn't be read
+	QueryChannelLogs(context.Context, Channel, *ChannelLogQuery) ([]*StoredChannelLog, []ChannelLogUUID, error)
+
 	// PopNextOutgoingMsg returns the next message that needs to be sent, callers should call MarkOutgoingMsgComplete with the
 	// returned message when they have dealt with the message (regardless of whether it was sent or not)
 	PopNextOutgoingMsg(context.Context) (MsgOut, error)
@@ -79,6 +88,9 @@ type Backend interface {
 	// a message is being forced in being resent by a user
 	ClearMsgSent(context.Context, MsgID) error
 
+	// RerouteOutgoingMsg queues the passed in message to be sent instead on the given channel to the given URN
+	RerouteOutgoingMsg(ctx context.Context, msg MsgOut, channel Channel, urn urns.URN, from *MsgReroute) error
+
 	// MarkOutgoingMsgComplete marks the passed in message as having been processed. Note this should be called even in the case
 	// of errors during sending as it will manage the number of active workers per channel. The optional status parameter can be
 	// used to determine any sort of deduping of msg sends
@@ -87,9 +99,22 @@ type Backend interface {
 	// SaveAttachment saves an attachment to backend storage
 	SaveAttachment(context.Context, Channel, string, []byte, string) (string, error)
 
+	// SaveAttachmentStream saves an attachment to backend storage as it's read from the given reader
+	SaveAttachmentStream(context.Context, Channel, string, io.Reader, string) (string, error)
+
+	// QuarantineAttachment saves an infected attachment to private backend storage, returning its path
+	QuarantineAttachment(context.Context, Channel, string, io.Reader, string) (string, error)
+
+	// PresignAttachmentURL returns a presigned URL for an attachment in backend storage which expires at the given time,
+	// or an empty string if the URL isn't of an attachment that storage can presign
+	PresignAttachmentURL(context.Context, string, time.Time) (string, error)
+
 	// ResolveMedia resolves an outgoing attachment URL to a media object
 	ResolveMedia(context.Context, string) (Media, error)
 
+	// SaveMediaAlternate saves transcoded media to backend storage and records it as an alternate of the given media
+	SaveMediaAlternate(context.Context, Channel, Media, *Transcoded) (Media, error)
+
 	// HttpClient returns an HTTP client for making external requests
 	HttpClient(bool) *http.Client
 	HttpAccess() *httpx.AccessConfig
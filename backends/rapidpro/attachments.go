@@ -0,0 +1,222 @@
+package rapidpro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/pkg/errors"
+)
+
+// set of incoming messages which have been written but are waiting for their pending attachments to be fetched, scored
+// by when they can next be claimed by a fetcher
+const pendingAttachmentsKey = "pending_attachments"
+
+// pendingMsg is an incoming message waiting for its pending attachments to be fetched before it can be queued for
+// handling by mailroom, which happens once they've all been fetched or the deadline has passed
+type pendingMsg struct {
+	Msg        *Msg      `json:"msg"`
+	NewContact bool      `json:"new_contact"`
+	Deadline   time.Time `json:"deadline"`
+
+	raw []byte // as it appears in the set so that it can be removed once it's done
+}
+
+func hasPendingAttachments(m *Msg) bool {
+	for _, a := range m.Attachments_ {
+		if _, isPending := courier.ParsePendingAttachment(a); isPending {
+			return true
+		}
+	}
+	return false
+}
+
+// removes any pending attachment placeholders from the given message
+func stripPendingAttachments(m *Msg) {
+	attachments := make([]string, 0, len(m.Attachments_))
+	for _, a := range m.Attachments_ {
+		if _, isPending := courier.ParsePendingAttachment(a); !isPending {
+			attachments = append(attachments, a)
+		}
+	}
+	m.Attachments_ = attachments
+}
+
+// queues the given message to have its pending attachments fetched by our fetchers
+func queuePendingMsg(rc redis.Conn, c *Contact, m *Msg, timeout time.Duration) error {
+	now := time.Now()
+	pm := &pendingMsg{Msg: m, NewContact: c.IsNew_, Deadline: now.Add(timeout)}
+
+	_, err := rc.Do("ZADD", pendingAttachmentsKey, now.UnixMilli(), jsonx.MustMarshal(pm))
+	return errors.Wrap(err, "error queueing msg with pending attachments")
+}
+
+// claims the first message which is ready by pushing back when it can next be claimed to when the lease expires
+var luaClaimPendingMsg = redis.NewScript(1, `-- KEYS: [PendingKey] ARGV: [Now, LeaseExpires]
+local items = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #items == 0 then
+	return nil
+end
+redis.call("zadd", KEYS[1], "XX", ARGV[2], items[1])
+return items[1]
+`)
+
+// claims the next message waiting for its attachments to be fetched. The message stays in the set until it's completed,
+// so if that doesn't happen before the lease expires, e.g. because we were stopped, it can be claimed again.
+func claimPendingMsg(rc redis.Conn, lease time.Duration) (*pendingMsg, error) {
+	now := time.Now()
+
+	raw, err := redis.Bytes(luaClaimPendingMsg.Do(rc, pendingAttachmentsKey, now.UnixMilli(), now.Add(lease).UnixMilli()))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error claiming msg with pending attachments")
+	}
+
+	pm := &pendingMsg{raw: raw}
+	if err := json.Unmarshal(raw, pm); err != nil {
+		// nothing will ever be able to handle this so don't leave it to be claimed again
+		rc.Do("ZREM", pendingAttachmentsKey, raw)
+		return nil, errors.Wrap(err, "error unmarshalling msg with pending attachments")
+	}
+	return pm, nil
+}
+
+// removes the given message from the set of those waiting for their attachments to be fetched
+func completePendingMsg(rc redis.Conn, pm *pendingMsg) error {
+	_, err := rc.Do("ZREM", pendingAttachmentsKey, pm.raw)
+	return errors.Wrap(err, "error completing msg with pending attachments")
+}
+
+// how long fetchers wait before checking again when there are no messages waiting for their attachments to be fetched
+const pendingMsgPollInterval = 250 * time.Millisecond
+
+// starts the go routines which fetch the pending attachments of incoming messages
+func (b *backend) startAttachmentFetchers() {
+	// a fetcher can take up until a message's deadline to fetch its attachments and then needs time to update it
+	lease := time.Duration(b.config.FetchTimeout)*time.Second + time.Minute
+
+	for i := 0; i < b.config.FetchWorkers; i++ {
+		b.waitGroup.Add(1)
+
+		go func() {
+			defer b.waitGroup.Done()
+
+			for {
+				select {
+				case <-b.stopChan:
+					return
+				default:
+				}
+
+				rc := b.redisPool.Get()
+				pm, err := claimPendingMsg(rc, lease)
+				rc.Close()
+
+				if err != nil {
+					slog.Error("error getting msg with pending attachments", "error", err)
+					time.Sleep(time.Second)
+					continue
+				}
+				if pm == nil {
+					time.Sleep(pendingMsgPollInterval)
+					continue
+				}
+
+				// if this fails, the message will be claimed again when its lease expires, by which time its deadline
+				// will have passed and it'll be queued for handling without any attachments we couldn't fetch
+				if err := b.fetchPendingAttachments(pm); err != nil {
+					slog.Error("error fetching pending attachments", "error", err, "msg", pm.Msg.UUID())
+					continue
+				}
+
+				rc = b.redisPool.Get()
+				err = completePendingMsg(rc, pm)
+				rc.Close()
+
+				if err != nil {
+					slog.Error("error completing msg with pending attachments", "error", err, "msg", pm.Msg.UUID())
+				}
+			}
+		}()
+	}
+}
+
+const sqlUpdateMsgAttachments = `
+UPDATE msgs_msg
+   SET attachments = $2, log_uuids = array_append(log_uuids, $3::uuid), modified_on = NOW()
+ WHERE id = $1`
+
+// fetches the pending attachments of the given message, updates it in the database and then queues it for handling.
+// Any attachments which can't be fetched before the deadline are left off the message.
+func (b *backend) fetchPendingAttachments(pm *pendingMsg) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	m := pm.Msg
+
+	channel, err := b.GetChannel(ctx, courier.AnyChannelType, m.ChannelUUID_)
+	if err != nil {
+		return errors.Wrap(err, "error getting channel")
+	}
+	m.channel = channel.(*Channel)
+
+	var redactVals []string
+	if handler := courier.GetHandler(channel.ChannelType()); handler != nil {
+		redactVals = handler.RedactValues(channel)
+	}
+	clog := courier.NewChannelLogForAttachmentFetch(channel, redactVals)
+
+	fetchCtx, cancelFetch := context.WithDeadline(context.Background(), pm.Deadline)
+	defer cancelFetch()
+
+	attachments := make([]string, 0, len(m.Attachments_))
+
+	for _, a := range m.Attachments_ {
+		ref, isPending := courier.ParsePendingAttachment(a)
+		if !isPending {
+			attachments = append(attachments, a)
+			continue
+		}
+
+		if fetchCtx.Err() != nil {
+			clog.Error(courier.ErrorAttachmentTimeout())
+			continue
+		}
+
+		attachment, err := courier.FetchPendingAttachment(fetchCtx, b, b.config, channel, ref, clog)
+		if err != nil {
+			if fetchCtx.Err() != nil {
+				clog.Error(courier.ErrorAttachmentTimeout())
+			} else {
+				slog.Error("error fetching pending attachment", "error", err, "msg", m.UUID(), "ref", ref)
+			}
+			continue
+		}
+		if attachment.ContentType != "unavailable" {
+			attachments = append(attachments, fmt.Sprintf("%s:%s", attachment.ContentType, attachment.URL))
+		}
+	}
+
+	m.Attachments_ = attachments
+
+	clog.End()
+	if err := b.WriteChannelLog(ctx, clog); err != nil {
+		slog.Error("error writing log", "error", err)
+	}
+
+	if _, err := b.db.ExecContext(ctx, sqlUpdateMsgAttachments, m.ID_, m.Attachments_, clog.UUID()); err != nil {
+		return errors.Wrap(err, "error updating msg attachments")
+	}
+
+	rc := b.redisPool.Get()
+	defer rc.Close()
+
+	return queueMsgHandling(rc, &Contact{ID_: m.ContactID_, IsNew_: pm.NewContact}, m)
+}
@@ -3,13 +3,17 @@ package rapidpro
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -19,6 +23,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/courier"
@@ -42,11 +47,17 @@ const msgQueueName = "msgs"
 // the name of our set for tracking sends
 const sentSetName = "msgs_sent_%s"
 
+// key of the URL of an attachment saved for an org with content of a given SHA-256 hash
+const attachmentHashKey = "attachment:%d:%s"
+
+// how long we remember saved attachments for, after which we check storage for one with the same content again
+const attachmentHashTTL = 30 * 24 * time.Hour
+
 // our timeout for backend operations
 const backendTimeout = time.Second * 20
 
-// storage directory (only used with file system storage)
-var storageDir = "_storage"
+// our timeout for querying channel logs, which must be less than the HTTP write timeout
+const channelLogsQueryTimeout = time.Second * 30
 
 var uuidRegex = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
 
@@ -65,7 +76,10 @@ type backend struct {
 	db                *sqlx.DB
 	redisPool         *redis.Pool
 	attachmentStorage storage.Storage
+	attachmentStreams streamStorage
 	logStorage        storage.Storage
+	quarantine        streamStorage // private storage for infected attachments
+	s3Client          s3iface.S3API // nil if not using S3 storage
 
 	channelsByUUID *cache.Local[courier.ChannelUUID, *Channel]
 	channelsByAddr *cache.Local[courier.ChannelAddress, *Channel]
@@ -169,8 +183,8 @@ func (b *backend) Start() error {
 		queue.StartDethrottler(b.redisPool, b.stopChan, b.waitGroup, msgQueueName)
 	}
 
-	// create our storage (S3 or file system)
-	if b.config.AWSAccessKeyID != "" || b.config.AWSUseCredChain {
+	// create our storage (S3 or local file system)
+	if b.config.ActiveStorageDriver() == courier.StorageDriverS3 {
 		s3config := &storage.S3Options{
 			AWSAccessKeyID:     b.config.AWSAccessKeyID,
 			AWSSecretAccessKey: b.config.AWSSecretAccessKey,
@@ -188,11 +202,29 @@ func (b *backend) Start() error {
 		if err != nil {
 			return err
 		}
-		b.attachmentStorage = storage.NewS3(s3Client, b.config.S3AttachmentsBucket, b.config.S3Region, s3.BucketCannedACLPublicRead, 32)
+		s3API, isAPI := s3Client.(s3iface.S3API)
+		if !isAPI {
+			return errors.New("S3 client doesn't support multipart uploads")
+		}
+		b.s3Client = s3API
+
+		// attachments are public unless they're configured to only be accessible through signed URLs
+		attachmentsACL := s3.BucketCannedACLPublicRead
+		if b.config.PrivateAttachments {
+			attachmentsACL = s3.BucketCannedACLPrivate
+		}
+
+		b.attachmentStorage = storage.NewS3(s3Client, b.config.S3AttachmentsBucket, b.config.S3Region, attachmentsACL, 32)
+		b.attachmentStreams = newS3StreamStorage(s3API, b.config.S3AttachmentsBucket, b.config.S3Region, attachmentsACL)
 		b.logStorage = storage.NewS3(s3Client, b.config.S3LogsBucket, b.config.S3Region, s3.BucketCannedACLPrivate, 32)
+		b.quarantine = newS3StreamStorage(s3API, b.config.S3LogsBucket, b.config.S3Region, s3.BucketCannedACLPrivate)
 	} else {
-		b.attachmentStorage = storage.NewFS(storageDir+"/attachments", 0766)
-		b.logStorage = storage.NewFS(storageDir+"/logs", 0766)
+		attachments := newLocalStorage(filepath.Join(b.config.StorageDir, "attachments"), 0766, courier.LocalAttachmentsURL(b.config.Domain))
+		b.attachmentStorage = attachments
+		b.attachmentStreams = attachments
+		logs := newLocalStorage(filepath.Join(b.config.StorageDir, "logs"), 0766, "")
+		b.logStorage = logs
+		b.quarantine = logs
 	}
 
 	// create and start channel caches...
@@ -237,6 +269,9 @@ func (b *backend) Start() error {
 	b.stLogWriter = NewStorageLogWriter(b.logStorage, b.writerWG)
 	b.stLogWriter.Start()
 
+	// start our fetchers of pending attachments of incoming messages
+	b.startAttachmentFetchers()
+
 	// register and start our spool flushers
 	courier.RegisterFlusher(path.Join(b.config.SpoolDir, "msgs"), b.flushMsgFile)
 	courier.RegisterFlusher(path.Join(b.config.SpoolDir, "statuses"), b.flushStatusFile)
@@ -504,6 +539,14 @@ func (b *backend) MarkOutgoingMsgComplete(ctx context.Context, msg courier.MsgOu
 	}
 }
 
+// RerouteOutgoingMsg updates the passed in message to be sent on the given channel and queues it for sending
+func (b *backend) RerouteOutgoingMsg(ctx context.Context, msg courier.MsgOut, channel courier.Channel, urn urns.URN, from *courier.MsgReroute) error {
+	timeout, cancel := context.WithTimeout(ctx, backendTimeout)
+	defer cancel()
+
+	return rerouteMsg(timeout, b, msg.(*Msg), channel.(*Channel), urn, from)
+}
+
 // WriteMsg writes the passed in message to our store
 func (b *backend) WriteMsg(ctx context.Context, m courier.MsgIn, clog *courier.ChannelLog) error {
 	timeout, cancel := context.WithTimeout(ctx, backendTimeout)
@@ -649,21 +692,132 @@ func (b *backend) WriteChannelLog(ctx context.Context, clog *courier.ChannelLog)
 	return nil
 }
 
+// GetChannelLog returns the channel log with the given UUID from the database or logs storage
+func (b *backend) GetChannelLog(ctx context.Context, ch courier.Channel, uuid courier.ChannelLogUUID) (*courier.StoredChannelLog, error) {
+	timeout, cancel := context.WithTimeout(ctx, backendTimeout)
+	defer cancel()
+
+	return readChannelLog(timeout, b, ch.(*Channel), uuid)
+}
+
+// QueryChannelLogs returns the most recent channel logs matching the given query from the database and logs storage
+func (b *backend) QueryChannelLogs(ctx context.Context, ch courier.Channel, query *courier.ChannelLogQuery) ([]*courier.StoredChannelLog, []courier.ChannelLogUUID, error) {
+	timeout, cancel := context.WithTimeout(ctx, channelLogsQueryTimeout)
+	defer cancel()
+
+	return queryChannelLogs(timeout, b, ch.(*Channel), query)
+}
+
 // SaveAttachment saves an attachment to backend storage
 func (b *backend) SaveAttachment(ctx context.Context, ch courier.Channel, contentType string, data []byte, extension string) (string, error) {
-	// create our filename
+	hash := sha256.Sum256(data)
+
+	storageURL, err := b.saveAttachment(ctx, ch, hex.EncodeToString(hash[:]), extension, func(path string) (string, error) {
+		return b.attachmentStorage.Put(ctx, path, contentType, data)
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "error saving attachment to storage (bytes=%d)", len(data))
+	}
+
+	return storageURL, nil
+}
+
+// SaveAttachmentStream saves an attachment to backend storage as it's read from the given reader
+func (b *backend) SaveAttachmentStream(ctx context.Context, ch courier.Channel, contentType string, body io.Reader, extension string) (string, error) {
+	// we need the hash of the content to know where to save it, so spool it to a temp file as we calculate that
+	f, err := os.CreateTemp("", "courier-attachment-*")
+	if err != nil {
+		return "", errors.Wrap(err, "error creating attachment temp file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(f, io.TeeReader(body, hash)); err != nil {
+		return "", errors.Wrap(err, "error reading attachment")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "error rewinding attachment temp file")
+	}
+
+	storageURL, err := b.saveAttachment(ctx, ch, hex.EncodeToString(hash.Sum(nil)), extension, func(path string) (string, error) {
+		return b.attachmentStreams.PutStream(ctx, path, contentType, f)
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error streaming attachment to storage")
+	}
+
+	return storageURL, nil
+}
+
+// QuarantineAttachment saves an infected attachment to the same private storage as logs
+func (b *backend) QuarantineAttachment(ctx context.Context, ch courier.Channel, contentType string, body io.Reader, extension string) (string, error) {
 	filename := string(uuids.New())
 	if extension != "" {
 		filename = fmt.Sprintf("%s.%s", filename, extension)
 	}
+	path := filepath.Join("quarantine", strconv.FormatInt(int64(ch.(*Channel).OrgID()), 10), filename)
 
+	if _, err := b.quarantine.PutStream(ctx, path, contentType, body); err != nil {
+		return "", errors.Wrap(err, "error saving attachment to quarantine")
+	}
+
+	return path, nil
+}
+
+// PresignAttachmentURL presigns the URL of an attachment in our S3 attachments bucket so that it expires at the given
+// time, attachments in local storage being left for courier to proxy
+func (b *backend) PresignAttachmentURL(ctx context.Context, attURL string, expires time.Time) (string, error) {
+	if b.s3Client == nil {
+		return "", nil
+	}
+
+	return presignS3URL(b.s3Client, b.config.S3AttachmentsBucket, b.config.S3Region, attURL, time.Until(expires))
+}
+
+// saves an attachment with the given content hash using the given put function, unless an attachment with the same
+// content has already been saved for the channel's org, in which case the URL of that is returned.
+//
+// Attachments are stored at paths derived from their content so a single object can be shared by any number of
+// messages in an org. Shared objects are only ever written if they don't exist and are never modified or deleted here,
+// so removing one is only safe once nothing in its org references its URL.
+func (b *backend) saveAttachment(ctx context.Context, ch courier.Channel, hash, extension string, put func(string) (string, error)) (string, error) {
 	orgID := ch.(*Channel).OrgID()
+	key := fmt.Sprintf(attachmentHashKey, orgID, hash)
+
+	rc := b.redisPool.Get()
+	existingURL, err := redis.String(rc.Do("GET", key))
+	rc.Close()
 
+	if err == nil {
+		return existingURL, nil
+	} else if err != redis.ErrNil {
+		slog.Error("error looking up saved attachment", "error", err, "org_id", orgID)
+	}
+
+	filename := hash
+	if extension != "" {
+		filename = fmt.Sprintf("%s.%s", filename, extension)
+	}
 	path := filepath.Join(b.config.S3AttachmentsPrefix, strconv.FormatInt(int64(orgID), 10), filename[:4], filename[4:8], filename)
 
-	storageURL, err := b.attachmentStorage.Put(ctx, path, contentType, data)
+	// we may have forgotten about an object which is still in storage, in which case we use it as is
+	storageURL, err := b.attachmentStreams.ExistingURL(ctx, path)
 	if err != nil {
-		return "", errors.Wrapf(err, "error saving attachment to storage (bytes=%d)", len(data))
+		return "", errors.Wrap(err, "error checking for existing attachment")
+	}
+	if storageURL == "" {
+		if storageURL, err = put(path); err != nil {
+			return "", err
+		}
+	}
+
+	rc = b.redisPool.Get()
+	_, err = rc.Do("SET", key, storageURL, "EX", int(attachmentHashTTL/time.Second))
+	rc.Close()
+
+	if err != nil {
+		slog.Error("error recording saved attachment", "error", err, "org_id", orgID)
 	}
 
 	return storageURL, nil
@@ -715,6 +869,46 @@ func (b *backend) ResolveMedia(ctx context.Context, mediaUrl string) (courier.Me
 	return media, nil
 }
 
+// SaveMediaAlternate saves the given transcoded media to storage and records it as an alternate of the given media
+func (b *backend) SaveMediaAlternate(ctx context.Context, ch courier.Channel, media courier.Media, t *courier.Transcoded) (courier.Media, error) {
+	original := media.(*Media)
+
+	storageURL, err := b.SaveAttachment(ctx, ch, t.ContentType, t.Data, t.Extension)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing storage URL")
+	}
+
+	alternate := &Media{
+		UUID_:        uuids.New(),
+		Path_:        u.Path,
+		ContentType_: t.ContentType,
+		URL_:         storageURL,
+		Size_:        len(t.Data),
+		Width_:       t.Width,
+		Height_:      t.Height,
+		Duration_:    t.Duration,
+	}
+
+	if err := insertMediaAlternate(ctx, b.db, original.UUID(), alternate); err != nil {
+		return nil, errors.Wrap(err, "error inserting media alternate")
+	}
+
+	// clear the cached lookup of the original so that the new alternate is included next time
+	rc := b.redisPool.Get()
+	defer rc.Close()
+
+	if err := b.mediaCache.Del(rc, string(original.UUID())); err != nil {
+		slog.Error("error clearing cached media", "error", err, "media_uuid", original.UUID())
+	}
+
+	return alternate, nil
+}
+
 func (b *backend) HttpClient(secure bool) *http.Client {
 	if secure {
 		return b.httpClient
@@ -150,6 +150,11 @@ func writeChannelEventToDB(ctx context.Context, b *backend, e *ChannelEvent, clo
 	e.ContactID_ = contact.ID_
 	e.ContactURNID_ = contact.URNID_
 
+	// if this is a reaction, try to resolve the message being reacted to
+	if e.EventType_ == courier.EventTypeReaction {
+		resolveReactedMsg(ctx, b, e)
+	}
+
 	rows, err := b.db.NamedQueryContext(ctx, sqlInsertChannelEvent, e)
 	if err != nil {
 		return err
@@ -175,6 +180,24 @@ func writeChannelEventToDB(ctx context.Context, b *backend, e *ChannelEvent, clo
 	return nil
 }
 
+// resolveReactedMsg tries to resolve the external ID of the message a reaction event refers to, to one of our messages
+func resolveReactedMsg(ctx context.Context, b *backend, e *ChannelEvent) {
+	externalID := e.Extra_[courier.ReactionKeyExternalID]
+	if externalID == "" || e.Extra_[courier.ReactionKeyMsgID] != "" {
+		return
+	}
+
+	msgID, err := b.resolveMsgIDByExternalID(ctx, e.ChannelID_, e.ContactID_, externalID)
+	if err != nil {
+		slog.Error("error resolving reacted to message", "error", err, "channel_id", e.ChannelID_, "external_id", externalID)
+		return
+	}
+
+	if msgID != courier.NilMsgID {
+		e.Extra_[courier.ReactionKeyMsgID] = msgID.String()
+	}
+}
+
 func (b *backend) flushChannelEventFile(filename string, contents []byte) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
@@ -2,10 +2,12 @@ package rapidpro
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"path"
+	"slices"
 	"sync"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/storage"
 	"github.com/nyaruka/gocommon/syncx"
+	"github.com/pkg/errors"
 )
 
 const sqlInsertChannelLog = `
@@ -36,13 +39,15 @@ type dbChannelLog struct {
 
 // channel log to be written to logs storage
 type stChannelLog struct {
-	UUID        courier.ChannelLogUUID `json:"uuid"`
-	Type        courier.ChannelLogType `json:"type"`
-	HTTPLogs    []*httpx.Log           `json:"http_logs"`
-	Errors      []channelError         `json:"errors"`
-	ElapsedMS   int                    `json:"elapsed_ms"`
-	CreatedOn   time.Time              `json:"created_on"`
-	ChannelUUID courier.ChannelUUID    `json:"-"`
+	UUID         courier.ChannelLogUUID `json:"uuid"`
+	Type         courier.ChannelLogType `json:"type"`
+	HTTPLogs     []*httpx.Log           `json:"http_logs"`
+	Errors       []channelError         `json:"errors"`
+	Segments     int                    `json:"segments,omitempty"`
+	ReroutedFrom *courier.MsgReroute    `json:"rerouted_from,omitempty"`
+	ElapsedMS    int                    `json:"elapsed_ms"`
+	CreatedOn    time.Time              `json:"created_on"`
+	ChannelUUID  courier.ChannelUUID    `json:"-"`
 }
 
 func (l *stChannelLog) path() string {
@@ -81,13 +86,15 @@ func queueChannelLog(ctx context.Context, b *backend, clog *courier.ChannelLog)
 	if clog.Attached() {
 		log = log.With("storage", "s3")
 		v := &stChannelLog{
-			UUID:        clog.UUID(),
-			Type:        clog.Type(),
-			HTTPLogs:    logs,
-			Errors:      errors,
-			ElapsedMS:   int(clog.Elapsed() / time.Millisecond),
-			CreatedOn:   clog.CreatedOn(),
-			ChannelUUID: clog.Channel().UUID(),
+			UUID:         clog.UUID(),
+			Type:         clog.Type(),
+			HTTPLogs:     logs,
+			Errors:       errors,
+			Segments:     clog.Segments(),
+			ReroutedFrom: clog.ReroutedFrom(),
+			ElapsedMS:    int(clog.Elapsed() / time.Millisecond),
+			CreatedOn:    clog.CreatedOn(),
+			ChannelUUID:  clog.Channel().UUID(),
 		}
 		if b.stLogWriter.Queue(v) <= 0 {
 			log.Error("channel log writer buffer full")
@@ -177,3 +184,144 @@ func writeStorageChannelLogs(ctx context.Context, st storage.Storage, batch []*s
 		slog.Error("error writing channel logs", "comp", "storage log writer")
 	}
 }
+
+const sqlSelectChannelLog = `
+SELECT uuid, log_type, http_logs, errors, elapsed_ms, created_on
+  FROM channels_channellog
+ WHERE channel_id = $1 AND uuid = $2`
+
+const sqlSelectChannelLogs = `
+  SELECT uuid, log_type, http_logs, errors, elapsed_ms, created_on
+    FROM channels_channellog
+   WHERE channel_id = $1 AND created_on >= $2 AND created_on < $3 AND ($4::text = '' OR log_type = $4::text) AND ($5::text = '' OR errors @> jsonb_build_array(jsonb_build_object('code', $5::text)))
+ORDER BY created_on DESC
+   LIMIT $6`
+
+// how many channel logs we read from storage at once when querying
+const storageLogReadConcurrency = 10
+
+// logs attached to messages are only in storage where they can't be queried, so we find them via recent messages
+const sqlSelectMsgLogUUIDs = `
+SELECT unnest(log_uuids) FROM (
+    SELECT log_uuids
+      FROM msgs_msg
+     WHERE channel_id = $1 AND created_on < $3 AND modified_on >= $2 AND log_uuids IS NOT NULL
+  ORDER BY modified_on DESC
+     LIMIT $4
+) m`
+
+// reads the channel log with the given UUID from the database or if it's not there, from storage
+func readChannelLog(ctx context.Context, b *backend, ch *Channel, uuid courier.ChannelLogUUID) (*courier.StoredChannelLog, error) {
+	row := &dbChannelLog{}
+	err := b.db.GetContext(ctx, row, sqlSelectChannelLog, ch.ID(), uuid)
+	if err == nil {
+		return row.stored()
+	}
+	if err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "error querying channel log")
+	}
+
+	return readStorageChannelLog(ctx, b.logStorage, ch.UUID(), uuid)
+}
+
+// reads the channel log with the given UUID from storage, returning nil if it doesn't exist
+func readStorageChannelLog(ctx context.Context, st storage.Storage, channelUUID courier.ChannelUUID, uuid courier.ChannelLogUUID) (*courier.StoredChannelLog, error) {
+	l := &stChannelLog{UUID: uuid, ChannelUUID: channelUUID}
+
+	_, body, err := st.Get(ctx, l.path())
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error reading channel log from storage")
+	}
+
+	stored := &courier.StoredChannelLog{}
+	if err := json.Unmarshal(body, stored); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling channel log from storage")
+	}
+	return stored, nil
+}
+
+// queries channel logs in the database and those in storage which are attached to recent messages, returning the UUIDs
+// of any logs in storage which couldn't be read separately rather than failing the whole query
+func queryChannelLogs(ctx context.Context, b *backend, ch *Channel, q *courier.ChannelLogQuery) ([]*courier.StoredChannelLog, []courier.ChannelLogUUID, error) {
+	rows := make([]*dbChannelLog, 0, q.Limit)
+	if err := b.db.SelectContext(ctx, &rows, sqlSelectChannelLogs, ch.ID(), q.Since, q.Until, q.Type, q.ErrorCode, q.Limit); err != nil {
+		return nil, nil, errors.Wrap(err, "error querying channel logs")
+	}
+
+	logs := make([]*courier.StoredChannelLog, 0, len(rows))
+	for _, r := range rows {
+		l, err := r.stored()
+		if err != nil {
+			return nil, nil, err
+		}
+		logs = append(logs, l)
+	}
+
+	var logUUIDs []courier.ChannelLogUUID
+	if err := b.db.SelectContext(ctx, &logUUIDs, sqlSelectMsgLogUUIDs, ch.ID(), q.Since, q.Until, q.Limit); err != nil {
+		return nil, nil, errors.Wrap(err, "error querying message log UUIDs")
+	}
+
+	stored, errs := readStorageChannelLogs(ctx, b.logStorage, ch.UUID(), logUUIDs)
+	unreadable := make([]courier.ChannelLogUUID, 0)
+
+	for i, uuid := range logUUIDs {
+		if errs[i] != nil {
+			slog.Error("error reading channel log from storage", "error", errs[i], "channel_uuid", ch.UUID(), "log_uuid", uuid)
+			unreadable = append(unreadable, uuid)
+		} else if stored[i] != nil && matchesLogQuery(stored[i], q) {
+			logs = append(logs, stored[i])
+		}
+	}
+
+	slices.SortFunc(logs, func(a, b *courier.StoredChannelLog) int { return b.CreatedOn.Compare(a.CreatedOn) })
+	if len(logs) > q.Limit {
+		logs = logs[:q.Limit]
+	}
+	return logs, unreadable, nil
+}
+
+// reads the channel logs with the given UUIDs from storage concurrently, returning the logs and errors in the same order
+func readStorageChannelLogs(ctx context.Context, st storage.Storage, channelUUID courier.ChannelUUID, uuids []courier.ChannelLogUUID) ([]*courier.StoredChannelLog, []error) {
+	logs := make([]*courier.StoredChannelLog, len(uuids))
+	errs := make([]error, len(uuids))
+	sem := make(chan struct{}, storageLogReadConcurrency)
+	wg := &sync.WaitGroup{}
+
+	for i, uuid := range uuids {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, uuid courier.ChannelLogUUID) {
+			defer func() { <-sem; wg.Done() }()
+
+			logs[i], errs[i] = readStorageChannelLog(ctx, st, channelUUID, uuid)
+		}(i, uuid)
+	}
+
+	wg.Wait()
+	return logs, errs
+}
+
+func matchesLogQuery(l *courier.StoredChannelLog, q *courier.ChannelLogQuery) bool {
+	if l.CreatedOn.Before(q.Since) || !l.CreatedOn.Before(q.Until) || (q.Type != "" && l.Type != q.Type) {
+		return false
+	}
+	return q.ErrorCode == "" || slices.ContainsFunc(l.Errors, func(e courier.StoredChannelError) bool { return e.Code == q.ErrorCode })
+}
+
+// converts a channel log read from the database
+func (l *dbChannelLog) stored() (*courier.StoredChannelLog, error) {
+	stored := &courier.StoredChannelLog{UUID: l.UUID, Type: l.Type, ElapsedMS: l.ElapsedMS, CreatedOn: l.CreatedOn}
+
+	if err := json.Unmarshal(l.HTTPLogs, &stored.HTTPLogs); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling channel log HTTP logs")
+	}
+	if err := json.Unmarshal(l.Errors, &stored.Errors); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling channel log errors")
+	}
+	return stored, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/gocommon/uuids"
+	"github.com/pkg/errors"
 )
 
 type Media struct {
@@ -61,3 +62,21 @@ func lookupMediaFromUUID(ctx context.Context, db *sqlx.DB, uuid uuids.UUID) (*Me
 	media.Alternates_ = alternates
 	return media, nil
 }
+
+const sqlInsertMediaAlternate = `
+INSERT INTO msgs_media(uuid, org_id, content_type, url, path, size, duration, width, height, original_id)
+     SELECT $2, org_id, $3, $4, $5, $6, $7, $8, $9, id
+       FROM msgs_media
+      WHERE uuid = $1`
+
+// inserts the given media as an alternate of the media with the given UUID
+func insertMediaAlternate(ctx context.Context, db *sqlx.DB, originalUUID uuids.UUID, m *Media) error {
+	res, err := db.ExecContext(ctx, sqlInsertMediaAlternate, originalUUID, m.UUID_, m.ContentType_, m.URL_, m.Path_, m.Size_, m.Duration_, m.Width_, m.Height_)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return errors.Errorf("no media with UUID %s", originalUUID)
+	}
+	return nil
+}
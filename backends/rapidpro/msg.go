@@ -3,6 +3,7 @@ package rapidpro
 import (
 	"context"
 	"crypto/sha1"
+	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -19,6 +20,7 @@ import (
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/queue"
 	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/null/v3"
@@ -76,17 +78,27 @@ type Msg struct {
 	SentOn_      *time.Time     `                     db:"sent_on"`
 	LogUUIDs     pq.StringArray `                     db:"log_uuids"`
 
+	// incoming messages which are replies to a previous message, also written to metadata
+	ReplyToExternalID_ null.String   `json:"reply_to_external_id"`
+	ReplyToID_         courier.MsgID `json:"reply_to_id"`
+
+	// incoming messages which share a location, also written to metadata
+	Location_ *courier.MsgLocation `json:"location"`
+
 	// extra non-model fields that mailroom will include in queued payload
-	ChannelUUID_          courier.ChannelUUID     `json:"channel_uuid"`
-	URN_                  urns.URN                `json:"urn"`
-	URNAuth_              string                  `json:"urn_auth"`
-	ResponseToExternalID_ string                  `json:"response_to_external_id"`
-	IsResend_             bool                    `json:"is_resend"`
-	Flow_                 *courier.FlowReference  `json:"flow"`
-	OptIn_                *courier.OptInReference `json:"optin"`
-	UserID_               courier.UserID          `json:"user_id"`
-	Origin_               courier.MsgOrigin       `json:"origin"`
-	ContactLastSeenOn_    *time.Time              `json:"contact_last_seen_on"`
+	ChannelUUID_          courier.ChannelUUID        `json:"channel_uuid"`
+	URN_                  urns.URN                   `json:"urn"`
+	URNAuth_              string                     `json:"urn_auth"`
+	ResponseToExternalID_ string                     `json:"response_to_external_id"`
+	IsResend_             bool                       `json:"is_resend"`
+	Flow_                 *courier.FlowReference     `json:"flow"`
+	OptIn_                *courier.OptInReference    `json:"optin"`
+	Reaction_             *courier.MsgReaction       `json:"reaction"`
+	ConversationAction_   courier.ConversationAction `json:"conversation_action"`
+	UserID_               courier.UserID             `json:"user_id"`
+	Origin_               courier.MsgOrigin          `json:"origin"`
+	ContactLastSeenOn_    *time.Time                 `json:"contact_last_seen_on"`
+	ReroutedFrom_         *courier.MsgReroute        `json:"rerouted_from,omitempty"`
 
 	// extra fields used to allow courier to update a session's timeout to *after* the message has been sent
 	SessionID_            SessionID  `json:"session_id"`
@@ -159,17 +171,22 @@ func (m *Msg) Topic() string {
 func (m *Msg) Metadata() json.RawMessage {
 	return m.Metadata_
 }
-func (m *Msg) ResponseToExternalID() string   { return m.ResponseToExternalID_ }
-func (m *Msg) SentOn() *time.Time             { return m.SentOn_ }
-func (m *Msg) IsResend() bool                 { return m.IsResend_ }
-func (m *Msg) Flow() *courier.FlowReference   { return m.Flow_ }
-func (m *Msg) OptIn() *courier.OptInReference { return m.OptIn_ }
-func (m *Msg) UserID() courier.UserID         { return m.UserID_ }
-func (m *Msg) SessionStatus() string          { return m.SessionStatus_ }
-func (m *Msg) HighPriority() bool             { return m.HighPriority_ }
+func (m *Msg) ResponseToExternalID() string                   { return m.ResponseToExternalID_ }
+func (m *Msg) SentOn() *time.Time                             { return m.SentOn_ }
+func (m *Msg) IsResend() bool                                 { return m.IsResend_ }
+func (m *Msg) Flow() *courier.FlowReference                   { return m.Flow_ }
+func (m *Msg) OptIn() *courier.OptInReference                 { return m.OptIn_ }
+func (m *Msg) Reaction() *courier.MsgReaction                 { return m.Reaction_ }
+func (m *Msg) ConversationAction() courier.ConversationAction { return m.ConversationAction_ }
+func (m *Msg) UserID() courier.UserID                         { return m.UserID_ }
+func (m *Msg) SessionStatus() string                          { return m.SessionStatus_ }
+func (m *Msg) HighPriority() bool                             { return m.HighPriority_ }
+func (m *Msg) ReroutedFrom() *courier.MsgReroute              { return m.ReroutedFrom_ }
 
 // incoming specific
-func (m *Msg) ReceivedOn() *time.Time { return m.SentOn_ }
+func (m *Msg) ReceivedOn() *time.Time         { return m.SentOn_ }
+func (m *Msg) ReplyToExternalID() string      { return string(m.ReplyToExternalID_) }
+func (m *Msg) Location() *courier.MsgLocation { return m.Location_ }
 func (m *Msg) WithAttachment(url string) courier.MsgIn {
 	m.Attachments_ = append(m.Attachments_, url)
 	return m
@@ -180,6 +197,33 @@ func (m *Msg) WithURNAuthTokens(tokens map[string]string) courier.MsgIn {
 	return m
 }
 func (m *Msg) WithReceivedOn(date time.Time) courier.MsgIn { m.SentOn_ = &date; return m }
+func (m *Msg) WithReplyTo(externalID string) courier.MsgIn {
+	m.ReplyToExternalID_ = null.String(externalID)
+	return m
+}
+func (m *Msg) WithLocation(loc *courier.MsgLocation) courier.MsgIn {
+	m.Location_ = loc
+	m.setMetadata("location", loc)
+	return m
+}
+func (m *Msg) WithChannel(channel courier.Channel) courier.MsgIn {
+	dbChannel := channel.(*Channel)
+	m.OrgID_ = dbChannel.OrgID()
+	m.ChannelID_ = dbChannel.ID()
+	m.ChannelUUID_ = dbChannel.UUID()
+	m.channel = dbChannel
+	return m
+}
+
+// sets the given key in our metadata, merging into any existing metadata rather than replacing it
+func (m *Msg) setMetadata(key string, value any) {
+	metadata := make(map[string]any)
+	if m.Metadata_ != nil {
+		json.Unmarshal(m.Metadata_, &metadata)
+	}
+	metadata[key] = value
+	m.Metadata_ = jsonx.MustMarshal(metadata)
+}
 
 func (m *Msg) hash() string {
 	hash := sha1.Sum([]byte(m.Text_ + "|" + strings.Join(m.Attachments_, "|")))
@@ -247,9 +291,11 @@ func writeMsg(ctx context.Context, b *backend, msg courier.MsgIn, clog *courier.
 const sqlInsertMsg = `
 INSERT INTO
 	msgs_msg(org_id, uuid, direction, text, attachments, msg_type, msg_count, error_count, high_priority, status,
-             visibility, external_id, channel_id, contact_id, contact_urn_id, created_on, modified_on, next_attempt, queued_on, sent_on, log_uuids)
+             visibility, external_id, channel_id, contact_id, contact_urn_id, created_on, modified_on, next_attempt, queued_on, sent_on, log_uuids,
+             metadata)
     VALUES(:org_id, :uuid, :direction, :text, :attachments, 'T', :msg_count, :error_count, :high_priority, :status,
-           :visibility, :external_id, :channel_id, :contact_id, :contact_urn_id, :created_on, :modified_on, :next_attempt, :queued_on, :sent_on, :log_uuids)
+           :visibility, :external_id, :channel_id, :contact_id, :contact_urn_id, :created_on, :modified_on, :next_attempt, :queued_on, :sent_on, :log_uuids,
+           :metadata)
 RETURNING id`
 
 func writeMsgToDB(ctx context.Context, b *backend, m *Msg, clog *courier.ChannelLog) error {
@@ -264,7 +310,28 @@ func writeMsgToDB(ctx context.Context, b *backend, m *Msg, clog *courier.Channel
 	m.ContactID_ = contact.ID_
 	m.ContactURNID_ = contact.URNID_
 
+	// if this is a reply, try to resolve the message it is replying to
+	if m.ReplyToExternalID_ != "" && m.ReplyToID_ == courier.NilMsgID {
+		m.ReplyToID_, err = b.resolveMsgIDByExternalID(ctx, m.ChannelID_, m.ContactID_, string(m.ReplyToExternalID_))
+		if err != nil {
+			// not fatal, we just won't know which message this was a reply to
+			slog.Error("error resolving reply to message", "error", err, "channel_id", m.ChannelID_, "external_id", m.ReplyToExternalID_)
+		}
+
+		replyTo := map[string]any{"external_id": m.ReplyToExternalID_}
+		if m.ReplyToID_ != courier.NilMsgID {
+			replyTo["id"] = m.ReplyToID_
+		}
+		m.setMetadata("reply_to", replyTo)
+	}
+
+	// pending attachments are only placeholders which RapidPro can't read, so until they've been fetched they're only
+	// kept with the message in redis
+	attachments := m.Attachments_
+	stripPendingAttachments(m)
+
 	rows, err := b.db.NamedQueryContext(ctx, sqlInsertMsg, m)
+	m.Attachments_ = attachments
 	if err != nil {
 		return errors.Wrap(err, "error inserting message")
 	}
@@ -276,10 +343,23 @@ func writeMsgToDB(ctx context.Context, b *backend, m *Msg, clog *courier.Channel
 		return errors.Wrap(err, "error scanning for inserted message id")
 	}
 
-	// queue this up to be handled by RapidPro
 	rc := b.redisPool.Get()
 	defer rc.Close()
-	err = queueMsgHandling(rc, contact, m)
+
+	// queue this up to be handled by RapidPro, unless it has attachments which need to be fetched first
+	if hasPendingAttachments(m) {
+		err = queuePendingMsg(rc, contact, m, time.Duration(b.config.FetchTimeout)*time.Second)
+
+		// if we can't queue it for its attachments to be fetched, better to handle it without them than not at all
+		if err != nil {
+			slog.Error("error queueing msg with pending attachments", "error", err, "msg_id", m.ID_)
+
+			stripPendingAttachments(m)
+			err = queueMsgHandling(rc, contact, m)
+		}
+	} else {
+		err = queueMsgHandling(rc, contact, m)
+	}
 
 	// if we had a problem queueing the handling, log it, but our message is written, it'll
 	// get picked up by our rapidpro catch-all after a period
@@ -290,6 +370,107 @@ func writeMsgToDB(ctx context.Context, b *backend, m *Msg, clog *courier.Channel
 	return nil
 }
 
+const sqlSelectMsgIDByExternalID = `
+  SELECT id 
+    FROM msgs_msg 
+   WHERE channel_id = $1 AND contact_id = $2 AND external_id = $3 AND direction = 'O'
+ORDER BY id DESC 
+   LIMIT 1`
+
+// resolveMsgIDByExternalID tries to resolve the given channel ID + external ID pair to the ID of an outgoing message to
+// the given contact, since some channels (e.g. Telegram) only have external IDs which are unique within a chat. Our cache
+// of recently sent messages isn't used because it doesn't know their contacts. If no message is found, NilMsgID is returned.
+func (b *backend) resolveMsgIDByExternalID(ctx context.Context, channelID courier.ChannelID, contactID ContactID, externalID string) (courier.MsgID, error) {
+	var msgID courier.MsgID
+	err := b.db.GetContext(ctx, &msgID, sqlSelectMsgIDByExternalID, channelID, contactID, externalID)
+	if err != nil && err != sql.ErrNoRows {
+		return courier.NilMsgID, errors.Wrap(err, "error looking up message by external id")
+	}
+
+	return msgID, nil
+}
+
+const sqlRerouteMsg = `
+UPDATE msgs_msg 
+   SET channel_id = $2, contact_urn_id = $3, status = 'Q', log_uuids = array_append(log_uuids, $4::uuid), modified_on = NOW() 
+ WHERE id = $1 AND direction = 'O'`
+
+// the TPS to queue rerouted messages with if their new channel doesn't specify one
+const defaultChannelTPS = 10
+
+// reroutes the given outgoing message to be sent on the given channel to the given URN, which must belong to the same
+// contact or not exist yet, updating the message in the database before queueing it for sending
+func rerouteMsg(ctx context.Context, b *backend, msg *Msg, channel *Channel, urn urns.URN, from *courier.MsgReroute) error {
+	// a fallback channel is only configured by UUID so make sure it can't be used to move messages to another org
+	if channel.OrgID() != msg.OrgID_ {
+		return errors.Errorf("channel %s belongs to another org", channel.UUID())
+	}
+
+	tx, err := b.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	existing := &ContactURN{}
+	err = tx.GetContext(ctx, existing, sqlSelectURNByIdentity, channel.OrgID(), urn.Identity())
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return errors.Wrap(err, "error looking up URN by identity")
+	}
+	if err == nil && existing.ContactID != msg.ContactID_ {
+		tx.Rollback()
+		return errors.Errorf("URN %s belongs to another contact", urn.Identity())
+	}
+
+	contactURN, err := getOrCreateContactURN(tx, channel, msg.ContactID_, urn, nil)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlRerouteMsg, msg.ID_, channel.ID(), contactURN.ID, from.LogUUID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "error updating rerouted msg")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "error committing rerouted msg")
+	}
+
+	rerouted := *msg
+	rerouted.ChannelID_ = channel.ID()
+	rerouted.ChannelUUID_ = channel.UUID()
+	rerouted.ContactURNID_ = contactURN.ID
+	rerouted.URN_ = urn
+	rerouted.URNAuth_ = ""
+	rerouted.ReroutedFrom_ = from
+
+	if err := queueMsgSend(b, channel, &rerouted); err != nil {
+		return errors.Wrap(err, "error queueing rerouted msg")
+	}
+
+	return nil
+}
+
+// pushes the given outgoing message onto the queue of its channel, as mailroom does for the messages it creates
+func queueMsgSend(b *backend, channel *Channel, m *Msg) error {
+	msgJSON, err := json.Marshal([]any{m})
+	if err != nil {
+		return errors.Wrap(err, "error marshalling msg")
+	}
+
+	priority := queue.Priority(queue.LowPriority)
+	if m.HighPriority() {
+		priority = queue.HighPriority
+	}
+
+	rc := b.redisPool.Get()
+	defer rc.Close()
+
+	tps := channel.IntConfigForKey("max_tps", defaultChannelTPS)
+	return queue.PushOntoQueue(rc, msgQueueName, string(channel.UUID()), tps, string(msgJSON), priority)
+}
+
 //-----------------------------------------------------------------------------
 // Msg flusher for flushing failed writes
 //-----------------------------------------------------------------------------
@@ -15,6 +15,7 @@ import (
 	"github.com/nyaruka/gocommon/syncx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 )
 
 // StatusUpdate represents a status update on a message
@@ -26,6 +27,9 @@ type StatusUpdate struct {
 	NewURN_      urns.URN               `json:"new_urn"                  db:"new_urn"`
 	ExternalID_  string                 `json:"external_id,omitempty"    db:"external_id"`
 	Status_      courier.MsgStatus      `json:"status"                   db:"status"`
+	Segments_    int                    `json:"segments,omitempty"       db:"segments"`
+	Cost_        *decimal.Decimal       `json:"cost,omitempty"`
+	Currency_    string                 `json:"currency,omitempty"`
 	ModifiedOn_  time.Time              `json:"modified_on"              db:"modified_on"`
 	LogUUID      courier.ChannelLogUUID `json:"log_uuid"                 db:"log_uuid"`
 }
@@ -104,12 +108,20 @@ UPDATE msgs_msg SET
 		ELSE
 			msgs_msg.external_id
 		END,
+	msg_count = CASE
+		WHEN
+			s.segments::int > 0
+		THEN
+			s.segments::int
+		ELSE
+			msg_count
+		END,
 	modified_on = NOW(),
 	log_uuids = array_append(log_uuids, s.log_uuid::uuid)
 FROM
-	(VALUES(:msg_id, :channel_id, :status, :external_id, :log_uuid)) 
+	(VALUES(:msg_id, :channel_id, :status, :external_id, :segments, :log_uuid)) 
 AS 
-	s(msg_id, channel_id, status, external_id, log_uuid) 
+	s(msg_id, channel_id, status, external_id, segments, log_uuid) 
 WHERE 
 	msgs_msg.id = s.msg_id::bigint AND
 	msgs_msg.channel_id = s.channel_id::int AND 
@@ -162,6 +174,20 @@ func (s *StatusUpdate) SetExternalID(id string) { s.ExternalID_ = id }
 func (s *StatusUpdate) Status() courier.MsgStatus          { return s.Status_ }
 func (s *StatusUpdate) SetStatus(status courier.MsgStatus) { s.Status_ = status }
 
+func (s *StatusUpdate) Segments() int     { return s.Segments_ }
+func (s *StatusUpdate) SetSegments(n int) { s.Segments_ = n }
+
+func (s *StatusUpdate) Cost() (decimal.Decimal, string) {
+	if s.Cost_ == nil {
+		return decimal.Zero, ""
+	}
+	return *s.Cost_, s.Currency_
+}
+func (s *StatusUpdate) SetCost(amount decimal.Decimal, currency string) {
+	s.Cost_ = &amount
+	s.Currency_ = currency
+}
+
 // StatusWriter handles batched writes of status updates to the database
 type StatusWriter struct {
 	*syncx.Batcher[*StatusUpdate]
@@ -0,0 +1,218 @@
+package rapidpro
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/nyaruka/gocommon/storage"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/pkg/errors"
+)
+
+// streamStorage is storage which can save content as it's read from a reader, rather than requiring it all in memory
+type streamStorage interface {
+	PutStream(ctx context.Context, path string, contentType string, body io.Reader) (string, error)
+
+	// ExistingURL returns the URL of the object at the given path, or an empty string if there's no such object
+	ExistingURL(ctx context.Context, path string) (string, error)
+}
+
+// same URL format used by S3 storage in gocommon
+const s3BucketURL = "https://%s.s3.%s.amazonaws.com/%s"
+
+// uploads are split into parts of this size, of which at most s3UploadConcurrency are held in memory at once
+const (
+	s3UploadPartSize    = 5 * 1024 * 1024
+	s3UploadConcurrency = 3
+)
+
+// presigns a GET of the given URL if it's of an object in the given S3 bucket, returning an empty string if it isn't
+func presignS3URL(client s3iface.S3API, bucket, region, objURL string, lifetime time.Duration) (string, error) {
+	key, inBucket := strings.CutPrefix(objURL, fmt.Sprintf(s3BucketURL, bucket, region, ""))
+	if !inBucket || key == "" {
+		return "", nil
+	}
+
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	signed, err := req.Presign(lifetime)
+	if err != nil {
+		return "", errors.Wrap(err, "error presigning object URL")
+	}
+	return signed, nil
+}
+
+// checks whether an error getting something from storage is because it doesn't exist
+func isNotFound(err error) bool {
+	cause := errors.Cause(err)
+	if aerr, ok := cause.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return os.IsNotExist(cause)
+}
+
+type s3StreamStorage struct {
+	client   s3iface.S3API
+	uploader *s3manager.Uploader
+	bucket   string
+	region   string
+	acl      string
+}
+
+// creates new stream storage which does multipart uploads to the given S3 bucket
+func newS3StreamStorage(client s3iface.S3API, bucket, region, acl string) streamStorage {
+	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		u.PartSize = s3UploadPartSize
+		u.Concurrency = s3UploadConcurrency
+	})
+
+	return &s3StreamStorage{client: client, uploader: uploader, bucket: bucket, region: region, acl: acl}
+}
+
+func (s *s3StreamStorage) ExistingURL(ctx context.Context, path string) (string, error) {
+	_, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(path)})
+	if err != nil {
+		// a HEAD has no body so a missing object is only identifiable by its status code
+		if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() == http.StatusNotFound {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "error checking for object in bucket")
+	}
+
+	return fmt.Sprintf(s3BucketURL, s.bucket, s.region, path), nil
+}
+
+func (s *s3StreamStorage) PutStream(ctx context.Context, path string, contentType string, body io.Reader) (string, error) {
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(path),
+		ContentType: aws.String(contentType),
+		Body:        body,
+		ACL:         aws.String(s.acl),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "error uploading file to bucket")
+	}
+
+	return fmt.Sprintf(s3BucketURL, s.bucket, s.region, path), nil
+}
+
+// localStorage is storage which writes files to a directory on the local file system. If it has a base URL, that's
+// used to construct the URLs of saved files, otherwise their file paths are returned. Existing files are never
+// overwritten because everything we write is either content addressed or has a unique path.
+type localStorage struct {
+	directory string
+	perms     os.FileMode
+	baseURL   string
+}
+
+func newLocalStorage(directory string, perms os.FileMode, baseURL string) *localStorage {
+	return &localStorage{directory: directory, perms: perms, baseURL: baseURL}
+}
+
+func (s *localStorage) Name() string {
+	return "local"
+}
+
+// Test checks that we can write files to our directory and read them back
+func (s *localStorage) Test(ctx context.Context) error {
+	path := fmt.Sprintf("%s.txt", uuids.New())
+	if _, err := s.Put(ctx, path, "text/plain", []byte(`test`)); err != nil {
+		return err
+	}
+	defer os.Remove(filepath.Join(s.directory, path))
+
+	_, body, err := s.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if string(body) != "test" {
+		return errors.New("test file content doesn't match what was written")
+	}
+	return nil
+}
+
+func (s *localStorage) Get(ctx context.Context, path string) (string, []byte, error) {
+	body, err := os.ReadFile(filepath.Join(s.directory, path))
+	return "", body, err
+}
+
+func (s *localStorage) Put(ctx context.Context, path string, contentType string, body []byte) (string, error) {
+	return s.PutStream(ctx, path, contentType, bytes.NewReader(body))
+}
+
+func (s *localStorage) PutStream(ctx context.Context, path string, contentType string, body io.Reader) (string, error) {
+	fullPath := filepath.Join(s.directory, path)
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), s.perms); err != nil {
+		return "", err
+	}
+
+	// write to a temp file first so that a failed write never leaves a partial file at the real path
+	f, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, body)
+	if err == nil {
+		err = f.Chmod(s.perms)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// linking fails rather than replacing the file if it already exists, in which case it already has this content
+	if err := os.Link(f.Name(), fullPath); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	return s.url(path, fullPath), nil
+}
+
+func (s *localStorage) ExistingURL(ctx context.Context, path string) (string, error) {
+	fullPath := filepath.Join(s.directory, path)
+
+	if _, err := os.Stat(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return s.url(path, fullPath), nil
+}
+
+func (s *localStorage) url(path, fullPath string) string {
+	if s.baseURL != "" {
+		return s.baseURL + filepath.ToSlash(filepath.Clean(path))
+	}
+	return fullPath
+}
+
+func (s *localStorage) BatchPut(ctx context.Context, us []*storage.Upload) error {
+	for _, upload := range us {
+		url, err := s.Put(ctx, upload.Path, upload.ContentType, upload.Body)
+		if err != nil {
+			upload.Error = err
+			return err
+		}
+		upload.URL = url
+	}
+	return nil
+}
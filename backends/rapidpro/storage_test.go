@@ -0,0 +1,151 @@
+package rapidpro
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/nyaruka/gocommon/storage"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newLocalStorage(filepath.Join(dir, "attachments"), 0766, "https://courier.example.com/c/storage/attachments/")
+	assert.Equal(t, "local", s.Name())
+	assert.NoError(t, s.Test(ctx))
+
+	url, err := s.Put(ctx, "media/1/hello.txt", "text/plain", []byte(`hello`))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://courier.example.com/c/storage/attachments/media/1/hello.txt", url)
+
+	_, body, err := s.Get(ctx, "media/1/hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`hello`), body)
+
+	_, _, err = s.Get(ctx, "media/1/missing.txt")
+	assert.Error(t, err)
+	assert.True(t, isNotFound(err))
+
+	url, err = s.PutStream(ctx, "media/1/world.txt", "text/plain", bytes.NewReader([]byte(`world`)))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://courier.example.com/c/storage/attachments/media/1/world.txt", url)
+
+	// a failed stream doesn't leave a partial file
+	_, err = s.PutStream(ctx, "media/1/broken.txt", "text/plain", iotest.ErrReader(os.ErrClosed))
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "attachments/media/1/broken.txt"))
+
+	// or touch an existing one
+	_, err = s.PutStream(ctx, "media/1/world.txt", "text/plain", iotest.ErrReader(os.ErrClosed))
+	assert.Error(t, err)
+	_, body, err = s.Get(ctx, "media/1/world.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`world`), body)
+
+	// existing files are never overwritten
+	url, err = s.PutStream(ctx, "media/1/world.txt", "text/plain", bytes.NewReader([]byte(`other`)))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://courier.example.com/c/storage/attachments/media/1/world.txt", url)
+	_, body, err = s.Get(ctx, "media/1/world.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`world`), body)
+
+	// and no temp files are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "attachments/media/1"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	url, err = s.ExistingURL(ctx, "media/1/world.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://courier.example.com/c/storage/attachments/media/1/world.txt", url)
+
+	url, err = s.ExistingURL(ctx, "media/1/missing.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "", url)
+
+	// storage without a base URL returns file paths
+	s = newLocalStorage(filepath.Join(dir, "logs"), 0766, "")
+
+	uploads := []*storage.Upload{{Path: "1/log.json", ContentType: "application/json", Body: []byte(`{}`)}}
+	require.NoError(t, s.BatchPut(ctx, uploads))
+	assert.Equal(t, filepath.Join(dir, "logs/1/log.json"), uploads[0].URL)
+	assert.FileExists(t, uploads[0].URL)
+
+	// and test fails if the directory isn't writable
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte(`x`), 0644))
+	s = newLocalStorage(filepath.Join(dir, "file"), 0766, "")
+	assert.Error(t, s.Test(ctx))
+}
+
+func TestPresignS3URL(t *testing.T) {
+	client, err := storage.NewS3Client(&storage.S3Options{AWSAccessKeyID: "AKIA123", AWSSecretAccessKey: "sesame", Region: "us-west-2"})
+	require.NoError(t, err)
+
+	signed, err := presignS3URL(client.(s3iface.S3API), "attachments", "us-west-2", "https://attachments.s3.us-west-2.amazonaws.com/media/1/c0dd/06c4/test.jpg", time.Hour)
+	assert.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "attachments.s3.us-west-2.amazonaws.com", u.Host)
+	assert.Equal(t, "/media/1/c0dd/06c4/test.jpg", u.Path)
+	assert.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+	assert.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+
+	// URLs of objects in other buckets or elsewhere can't be presigned
+	signed, err = presignS3URL(client.(s3iface.S3API), "attachments", "us-west-2", "https://other.s3.us-west-2.amazonaws.com/media/1/test.jpg", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "", signed)
+
+	signed, err = presignS3URL(client.(s3iface.S3API), "attachments", "us-west-2", "https://example.com/test.jpg", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "", signed)
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(errors.Wrap(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), "error getting S3 object")))
+	assert.False(t, isNotFound(errors.Wrap(awserr.New("AccessDenied", "Access Denied", nil), "error getting S3 object")))
+	assert.True(t, isNotFound(errors.Wrap(os.ErrNotExist, "error reading file")))
+	assert.False(t, isNotFound(os.ErrPermission))
+}
+
+type headObjectClient struct {
+	s3iface.S3API
+	err error
+}
+
+func (c *headObjectClient) HeadObjectWithContext(ctx aws.Context, in *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{}, c.err
+}
+
+func TestS3StreamStorageExistingURL(t *testing.T) {
+	ctx := context.Background()
+
+	s := newS3StreamStorage(&headObjectClient{}, "attachments", "us-west-2", s3.BucketCannedACLPrivate)
+	url, err := s.ExistingURL(ctx, "media/1/test.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://attachments.s3.us-west-2.amazonaws.com/media/1/test.jpg", url)
+
+	s = newS3StreamStorage(&headObjectClient{err: awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "")}, "attachments", "us-west-2", s3.BucketCannedACLPrivate)
+	url, err = s.ExistingURL(ctx, "media/1/test.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "", url)
+
+	s = newS3StreamStorage(&headObjectClient{err: awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), 403, "")}, "attachments", "us-west-2", s3.BucketCannedACLPrivate)
+	_, err = s.ExistingURL(ctx, "media/1/test.jpg")
+	assert.EqualError(t, err, "error checking for object in bucket: Forbidden: Forbidden\n\tstatus code: 403, request id: ")
+}
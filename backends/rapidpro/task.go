@@ -27,6 +27,13 @@ func queueMsgHandling(rc redis.Conn, c *Contact, m *Msg) error {
 		"new_contact":     c.IsNew_,
 	}
 
+	if m.ReplyToExternalID_ != "" {
+		body["reply_to_external_id"] = m.ReplyToExternalID()
+	}
+	if m.ReplyToID_ != courier.NilMsgID {
+		body["reply_to_id"] = m.ReplyToID_
+	}
+
 	return queueMailroomTask(rc, "msg_event", m.OrgID_, m.ContactID_, body)
 }
 
@@ -55,6 +62,10 @@ func queueChannelEvent(rc redis.Conn, c *Contact, e *ChannelEvent) error {
 		return queueMailroomTask(rc, "optin", e.OrgID_, e.ContactID_, body)
 	case courier.EventTypeOptOut:
 		return queueMailroomTask(rc, "optout", e.OrgID_, e.ContactID_, body)
+	case courier.EventTypeReaction:
+		return queueMailroomTask(rc, "reaction", e.OrgID_, e.ContactID_, body)
+	case courier.EventTypeLinkClicked:
+		return queueMailroomTask(rc, "link_clicked", e.OrgID_, e.ContactID_, body)
 	default:
 		return fmt.Errorf("unknown event type: %s", e.EventType())
 	}
@@ -53,6 +53,70 @@ const (
 
 	// ConfigSendHeaders is a constant key for channel configs
 	ConfigSendHeaders = "headers"
+
+	// ConfigKeywordRoutes is a map of keywords to the UUIDs of the channels that incoming messages starting with them
+	// should be written to
+	ConfigKeywordRoutes = "keyword_routes"
+
+	// ConfigKeywordRouteDefault is the UUID of the channel that incoming messages not matching a keyword route should
+	// be written to, defaulting to the receiving channel
+	ConfigKeywordRouteDefault = "keyword_route_default"
+
+	// ConfigKeywordRouteSticky is whether URNs should continue to be routed to the channel of the last keyword they matched
+	ConfigKeywordRouteSticky = "keyword_route_sticky"
+
+	// ConfigCompliance is whether STOP, START and HELP keywords in incoming messages should be handled by courier
+	ConfigCompliance = "compliance"
+
+	// ConfigComplianceStopKeywords is a list of keywords, in addition to the defaults, that opt a contact out
+	ConfigComplianceStopKeywords = "compliance_stop_keywords"
+
+	// ConfigComplianceStartKeywords is a list of keywords, in addition to the defaults, that opt a contact back in
+	ConfigComplianceStartKeywords = "compliance_start_keywords"
+
+	// ConfigComplianceHelpKeywords is a list of keywords, in addition to the defaults, that request help
+	ConfigComplianceHelpKeywords = "compliance_help_keywords"
+
+	// ConfigComplianceStopReply is the auto-reply to a STOP keyword, either text or a map of language codes to text
+	ConfigComplianceStopReply = "compliance_stop_reply"
+
+	// ConfigComplianceStartReply is the auto-reply to a START keyword, either text or a map of language codes to text
+	ConfigComplianceStartReply = "compliance_start_reply"
+
+	// ConfigComplianceHelpReply is the auto-reply to a HELP keyword, either text or a map of language codes to text
+	ConfigComplianceHelpReply = "compliance_help_reply"
+
+	// ConfigSendMiddleware is a list of the names of send middleware to apply to outgoing messages, which can be set
+	// in org config as well as channel config, with org middleware applied first
+	ConfigSendMiddleware = "send_middleware"
+
+	// ConfigTransliterate is whether the text of outgoing SMS should have characters replaced with GSM7 equivalents
+	// where that avoids having to send them as UCS2
+	ConfigTransliterate = "transliterate"
+
+	// ConfigSandbox is whether outgoing messages should be rendered as requests by the channel handler but never
+	// actually sent, with their statuses being synthesized
+	ConfigSandbox = "sandbox"
+
+	// ConfigSandboxResponse is the body of the response to return for requests made by a sandboxed channel, either
+	// text or JSON, defaulting to an empty JSON object
+	ConfigSandboxResponse = "sandbox_response"
+
+	// ConfigFallbackChannel is the UUID of a channel that outgoing messages should be rerouted to if sending fails with
+	// one of the errors in ConfigFallbackErrors
+	ConfigFallbackChannel = "fallback_channel"
+
+	// ConfigFallbackErrors is the list of channel error codes which trigger rerouting to the fallback channel, each being
+	// either a code like "response_status_code" or a code and external code like "external:131026"
+	ConfigFallbackErrors = "fallback_errors"
+
+	// ConfigSendTimeout is the number of seconds allowed for each request made when sending on a channel, overriding
+	// the timeout for its channel type
+	ConfigSendTimeout = "send_timeout"
+
+	// ConfigSignedURLLifetime is the number of seconds that signed URLs of outgoing attachments are valid for, overriding
+	// the default lifetime
+	ConfigSignedURLLifetime = "signed_url_lifetime"
 )
 
 // ChannelType is the 1-3 letter code used for channel types in the database
@@ -17,6 +17,33 @@ const (
 	EventTypeWelcomeMessage  ChannelEventType = "welcome_message"
 	EventTypeOptIn           ChannelEventType = "optin"
 	EventTypeOptOut          ChannelEventType = "optout"
+	EventTypeReaction        ChannelEventType = "reaction"
+	EventTypeLinkClicked     ChannelEventType = "link_clicked"
+	EventTypeStartContact    ChannelEventType = "start_contact"
+	EventTypeHelpRequest     ChannelEventType = "help_request"
+)
+
+// keys used in the extra of events created from compliance keywords
+const (
+	ComplianceKeyKeyword = "keyword" // the type of keyword, e.g. stop
+	ComplianceKeyReply   = "reply"   // the configured auto-reply which should be sent to the contact, if any
+)
+
+// keys used in the extra of reaction events
+const (
+	ReactionKeyEmoji      = "emoji"       // the emoji reacted with
+	ReactionKeyAction     = "action"      // whether the reaction was added or removed
+	ReactionKeyExternalID = "external_id" // the external id of the message reacted to
+	ReactionKeyMsgID      = "msg_id"      // our id of the message reacted to if it could be resolved
+)
+
+// ReactionAction is whether a reaction was added or removed
+type ReactionAction string
+
+// Possible values for ReactionActions
+const (
+	ReactionActionAdd    ReactionAction = "add"
+	ReactionActionRemove ReactionAction = "remove"
 )
 
 //-----------------------------------------------------------------------------
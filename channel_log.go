@@ -68,6 +68,30 @@ func ErrorAttachmentNotDecodable() *ChannelError {
 	return NewChannelError("attachment_not_decodable", "", "Unable to decode embedded attachment data.")
 }
 
+func ErrorAttachmentTooLarge(maxBytes int) *ChannelError {
+	return NewChannelError("attachment_too_large", "", "Attachment exceeds maximum size of %d bytes.", maxBytes)
+}
+
+func ErrorAttachmentHTMLResponse() *ChannelError {
+	return NewChannelError("attachment_html_response", "", "Attachment URL returned an HTML page instead of an attachment.")
+}
+
+func ErrorAttachmentTypeMismatch(contentType string) *ChannelError {
+	return NewChannelError("attachment_type_mismatch", "", "Attachment content doesn't match its declared type of %s.", contentType)
+}
+
+func ErrorAttachmentInfected(signature string) *ChannelError {
+	return NewChannelError("attachment_infected", "", "Attachment contains malware (%s) and was quarantined.", signature)
+}
+
+func ErrorAttachmentNotScanned() *ChannelError {
+	return NewChannelError("attachment_not_scanned", "", "Unable to scan attachment for malware.")
+}
+
+func ErrorAttachmentTimeout() *ChannelError {
+	return NewChannelError("attachment_timeout", "", "Attachment couldn't be fetched before the message had to be handled.")
+}
+
 func ErrorExternal(code, message string) *ChannelError {
 	if message == "" {
 		message = fmt.Sprintf("Service specific error: %s.", code)
@@ -98,6 +122,8 @@ type ChannelLog struct {
 	channel   Channel
 	httpLogs  []*httpx.Log
 	errors    []*ChannelError
+	segments  int
+	rerouted  *MsgReroute
 	createdOn time.Time
 	elapsed   time.Duration
 
@@ -194,6 +220,24 @@ func (l *ChannelLog) Errors() []*ChannelError {
 	return l.errors
 }
 
+// Segments is the number of SMS segments an outgoing message was sent as, or zero if not applicable
+func (l *ChannelLog) Segments() int {
+	return l.segments
+}
+
+func (l *ChannelLog) SetSegments(n int) {
+	l.segments = n
+}
+
+// ReroutedFrom is where an outgoing message was rerouted from, linking this log to that of the failed send
+func (l *ChannelLog) ReroutedFrom() *MsgReroute {
+	return l.rerouted
+}
+
+func (l *ChannelLog) SetReroutedFrom(r *MsgReroute) {
+	l.rerouted = r
+}
+
 func (l *ChannelLog) CreatedOn() time.Time {
 	return l.createdOn
 }
@@ -0,0 +1,166 @@
+package courier
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/pkg/errors"
+)
+
+// ComplianceKeyword is the type of a compliance keyword found in an incoming message
+type ComplianceKeyword string
+
+// the compliance keyword types we handle
+const (
+	ComplianceKeywordNone  ComplianceKeyword = ""
+	ComplianceKeywordStop  ComplianceKeyword = "stop"
+	ComplianceKeywordStart ComplianceKeyword = "start"
+	ComplianceKeywordHelp  ComplianceKeyword = "help"
+)
+
+// default keywords by type and language, which are matched against the entire text of a message
+var defaultComplianceKeywords = map[ComplianceKeyword]map[i18n.Language][]string{
+	ComplianceKeywordStop: {
+		"eng": {"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT", "OPTOUT", "REVOKE"},
+		"spa": {"ALTO", "BAJA", "DETENER"},
+		"fra": {"ARRET", "ARRÊT", "DESABONNER", "DÉSABONNER"},
+		"por": {"PARAR", "SAIR", "CANCELAR"},
+	},
+	ComplianceKeywordStart: {
+		"eng": {"START", "UNSTOP", "SUBSCRIBE"},
+		"spa": {"COMENZAR", "ALTA"},
+		"fra": {"COMMENCER", "ABONNER"},
+		"por": {"INICIAR", "VOLTAR"},
+	},
+	ComplianceKeywordHelp: {
+		"eng": {"HELP", "INFO"},
+		"spa": {"AYUDA"},
+		"fra": {"AIDE"},
+		"por": {"AJUDA"},
+	},
+}
+
+var complianceKeywordConfigs = map[ComplianceKeyword]string{
+	ComplianceKeywordStop:  ConfigComplianceStopKeywords,
+	ComplianceKeywordStart: ConfigComplianceStartKeywords,
+	ComplianceKeywordHelp:  ConfigComplianceHelpKeywords,
+}
+
+var complianceReplyConfigs = map[ComplianceKeyword]string{
+	ComplianceKeywordStop:  ConfigComplianceStopReply,
+	ComplianceKeywordStart: ConfigComplianceStartReply,
+	ComplianceKeywordHelp:  ConfigComplianceHelpReply,
+}
+
+// ComplianceEnabled returns whether compliance keywords should be handled for the given channel, which must be an
+// SMS channel with compliance turned on in its config
+func ComplianceEnabled(channel Channel) bool {
+	return channel.IsScheme(urns.TelScheme) && channel.BoolConfigForKey(ConfigCompliance, false)
+}
+
+// MatchComplianceKeyword checks whether the given text consists of a compliance keyword for the given channel, returning
+// the type of keyword and its language if known
+func MatchComplianceKeyword(channel Channel, text string) (ComplianceKeyword, i18n.Language) {
+	text = strings.ToUpper(strings.TrimFunc(text, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) }))
+	if text == "" {
+		return ComplianceKeywordNone, i18n.NilLanguage
+	}
+
+	for _, kw := range []ComplianceKeyword{ComplianceKeywordStop, ComplianceKeywordStart, ComplianceKeywordHelp} {
+		for _, custom := range configStrings(channel.ConfigForKey(complianceKeywordConfigs[kw], nil)) {
+			if strings.ToUpper(custom) == text {
+				return kw, i18n.NilLanguage
+			}
+		}
+		for lang, keywords := range defaultComplianceKeywords[kw] {
+			for _, keyword := range keywords {
+				if keyword == text {
+					return kw, lang
+				}
+			}
+		}
+	}
+
+	return ComplianceKeywordNone, i18n.NilLanguage
+}
+
+// ComplianceReply returns the configured auto-reply for the given keyword type, preferring the given language, then
+// English, if the channel has replies by language
+func ComplianceReply(channel Channel, kw ComplianceKeyword, lang i18n.Language) string {
+	switch reply := channel.ConfigForKey(complianceReplyConfigs[kw], nil).(type) {
+	case string:
+		return reply
+	case map[string]any:
+		for _, l := range []i18n.Language{lang, "eng"} {
+			if text, isStr := reply[string(l)].(string); isStr && text != "" {
+				return text
+			}
+		}
+	case map[string]string:
+		for _, l := range []i18n.Language{lang, "eng"} {
+			if text := reply[string(l)]; text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+var complianceEventTypes = map[ComplianceKeyword]ChannelEventType{
+	ComplianceKeywordStop:  EventTypeStopContact,
+	ComplianceKeywordStart: EventTypeStartContact,
+	ComplianceKeywordHelp:  EventTypeHelpRequest,
+}
+
+// handleComplianceKeyword checks the given incoming message for a compliance keyword, and if found, writes an event for
+// it with any configured auto-reply, leaving it to mailroom to stop or unstop the contact and send the reply
+func handleComplianceKeyword(ctx context.Context, b Backend, msg MsgIn, clog *ChannelLog) error {
+	channel := msg.Channel()
+	if !ComplianceEnabled(channel) {
+		return nil
+	}
+
+	kw, lang := MatchComplianceKeyword(channel, msg.Text())
+	if kw == ComplianceKeywordNone {
+		return nil
+	}
+
+	reply := ComplianceReply(channel, kw, lang)
+
+	// help requests only need handling if there's a reply to send
+	if kw == ComplianceKeywordHelp && reply == "" {
+		return nil
+	}
+
+	extra := map[string]string{ComplianceKeyKeyword: string(kw)}
+	if reply != "" {
+		extra[ComplianceKeyReply] = reply
+	}
+
+	event := b.NewChannelEvent(channel, complianceEventTypes[kw], msg.URN(), clog).WithExtra(extra)
+	if err := b.WriteChannelEvent(ctx, event, clog); err != nil {
+		return errors.Wrapf(err, "error writing %s event", event.EventType())
+	}
+
+	return nil
+}
+
+// reads a list of strings from a config value, which will be []any if it came from JSON
+func configStrings(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		strs := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, isStr := s.(string); isStr {
+				strs = append(strs, str)
+			}
+		}
+		return strs
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package courier_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchComplianceKeyword(t *testing.T) {
+	ch := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigCompliance:             true,
+		courier.ConfigComplianceStopKeywords: []any{"enough"},
+	})
+
+	tcs := []struct {
+		text    string
+		keyword courier.ComplianceKeyword
+		lang    i18n.Language
+	}{
+		{"STOP", courier.ComplianceKeywordStop, "eng"},
+		{" stop. ", courier.ComplianceKeywordStop, "eng"},
+		{"Arrêt", courier.ComplianceKeywordStop, "fra"},
+		{"Enough!", courier.ComplianceKeywordStop, i18n.NilLanguage},
+		{"unstop", courier.ComplianceKeywordStart, "eng"},
+		{"ayuda", courier.ComplianceKeywordHelp, "spa"},
+		{"stop sending me these", courier.ComplianceKeywordNone, i18n.NilLanguage},
+		{"hello", courier.ComplianceKeywordNone, i18n.NilLanguage},
+		{"", courier.ComplianceKeywordNone, i18n.NilLanguage},
+	}
+
+	for _, tc := range tcs {
+		keyword, lang := courier.MatchComplianceKeyword(ch, tc.text)
+		assert.Equal(t, tc.keyword, keyword, "keyword mismatch for '%s'", tc.text)
+		assert.Equal(t, tc.lang, lang, "language mismatch for '%s'", tc.text)
+	}
+
+	assert.True(t, courier.ComplianceEnabled(ch))
+	assert.False(t, courier.ComplianceEnabled(test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", nil)))
+
+	ch.SetScheme(urns.TelegramScheme)
+	assert.False(t, courier.ComplianceEnabled(ch))
+}
+
+func TestComplianceReply(t *testing.T) {
+	ch := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigComplianceStopReply: "You have been unsubscribed.",
+		courier.ConfigComplianceHelpReply: map[string]any{"eng": "Reply STOP to unsubscribe.", "spa": "Responda ALTO para cancelar."},
+	})
+
+	assert.Equal(t, "You have been unsubscribed.", courier.ComplianceReply(ch, courier.ComplianceKeywordStop, "fra"))
+	assert.Equal(t, "Responda ALTO para cancelar.", courier.ComplianceReply(ch, courier.ComplianceKeywordHelp, "spa"))
+	assert.Equal(t, "Reply STOP to unsubscribe.", courier.ComplianceReply(ch, courier.ComplianceKeywordHelp, "fra"))
+	assert.Equal(t, "Reply STOP to unsubscribe.", courier.ComplianceReply(ch, courier.ComplianceKeywordHelp, i18n.NilLanguage))
+	assert.Equal(t, "", courier.ComplianceReply(ch, courier.ComplianceKeywordStart, "eng"))
+}
+
+func TestComplianceKeywords(t *testing.T) {
+	mb := test.NewMockBackend()
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigCompliance:          true,
+		courier.ConfigComplianceStopReply: "You have been unsubscribed.",
+	})
+	mb.AddChannel(mockChannel)
+
+	server := courier.NewServerWithLogger(testConfig(), mb, slog.Default())
+	server.Start()
+	defer server.Stop()
+
+	// wait for server to come up
+	time.Sleep(100 * time.Millisecond)
+
+	receive := func(text string) {
+		resp, err := http.Get("http://localhost:8080/c/mck/e4bb1578-29da-4fa5-a214-9da19dd24230/receive?from=%2B12065551212&text=" + url.QueryEscape(text))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, 200, resp.StatusCode)
+	}
+
+	// a stop is written as an event for mailroom to stop the contact and send the reply
+	receive("STOP")
+
+	require.Len(t, mb.WrittenMsgs(), 1)
+	require.Len(t, mb.WrittenChannelEvents(), 1)
+	assert.Equal(t, courier.EventTypeStopContact, mb.WrittenChannelEvents()[0].EventType())
+	assert.Equal(t, map[string]string{"keyword": "stop", "reply": "You have been unsubscribed."}, mb.WrittenChannelEvents()[0].Extra())
+	assert.Len(t, mb.WrittenChannelLogs(), 1)
+	mb.Reset()
+
+	// a start has its own event type, and no reply since none is configured
+	receive("start")
+
+	require.Len(t, mb.WrittenChannelEvents(), 1)
+	assert.Equal(t, courier.EventTypeStartContact, mb.WrittenChannelEvents()[0].EventType())
+	assert.Equal(t, map[string]string{"keyword": "start"}, mb.WrittenChannelEvents()[0].Extra())
+	mb.Reset()
+
+	// a help request without a reply doesn't need handling
+	receive("help")
+	assert.Len(t, mb.WrittenChannelEvents(), 0)
+
+	// other messages aren't affected
+	receive("stop it")
+	assert.Len(t, mb.WrittenChannelEvents(), 0)
+	mb.Reset()
+
+	// messages written outside of requests, e.g. flushed concatenated messages, are handled too
+	b := server.Backend()
+	require.NoError(t, b.WriteMsg(context.Background(), mb.NewIncomingMsg(mockChannel, "tel:+12065551212", "stop", "", nil), nil))
+
+	require.Len(t, mb.WrittenChannelEvents(), 1)
+	assert.Equal(t, courier.EventTypeStopContact, mb.WrittenChannelEvents()[0].EventType())
+}
@@ -6,7 +6,9 @@ import (
 	"log"
 	"log/slog"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nyaruka/courier/utils"
 	"github.com/nyaruka/ezconf"
@@ -14,6 +16,15 @@ import (
 	"github.com/pkg/errors"
 )
 
+// the storage drivers which can be used for attachments and logs
+const (
+	StorageDriverS3 = "s3"
+	StorageDriverFS = "fs"
+)
+
+// the send timeout if one isn't configured
+const defaultSendTimeout = 30 * time.Second
+
 // Config is our top level configuration object
 type Config struct {
 	Backend   string `help:"the backend that will be used by courier (currently only rapidpro is supported)"`
@@ -25,6 +36,9 @@ type Config struct {
 	Redis     string `validate:"url,startswith=redis:"      help:"URL for your Redis instance"`
 	SpoolDir  string `help:"the local directory where courier will write statuses or msgs that need to be retried (needs to be writable)"`
 
+	StorageDriver string `validate:"omitempty,oneof=s3 fs" help:"the storage driver for attachments and logs (s3 or fs), if empty s3 is used when AWS credentials are configured"`
+	StorageDir    string `help:"the local directory where attachments and logs are written when using the fs storage driver"`
+
 	AWSAccessKeyID      string `help:"the access key id to use when authenticating S3"`
 	AWSSecretAccessKey  string `help:"the secret access key id to use when authenticating S3"`
 	AWSUseCredChain     bool   `help:"whether to use the AWS credentials chain. Defaults to false."`
@@ -41,8 +55,26 @@ type Config struct {
 	WhatsappAdminSystemUserToken string `help:"the token of the admin system user for WhatsApp"`
 
 	DisallowedNetworks string     `help:"comma separated list of IP addresses and networks which we disallow fetching attachments from"`
+	MaxAttachmentBytes int        `help:"the maximum size in bytes of attachments that will be fetched from channels"`
+	FetchDedupWindow   int        `help:"the number of seconds for which repeated requests to fetch the same attachment URL get the attachment already fetched"`
+	FetchWorkers       int        `help:"the number of go routines that will be used to fetch pending attachments of incoming messages"`
+	FetchTimeout       int        `help:"the number of seconds allowed to fetch the pending attachments of an incoming message before it's handled without them"`
+	ClamdAddress       string     `help:"the address of a ClamAV daemon to scan incoming attachments with, e.g. tcp://localhost:3310 or unix:///var/run/clamav/clamd.ctl"`
+	ClamdMaxBytes      int        `help:"the maximum size in bytes of attachments that will be scanned, which shouldn't exceed the daemon's StreamMaxLength"`
+	ScanFailClosed     bool       `help:"whether attachments which can't be scanned are dropped rather than saved unscanned"`
 	MediaDomain        string     `help:"the domain on which we'll try to resolve outgoing media URLs"`
+	TranscodeMedia     bool       `help:"whether to transcode outgoing media which channels can't send as is"`
+	FFmpegPath         string     `help:"the path of the ffmpeg binary used to transcode audio and video, empty to only transcode images"`
+	ThumbnailMedia     bool       `help:"whether to generate thumbnails for outgoing image and video attachments which don't have them"`
+	SignedURLSecret    string     `help:"the secret used to sign the URLs of outgoing attachments which are proxied by courier"`
+	SignedURLLifetime  int        `help:"the default number of seconds that signed URLs of outgoing attachments are valid for"`
+	PrivateAttachments bool       `help:"whether saved attachments are private and only accessible through signed URLs, which are then used for outgoing attachments on all channels"`
 	MaxWorkers         int        `help:"the maximum number of go routines that will be used for sending (set to 0 to disable sending)"`
+	SendTimeout        int        `help:"the number of seconds allowed for each request made to a channel when sending"`
+	SendTimeouts       string     `help:"comma separated list of channel type send timeouts in seconds which override the default, e.g. WA:60,T:5"`
+	HTTPReadTimeout    int        `help:"the number of seconds allowed for reading incoming requests"`
+	HTTPWriteTimeout   int        `help:"the number of seconds allowed for writing responses to incoming requests"`
+	ConcatMsgTimeout   int        `help:"the number of seconds to wait for all parts of a concatenated SMS before writing the parts received"`
 	LibratoUsername    string     `help:"the username that will be used to authenticate to Librato"`
 	LibratoToken       string     `help:"the token that will be used to authenticate to Librato"`
 	StatusUsername     string     `help:"the username that is needed to authenticate against the /status endpoint"`
@@ -56,6 +88,9 @@ type Config struct {
 
 	// ExcludeChannels is the list of channels to exclude, empty means exclude none
 	ExcludeChannels []string
+
+	// parsed from SendTimeouts when the config is validated
+	sendTimeouts map[ChannelType]time.Duration
 }
 
 // NewDefaultConfig returns a new default configuration object
@@ -69,6 +104,9 @@ func NewDefaultConfig() *Config {
 		Redis:    "redis://localhost:6379/15",
 		SpoolDir: "/var/spool/courier",
 
+		StorageDriver: "",
+		StorageDir:    "_storage",
+
 		AWSAccessKeyID:      "",
 		AWSSecretAccessKey:  "",
 		AWSUseCredChain:     false,
@@ -85,7 +123,18 @@ func NewDefaultConfig() *Config {
 		WhatsappAdminSystemUserToken: "missing_whatsapp_admin_system_user_token",
 
 		DisallowedNetworks: `127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,fe80::/10`,
+		MaxAttachmentBytes: 100 * 1024 * 1024,
+		FetchDedupWindow:   600,
+		FetchWorkers:       8,
+		FetchTimeout:       60,
+		ClamdMaxBytes:      25 * 1024 * 1024,
+		SignedURLLifetime:  3600,
+		FFmpegPath:         "ffmpeg",
 		MaxWorkers:         32,
+		SendTimeout:        30,
+		HTTPReadTimeout:    30,
+		HTTPWriteTimeout:   45,
+		ConcatMsgTimeout:   60,
 		LogLevel:           slog.LevelWarn,
 		Version:            "Dev",
 	}
@@ -113,9 +162,29 @@ func (c *Config) Validate() error {
 	if _, _, err := c.ParseDisallowedNetworks(); err != nil {
 		return errors.Wrap(err, "unable to parse 'DisallowedNetworks'")
 	}
+	if c.PrivateAttachments && c.SignedURLSecret == "" {
+		return errors.New("'PrivateAttachments' requires a 'SignedURLSecret'")
+	}
+
+	sendTimeouts, err := c.ParseSendTimeouts()
+	if err != nil {
+		return errors.Wrap(err, "unable to parse 'SendTimeouts'")
+	}
+	c.sendTimeouts = sendTimeouts
 	return nil
 }
 
+// ActiveStorageDriver returns the storage driver to use for attachments and logs
+func (c *Config) ActiveStorageDriver() string {
+	if c.StorageDriver != "" {
+		return c.StorageDriver
+	}
+	if c.AWSAccessKeyID != "" || c.AWSUseCredChain {
+		return StorageDriverS3
+	}
+	return StorageDriverFS
+}
+
 // ParseDisallowedNetworks parses the list of IPs and IP networks (written in CIDR notation)
 func (c *Config) ParseDisallowedNetworks() ([]net.IP, []*net.IPNet, error) {
 	addrs, err := csv.NewReader(strings.NewReader(c.DisallowedNetworks)).Read()
@@ -125,3 +194,39 @@ func (c *Config) ParseDisallowedNetworks() ([]net.IP, []*net.IPNet, error) {
 
 	return httpx.ParseNetworks(addrs...)
 }
+
+// ParseSendTimeouts parses the list of channel type send timeouts, e.g. WA:60,T:5
+func (c *Config) ParseSendTimeouts() (map[ChannelType]time.Duration, error) {
+	timeouts := make(map[ChannelType]time.Duration)
+	if strings.TrimSpace(c.SendTimeouts) == "" {
+		return timeouts, nil
+	}
+
+	for _, item := range strings.Split(c.SendTimeouts, ",") {
+		channelType, secs, found := strings.Cut(strings.TrimSpace(item), ":")
+		n, err := strconv.Atoi(secs)
+		if !found || channelType == "" || err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid send timeout: %s", item)
+		}
+		timeouts[ChannelType(channelType)] = time.Duration(n) * time.Second
+	}
+	return timeouts, nil
+}
+
+// SendTimeoutFor returns the timeout for requests made when sending on the given channel, which can be set on the
+// channel itself, for its channel type or as the default. Channel type timeouts are only applied once the config has
+// been validated.
+func (c *Config) SendTimeoutFor(channel Channel) time.Duration {
+	if secs := channel.IntConfigForKey(ConfigSendTimeout, 0); secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if timeout, found := c.sendTimeouts[channel.ChannelType()]; found {
+		return timeout
+	}
+
+	if c.SendTimeout > 0 {
+		return time.Duration(c.SendTimeout) * time.Second
+	}
+	return defaultSendTimeout
+}
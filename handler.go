@@ -45,6 +45,22 @@ type AttachmentRequestBuilder interface {
 	BuildAttachmentRequest(context.Context, Backend, Channel, string, *ChannelLog) (*http.Request, error)
 }
 
+// AttachmentResolver is the interface handlers which receive references to attachments that must be resolved to URLs
+// before they can be fetched, e.g. media IDs, should satisfy
+type AttachmentResolver interface {
+	ResolveAttachment(context.Context, Channel, string, *ChannelLog) (string, error)
+}
+
+// ReactionSender is the interface handlers which can send reactions to received messages should satisfy
+type ReactionSender interface {
+	SendReaction(context.Context, MsgOut, *SendResult, *ChannelLog) error
+}
+
+// ConversationActions is the interface handlers which can show typing indicators or mark messages as read should satisfy
+type ConversationActions interface {
+	SendConversationAction(context.Context, MsgOut, *SendResult, *ChannelLog) error
+}
+
 // RegisterHandler adds a new handler for a channel type, this is called by individual handlers when they are initialized
 func RegisterHandler(handler ChannelHandler) {
 	registeredHandlers[handler.ChannelType()] = handler
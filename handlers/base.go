@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/nyaruka/courier"
+	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/gocommon/httpx"
 )
 
@@ -111,24 +114,74 @@ func (h *BaseHandler) RequestHTTPInsecure(req *http.Request, clog *courier.Chann
 
 // RequestHTTP does the given request using the given client, logging the trace, and returns the response
 func (h *BaseHandler) RequestHTTPWithClient(client *http.Client, req *http.Request, clog *courier.ChannelLog) (*http.Response, []byte, error) {
+	return h.requestHTTP(client, req, clog, true, true)
+}
+
+// RequestAttachmentHTTP does the given request to fetch one of a message's attachments, logging the trace, and returns
+// the response. Unlike requests to the channel, these are made even when sending on a sandboxed channel.
+func (h *BaseHandler) RequestAttachmentHTTP(req *http.Request, clog *courier.ChannelLog) (*http.Response, []byte, error) {
+	return h.requestHTTP(h.backend.HttpClient(true), req, clog, true, false)
+}
+
+// does the given request using the given client, logging the trace with or without the response body
+func (h *BaseHandler) requestHTTP(client *http.Client, req *http.Request, clog *courier.ChannelLog, logBody, sandboxable bool) (*http.Response, []byte, error) {
 	var resp *http.Response
 	var body []byte
 
 	req.Header.Set("User-Agent", fmt.Sprintf("Courier/%s", h.server.Config().Version))
 
-	trace, err := httpx.DoTrace(client, req, nil, h.backend.HttpAccess(), 0)
+	// requests made sending a message are limited by the channel's send timeout rather than that of the client
+	if clog.Type() == courier.ChannelLogTypeMsgSend {
+		timeout := h.server.Config().SendTimeoutFor(clog.Channel())
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		req = req.WithContext(ctx)
+		limited := *client
+		limited.Timeout = timeout
+		client = &limited
+	}
+
+	var trace *httpx.Trace
+	var err error
+
+	// requests to the channel made sending on a sandboxed channel are recorded but never actually made
+	if sandboxable && clog.Type() == courier.ChannelLogTypeMsgSend && courier.IsSandboxed(clog.Channel()) {
+		trace, err = courier.SandboxTrace(clog.Channel(), req)
+	} else {
+		trace, err = httpx.DoTrace(client, req, nil, h.backend.HttpAccess(), 0)
+	}
 	if trace != nil {
-		clog.HTTP(trace)
+		if logBody {
+			clog.HTTP(trace)
+		} else {
+			withoutBody := *trace
+			withoutBody.ResponseBody = nil
+			clog.HTTP(&withoutBody)
+		}
 		resp = trace.Response
 		body = trace.ResponseBody
 	}
 	if err != nil {
+		if isTimeout(err) && clog.Type() == courier.ChannelLogTypeMsgSend {
+			countSendTimeout(clog.Channel().ChannelType())
+		}
 		return nil, nil, err
 	}
 
 	return resp, body, nil
 }
 
+// records a send timeout for the given channel type
+func countSendTimeout(channelType courier.ChannelType) {
+	analytics.Gauge(fmt.Sprintf("courier.send_timeout_%s", channelType), 1)
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &nerr) && nerr.Timeout())
+}
+
 // WriteStatusSuccessResponse writes a success response for the statuses
 func (h *BaseHandler) WriteStatusSuccessResponse(ctx context.Context, w http.ResponseWriter, statuses []courier.StatusUpdate) error {
 	return courier.WriteStatusSuccess(w, statuses)
@@ -2,11 +2,15 @@ package handlers_test
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/handlers"
 	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/stretchr/testify/assert"
@@ -18,11 +22,14 @@ func TestRequestHTTP(t *testing.T) {
 			httpx.NewMockResponse(200, nil, []byte(`{"status":"success"}`)),
 			httpx.NewMockResponse(400, nil, []byte(`{"status":"error"}`)),
 		},
+		"https://media.example.com/test.jpg": {
+			httpx.NewMockResponse(200, nil, []byte(`imagebytes`)),
+		},
 	}))
 	defer httpx.SetRequestor(httpx.DefaultRequestor)
 
 	mb := test.NewMockBackend()
-	mc := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", nil)
+	mc := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{})
 	mm := mb.NewOutgoingMsg(mc, 123, urns.URN("tel:+1234"), "Hello World", false, nil, "", "", courier.MsgOriginChat, nil)
 	clog := courier.NewChannelLogForSend(mm, nil)
 
@@ -52,4 +59,71 @@ func TestRequestHTTP(t *testing.T) {
 	hlog2 := clog.HTTPLogs()[1]
 	assert.Equal(t, 400, hlog2.StatusCode)
 	assert.Equal(t, "https://api.messages.com/send.json", hlog2.URL)
+
+	// sends on sandboxed channels aren't actually made
+	mc.SetConfig(courier.ConfigSandbox, true)
+	req, _ = http.NewRequest("POST", "https://api.messages.com/send.json", strings.NewReader(`{"text":"Hello World"}`))
+	resp, respBody, err = h.RequestHTTP(req, clog)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []byte(`{}`), respBody)
+	assert.Len(t, clog.HTTPLogs(), 3)
+	assert.Contains(t, clog.HTTPLogs()[2].Request, `{"text":"Hello World"}`)
+
+	// but fetches of the message's attachments are
+	req, _ = http.NewRequest("GET", "https://media.example.com/test.jpg", nil)
+	resp, respBody, err = h.RequestAttachmentHTTP(req, clog)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []byte(`imagebytes`), respBody)
+	assert.Len(t, clog.HTTPLogs(), 4)
+}
+
+func TestRequestHTTPTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 1500)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	metrics := analytics.NewMock()
+	analytics.RegisterBackend(metrics)
+
+	mb := test.NewMockBackend()
+	mc := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{courier.ConfigSendTimeout: 1})
+	mm := mb.NewOutgoingMsg(mc, 123, urns.URN("tel:+1234"), "Hello World", false, nil, "", "", courier.MsgOriginChat, nil)
+	clog := courier.NewChannelLogForSend(mm, nil)
+
+	h := handlers.NewBaseHandler("NX", "Test")
+	h.SetServer(test.NewMockServer(courier.NewDefaultConfig(), mb))
+
+	// request takes longer than the channel's send timeout
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	_, _, err := h.RequestHTTP(req, clog)
+	assert.Error(t, err)
+	assert.Equal(t, []float64{1}, metrics.Gauges["courier.send_timeout_NX"])
+
+	// but not longer than a more generous one
+	mc.SetConfig(courier.ConfigSendTimeout, 3)
+
+	req, _ = http.NewRequest("POST", server.URL, nil)
+	resp, _, err := h.RequestHTTP(req, clog)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, metrics.Gauges["courier.send_timeout_NX"], 1)
+
+	// each timeout is recorded
+	mc.SetConfig(courier.ConfigSendTimeout, 1)
+
+	req, _ = http.NewRequest("POST", server.URL, nil)
+	_, _, err = h.RequestHTTP(req, clog)
+	assert.Error(t, err)
+	assert.Equal(t, []float64{1, 1}, metrics.Gauges["courier.send_timeout_NX"])
+
+	// and the send timeout doesn't apply to other requests for the channel
+	req, _ = http.NewRequest("POST", server.URL, nil)
+	resp, _, err = h.RequestHTTP(req, courier.NewChannelLog(courier.ChannelLogTypeMsgReceive, mc, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, metrics.Gauges["courier.send_timeout_NX"], 2)
 }
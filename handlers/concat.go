@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/pkg/errors"
+)
+
+const (
+	concatBufferKey  = "concat:%s:%s:%d:%d" // channel UUID, sender, reference and total parts
+	concatPendingKey = "concat_pending:%s"  // channel type
+	concatDoneKey    = "%s:done"            // buffer key
+
+	// how often we look for partial messages which have timed out
+	concatFlushInterval = 15 * time.Second
+)
+
+// ConcatPart describes a single segment of a concatenated SMS
+type ConcatPart struct {
+	Ref   int
+	Total int
+	Seq   int
+}
+
+// ParseUDH parses the concatenation information element from the given user data header, which can be hex encoded or
+// raw bytes, returning nil if it doesn't describe a segment of a concatenated message
+func ParseUDH(udh string) *ConcatPart {
+	data, err := hex.DecodeString(udh)
+	if err != nil {
+		data = []byte(udh)
+	}
+	if len(data) < 2 || int(data[0]) != len(data)-1 {
+		return nil
+	}
+
+	// walk the information elements looking for a concatenation one
+	ies := data[1:]
+	for len(ies) >= 2 {
+		iei, length := ies[0], int(ies[1])
+		if len(ies) < 2+length {
+			return nil
+		}
+		ie := ies[2 : 2+length]
+
+		var part *ConcatPart
+		if iei == 0x00 && length == 3 {
+			part = &ConcatPart{Ref: int(ie[0]), Total: int(ie[1]), Seq: int(ie[2])}
+		} else if iei == 0x08 && length == 4 {
+			part = &ConcatPart{Ref: int(ie[0])<<8 | int(ie[1]), Total: int(ie[2]), Seq: int(ie[3])}
+		}
+		if part != nil {
+			if part.Total < 2 || part.Seq < 1 || part.Seq > part.Total {
+				return nil
+			}
+			return part
+		}
+
+		ies = ies[2+length:]
+	}
+	return nil
+}
+
+var luaConcatAdd = redis.NewScript(3, `-- KEYS: [BufferKey, PendingKey, DoneKey] ARGV: [Seq, Text, Total, Now, TTL, ChannelType, ChannelUUID, URN, ExternalID, ReceivedOn, DoneTTL]
+	local key, pendingKey, doneKey = KEYS[1], KEYS[2], KEYS[3]
+
+	-- ignore late or duplicate segments of a message which has already been completed or flushed
+	if redis.call("exists", doneKey) == 1 then
+		return {}
+	end
+
+	-- ignore duplicate deliveries of the same segment
+	if redis.call("hsetnx", key, "part:" .. ARGV[1], ARGV[2]) == 1 then
+		redis.call("hincrby", key, "received", 1)
+	end
+
+	-- the first segment we see determines the message's external ID and received on
+	redis.call("hsetnx", key, "channel_type", ARGV[6])
+	redis.call("hsetnx", key, "channel_uuid", ARGV[7])
+	redis.call("hsetnx", key, "urn", ARGV[8])
+	redis.call("hsetnx", key, "external_id", ARGV[9])
+	redis.call("hsetnx", key, "received_on", ARGV[10])
+	redis.call("hsetnx", key, "total", ARGV[3])
+
+	if tonumber(redis.call("hget", key, "received")) >= tonumber(ARGV[3]) then
+		local buffer = redis.call("hgetall", key)
+		redis.call("del", key)
+		redis.call("zrem", pendingKey, key)
+		redis.call("set", doneKey, "1", "EX", ARGV[11])
+		return buffer
+	end
+
+	redis.call("zadd", pendingKey, "NX", ARGV[4], key)
+	redis.call("expire", key, ARGV[5])
+	return {}
+`)
+
+var luaConcatTake = redis.NewScript(3, `-- KEYS: [BufferKey, PendingKey, DoneKey] ARGV: [DoneTTL]
+	local buffer = redis.call("hgetall", KEYS[1])
+	redis.call("del", KEYS[1])
+	redis.call("zrem", KEYS[2], KEYS[1])
+	if #buffer > 0 then
+		redis.call("set", KEYS[3], "1", "EX", ARGV[1])
+	end
+	return buffer
+`)
+
+// ConcatMsg is a concatenated message whose segments have been reassembled
+type ConcatMsg struct {
+	Text       string
+	ExternalID string
+	ReceivedOn time.Time
+}
+
+// ReassembleConcatMsg buffers the given segment of a concatenated message, returning the reassembled message once the
+// last segment has been received, or nil if we're still waiting on more. The external ID and received on of the
+// reassembled message are those of the first segment received. Segments which arrive within the timeout after their
+// message has been completed or flushed are ignored.
+func ReassembleConcatMsg(ctx context.Context, h courier.ChannelHandler, channel courier.Channel, urn urns.URN, part *ConcatPart, text, externalID string, receivedOn time.Time) (*ConcatMsg, error) {
+	rc := h.Server().Backend().RedisPool().Get()
+	defer rc.Close()
+
+	timeout := time.Duration(h.Server().Config().ConcatMsgTimeout) * time.Second
+	bufferKey := fmt.Sprintf(concatBufferKey, channel.UUID(), urn.Identity(), part.Ref, part.Total)
+	pendingKey := fmt.Sprintf(concatPendingKey, channel.ChannelType())
+
+	buffer, err := redis.StringMap(luaConcatAdd.Do(rc, bufferKey, pendingKey, fmt.Sprintf(concatDoneKey, bufferKey),
+		part.Seq, text, part.Total, dates.Now().Unix(), int(timeout.Seconds())*10,
+		string(channel.ChannelType()), string(channel.UUID()), string(urn), externalID, receivedOn.UTC().Format(time.RFC3339Nano),
+		int(timeout.Seconds()),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "error buffering concatenated message part")
+	}
+	if len(buffer) == 0 {
+		return nil, nil
+	}
+
+	return newConcatMsg(buffer), nil
+}
+
+// StartConcatFlusher starts a background process which writes the partial text of any concatenated messages for
+// channels of the given handler's type that haven't received all their segments within the configured timeout
+func StartConcatFlusher(h courier.ChannelHandler) {
+	s := h.Server()
+	s.WaitGroup().Add(1)
+
+	go func() {
+		defer s.WaitGroup().Done()
+
+		log := slog.With("comp", "concat", "channel_type", h.ChannelType())
+
+		for {
+			select {
+			case <-s.StopChan():
+				return
+			case <-time.After(concatFlushInterval):
+				if err := FlushConcatMsgs(context.Background(), h); err != nil {
+					log.Error("error flushing partial concatenated messages", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// FlushConcatMsgs writes the partial text of any concatenated messages for channels of the given handler's type which
+// have timed out waiting for their remaining segments
+func FlushConcatMsgs(ctx context.Context, h courier.ChannelHandler) error {
+	b := h.Server().Backend()
+	rc := b.RedisPool().Get()
+	defer rc.Close()
+
+	timeout := time.Duration(h.Server().Config().ConcatMsgTimeout) * time.Second
+	pendingKey := fmt.Sprintf(concatPendingKey, h.ChannelType())
+
+	bufferKeys, err := redis.Strings(rc.Do("ZRANGEBYSCORE", pendingKey, "-inf", dates.Now().Add(-timeout).Unix()))
+	if err != nil {
+		return errors.Wrap(err, "error looking up partial concatenated messages")
+	}
+
+	for _, bufferKey := range bufferKeys {
+		// take the buffer atomically in case another instance is also flushing
+		buffer, err := redis.StringMap(luaConcatTake.Do(rc, bufferKey, pendingKey, fmt.Sprintf(concatDoneKey, bufferKey), int(timeout.Seconds())))
+		if err != nil {
+			return errors.Wrap(err, "error taking partial concatenated message")
+		}
+		if len(buffer) == 0 {
+			continue
+		}
+
+		if err := writeConcatMsg(ctx, b, h, buffer); err != nil {
+			slog.Error("error writing partial concatenated message", "error", err, "buffer", bufferKey)
+		}
+	}
+
+	return nil
+}
+
+func writeConcatMsg(ctx context.Context, b courier.Backend, h courier.ChannelHandler, buffer map[string]string) error {
+	channel, err := b.GetChannel(ctx, courier.ChannelType(buffer["channel_type"]), courier.ChannelUUID(buffer["channel_uuid"]))
+	if err != nil {
+		return errors.Wrap(err, "error looking up channel")
+	}
+
+	cm := newConcatMsg(buffer)
+	clog := courier.NewChannelLog(courier.ChannelLogTypeMsgReceive, channel, h.RedactValues(channel))
+	msg := b.NewIncomingMsg(channel, urns.URN(buffer["urn"]), cm.Text, cm.ExternalID, clog).WithReceivedOn(cm.ReceivedOn)
+
+	err = b.WriteMsg(ctx, msg, clog)
+	if err != nil {
+		clog.RawError(err)
+	}
+
+	clog.End()
+	if err := b.WriteChannelLog(ctx, clog); err != nil {
+		slog.Error("error writing channel log", "error", err)
+	}
+
+	return err
+}
+
+// creates a message from a buffer, joining the text of the segments in order and skipping any that are missing
+func newConcatMsg(buffer map[string]string) *ConcatMsg {
+	total, _ := strconv.Atoi(buffer["total"])
+
+	text := &strings.Builder{}
+	for i := 1; i <= total; i++ {
+		text.WriteString(buffer[fmt.Sprintf("part:%d", i)])
+	}
+
+	receivedOn, err := time.Parse(time.RFC3339Nano, buffer["received_on"])
+	if err != nil {
+		receivedOn = dates.Now()
+	}
+
+	return &ConcatMsg{Text: text.String(), ExternalID: buffer["external_id"], ReceivedOn: receivedOn}
+}
@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/handlers"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type concatTestHandler struct {
+	handlers.BaseHandler
+}
+
+func (h *concatTestHandler) Initialize(s courier.Server) error { return nil }
+
+func (h *concatTestHandler) Send(context.Context, courier.MsgOut, *courier.SendResult, *courier.ChannelLog) error {
+	return nil
+}
+
+func TestParseUDH(t *testing.T) {
+	tcs := []struct {
+		udh  string
+		part *handlers.ConcatPart
+	}{
+		{"050003CC0201", &handlers.ConcatPart{Ref: 204, Total: 2, Seq: 1}},
+		{"050003cc0202", &handlers.ConcatPart{Ref: 204, Total: 2, Seq: 2}},
+		{"06080412340302", &handlers.ConcatPart{Ref: 4660, Total: 3, Seq: 2}},
+		{"\x05\x00\x03\x2a\x03\x03", &handlers.ConcatPart{Ref: 42, Total: 3, Seq: 3}},
+		{"0B0504158200000003CC0201", &handlers.ConcatPart{Ref: 204, Total: 2, Seq: 1}}, // port addressing element first
+		{"", nil},
+		{"050003CC02", nil},   // length mismatch
+		{"050003CC0203", nil}, // sequence greater than total
+		{"050003CC0100", nil}, // single part
+		{"0605041582000", nil},
+		{"06050415820000", nil}, // port addressing only
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.part, handlers.ParseUDH(tc.udh), "part mismatch for udh %q", tc.udh)
+	}
+}
+
+func TestConcatMsgs(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	ch := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "KN", "2020", "US", nil)
+	mb.AddChannel(ch)
+
+	h := &concatTestHandler{handlers.NewBaseHandler("KN", "Kannel")}
+	h.SetServer(test.NewMockServer(courier.NewDefaultConfig(), mb))
+
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+
+	urn := urns.URN("tel:+12065551212")
+	receivedOn := time.Date(2024, 5, 1, 11, 59, 58, 0, time.UTC)
+
+	// segments can arrive out of order, and be delivered more than once
+	cm, err := handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 12, Total: 3, Seq: 2}, "lo wo", "ext2", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 12, Total: 3, Seq: 2}, "lo wo", "ext2", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+
+	// a segment of a different message from the same sender doesn't interfere
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 13, Total: 2, Seq: 1}, "Other ", "ext4", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 12, Total: 3, Seq: 1}, "Hel", "ext1", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 12, Total: 3, Seq: 3}, "rld", "ext3", receivedOn.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, &handlers.ConcatMsg{Text: "Hello world", ExternalID: "ext2", ReceivedOn: receivedOn}, cm)
+
+	// nothing to flush until the timeout has passed
+	assert.NoError(t, handlers.FlushConcatMsgs(ctx, h))
+	assert.Len(t, mb.WrittenMsgs(), 0)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2024, 5, 1, 12, 1, 1, 0, time.UTC)))
+
+	assert.NoError(t, handlers.FlushConcatMsgs(ctx, h))
+	require.Len(t, mb.WrittenMsgs(), 1)
+	assert.Equal(t, "Other ", mb.WrittenMsgs()[0].Text())
+	assert.Equal(t, urn, mb.WrittenMsgs()[0].URN())
+	assert.Equal(t, "ext4", mb.WrittenMsgs()[0].ExternalID())
+	assert.Equal(t, receivedOn, *mb.WrittenMsgs()[0].ReceivedOn())
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	assert.Equal(t, courier.ChannelLogTypeMsgReceive, mb.WrittenChannelLogs()[0].Type())
+
+	// and only flushed once
+	assert.NoError(t, handlers.FlushConcatMsgs(ctx, h))
+	assert.Len(t, mb.WrittenMsgs(), 1)
+
+	// a late segment of a flushed message is ignored
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 13, Total: 2, Seq: 2}, "message", "ext5", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+
+	// as is a duplicate of a segment of a completed message
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 12, Total: 3, Seq: 3}, "rld", "ext3", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+
+	// neither starts a new buffer which would later be flushed
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2024, 5, 1, 12, 2, 2, 0, time.UTC)))
+
+	assert.NoError(t, handlers.FlushConcatMsgs(ctx, h))
+	assert.Len(t, mb.WrittenMsgs(), 1)
+
+	// once the marker has expired, the reference can be reused by a new message
+	rc := mb.RedisPool().Get()
+	defer rc.Close()
+	_, err = rc.Do("DEL", "concat:8eb23e93-5ecb-45ba-b726-3b064e0c56ab:tel:+12065551212:12:3:done")
+	require.NoError(t, err)
+
+	cm, err = handlers.ReassembleConcatMsg(ctx, h, ch, urn, &handlers.ConcatPart{Ref: 12, Total: 3, Seq: 1}, "New", "ext6", receivedOn)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+}
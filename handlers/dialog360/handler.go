@@ -144,6 +144,8 @@ func (h *handler) processWhatsAppPayload(ctx context.Context, channel courier.Ch
 
 				text := ""
 				mediaURL := ""
+				var location *courier.MsgLocation
+				vcards := make([]string, 0)
 
 				if msg.Type == "text" {
 					text = msg.Text.Body
@@ -165,7 +167,15 @@ func (h *handler) processWhatsAppPayload(ctx context.Context, channel courier.Ch
 					text = msg.Video.Caption
 					mediaURL, err = h.resolveMediaURL(channel, msg.Video.ID, clog)
 				} else if msg.Type == "location" && msg.Location != nil {
-					mediaURL = fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude)
+					location = &courier.MsgLocation{Latitude: msg.Location.Latitude, Longitude: msg.Location.Longitude, Name: msg.Location.Name, Address: msg.Location.Address}
+				} else if msg.Type == "contacts" && len(msg.Contacts) > 0 {
+					for _, contact := range msg.Contacts {
+						vcard, err := handlers.SaveVCard(ctx, h.Backend(), channel, contact.VCard())
+						if err != nil {
+							return nil, nil, err
+						}
+						vcards = append(vcards, vcard)
+					}
 				} else if msg.Type == "interactive" && msg.Interactive.Type == "button_reply" {
 					text = msg.Interactive.ButtonReply.Title
 				} else if msg.Type == "interactive" && msg.Interactive.Type == "list_reply" {
@@ -187,6 +197,17 @@ func (h *handler) processWhatsAppPayload(ctx context.Context, channel courier.Ch
 				if mediaURL != "" {
 					event.WithAttachment(mediaURL)
 				}
+				if location != nil {
+					handlers.AddLocation(event, location.Latitude, location.Longitude, location.Name, location.Address)
+				}
+				for _, vcard := range vcards {
+					event.WithAttachment(vcard)
+				}
+
+				// this is a reply to a previous message
+				if msg.Context != nil && msg.Context.ID != "" {
+					event.WithReplyTo(msg.Context.ID)
+				}
 
 				err = h.Backend().WriteMsg(ctx, event, clog)
 				if err != nil {
@@ -301,6 +322,35 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 	conn := h.Backend().RedisPool().Get()
 	defer conn.Close()
 
+	// locations are sent as their own native location messages ahead of any media
+	locations, attachments := handlers.SplitGeoAttachments(msg.Attachments())
+	for _, loc := range locations {
+		payload := whatsapp.SendRequest{MessagingProduct: "whatsapp", RecipientType: "individual", To: msg.URN().Path(), Type: "location", Location: &whatsapp.Location{Latitude: loc.Latitude, Longitude: loc.Longitude}}
+		err := h.requestD3C(payload, accessToken, res, sendURL, clog)
+		if err != nil {
+			return err
+		}
+	}
+
+	// contact cards are sent as native contacts messages, also ahead of any media
+	vcards, attachments := handlers.SplitVCardAttachments(attachments)
+	cards, err := handlers.ResolveAttachments(ctx, h.Backend(), h.Server().Config(), vcards, whatsapp.ContactMediaSupport, true, clog)
+	if err != nil {
+		return errors.Wrap(err, "error resolving attachments")
+	}
+	for _, card := range cards {
+		vcard, err := h.FetchVCard(ctx, card.URL, clog)
+		if err != nil {
+			return err
+		}
+
+		payload := whatsapp.SendRequest{MessagingProduct: "whatsapp", RecipientType: "individual", To: msg.URN().Path(), Type: "contacts", Contacts: []*whatsapp.Contact{whatsapp.GetContactPayload(vcard)}}
+		err = h.requestD3C(payload, accessToken, res, sendURL, clog)
+		if err != nil {
+			return err
+		}
+	}
+
 	hasCaption := false
 
 	msgParts := make([]string, 0)
@@ -312,10 +362,10 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 
 	var payloadAudio whatsapp.SendRequest
 
-	for i := 0; i < len(msgParts)+len(msg.Attachments()); i++ {
+	for i := 0; i < len(msgParts)+len(attachments); i++ {
 		payload := whatsapp.SendRequest{MessagingProduct: "whatsapp", RecipientType: "individual", To: msg.URN().Path()}
 
-		if len(msg.Attachments()) == 0 {
+		if len(attachments) == 0 {
 			// do we have a template?
 			templating, err := whatsapp.GetTemplating(msg)
 			if err != nil {
@@ -325,14 +375,14 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 				payload.Type = "template"
 				payload.Template = whatsapp.GetTemplatePayload(templating)
 			} else {
-				if i < (len(msgParts) + len(msg.Attachments()) - 1) {
+				if i < (len(msgParts) + len(attachments) - 1) {
 					// this is still a msg part
 					text := &whatsapp.Text{PreviewURL: false}
 					payload.Type = "text"
-					if strings.Contains(msgParts[i-len(msg.Attachments())], "https://") || strings.Contains(msgParts[i-len(msg.Attachments())], "http://") {
+					if strings.Contains(msgParts[i-len(attachments)], "https://") || strings.Contains(msgParts[i-len(attachments)], "http://") {
 						text.PreviewURL = true
 					}
-					text.Body = msgParts[i-len(msg.Attachments())]
+					text.Body = msgParts[i-len(attachments)]
 					payload.Text = text
 				} else {
 					if len(qrs) > 0 {
@@ -348,7 +398,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 						if len(qrs) <= 3 {
 							interactive := whatsapp.Interactive{Type: "button", Body: struct {
 								Text string "json:\"text\""
-							}{Text: msgParts[i-len(msg.Attachments())]}}
+							}{Text: msgParts[i-len(attachments)]}}
 
 							btns := make([]whatsapp.Button, len(qrs))
 							for i, qr := range qrs {
@@ -367,7 +417,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 						} else {
 							interactive := whatsapp.Interactive{Type: "list", Body: struct {
 								Text string "json:\"text\""
-							}{Text: msgParts[i-len(msg.Attachments())]}}
+							}{Text: msgParts[i-len(attachments)]}}
 
 							section := whatsapp.Section{
 								Rows: make([]whatsapp.SectionRow, len(qrs)),
@@ -393,17 +443,17 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 						// this is still a msg part
 						text := &whatsapp.Text{PreviewURL: false}
 						payload.Type = "text"
-						if strings.Contains(msgParts[i-len(msg.Attachments())], "https://") || strings.Contains(msgParts[i-len(msg.Attachments())], "http://") {
+						if strings.Contains(msgParts[i-len(attachments)], "https://") || strings.Contains(msgParts[i-len(attachments)], "http://") {
 							text.PreviewURL = true
 						}
-						text.Body = msgParts[i-len(msg.Attachments())]
+						text.Body = msgParts[i-len(attachments)]
 						payload.Text = text
 					}
 				}
 			}
 
-		} else if i < len(msg.Attachments()) && (len(qrs) == 0 || len(qrs) > 3) {
-			attType, attURL := handlers.SplitAttachment(msg.Attachments()[i])
+		} else if i < len(attachments) && (len(qrs) == 0 || len(qrs) > 3) {
+			attType, attURL := handlers.SplitAttachment(attachments[i])
 			attType = strings.Split(attType, "/")[0]
 			if attType == "application" {
 				attType = "document"
@@ -411,7 +461,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 			payload.Type = attType
 			media := whatsapp.Media{Link: attURL}
 
-			if len(msgParts) == 1 && attType != "audio" && len(msg.Attachments()) == 1 && len(msg.QuickReplies()) == 0 {
+			if len(msgParts) == 1 && attType != "audio" && len(attachments) == 1 && len(msg.QuickReplies()) == 0 {
 				media.Caption = msgParts[i]
 				hasCaption = true
 			}
@@ -447,9 +497,9 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 						Text string "json:\"text\""
 					}{Text: msgParts[i]}}
 
-					if len(msg.Attachments()) > 0 {
+					if len(attachments) > 0 {
 						hasCaption = true
-						attType, attURL := handlers.SplitAttachment(msg.Attachments()[i])
+						attType, attURL := handlers.SplitAttachment(attachments[i])
 						attType = strings.Split(attType, "/")[0]
 						if attType == "application" {
 							attType = "document"
@@ -522,7 +572,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 				} else {
 					interactive := whatsapp.Interactive{Type: "list", Body: struct {
 						Text string "json:\"text\""
-					}{Text: msgParts[i-len(msg.Attachments())]}}
+					}{Text: msgParts[i-len(attachments)]}}
 
 					section := whatsapp.Section{
 						Rows: make([]whatsapp.SectionRow, len(qrs)),
@@ -548,10 +598,10 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 				// this is still a msg part
 				text := &whatsapp.Text{PreviewURL: false}
 				payload.Type = "text"
-				if strings.Contains(msgParts[i-len(msg.Attachments())], "https://") || strings.Contains(msgParts[i-len(msg.Attachments())], "http://") {
+				if strings.Contains(msgParts[i-len(attachments)], "https://") || strings.Contains(msgParts[i-len(attachments)], "http://") {
 					text.PreviewURL = true
 				}
-				text.Body = msgParts[i-len(msg.Attachments())]
+				text.Body = msgParts[i-len(attachments)]
 				payload.Text = text
 			}
 		}
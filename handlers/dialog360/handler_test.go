@@ -85,6 +85,7 @@ var testCasesD3C = []IncomingTestCase{
 		ExpectedMsgText:       Sp("No"),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
+		ExpectedReplyTo:       "gBGGFmkiWVVPAgkgQkwi7IORac0",
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 	},
 	{
@@ -151,6 +152,19 @@ var testCasesD3C = []IncomingTestCase{
 		ExpectedBodyContains: `"type":"msg"`,
 		ExpectedMsgText:      Sp(""),
 		ExpectedAttachments:  []string{"geo:0.000000,1.000000"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: 0, Longitude: 1, Name: "Main Street Beach", Address: "Main Street Beach, Santa Cruz, CA"},
+		ExpectedURN:          "whatsapp:5678",
+		ExpectedExternalID:   "external_id",
+		ExpectedDate:         time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
+	},
+	{
+		Label:                "Receive Valid Contacts Message",
+		URL:                  d3CReceiveURL,
+		Data:                 string(test.ReadFile("../meta/testdata/wac/contacts.json")),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: `"type":"msg"`,
+		ExpectedMsgText:      Sp(""),
+		ExpectedAttachments:  []string{"text/vcard:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.vcf", "text/vcard:https://backend.com/attachments/547deaf7-7620-4434-95b3-58675999c4b7.vcf"},
 		ExpectedURN:          "whatsapp:5678",
 		ExpectedExternalID:   "external_id",
 		ExpectedDate:         time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
@@ -349,6 +363,44 @@ var SendTestCasesD3C = []OutgoingTestCase{
 		},
 		ExpectedExtIDs: []string{"157b5e14568e8"},
 	},
+	{
+		Label:          "Contact Send",
+		MsgText:        "here's bob",
+		MsgURN:         "whatsapp:250788123123",
+		MsgAttachments: []string{"text/vcard:https://foo.bar/bob.vcf"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://foo.bar/bob.vcf": {
+				httpx.NewMockResponse(200, nil, []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;Bob;;;\r\nFN:Bob Smith\r\nTEL;TYPE=CELL:+250788123123\r\nEND:VCARD\r\n")),
+			},
+			"*/messages": {
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e8"}] }`)),
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e9"}] }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Body: ""},
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"contacts","contacts":[{"name":{"formatted_name":"Bob Smith","first_name":"Bob","last_name":"Smith"},"phones":[{"phone":"+250788123123","type":"CELL"}]}]}`},
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"text","text":{"body":"here's bob","preview_url":false}}`},
+		},
+		ExpectedExtIDs: []string{"157b5e14568e8", "157b5e14568e9"},
+	},
+	{
+		Label:          "Location Send",
+		MsgText:        "meet here",
+		MsgURN:         "whatsapp:250788123123",
+		MsgAttachments: []string{"geo:-1.950000,30.058000"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/messages": {
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e8"}] }`)),
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e9"}] }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"location","location":{"latitude":-1.95,"longitude":30.058}}`},
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"text","text":{"body":"meet here","preview_url":false}}`},
+		},
+		ExpectedExtIDs: []string{"157b5e14568e8", "157b5e14568e9"},
+	},
 	{
 		Label:          "Audio Send",
 		MsgText:        "audio caption",
@@ -31,6 +31,7 @@ const (
 	configMOFromField = "mo_from_field"
 	configMOTextField = "mo_text_field"
 	configMODateField = "mo_date_field"
+	configMOUDHField  = "mo_udh_field"
 
 	configMOResponseContentType = "mo_response_content_type"
 	configMOResponse            = "mo_response"
@@ -44,6 +45,7 @@ const (
 var defaultFromFields = []string{"from", "sender"}
 var defaultTextFields = []string{"text"}
 var defaultDateFields = []string{"date", "time"}
+var defaultUDHFields = []string{"udh"}
 
 var contentTypeMappings = map[string]string{
 	contentURLEncoded: "application/x-www-form-urlencoded",
@@ -84,6 +86,7 @@ func (h *handler) Initialize(s courier.Server) error {
 	s.AddHandlerRoute(h, http.MethodPost, "stopped", courier.ChannelLogTypeEventReceive, h.receiveStopContact)
 	s.AddHandlerRoute(h, http.MethodGet, "stopped", courier.ChannelLogTypeEventReceive, h.receiveStopContact)
 
+	handlers.StartConcatFlusher(h)
 	return nil
 }
 
@@ -143,7 +146,7 @@ func getFormField(form url.Values, defaultNames []string, name string) string {
 func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w http.ResponseWriter, r *http.Request, clog *courier.ChannelLog) ([]courier.Event, error) {
 	var err error
 
-	var from, dateString, text string
+	var from, dateString, text, udh string
 
 	fromXPath := channel.StringConfigForKey(configFromXPath, "")
 	textXPath := channel.StringConfigForKey(configTextXPath, "")
@@ -184,6 +187,7 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 		from = getFormField(r.Form, defaultFromFields, channel.StringConfigForKey(configMOFromField, ""))
 		text = getFormField(r.Form, defaultTextFields, channel.StringConfigForKey(configMOTextField, ""))
 		dateString = getFormField(r.Form, defaultDateFields, channel.StringConfigForKey(configMODateField, ""))
+		udh = getFormField(r.Form, defaultUDHFields, channel.StringConfigForKey(configMOUDHField, ""))
 	}
 
 	// must have from field
@@ -212,8 +216,21 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 	}
 	urn = urn.Normalize(channel.Country())
 
+	// segments of a concatenated message are buffered until we have them all
+	externalID := ""
+	if part := handlers.ParseUDH(udh); part != nil {
+		cm, err := handlers.ReassembleConcatMsg(ctx, h, channel, urn, part, text, externalID, date)
+		if err != nil {
+			return nil, err
+		}
+		if cm == nil {
+			return nil, handlers.WriteAndLogRequestIgnored(ctx, h, channel, w, r, fmt.Sprintf("buffered part %d of %d of concatenated message", part.Seq, part.Total))
+		}
+		text, externalID, date = cm.Text, cm.ExternalID, cm.ReceivedOn
+	}
+
 	// build our msg
-	msg := h.Backend().NewIncomingMsg(channel, urn, text, "", clog).WithReceivedOn(date)
+	msg := h.Backend().NewIncomingMsg(channel, urn, text, externalID, clog).WithReceivedOn(date)
 
 	// and finally write our message
 	return handlers.WriteMsgsAndResponse(ctx, h, []courier.MsgIn{msg}, w, r, clog)
@@ -52,6 +52,22 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedMsgText:      Sp("Join"),
 		ExpectedURN:          "tel:+2349067554729",
 	},
+	{
+		Label:                "Receive Concatenated Message Part 1",
+		URL:                  receiveURL,
+		Data:                 "sender=%2B2349067554729&text=Hello+&udh=050003CC0201",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "buffered part 1 of 2 of concatenated message",
+	},
+	{
+		Label:                "Receive Concatenated Message Part 2",
+		URL:                  receiveURL,
+		Data:                 "sender=%2B2349067554729&text=World&udh=050003CC0202",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedMsgText:      Sp("Hello World"),
+		ExpectedURN:          "tel:+2349067554729",
+	},
 	{
 		Label:                "Receive Valid From",
 		URL:                  receiveURL + "?from=%2B2349067554729&text=Join",
@@ -243,6 +259,7 @@ var customChannels = []courier.Channel{
 			configMOFromField: "from_number",
 			configMODateField: "timestamp",
 			configMOTextField: "messageText",
+			configMOUDHField:  "header",
 		},
 	),
 }
@@ -258,6 +275,23 @@ var customTestCases = []IncomingTestCase{
 		ExpectedURN:          "tel:+12067799192",
 		ExpectedDate:         time.Date(2017, 6, 23, 12, 30, 0, 0, time.UTC),
 	},
+	{
+		Label:                "Receive Custom Concatenated Message Part 1",
+		URL:                  "/c/ex/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/receive/?from_number=12067799192&messageText=Hello+&timestamp=2017-06-23T12:30:00Z&header=050003CC0201",
+		Data:                 "empty",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "buffered part 1 of 2 of concatenated message",
+	},
+	{
+		Label:                "Receive Custom Concatenated Message Part 2",
+		URL:                  "/c/ex/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/receive/?from_number=12067799192&messageText=World&timestamp=2017-06-23T12:30:05Z&header=050003CC0202",
+		Data:                 "empty",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedMsgText:      Sp("Hello World"),
+		ExpectedURN:          "tel:+12067799192",
+		ExpectedDate:         time.Date(2017, 6, 23, 12, 30, 0, 0, time.UTC),
+	},
 	{
 		Label:                "Receive Custom Missing",
 		URL:                  "/c/ex/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/receive/?sent_from=12067799192&messageText=Join",
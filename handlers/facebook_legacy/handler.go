@@ -193,6 +193,7 @@ type moPayload struct {
 				StickerID   int64  `json:"sticker_id"`
 				Attachments []struct {
 					Type    string `json:"type"`
+					Title   string `json:"title"`
 					Payload *struct {
 						URL         string `json:"url"`
 						StickerID   int64  `json:"sticker_id"`
@@ -360,6 +361,7 @@ func (h *handler) receiveEvents(ctx context.Context, channel courier.Channel, w
 			text := msg.Message.Text
 
 			attachmentURLs := make([]string, 0, 2)
+			locations := make([]*courier.MsgLocation, 0)
 
 			// loop on our attachments
 			for _, att := range msg.Message.Attachments {
@@ -368,8 +370,8 @@ func (h *handler) receiveEvents(ctx context.Context, channel courier.Channel, w
 					text = stickerIDToEmoji[att.Payload.StickerID]
 				}
 
-				if att.Type == "location" {
-					attachmentURLs = append(attachmentURLs, fmt.Sprintf("geo:%f,%f", att.Payload.Coordinates.Lat, att.Payload.Coordinates.Long))
+				if att.Type == "location" && att.Payload != nil && att.Payload.Coordinates != nil {
+					locations = append(locations, &courier.MsgLocation{Latitude: att.Payload.Coordinates.Lat, Longitude: att.Payload.Coordinates.Long, Name: att.Title})
 				}
 
 				if att.Payload != nil && att.Payload.URL != "" {
@@ -391,6 +393,9 @@ func (h *handler) receiveEvents(ctx context.Context, channel courier.Channel, w
 			for _, attURL := range attachmentURLs {
 				event.WithAttachment(attURL)
 			}
+			for _, loc := range locations {
+				handlers.AddLocation(event, loc.Latitude, loc.Longitude, loc.Name, loc.Address)
+			}
 
 			err := h.Backend().WriteMsg(ctx, event, clog)
 			if err != nil {
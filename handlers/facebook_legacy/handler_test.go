@@ -462,6 +462,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Handled",
 		ExpectedMsgText:      Sp(""),
 		ExpectedAttachments:  []string{"geo:1.200000,-1.300000"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: 1.2, Longitude: -1.3},
 		ExpectedURN:          "facebook:5678",
 		ExpectedExternalID:   "external_id",
 		ExpectedDate:         time.Date(2016, 4, 7, 1, 11, 27, 970000000, time.UTC),
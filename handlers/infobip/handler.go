@@ -13,6 +13,7 @@ import (
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/handlers"
 	"github.com/nyaruka/gocommon/httpx"
+	"github.com/shopspring/decimal"
 )
 
 var sendURL = "https://api.infobip.com/sms/1/text/advanced"
@@ -55,6 +56,11 @@ type ibStatus struct {
 	Status    struct {
 		GroupName string `validate:"required" json:"groupName"`
 	} `validate:"required" json:"status"`
+	SMSCount int `json:"smsCount"`
+	Price    struct {
+		PricePerMessage decimal.Decimal `json:"pricePerMessage"`
+		Currency        string          `json:"currency"`
+	} `json:"price"`
 }
 
 // statusMessage is our HTTP handler function for status updates
@@ -69,6 +75,15 @@ func (h *handler) statusMessage(ctx context.Context, channel courier.Channel, w
 
 		// write our status
 		status := h.Backend().NewStatusUpdateByExternalID(channel, s.MessageID, msgStatus, clog)
+
+		// reports include how many segments were sent and the price of each
+		if s.SMSCount > 0 {
+			status.SetSegments(s.SMSCount)
+			if s.Price.Currency != "" {
+				status.SetCost(s.Price.PricePerMessage.Mul(decimal.NewFromInt(int64(s.SMSCount))), s.Price.Currency)
+			}
+		}
+
 		err := h.Backend().WriteStatusUpdate(ctx, status)
 		if err != nil {
 			return nil, err
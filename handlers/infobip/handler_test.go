@@ -131,6 +131,22 @@ var validStatusDelivered = `{
 	]
 }`
 
+var validStatusDeliveredWithPrice = `{
+	"results": [
+		{
+			"messageId": "12345",
+			"status": {
+				"groupName": "DELIVERED"
+			},
+			"smsCount": 2,
+			"price": {
+				"pricePerMessage": 0.01,
+				"currency": "EUR"
+			}
+		}
+	]
+}`
+
 var validStatusRejected = `{
 	"results": [
 		{
@@ -247,6 +263,14 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: `"status":"D"`,
 		ExpectedStatuses:     []ExpectedStatus{{ExternalID: "12345", Status: courier.MsgStatusDelivered}},
 	},
+	{
+		Label:                "Status delivered with price",
+		URL:                  statusURL,
+		Data:                 validStatusDeliveredWithPrice,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: `"status":"D"`,
+		ExpectedStatuses:     []ExpectedStatus{{ExternalID: "12345", Status: courier.MsgStatusDelivered, Segments: 2, Cost: "0.02 EUR"}},
+	},
 	{
 		Label:                "Status rejected",
 		URL:                  statusURL,
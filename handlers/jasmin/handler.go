@@ -33,6 +33,7 @@ func (h *handler) Initialize(s courier.Server) error {
 	h.SetServer(s)
 	s.AddHandlerRoute(h, http.MethodPost, "receive", courier.ChannelLogTypeMsgReceive, h.receiveMessage)
 	s.AddHandlerRoute(h, http.MethodPost, "status", courier.ChannelLogTypeMsgStatus, h.receiveStatus)
+	handlers.StartConcatFlusher(h)
 	return nil
 }
 
@@ -70,6 +71,7 @@ type moForm struct {
 	From    string `name:"from"     validate:"required"`
 	To      string `name:"to"       validate:"required"`
 	ID      string `name:"id"       validate:"required"`
+	UDH     string `name:"udh"`
 }
 
 // receiveMessage is our HTTP handler function for incoming messages
@@ -93,8 +95,23 @@ func (h *handler) receiveMessage(ctx context.Context, c courier.Channel, w http.
 		text = gsm7.Decode([]byte(form.Content))
 	}
 
+	date := time.Now().UTC()
+
+	// segments of a concatenated message are buffered until we have them all
+	externalID := form.ID
+	if part := handlers.ParseUDH(form.UDH); part != nil {
+		cm, err := handlers.ReassembleConcatMsg(ctx, h, c, urn, part, text, externalID, date)
+		if err != nil {
+			return nil, err
+		}
+		if cm == nil {
+			return nil, handlers.WriteAndLogRequestIgnored(ctx, h, c, w, r, fmt.Sprintf("buffered part %d of %d of concatenated message", part.Seq, part.Total))
+		}
+		text, externalID, date = cm.Text, cm.ExternalID, cm.ReceivedOn
+	}
+
 	// build our msg
-	msg := h.Backend().NewIncomingMsg(c, urn, text, form.ID, clog).WithReceivedOn(time.Now().UTC())
+	msg := h.Backend().NewIncomingMsg(c, urn, text, externalID, clog).WithReceivedOn(date)
 
 	// and finally queue our message
 	return handlers.WriteMsgsAndResponse(ctx, h, []courier.MsgIn{msg}, w, r, clog)
@@ -31,6 +31,23 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedURN:          "tel:+2349067554729",
 		ExpectedExternalID:   "1001",
 	},
+	{
+		Label:                "Receive Concatenated Message Part 1",
+		URL:                  receiveURL,
+		Data:                 "content=Hello+&coding=0&From=2349067554729&To=2349067554711&id=1002&udh=050003CC0201",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "ACK/Jasmin",
+	},
+	{
+		Label:                "Receive Concatenated Message Part 2",
+		URL:                  receiveURL,
+		Data:                 "content=World&coding=0&From=2349067554729&To=2349067554711&id=1003&udh=050003CC0202",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "ACK/Jasmin",
+		ExpectedMsgText:      Sp("Hello World"),
+		ExpectedURN:          "tel:+2349067554729",
+		ExpectedExternalID:   "1002",
+	},
 	{
 		Label:                "Receive Missing To",
 		URL:                  receiveURL,
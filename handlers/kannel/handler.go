@@ -45,6 +45,7 @@ func (h *handler) Initialize(s courier.Server) error {
 	h.SetServer(s)
 	s.AddHandlerRoute(h, http.MethodPost, "receive", courier.ChannelLogTypeMsgReceive, h.receiveMessage)
 	s.AddHandlerRoute(h, http.MethodGet, "status", courier.ChannelLogTypeMsgReceive, h.receiveStatus)
+	handlers.StartConcatFlusher(h)
 	return nil
 }
 
@@ -53,6 +54,7 @@ type moForm struct {
 	TS      int64  `validate:"required" name:"ts"`
 	Message string `name:"message"`
 	Sender  string `validate:"required" name:"sender"`
+	UDH     string `name:"udh"`
 }
 
 // receiveMessage is our HTTP handler function for incoming messages
@@ -73,8 +75,22 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 		return nil, handlers.WriteAndLogRequestError(ctx, h, channel, w, r, err)
 	}
 
+	// segments of a concatenated message are buffered until we have them all
+	text := form.Message
+	externalID := form.ID
+	if part := handlers.ParseUDH(form.UDH); part != nil {
+		cm, err := handlers.ReassembleConcatMsg(ctx, h, channel, urn, part, text, externalID, date)
+		if err != nil {
+			return nil, err
+		}
+		if cm == nil {
+			return nil, handlers.WriteAndLogRequestIgnored(ctx, h, channel, w, r, fmt.Sprintf("buffered part %d of %d of concatenated message", part.Seq, part.Total))
+		}
+		text, externalID, date = cm.Text, cm.ExternalID, cm.ReceivedOn
+	}
+
 	// build our msg
-	msg := h.Backend().NewIncomingMsg(channel, urn, form.Message, form.ID, clog).WithReceivedOn(date)
+	msg := h.Backend().NewIncomingMsg(channel, urn, text, externalID, clog).WithReceivedOn(date)
 
 	// and finally write our message
 	return handlers.WriteMsgsAndResponse(ctx, h, []courier.MsgIn{msg}, w, r, clog)
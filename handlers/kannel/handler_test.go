@@ -53,6 +53,24 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedExternalID:   "asdf-asdf",
 		ExpectedDate:         time.Date(2017, 5, 2, 14, 31, 49, 0, time.UTC),
 	},
+	{
+		Label:                "Receive Concatenated Message Part 1",
+		URL:                  "/c/kn/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/receive/?backend=NIG_MTN&sender=%2B2349067554729&message=Hello+&ts=1493735509&id=part-1&to=24453&udh=050003CC0201",
+		Data:                 "empty",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "buffered part 1 of 2 of concatenated message",
+	},
+	{
+		Label:                "Receive Concatenated Message Part 2",
+		URL:                  "/c/kn/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/receive/?backend=NIG_MTN&sender=%2B2349067554729&message=World&ts=1493735510&id=part-2&to=24453&udh=050003CC0202",
+		Data:                 "empty",
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedMsgText:      Sp("Hello World"),
+		ExpectedURN:          "tel:+2349067554729",
+		ExpectedExternalID:   "part-1",
+		ExpectedDate:         time.Date(2017, 5, 2, 14, 31, 49, 0, time.UTC),
+	},
 	{
 		Label:                "Receive No Params",
 		URL:                  "/c/kn/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/receive/",
@@ -34,7 +34,7 @@ var (
 var mediaSupport = map[handlers.MediaType]handlers.MediaTypeSupport{
 	handlers.MediaTypeImage:       {Types: []string{"image/jpeg", "image/png"}, MaxBytes: 10 * 1024 * 1024},
 	handlers.MediaTypeAudio:       {Types: []string{"audio/mp4"}, MaxBytes: 200 * 1024 * 1024},
-	handlers.MediaTypeVideo:       {Types: []string{"video/mp4"}, MaxBytes: 200 * 1024 * 1024},
+	handlers.MediaTypeVideo:       {Types: []string{"video/mp4"}, MaxBytes: 200 * 1024 * 1024, Thumbnails: true},
 	handlers.MediaTypeApplication: {},
 }
 
@@ -101,6 +101,7 @@ type moPayload struct {
 			Address         string  `json:"address"`
 			Latitude        float64 `json:"latitude"`
 			Longitude       float64 `json:"longitude"`
+			QuotedMessageID string  `json:"quotedMessageId"`
 			ContentProvider struct {
 				Type               string `json:"type"`
 				OriginalContentURL string `json:"originalContentUrl"`
@@ -125,6 +126,7 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 
 		text := ""
 		mediaURL := ""
+		var location *courier.MsgLocation
 
 		lineEventMsgType := lineEvent.Message.Type
 
@@ -139,7 +141,7 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 			}
 
 		} else if lineEventMsgType == "location" {
-			mediaURL = fmt.Sprintf("geo:%f,%f", lineEvent.Message.Latitude, lineEvent.Message.Longitude)
+			location = &courier.MsgLocation{Latitude: lineEvent.Message.Latitude, Longitude: lineEvent.Message.Longitude, Name: lineEvent.Message.Title, Address: lineEvent.Message.Address}
 			text = lineEvent.Message.Title
 		} else {
 			continue
@@ -158,6 +160,14 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 		if mediaURL != "" {
 			msg.WithAttachment(mediaURL)
 		}
+		if location != nil {
+			handlers.AddLocation(msg, location.Latitude, location.Longitude, location.Name, location.Address)
+		}
+
+		// user quoted one of our messages when replying
+		if lineEvent.Message.QuotedMessageID != "" {
+			msg.WithReplyTo(lineEvent.Message.QuotedMessageID)
+		}
 
 		msgs = append(msgs, msg)
 	}
@@ -272,6 +282,14 @@ type mtAudioMsg struct {
 	Duration int    `json:"duration"`
 }
 
+type mtLocationMsg struct {
+	Type      string  `json:"type"`
+	Title     string  `json:"title"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
 type mtPayload struct {
 	To         string          `json:"to,omitempty"`
 	ReplyToken string          `json:"replyToken,omitempty"`
@@ -279,7 +297,11 @@ type mtPayload struct {
 }
 
 type mtResponse struct {
-	Message string `json:"message"`
+	Message      string `json:"message"`
+	SentMessages []struct {
+		ID         string `json:"id"`
+		QuoteToken string `json:"quoteToken"`
+	} `json:"sentMessages"`
 }
 
 func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
@@ -293,7 +315,10 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 	parts := handlers.SplitMsgByChannel(msg.Channel(), msg.Text(), maxMsgLength)
 	qrs := msg.QuickReplies()
 
-	attachments, err := handlers.ResolveAttachments(ctx, h.Backend(), msg.Attachments(), mediaSupport, false, clog)
+	// locations are sent natively so don't need resolving as media
+	locations, others := handlers.SplitGeoAttachments(msg.Attachments())
+
+	attachments, err := handlers.ResolveAttachments(ctx, h.Backend(), h.Server().Config(), others, mediaSupport, false, clog)
 	if err != nil {
 		return errors.Wrap(err, "error resolving attachments")
 	}
@@ -306,11 +331,11 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 
 		switch attachment.Type {
 		case handlers.MediaTypeImage:
-			jsonMsg, err = json.Marshal(mtImageMsg{Type: "image", URL: attachment.Media.URL(), PreviewURL: attachment.Media.URL()})
+			jsonMsg, err = json.Marshal(mtImageMsg{Type: "image", URL: attachment.URL, PreviewURL: attachment.URL})
 		case handlers.MediaTypeVideo:
-			jsonMsg, err = json.Marshal(mtVideoMsg{Type: "video", URL: attachment.Media.URL(), PreviewURL: attachment.Thumbnail.URL()})
+			jsonMsg, err = json.Marshal(mtVideoMsg{Type: "video", URL: attachment.URL, PreviewURL: attachment.ThumbnailURL})
 		case handlers.MediaTypeAudio:
-			jsonMsg, err = json.Marshal(mtAudioMsg{Type: "audio", URL: attachment.Media.URL(), Duration: attachment.Media.Duration()})
+			jsonMsg, err = json.Marshal(mtAudioMsg{Type: "audio", URL: attachment.URL, Duration: attachment.Media.Duration()})
 		default:
 			jsonMsg, err = json.Marshal(mtTextMsg{Type: "text", Text: attachment.URL})
 		}
@@ -322,6 +347,15 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 		}
 	}
 
+	// locations require a title and address so we use the coordinates as the address
+	for _, loc := range locations {
+		jsonMsg, err := json.Marshal(mtLocationMsg{Type: "location", Title: "Location", Address: fmt.Sprintf("%f,%f", loc.Latitude, loc.Longitude), Latitude: loc.Latitude, Longitude: loc.Longitude})
+		if err != nil {
+			return err
+		}
+		jsonMsgs = append(jsonMsgs, string(jsonMsg))
+	}
+
 	// fill all msg parts with text parts
 	for i, part := range parts {
 		if i < (len(parts) - 1) {
@@ -363,6 +397,8 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 			resp, respBody, err := h.RequestHTTP(req, clog)
 
 			if err == nil && resp.StatusCode/100 == 2 {
+				addSentMessageIDs(respBody, res)
+
 				batch = []string{}
 				batchCount = 0
 				continue
@@ -392,6 +428,8 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 				if resp.StatusCode/100 != 2 {
 					return courier.ErrFailedWithReason(strconv.Itoa(resp.StatusCode), respPayload.Message)
 				}
+
+				addSentMessageIDs(respBody, res)
 			} else {
 				return courier.ErrFailedWithReason(strconv.Itoa(resp.StatusCode), respPayload.Message)
 			}
@@ -401,6 +439,18 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 	return nil
 }
 
+// addSentMessageIDs records the ids of sent messages as external ids so that replies quoting them can be matched
+func addSentMessageIDs(respBody []byte, res *courier.SendResult) {
+	respPayload := &mtResponse{}
+	if err := json.Unmarshal(respBody, respPayload); err == nil {
+		for _, sent := range respPayload.SentMessages {
+			if sent.ID != "" {
+				res.AddExternalID(sent.ID)
+			}
+		}
+	}
+}
+
 func buildSendMsgRequest(authToken, to string, replyToken string, jsonMsgs []string) (*http.Request, error) {
 	// convert from string slice to bytes JSON
 	rawJsonMsgs := bytes.Buffer{}
@@ -49,6 +49,26 @@ var receiveValidMessage = `
 	}]
 }`
 
+var receiveQuotingMessage = `
+{
+	"events": [{
+		"replyToken": "abcdefghij",
+		"type": "message",
+		"timestamp": 1459991487970,
+		"source": {
+			"type": "user",
+			"userId": "uabcdefghij"
+		},
+		"message": {
+			"id": "100003",
+			"type": "text",
+			"text": "Yes please",
+			"quoteToken": "q3Plxr4AgKd...",
+			"quotedMessageId": "468789577898262530"
+		}
+	}]
+}`
+
 var invalidURN = `
 {
 	"events": [{
@@ -279,6 +299,17 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedDate:         time.Date(2016, 4, 7, 1, 11, 27, 970000000, time.UTC),
 		PrepRequest:          addValidSignature,
 	},
+	{
+		Label:                "Receive Quoting Message",
+		URL:                  receiveURL,
+		Data:                 receiveQuotingMessage,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedMsgText:      Sp("Yes please"),
+		ExpectedURN:          "line:uabcdefghij",
+		ExpectedReplyTo:      "468789577898262530",
+		PrepRequest:          addValidSignature,
+	},
 	{
 		Label:                "Receive Valid Image Message",
 		URL:                  receiveURL,
@@ -335,6 +366,7 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedMsgText:      Sp("my location"),
 		ExpectedAttachments:  []string{"geo:35.687574,139.729220"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: 35.687574, Longitude: 139.72922, Name: "my location", Address: "Japan, 〒160-0004 Tokyo, Shinjuku City, Yotsuya, 1-chōme-6-1"},
 		ExpectedURN:          "line:uabcdefghij",
 		ExpectedDate:         time.Date(2016, 4, 7, 1, 11, 27, 970000000, time.UTC),
 		PrepRequest:          addValidSignature,
@@ -456,6 +488,20 @@ var defaultSendTestCases = []OutgoingTestCase{
 			},
 		},
 	},
+	{
+		Label:          "Send Location",
+		MsgText:        "I'm here!",
+		MsgURN:         "line:uabcdefghij",
+		MsgAttachments: []string{"geo:-1.950000,30.058000"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://api.line.me/v2/bot/message/push": {httpx.NewMockResponse(200, nil, []byte(`{}`))},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{
+				Body: `{"to":"uabcdefghij","messages":[{"type":"location","title":"Location","address":"-1.950000,30.058000","latitude":-1.95,"longitude":30.058},{"type":"text","text":"I'm here!"}]}`,
+			},
+		},
+	},
 	{
 		Label:          "Send Other Attachment",
 		MsgText:        "My doc!",
@@ -476,13 +522,14 @@ var defaultSendTestCases = []OutgoingTestCase{
 		MsgURN:                  "line:uabcdefghij",
 		MsgResponseToExternalID: "nHuyWiB7yP5Zw52FIkcQobQuGDXCTA",
 		MockResponses: map[string][]*httpx.MockResponse{
-			"https://api.line.me/v2/bot/message/reply": {httpx.NewMockResponse(200, nil, []byte(`{}`))},
+			"https://api.line.me/v2/bot/message/reply": {httpx.NewMockResponse(200, nil, []byte(`{"sentMessages":[{"id":"468789577898262530","quoteToken":"q3Plxr4AgKd..."}]}`))},
 		},
 		ExpectedRequests: []ExpectedRequest{
 			{
 				Body: `{"replyToken":"nHuyWiB7yP5Zw52FIkcQobQuGDXCTA","messages":[{"type":"text","text":"Simple Message"}]}`,
 			},
 		},
+		ExpectedExtIDs: []string{"468789577898262530"},
 	},
 	{
 		Label:           "Quick Reply",
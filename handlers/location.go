@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/courier"
+)
+
+// GeoAttachment returns the normalized geo: attachment for the given coordinates
+func GeoAttachment(lat, lng float64) string {
+	return fmt.Sprintf("geo:%f,%f", lat, lng)
+}
+
+// AddLocation adds a location shared by a contact to the passed in incoming message, as a geo: attachment and with its
+// name and address if the channel provided them
+func AddLocation(msg courier.MsgIn, lat, lng float64, name, address string) courier.MsgIn {
+	return msg.WithAttachment(GeoAttachment(lat, lng)).WithLocation(&courier.MsgLocation{
+		Latitude:  lat,
+		Longitude: lng,
+		Name:      strings.TrimSpace(name),
+		Address:   strings.TrimSpace(address),
+	})
+}
+
+// ParseGeoAttachment parses a geo:lat,lng attachment into a location, returning false if it isn't one
+func ParseGeoAttachment(attachment string) (*courier.MsgLocation, bool) {
+	coords, isGeo := strings.CutPrefix(attachment, "geo:")
+	if !isGeo {
+		return nil, false
+	}
+
+	parts := strings.Split(coords, ",")
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, false
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return nil, false
+	}
+
+	return &courier.MsgLocation{Latitude: lat, Longitude: lng}, true
+}
+
+// SplitGeoAttachments separates any geo: attachments in the passed in attachments, so that they can be sent as native
+// locations, from the other attachments which are left to be resolved as media
+func SplitGeoAttachments(attachments []string) ([]*courier.MsgLocation, []string) {
+	locations := make([]*courier.MsgLocation, 0)
+	others := make([]string, 0, len(attachments))
+
+	for _, a := range attachments {
+		if loc, isGeo := ParseGeoAttachment(a); isGeo {
+			locations = append(locations, loc)
+		} else {
+			others = append(others, a)
+		}
+	}
+
+	return locations, others
+}
@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/handlers"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoAttachment(t *testing.T) {
+	assert.Equal(t, "geo:-2.890287,104.631760", handlers.GeoAttachment(-2.890287, 104.63176))
+	assert.Equal(t, "geo:0.000000,0.000000", handlers.GeoAttachment(0, 0))
+}
+
+func TestAddLocation(t *testing.T) {
+	ch := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "TG", "2020", "US", nil)
+	msg := test.NewMockMsg(courier.NilMsgID, "", ch, urns.URN("telegram:12345"), "", nil)
+
+	handlers.AddLocation(msg, 1.2, -3.4, " Kigali Heights ", "KG 7 Ave")
+
+	assert.Equal(t, []string{"geo:1.200000,-3.400000"}, msg.Attachments())
+	assert.Equal(t, &courier.MsgLocation{Latitude: 1.2, Longitude: -3.4, Name: "Kigali Heights", Address: "KG 7 Ave"}, msg.Location())
+}
+
+func TestParseGeoAttachment(t *testing.T) {
+	tcs := []struct {
+		attachment string
+		location   *courier.MsgLocation
+		valid      bool
+	}{
+		{"geo:1.200000,-3.400000", &courier.MsgLocation{Latitude: 1.2, Longitude: -3.4}, true},
+		{"geo:-2.890287, 104.63176", &courier.MsgLocation{Latitude: -2.890287, Longitude: 104.63176}, true},
+		{"geo:1.2", nil, false},
+		{"geo:abc,1.2", nil, false},
+		{"geo:91,0", nil, false},
+		{"geo:0,181", nil, false},
+		{"image/jpeg:https://example.com/test.jpg", nil, false},
+	}
+
+	for _, tc := range tcs {
+		loc, valid := handlers.ParseGeoAttachment(tc.attachment)
+		assert.Equal(t, tc.valid, valid, "valid mismatch for %s", tc.attachment)
+		assert.Equal(t, tc.location, loc, "location mismatch for %s", tc.attachment)
+	}
+}
+
+func TestSplitGeoAttachments(t *testing.T) {
+	locations, others := handlers.SplitGeoAttachments([]string{"image/jpeg:https://example.com/test.jpg", "geo:1.2,-3.4", "audio/mp3:https://example.com/test.mp3"})
+	assert.Equal(t, []*courier.MsgLocation{{Latitude: 1.2, Longitude: -3.4}}, locations)
+	assert.Equal(t, []string{"image/jpeg:https://example.com/test.jpg", "audio/mp3:https://example.com/test.mp3"}, others)
+
+	locations, others = handlers.SplitGeoAttachments(nil)
+	assert.Equal(t, []*courier.MsgLocation{}, locations)
+	assert.Equal(t, []string{}, others)
+}
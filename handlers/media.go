@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"log/slog"
 	"net/url"
 	"path"
 	"strings"
@@ -17,25 +18,29 @@ const (
 	MediaTypeAudio       MediaType = "audio"
 	MediaTypeVideo       MediaType = "video"
 	MediaTypeApplication MediaType = "application"
+	MediaTypeContact     MediaType = "contact"
 )
 
 type MediaTypeSupport struct {
-	Types    []string
-	MaxBytes int
+	Types      []string
+	MaxBytes   int
+	Thumbnails bool // whether the channel uses thumbnails, and so they should be generated for media without them
 }
 
 // Attachment is a resolved attachment
 type Attachment struct {
-	Type        MediaType
-	Name        string
-	ContentType string
-	URL         string
-	Media       courier.Media
-	Thumbnail   courier.Media
+	Type         MediaType
+	Name         string
+	ContentType  string
+	URL          string
+	Media        courier.Media
+	Thumbnail    courier.Media
+	ThumbnailURL string
 }
 
-// ResolveAttachments resolves the given attachment strings (content-type:url) into attachment objects
-func ResolveAttachments(ctx context.Context, b courier.Backend, attachments []string, support map[MediaType]MediaTypeSupport, allowURLOnly bool, clog *courier.ChannelLog) ([]*Attachment, error) {
+// ResolveAttachments resolves the given attachment strings (content-type:url) into attachment objects, logging an error
+// for each that can't be resolved
+func ResolveAttachments(ctx context.Context, b courier.Backend, cfg *courier.Config, attachments []string, support map[MediaType]MediaTypeSupport, allowURLOnly bool, clog *courier.ChannelLog) ([]*Attachment, error) {
 	resolved := make([]*Attachment, 0, len(attachments))
 
 	for _, as := range attachments {
@@ -46,22 +51,26 @@ func ResolveAttachments(ctx context.Context, b courier.Backend, attachments []st
 		}
 		contentType, mediaUrl := parts[0], parts[1]
 
-		att, err := resolveAttachment(ctx, b, contentType, mediaUrl, support, allowURLOnly)
+		att, err := resolveAttachment(ctx, b, cfg, contentType, mediaUrl, support, allowURLOnly, clog)
 		if err != nil {
 			return nil, err
 		}
 		if att != nil {
 			resolved = append(resolved, att)
-		} else {
-			clog.Error(courier.ErrorMediaUnresolveable(contentType))
 		}
 	}
 
 	return resolved, nil
 }
 
-func resolveAttachment(ctx context.Context, b courier.Backend, contentType, mediaUrl string, support map[MediaType]MediaTypeSupport, allowURLOnly bool) (*Attachment, error) {
-	media, err := b.ResolveMedia(ctx, mediaUrl)
+func resolveAttachment(ctx context.Context, b courier.Backend, cfg *courier.Config, contentType, mediaUrl string, support map[MediaType]MediaTypeSupport, allowURLOnly bool, clog *courier.ChannelLog) (*Attachment, error) {
+	// if the URL has been signed, we resolve the media of the original URL and sign whatever we end up using
+	originalURL, expires, isSigned := courier.UnsignAttachmentURL(mediaUrl)
+	if !isSigned {
+		originalURL = mediaUrl
+	}
+
+	media, err := b.ResolveMedia(ctx, originalURL)
 	if err != nil {
 		return nil, err
 	}
@@ -77,17 +86,23 @@ func resolveAttachment(ctx context.Context, b courier.Backend, contentType, medi
 
 			mediaType, _ := parseContentType(contentType)
 			name := filenameFromURL(mediaUrl)
+			if isSigned {
+				name = filenameFromURL(originalURL)
+			}
 			return &Attachment{Type: mediaType, Name: name, ContentType: contentType, URL: mediaUrl}, nil
 		} else {
+			clog.Error(courier.ErrorMediaUnresolveable(contentType))
 			return nil, nil
 		}
 	}
 
 	mediaType, _ := parseContentType(media.ContentType())
 	mediaSupport := support[mediaType]
+	original := media
 
-	// our candidates are the uploaded media and any alternates of the same media type
-	candidates := append([]courier.Media{media}, filterMediaByType(media.Alternates(), mediaType)...)
+	// our candidates are the uploaded media and any alternates of the same media type which aren't thumbnails
+	alternates := filterMedia(filterMediaByType(media.Alternates(), mediaType), func(m courier.Media) bool { return !courier.IsThumbnail(original, m) })
+	candidates := append([]courier.Media{media}, alternates...)
 
 	// narrow down the candidates to the ones we support
 	if len(mediaSupport.Types) > 0 {
@@ -99,26 +114,67 @@ func resolveAttachment(ctx context.Context, b courier.Backend, contentType, medi
 		candidates = filterMediaBySize(candidates, mediaSupport.MaxBytes)
 	}
 
-	// if we have no candidates, we can't use this media
+	// if we have no candidates, try transcoding the media into something we can use
 	if len(candidates) == 0 {
-		return nil, nil
+		target := &courier.TranscodeTarget{ContentTypes: mediaSupport.Types, MaxBytes: mediaSupport.MaxBytes}
+
+		transcoded, err := courier.TranscodeMedia(ctx, b, cfg, clog.Channel(), media, target)
+		if err != nil {
+			slog.Error("error transcoding media", "error", err, "url", media.URL())
+			clog.Error(courier.ErrorMediaUnsupported(media.ContentType()))
+			return nil, nil
+		}
+		if transcoded == nil {
+			clog.Error(courier.ErrorMediaUnresolveable(contentType))
+			return nil, nil
+		}
+		candidates = []courier.Media{transcoded}
 	}
 	media = candidates[0]
 
-	// if we have an image alternate, that can be a thumbnail
+	// use an existing thumbnail if there is one, falling back to any image alternate, otherwise if the channel uses
+	// thumbnails, try to generate one
 	var thumbnail courier.Media
-	thumbnails := filterMediaByType(media.Alternates(), MediaTypeImage)
+	thumbnails := filterMedia(original.Alternates(), func(m courier.Media) bool { return courier.IsThumbnail(original, m) })
+	if len(thumbnails) == 0 {
+		thumbnails = filterMediaByType(original.Alternates(), MediaTypeImage)
+	}
 	if len(thumbnails) > 0 {
 		thumbnail = thumbnails[0]
+	} else if mediaSupport.Thumbnails && (mediaType == MediaTypeImage || mediaType == MediaTypeVideo) {
+		thumbnail, err = courier.GenerateThumbnail(ctx, b, cfg, clog.Channel(), original)
+		if err != nil {
+			slog.Error("error generating thumbnail", "error", err, "url", original.URL())
+		}
+	}
+
+	attURL, thumbnailURL := media.URL(), ""
+	if thumbnail != nil {
+		thumbnailURL = thumbnail.URL()
+	}
+
+	// sign the URLs we're using in the same way as the original URL
+	if isSigned {
+		if attURL == originalURL {
+			attURL = mediaUrl
+		} else if attURL, err = courier.SignAttachmentURL(ctx, b, attURL, expires); err != nil {
+			return nil, errors.Wrap(err, "error signing attachment URL")
+		}
+		if thumbnailURL != "" {
+			if thumbnailURL, err = courier.SignAttachmentURL(ctx, b, thumbnailURL, expires); err != nil {
+				return nil, errors.Wrap(err, "error signing thumbnail URL")
+			}
+		}
 	}
 
 	return &Attachment{
-		Type:        mediaType,
-		Name:        media.Name(),
-		ContentType: media.ContentType(),
-		URL:         media.URL(),
-		Media:       media,
-		Thumbnail:   thumbnail,
+		Type:         mediaType,
+		Name:         media.Name(),
+		ContentType:  media.ContentType(),
+		URL:          attURL,
+		Media:        media,
+		Thumbnail:    thumbnail,
+		ThumbnailURL: thumbnailURL,
 	}, nil
 }
 
@@ -164,6 +220,11 @@ func filenameFromURL(u string) string {
 }
 
 func parseContentType(t string) (MediaType, string) {
+	// contact cards are text but get sent as their own native type
+	if t == "text/vcard" || t == "text/x-vcard" {
+		return MediaTypeContact, strings.TrimPrefix(t, "text/")
+	}
+
 	parts := strings.SplitN(t, "/", 2)
 	if len(parts) == 2 {
 		return MediaType(parts[0]), parts[1]
@@ -1,18 +1,27 @@
 package handlers_test
 
 import (
+	"bytes"
 	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/handlers"
 	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestResolveAttachments(t *testing.T) {
 	ctx := context.Background()
 	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
 
 	imageJPG := test.NewMockMedia("test.jpg", "image/jpeg", "http://mock.com/1234/test.jpg", 1024*1024, 640, 480, 0, nil)
 
@@ -29,6 +38,9 @@ func TestResolveAttachments(t *testing.T) {
 	mb.MockMedia(videoMP4)
 	mb.MockMedia(videoMOV)
 
+	contactVCF := test.NewMockMedia("bob.vcf", "text/vcard", "http://mock.com/7890/bob.vcf", 1024, 0, 0, 0, nil)
+	mb.MockMedia(contactVCF)
+
 	tcs := []struct {
 		attachments  []string
 		mediaSupport map[handlers.MediaType]handlers.MediaTypeSupport
@@ -111,7 +123,7 @@ func TestResolveAttachments(t *testing.T) {
 			mediaSupport: map[handlers.MediaType]handlers.MediaTypeSupport{handlers.MediaTypeVideo: {Types: []string{"video/mp4", "video/quicktime"}}},
 			allowURLOnly: true,
 			resolved: []*handlers.Attachment{
-				{Type: handlers.MediaTypeVideo, Name: "test.mp4", ContentType: "video/mp4", URL: "http://mock.com/5678/test.mp4", Media: videoMP4, Thumbnail: thumbJPG},
+				{Type: handlers.MediaTypeVideo, Name: "test.mp4", ContentType: "video/mp4", URL: "http://mock.com/5678/test.mp4", Media: videoMP4, Thumbnail: thumbJPG, ThumbnailURL: "http://mock.com/4567/test.jpg"},
 			},
 		},
 		{ // 10: resolveable uploaded video URL, no thumbnail
@@ -129,12 +141,20 @@ func TestResolveAttachments(t *testing.T) {
 			resolved:     []*handlers.Attachment{},
 			errors:       []*courier.ChannelError{courier.ErrorMediaUnresolveable("video/quicktime")},
 		},
-		{ // 12: invalid attachment format
+		{ // 12: resolveable uploaded contact card
+			attachments:  []string{"text/vcard:http://mock.com/7890/bob.vcf"},
+			mediaSupport: map[handlers.MediaType]handlers.MediaTypeSupport{handlers.MediaTypeContact: {Types: []string{"text/vcard"}}},
+			allowURLOnly: true,
+			resolved: []*handlers.Attachment{
+				{Type: handlers.MediaTypeContact, Name: "bob.vcf", ContentType: "text/vcard", URL: "http://mock.com/7890/bob.vcf", Media: contactVCF, Thumbnail: nil},
+			},
+		},
+		{ // 13: invalid attachment format
 			attachments:  []string{"image"},
 			mediaSupport: map[handlers.MediaType]handlers.MediaTypeSupport{},
 			err:          "invalid attachment format: image",
 		},
-		{ // 13: invalid attachment format (missing content type)
+		{ // 14: invalid attachment format (missing content type)
 			attachments:  []string{"http://mock.com/1234/test.jpg"},
 			mediaSupport: map[handlers.MediaType]handlers.MediaTypeSupport{},
 			err:          "invalid attachment format: http://mock.com/1234/test.jpg",
@@ -144,7 +164,7 @@ func TestResolveAttachments(t *testing.T) {
 	for i, tc := range tcs {
 		clog := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, nil, nil)
 
-		resolved, err := handlers.ResolveAttachments(ctx, mb, tc.attachments, tc.mediaSupport, tc.allowURLOnly, clog)
+		resolved, err := handlers.ResolveAttachments(ctx, mb, cfg, tc.attachments, tc.mediaSupport, tc.allowURLOnly, clog)
 		if tc.err != "" {
 			assert.EqualError(t, err, tc.err, "expected error for test %d", i)
 		} else {
@@ -154,3 +174,196 @@ func TestResolveAttachments(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveAttachmentsWithTranscoding(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	channel := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{})
+
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{255, 0, 0, 255}}, image.Point{}, draw.Src)
+	imgPNG := &bytes.Buffer{}
+	png.Encode(imgPNG, img)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/1234/big.png":  {httpx.NewMockResponse(200, nil, imgPNG.Bytes())},
+		"http://mock.com/2345/gone.png": {httpx.NewMockResponse(404, nil, []byte(`not found`))},
+	}))
+
+	cfg := courier.NewDefaultConfig()
+	cfg.TranscodeMedia = true
+
+	bigPNG := test.NewMockMedia("big.png", "image/png", "http://mock.com/1234/big.png", 12*1024*1024, 200, 100, 0, nil)
+	gonePNG := test.NewMockMedia("gone.png", "image/png", "http://mock.com/2345/gone.png", 12*1024*1024, 200, 100, 0, nil)
+	mb.MockMedia(bigPNG)
+	mb.MockMedia(gonePNG)
+
+	support := map[handlers.MediaType]handlers.MediaTypeSupport{handlers.MediaTypeImage: {Types: []string{"image/jpeg"}, MaxBytes: 5 * 1024 * 1024}}
+
+	// media which doesn't fit the channel's limits is transcoded to something that does
+	clog := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, channel, nil)
+	resolved, err := handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/1234/big.png"}, support, false, clog)
+	assert.NoError(t, err)
+	assert.Len(t, clog.Errors(), 0)
+	if assert.Len(t, resolved, 1) {
+		assert.Equal(t, handlers.MediaTypeImage, resolved[0].Type)
+		assert.Equal(t, "image/jpeg", resolved[0].ContentType)
+		assert.Regexp(t, `^https://backend.com/attachments/[0-9a-f-]{36}\.jpg$`, resolved[0].URL)
+		assert.Equal(t, 200, resolved[0].Media.Width())
+		assert.Equal(t, 100, resolved[0].Media.Height())
+	}
+
+	// with the transcoded media saved as an alternate of the original
+	require.Len(t, mb.SavedAttachments(), 1)
+	assert.Equal(t, "image/jpeg", mb.SavedAttachments()[0].ContentType)
+	assert.Equal(t, "jpg", mb.SavedAttachments()[0].Extension)
+	require.Len(t, bigPNG.Alternates(), 1)
+	assert.Equal(t, resolved[0].URL, bigPNG.Alternates()[0].URL())
+
+	// if transcoding fails, the media is unsupported
+	clog = courier.NewChannelLog(courier.ChannelLogTypeMsgSend, channel, nil)
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/2345/gone.png"}, support, false, clog)
+	assert.NoError(t, err)
+	assert.Len(t, resolved, 0)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorMediaUnsupported("image/png")}, clog.Errors())
+
+	// and the failure is remembered so the media isn't fetched again
+	clog = courier.NewChannelLog(courier.ChannelLogTypeMsgSend, channel, nil)
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/2345/gone.png"}, support, false, clog)
+	assert.NoError(t, err)
+	assert.Len(t, resolved, 0)
+	assert.Equal(t, []*courier.ChannelError{courier.ErrorMediaUnsupported("image/png")}, clog.Errors())
+}
+
+func TestResolveAttachmentsWithThumbnails(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+	channel := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{})
+
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{255, 0, 0, 255}}, image.Point{}, draw.Src)
+	imgPNG := &bytes.Buffer{}
+	png.Encode(imgPNG, img)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/1234/big.png": {httpx.NewMockResponse(200, nil, imgPNG.Bytes())},
+	}))
+
+	cfg.ThumbnailMedia = true
+	cfg.FFmpegPath = ""
+
+	bigPNG := test.NewMockMedia("big.png", "image/png", "http://mock.com/1234/big.png", 1024*1024, 640, 480, 0, nil)
+	videoMOV := test.NewMockMedia("test.mov", "video/quicktime", "http://mock.com/6789/test.mov", 1024*1024, 0, 0, 2000, nil)
+	smallJPG := test.NewMockMedia("test.jpg", "image/jpeg", "http://mock.com/4567/test.jpg", 1024, 320, 240, 0, nil)
+	otherPNG := test.NewMockMedia("other.png", "image/png", "http://mock.com/5678/other.png", 1024*1024, 640, 480, 0, []courier.Media{smallJPG})
+	mb.MockMedia(bigPNG)
+	mb.MockMedia(videoMOV)
+	mb.MockMedia(otherPNG)
+
+	support := map[handlers.MediaType]handlers.MediaTypeSupport{
+		handlers.MediaTypeImage: {Types: []string{"image/png", "image/jpeg"}, Thumbnails: true},
+		handlers.MediaTypeVideo: {Types: []string{"video/quicktime"}, Thumbnails: true},
+	}
+
+	// image without a thumbnail doesn't get one generated for a channel which doesn't use them
+	clog := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, channel, nil)
+	resolved, err := handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/1234/big.png"}, map[handlers.MediaType]handlers.MediaTypeSupport{}, false, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Nil(t, resolved[0].Thumbnail)
+	assert.Len(t, mb.SavedAttachments(), 0)
+
+	// but does for one that does
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/1234/big.png"}, support, false, clog)
+	assert.NoError(t, err)
+	assert.Len(t, clog.Errors(), 0)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, bigPNG, resolved[0].Media)
+	require.NotNil(t, resolved[0].Thumbnail)
+	assert.Equal(t, "image/jpeg", resolved[0].Thumbnail.ContentType())
+	assert.Equal(t, 320, resolved[0].Thumbnail.Width())
+	assert.Equal(t, 240, resolved[0].Thumbnail.Height())
+
+	// with the thumbnail saved as an alternate of the original
+	require.Len(t, mb.SavedAttachments(), 1)
+	require.Len(t, bigPNG.Alternates(), 1)
+	assert.Equal(t, resolved[0].Thumbnail.URL(), bigPNG.Alternates()[0].URL())
+
+	// resolving again uses the existing thumbnail and never as the media itself
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/1234/big.png"}, support, false, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, bigPNG, resolved[0].Media)
+	assert.Equal(t, bigPNG.Alternates()[0], resolved[0].Thumbnail)
+	assert.Len(t, mb.SavedAttachments(), 1)
+
+	// an existing image alternate which wasn't generated as a thumbnail is still used as one
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/png:http://mock.com/5678/other.png"}, support, false, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, otherPNG, resolved[0].Media)
+	assert.Equal(t, smallJPG, resolved[0].Thumbnail)
+	assert.Len(t, mb.SavedAttachments(), 1)
+
+	// video without ffmpeg to generate one doesn't get a thumbnail
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"video/quicktime:http://mock.com/6789/test.mov"}, support, false, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Nil(t, resolved[0].Thumbnail)
+}
+
+func TestResolveAttachmentsWithSignedURLs(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	cfg := courier.NewDefaultConfig()
+	channel := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{})
+
+	signer := courier.NewURLSigner("courier.example.com", "sesame")
+	defer courier.SetURLSigner(nil)
+	courier.SetURLSigner(signer)
+
+	audioM4A := test.NewMockMedia("test.m4a", "audio/mp4", "http://mock.com/2345/test.m4a", 1024*1024, 0, 0, 200, nil)
+	audioMP3 := test.NewMockMedia("test.mp3", "audio/mp3", "http://mock.com/3456/test.mp3", 1024*1024, 0, 0, 200, []courier.Media{audioM4A})
+	thumbJPG := test.NewMockMedia("test.jpg", "image/jpeg", "http://mock.com/4567/test.jpg", 1024*1024, 320, 240, 0, nil)
+	videoMP4 := test.NewMockMedia("test.mp4", "video/mp4", "http://mock.com/5678/test.mp4", 1024*1024, 0, 0, 1000, []courier.Media{thumbJPG})
+	mb.MockMedia(audioMP3)
+	mb.MockMedia(videoMP4)
+
+	support := map[handlers.MediaType]handlers.MediaTypeSupport{
+		handlers.MediaTypeAudio: {Types: []string{"audio/mp4"}},
+		handlers.MediaTypeVideo: {Types: []string{"video/mp4"}},
+	}
+	expires := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+
+	// media of a signed URL is resolved from its original URL and the signed URL is used as is
+	clog := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, channel, nil)
+	signedMP4 := signer.Sign("http://mock.com/5678/test.mp4", expires)
+	resolved, err := handlers.ResolveAttachments(ctx, mb, cfg, []string{"video/mp4:" + signedMP4}, support, false, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, videoMP4, resolved[0].Media)
+	assert.Equal(t, signedMP4, resolved[0].URL)
+
+	// with its thumbnail signed in the same way
+	assert.Equal(t, thumbJPG, resolved[0].Thumbnail)
+	assert.Equal(t, signer.Sign("http://mock.com/4567/test.jpg", expires), resolved[0].ThumbnailURL)
+
+	// if an alternate is used instead, that gets signed in the same way
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"audio/mp3:" + signer.Sign("http://mock.com/3456/test.mp3", expires)}, support, false, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, audioM4A, resolved[0].Media)
+	assert.Equal(t, signer.Sign("http://mock.com/2345/test.m4a", expires), resolved[0].URL)
+
+	// signed URLs of media which can't be resolved are used as is
+	signedJPG := signer.Sign("https://example.com/image.jpg", expires)
+	resolved, err = handlers.ResolveAttachments(ctx, mb, cfg, []string{"image/jpeg:" + signedJPG}, support, true, clog)
+	assert.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, signedJPG, resolved[0].URL)
+	assert.Equal(t, "image.jpg", resolved[0].Name)
+	assert.Len(t, clog.Errors(), 0)
+}
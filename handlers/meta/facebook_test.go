@@ -78,6 +78,7 @@ var facebookIncomingTests = []IncomingTestCase{
 		ExpectedBodyContains: "Handled",
 		ExpectedMsgText:      Sp(""),
 		ExpectedAttachments:  []string{"geo:1.200000,-1.300000"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: 1.2, Longitude: -1.3},
 		ExpectedURN:          "facebook:5678",
 		ExpectedExternalID:   "external_id",
 		ExpectedDate:         time.Date(2016, 4, 7, 1, 11, 27, 970000000, time.UTC),
@@ -272,6 +273,28 @@ var facebookIncomingTests = []IncomingTestCase{
 		NoLogsExpected:       true,
 		PrepRequest:          addValidSignature,
 	},
+	{
+		Label:                "Receive Reaction",
+		URL:                  "/c/fba/receive",
+		Data:                 string(test.ReadFile("./testdata/fba/reaction.json")),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Handled",
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "facebook:5678", Time: time.Date(2016, 4, 7, 1, 11, 27, 970000000, time.UTC), Extra: map[string]string{"emoji": "❤", "action": "add", "external_id": "mid.1458668856218:ed81099e15d3f4f233"}},
+		},
+		PrepRequest: addValidSignature,
+	},
+	{
+		Label:                "Receive Reaction Removed",
+		URL:                  "/c/fba/receive",
+		Data:                 string(test.ReadFile("./testdata/fba/unreaction.json")),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Handled",
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "facebook:5678", Time: time.Date(2016, 4, 7, 1, 11, 27, 970000000, time.UTC), Extra: map[string]string{"emoji": "", "action": "remove", "external_id": "mid.1458668856218:ed81099e15d3f4f233"}},
+		},
+		PrepRequest: addValidSignature,
+	},
 	{
 		Label:                "Invalid URN",
 		URL:                  "/c/fba/receive",
@@ -569,6 +592,80 @@ var facebookOutgoingTests = []OutgoingTestCase{
 		}},
 		ExpectedExtIDs: []string{"mid.133"},
 	},
+	{
+		Label:                   "Reaction",
+		MsgURN:                  "facebook:12345",
+		MsgReaction:             &courier.MsgReaction{Emoji: "👍"},
+		MsgResponseToExternalID: "mid.133",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://graph.facebook.com/v17.0/me/messages*": {
+				httpx.NewMockResponse(200, nil, []byte(`{"recipient_id": "12345"}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{{
+			Params: url.Values{"access_token": {"a123"}},
+			Body:   `{"recipient":{"id":"12345"},"sender_action":"react","payload":{"message_id":"mid.133","reaction":"like"}}`,
+		}},
+	},
+	{
+		Label:                   "Reaction removed",
+		MsgURN:                  "facebook:12345",
+		MsgReaction:             &courier.MsgReaction{Emoji: ""},
+		MsgResponseToExternalID: "mid.133",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://graph.facebook.com/v17.0/me/messages*": {
+				httpx.NewMockResponse(200, nil, []byte(`{"recipient_id": "12345"}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{{
+			Params: url.Values{"access_token": {"a123"}},
+			Body:   `{"recipient":{"id":"12345"},"sender_action":"unreact","payload":{"message_id":"mid.133"}}`,
+		}},
+	},
+	{
+		Label:                   "Reaction error",
+		MsgURN:                  "facebook:12345",
+		MsgReaction:             &courier.MsgReaction{Emoji: "🦖"},
+		MsgResponseToExternalID: "mid.133",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://graph.facebook.com/v17.0/me/messages*": {
+				httpx.NewMockResponse(400, nil, []byte(`{ "error": {"message": "Invalid message id","code": 100 }}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{{
+			Params: url.Values{"access_token": {"a123"}},
+			Body:   `{"recipient":{"id":"12345"},"sender_action":"react","payload":{"message_id":"mid.133","reaction":"other"}}`,
+		}},
+		ExpectedError: courier.ErrFailedWithReason("100", "Invalid message id"),
+	},
+	{
+		Label:                 "Typing indicator",
+		MsgURN:                "facebook:12345",
+		MsgConversationAction: courier.ConversationActionTyping,
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://graph.facebook.com/v17.0/me/messages*": {
+				httpx.NewMockResponse(200, nil, []byte(`{"recipient_id": "12345"}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{{
+			Params: url.Values{"access_token": {"a123"}},
+			Body:   `{"recipient":{"id":"12345"},"sender_action":"typing_on"}`,
+		}},
+	},
+	{
+		Label:                 "Mark as read",
+		MsgURN:                "facebook:12345",
+		MsgConversationAction: courier.ConversationActionMarkRead,
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://graph.facebook.com/v17.0/me/messages*": {
+				httpx.NewMockResponse(200, nil, []byte(`{"recipient_id": "12345"}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{{
+			Params: url.Values{"access_token": {"a123"}},
+			Body:   `{"recipient":{"id":"12345"},"sender_action":"mark_seen"}`,
+		}},
+	},
 	{
 		Label:   "Response doesn't contain message id",
 		MsgText: "ID Error",
@@ -44,6 +44,18 @@ var (
 		369239383222810: "👍", // big
 	}
 
+	// reactions supported by Messenger and Instagram, anything else is sent as "other"
+	reactionByEmoji = map[string]string{
+		"😆":  "smile",
+		"😠":  "angry",
+		"😢":  "sad",
+		"😮":  "wow",
+		"❤":  "love",
+		"❤️": "love",
+		"👍":  "like",
+		"👎":  "dislike",
+	}
+
 	tagByTopic = map[string]string{
 		"event":    "CONFIRMED_EVENT_UPDATE",
 		"purchase": "POST_PURCHASE_UPDATE",
@@ -252,8 +264,6 @@ func (h *handler) processWhatsAppPayload(ctx context.Context, channel courier.Ch
 	// the list of data we will return in our response
 	data := make([]any, 0, 2)
 
-	token := h.Server().Config().WhatsappAdminSystemUserToken
-
 	seenMsgIDs := make(map[string]bool, 2)
 	contactNames := make(map[string]string)
 
@@ -290,30 +300,60 @@ func (h *handler) processWhatsAppPayload(ctx context.Context, channel courier.Ch
 					clog.Error(courier.ErrorExternal(strconv.Itoa(msgError.Code), msgError.Title))
 				}
 
+				// reactions are written as channel events, an empty emoji means the reaction was removed
+				if msg.Type == "reaction" && msg.Reaction != nil {
+					action := courier.ReactionActionAdd
+					if msg.Reaction.Emoji == "" {
+						action = courier.ReactionActionRemove
+					}
+
+					event := handlers.NewReactionEvent(h.Backend(), channel, urn, msg.Reaction.MessageID, msg.Reaction.Emoji, action, clog).WithOccurredOn(date).WithContactName(contactNames[msg.From])
+
+					err := h.Backend().WriteChannelEvent(ctx, event, clog)
+					if err != nil {
+						return nil, nil, err
+					}
+
+					events = append(events, event)
+					data = append(data, courier.NewEventReceiveData(event))
+					seenMsgIDs[msg.ID] = true
+					continue
+				}
+
 				text := ""
-				mediaURL := ""
+				mediaID := ""
+				var location *courier.MsgLocation
+				vcards := make([]string, 0)
 
 				if msg.Type == "text" {
 					text = msg.Text.Body
 				} else if msg.Type == "audio" && msg.Audio != nil {
 					text = msg.Audio.Caption
-					mediaURL, err = h.resolveMediaURL(msg.Audio.ID, token, clog)
+					mediaID = msg.Audio.ID
 				} else if msg.Type == "voice" && msg.Voice != nil {
 					text = msg.Voice.Caption
-					mediaURL, err = h.resolveMediaURL(msg.Voice.ID, token, clog)
+					mediaID = msg.Voice.ID
 				} else if msg.Type == "button" && msg.Button != nil {
 					text = msg.Button.Text
 				} else if msg.Type == "document" && msg.Document != nil {
 					text = msg.Document.Caption
-					mediaURL, err = h.resolveMediaURL(msg.Document.ID, token, clog)
+					mediaID = msg.Document.ID
 				} else if msg.Type == "image" && msg.Image != nil {
 					text = msg.Image.Caption
-					mediaURL, err = h.resolveMediaURL(msg.Image.ID, token, clog)
+					mediaID = msg.Image.ID
 				} else if msg.Type == "video" && msg.Video != nil {
 					text = msg.Video.Caption
-					mediaURL, err = h.resolveMediaURL(msg.Video.ID, token, clog)
+					mediaID = msg.Video.ID
 				} else if msg.Type == "location" && msg.Location != nil {
-					mediaURL = fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude)
+					location = &courier.MsgLocation{Latitude: msg.Location.Latitude, Longitude: msg.Location.Longitude, Name: msg.Location.Name, Address: msg.Location.Address}
+				} else if msg.Type == "contacts" && len(msg.Contacts) > 0 {
+					for _, contact := range msg.Contacts {
+						vcard, err := handlers.SaveVCard(ctx, h.Backend(), channel, contact.VCard())
+						if err != nil {
+							return nil, nil, err
+						}
+						vcards = append(vcards, vcard)
+					}
 				} else if msg.Type == "interactive" && msg.Interactive.Type == "button_reply" {
 					text = msg.Interactive.ButtonReply.Title
 				} else if msg.Type == "interactive" && msg.Interactive.Type == "list_reply" {
@@ -327,13 +367,20 @@ func (h *handler) processWhatsAppPayload(ctx context.Context, channel courier.Ch
 				// create our message
 				event := h.Backend().NewIncomingMsg(channel, urn, text, msg.ID, clog).WithReceivedOn(date).WithContactName(contactNames[msg.From])
 
-				// we had an error downloading media
-				if err != nil {
-					courier.LogRequestError(r, channel, err)
+				// media is fetched once the message has been written so we don't keep Meta waiting
+				if mediaID != "" {
+					event.WithAttachment(courier.PendingAttachment(mediaID))
+				}
+				if location != nil {
+					handlers.AddLocation(event, location.Latitude, location.Longitude, location.Name, location.Address)
+				}
+				for _, vcard := range vcards {
+					event.WithAttachment(vcard)
 				}
 
-				if mediaURL != "" {
-					event.WithAttachment(mediaURL)
+				// this is a reply to a previous message
+				if msg.Context != nil && msg.Context.ID != "" {
+					event.WithReplyTo(msg.Context.ID)
 				}
 
 				err = h.Backend().WriteMsg(ctx, event, clog)
@@ -553,6 +600,7 @@ func (h *handler) processFacebookInstagramPayload(ctx context.Context, channel c
 
 			text := msg.Message.Text
 			attachmentURLs := make([]string, 0, 2)
+			locations := make([]*courier.MsgLocation, 0, 1)
 
 			for _, att := range msg.Message.Attachments {
 				// if we have a sticker ID, use that as our text
@@ -563,8 +611,8 @@ func (h *handler) processFacebookInstagramPayload(ctx context.Context, channel c
 					text = "❤️"
 				}
 
-				if att.Type == "location" {
-					attachmentURLs = append(attachmentURLs, fmt.Sprintf("geo:%f,%f", att.Payload.Coordinates.Lat, att.Payload.Coordinates.Long))
+				if att.Type == "location" && att.Payload != nil && att.Payload.Coordinates != nil {
+					locations = append(locations, &courier.MsgLocation{Latitude: att.Payload.Coordinates.Lat, Longitude: att.Payload.Coordinates.Long, Name: att.Title})
 				}
 
 				if att.Type == "story_mention" {
@@ -579,7 +627,7 @@ func (h *handler) processFacebookInstagramPayload(ctx context.Context, channel c
 			}
 
 			// if we have no text or accepted attachments, don't create a message
-			if text == "" && len(attachmentURLs) == 0 {
+			if text == "" && len(attachmentURLs) == 0 && len(locations) == 0 {
 				continue
 			}
 
@@ -590,6 +638,9 @@ func (h *handler) processFacebookInstagramPayload(ctx context.Context, channel c
 			for _, attURL := range attachmentURLs {
 				event.WithAttachment(attURL)
 			}
+			for _, loc := range locations {
+				handlers.AddLocation(event, loc.Latitude, loc.Longitude, loc.Name, loc.Address)
+			}
 
 			err := h.Backend().WriteMsg(ctx, event, clog)
 			if err != nil {
@@ -600,6 +651,23 @@ func (h *handler) processFacebookInstagramPayload(ctx context.Context, channel c
 			data = append(data, courier.NewMsgReceiveData(event))
 			seenMsgIDs[msg.Message.MID] = true
 
+		} else if msg.Reaction != nil {
+			// this is a reaction to a message
+			action := courier.ReactionActionAdd
+			if msg.Reaction.Action == "unreact" {
+				action = courier.ReactionActionRemove
+			}
+
+			event := handlers.NewReactionEvent(h.Backend(), channel, urn, msg.Reaction.MID, msg.Reaction.Emoji, action, clog).WithOccurredOn(date)
+
+			err := h.Backend().WriteChannelEvent(ctx, event, clog)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			events = append(events, event)
+			data = append(data, courier.NewEventReceiveData(event))
+
 		} else if msg.Delivery != nil {
 			// this is a delivery report
 			for _, mid := range msg.Delivery.MIDs {
@@ -789,6 +857,35 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 	path, _ := url.Parse(fmt.Sprintf("/%s/messages", msg.Channel().Address()))
 	wacPhoneURL := base.ResolveReference(path)
 
+	// locations are sent as their own native location messages ahead of any media
+	locations, attachments := handlers.SplitGeoAttachments(msg.Attachments())
+	for _, loc := range locations {
+		payload := whatsapp.SendRequest{MessagingProduct: "whatsapp", RecipientType: "individual", To: msg.URN().Path(), Type: "location", Location: &whatsapp.Location{Latitude: loc.Latitude, Longitude: loc.Longitude}}
+		err := h.requestWAC(payload, accessToken, res, wacPhoneURL, clog)
+		if err != nil {
+			return err
+		}
+	}
+
+	// contact cards are sent as native contacts messages, also ahead of any media
+	vcards, attachments := handlers.SplitVCardAttachments(attachments)
+	cards, err := handlers.ResolveAttachments(ctx, h.Backend(), h.Server().Config(), vcards, whatsapp.ContactMediaSupport, true, clog)
+	if err != nil {
+		return errors.Wrap(err, "error resolving attachments")
+	}
+	for _, card := range cards {
+		vcard, err := h.FetchVCard(ctx, card.URL, clog)
+		if err != nil {
+			return err
+		}
+
+		payload := whatsapp.SendRequest{MessagingProduct: "whatsapp", RecipientType: "individual", To: msg.URN().Path(), Type: "contacts", Contacts: []*whatsapp.Contact{whatsapp.GetContactPayload(vcard)}}
+		err = h.requestWAC(payload, accessToken, res, wacPhoneURL, clog)
+		if err != nil {
+			return err
+		}
+	}
+
 	hasCaption := false
 
 	msgParts := make([]string, 0)
@@ -800,10 +897,10 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 
 	var payloadAudio whatsapp.SendRequest
 
-	for i := 0; i < len(msgParts)+len(msg.Attachments()); i++ {
+	for i := 0; i < len(msgParts)+len(attachments); i++ {
 		payload := whatsapp.SendRequest{MessagingProduct: "whatsapp", RecipientType: "individual", To: msg.URN().Path()}
 
-		if len(msg.Attachments()) == 0 {
+		if len(attachments) == 0 {
 			// do we have a template?
 			templating, err := whatsapp.GetTemplating(msg)
 			if err != nil {
@@ -814,14 +911,14 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 				payload.Template = whatsapp.GetTemplatePayload(templating)
 
 			} else {
-				if i < (len(msgParts) + len(msg.Attachments()) - 1) {
+				if i < (len(msgParts) + len(attachments) - 1) {
 					// this is still a msg part
 					text := &whatsapp.Text{PreviewURL: false}
 					payload.Type = "text"
-					if strings.Contains(msgParts[i-len(msg.Attachments())], "https://") || strings.Contains(msgParts[i-len(msg.Attachments())], "http://") {
+					if strings.Contains(msgParts[i-len(attachments)], "https://") || strings.Contains(msgParts[i-len(attachments)], "http://") {
 						text.PreviewURL = true
 					}
-					text.Body = msgParts[i-len(msg.Attachments())]
+					text.Body = msgParts[i-len(attachments)]
 					payload.Text = text
 				} else {
 					if len(qrs) > 0 {
@@ -837,7 +934,7 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 						if len(qrs) <= 3 {
 							interactive := whatsapp.Interactive{Type: "button", Body: struct {
 								Text string "json:\"text\""
-							}{Text: msgParts[i-len(msg.Attachments())]}}
+							}{Text: msgParts[i-len(attachments)]}}
 
 							btns := make([]whatsapp.Button, len(qrs))
 							for i, qr := range qrs {
@@ -856,7 +953,7 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 						} else {
 							interactive := whatsapp.Interactive{Type: "list", Body: struct {
 								Text string "json:\"text\""
-							}{Text: msgParts[i-len(msg.Attachments())]}}
+							}{Text: msgParts[i-len(attachments)]}}
 
 							section := whatsapp.Section{
 								Rows: make([]whatsapp.SectionRow, len(qrs)),
@@ -882,17 +979,17 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 						// this is still a msg part
 						text := &whatsapp.Text{PreviewURL: false}
 						payload.Type = "text"
-						if strings.Contains(msgParts[i-len(msg.Attachments())], "https://") || strings.Contains(msgParts[i-len(msg.Attachments())], "http://") {
+						if strings.Contains(msgParts[i-len(attachments)], "https://") || strings.Contains(msgParts[i-len(attachments)], "http://") {
 							text.PreviewURL = true
 						}
-						text.Body = msgParts[i-len(msg.Attachments())]
+						text.Body = msgParts[i-len(attachments)]
 						payload.Text = text
 					}
 				}
 			}
 
-		} else if i < len(msg.Attachments()) && (len(qrs) == 0 || len(qrs) > 3) {
-			attType, attURL := handlers.SplitAttachment(msg.Attachments()[i])
+		} else if i < len(attachments) && (len(qrs) == 0 || len(qrs) > 3) {
+			attType, attURL := handlers.SplitAttachment(attachments[i])
 			attType = strings.Split(attType, "/")[0]
 			if attType == "application" {
 				attType = "document"
@@ -900,7 +997,7 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 			payload.Type = attType
 			media := whatsapp.Media{Link: attURL}
 
-			if len(msgParts) == 1 && attType != "audio" && len(msg.Attachments()) == 1 && len(msg.QuickReplies()) == 0 {
+			if len(msgParts) == 1 && attType != "audio" && len(attachments) == 1 && len(msg.QuickReplies()) == 0 {
 				media.Caption = msgParts[i]
 				hasCaption = true
 			}
@@ -937,9 +1034,9 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 						Text string "json:\"text\""
 					}{Text: msgParts[i]}}
 
-					if len(msg.Attachments()) > 0 {
+					if len(attachments) > 0 {
 						hasCaption = true
-						attType, attURL := handlers.SplitAttachment(msg.Attachments()[i])
+						attType, attURL := handlers.SplitAttachment(attachments[i])
 						attType = strings.Split(attType, "/")[0]
 						if attType == "application" {
 							attType = "document"
@@ -1013,7 +1110,7 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 				} else {
 					interactive := whatsapp.Interactive{Type: "list", Body: struct {
 						Text string "json:\"text\""
-					}{Text: msgParts[i-len(msg.Attachments())]}}
+					}{Text: msgParts[i-len(attachments)]}}
 
 					section := whatsapp.Section{
 						Rows: make([]whatsapp.SectionRow, len(qrs)),
@@ -1039,10 +1136,10 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 				// this is still a msg part
 				text := &whatsapp.Text{PreviewURL: false}
 				payload.Type = "text"
-				if strings.Contains(msgParts[i-len(msg.Attachments())], "https://") || strings.Contains(msgParts[i-len(msg.Attachments())], "http://") {
+				if strings.Contains(msgParts[i-len(attachments)], "https://") || strings.Contains(msgParts[i-len(attachments)], "http://") {
 					text.PreviewURL = true
 				}
-				text.Body = msgParts[i-len(msg.Attachments())]
+				text.Body = msgParts[i-len(attachments)]
 				payload.Text = text
 			}
 		}
@@ -1059,7 +1156,153 @@ func (h *handler) sendWhatsAppMsg(ctx context.Context, msg courier.MsgOut, res *
 	return nil
 }
 
-func (h *handler) requestWAC(payload whatsapp.SendRequest, accessToken string, res *courier.SendResult, wacPhoneURL *url.URL, clog *courier.ChannelLog) error {
+// SendReaction sends a reaction to the message the passed in msg is a response to
+func (h *handler) SendReaction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	if msg.Channel().ChannelType() == "FBA" || msg.Channel().ChannelType() == "IG" {
+		return h.sendFacebookInstagramReaction(ctx, msg, res, clog)
+	} else if msg.Channel().ChannelType() == "WAC" {
+		return h.sendWhatsAppReaction(ctx, msg, res, clog)
+	}
+
+	return fmt.Errorf("unsupported channel type")
+}
+
+func (h *handler) sendFacebookInstagramReaction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	// can't do anything without an access token
+	accessToken := msg.Channel().StringConfigForKey(courier.ConfigAuthToken, "")
+	if accessToken == "" {
+		return courier.ErrChannelConfig
+	}
+
+	payload := &messenger.SenderActionRequest{Payload: &messenger.SenderActionPayload{MessageID: msg.ResponseToExternalID()}}
+	payload.Recipient.ID = msg.URN().Path()
+
+	if emoji := msg.Reaction().Emoji; emoji != "" {
+		payload.SenderAction = "react"
+		payload.Payload.Reaction = reactionByEmoji[emoji]
+		if payload.Payload.Reaction == "" {
+			payload.Payload.Reaction = "other"
+		}
+	} else {
+		payload.SenderAction = "unreact"
+	}
+
+	return h.requestSenderAction(payload, accessToken, clog)
+}
+
+// SendConversationAction shows a typing indicator or marks the message being responded to as read
+func (h *handler) SendConversationAction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	if msg.Channel().ChannelType() == "FBA" || msg.Channel().ChannelType() == "IG" {
+		return h.sendFacebookInstagramConversationAction(ctx, msg, res, clog)
+	} else if msg.Channel().ChannelType() == "WAC" {
+		return h.sendWhatsAppConversationAction(ctx, msg, res, clog)
+	}
+
+	return fmt.Errorf("unsupported channel type")
+}
+
+func (h *handler) sendFacebookInstagramConversationAction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	// can't do anything without an access token
+	accessToken := msg.Channel().StringConfigForKey(courier.ConfigAuthToken, "")
+	if accessToken == "" {
+		return courier.ErrChannelConfig
+	}
+
+	payload := &messenger.SenderActionRequest{}
+	payload.Recipient.ID = msg.URN().Path()
+
+	switch msg.ConversationAction() {
+	case courier.ConversationActionTyping:
+		payload.SenderAction = "typing_on"
+	case courier.ConversationActionMarkRead:
+		payload.SenderAction = "mark_seen"
+	default:
+		return courier.ErrConversationActionUnsupported
+	}
+
+	return h.requestSenderAction(payload, accessToken, clog)
+}
+
+func (h *handler) sendWhatsAppConversationAction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	// both marking as read and typing indicators apply to a received message
+	if msg.ResponseToExternalID() == "" {
+		return courier.ErrConversationActionUnsupported
+	}
+
+	accessToken := h.Server().Config().WhatsappAdminSystemUserToken
+
+	base, _ := url.Parse(graphURL)
+	path, _ := url.Parse(fmt.Sprintf("/%s/messages", msg.Channel().Address()))
+	wacPhoneURL := base.ResolveReference(path)
+
+	payload := whatsapp.StatusRequest{MessagingProduct: "whatsapp", Status: "read", MessageID: msg.ResponseToExternalID()}
+
+	switch msg.ConversationAction() {
+	case courier.ConversationActionTyping:
+		payload.TypingIndicator = &whatsapp.TypingIndicator{Type: "text"}
+	case courier.ConversationActionMarkRead:
+		// nothing to add, marking as read is all the status request does by default
+	default:
+		return courier.ErrConversationActionUnsupported
+	}
+
+	return h.requestWAC(payload, accessToken, res, wacPhoneURL, clog)
+}
+
+func (h *handler) requestSenderAction(payload *messenger.SenderActionRequest, accessToken string, clog *courier.ChannelLog) error {
+	msgURL, _ := url.Parse(sendURL)
+	query := url.Values{}
+	query.Set("access_token", accessToken)
+	msgURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, msgURL.String(), bytes.NewReader(jsonx.MustMarshal(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, respBody, err := h.RequestHTTP(req, clog)
+	if err != nil || resp.StatusCode/100 == 5 {
+		return courier.ErrConnectionFailed
+	}
+
+	respPayload := &messenger.SendResponse{}
+	err = json.Unmarshal(respBody, respPayload)
+	if err != nil {
+		return courier.ErrResponseUnparseable
+	}
+
+	if respPayload.Error.Code != 0 {
+		return courier.ErrFailedWithReason(strconv.Itoa(respPayload.Error.Code), respPayload.Error.Message)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return courier.ErrResponseStatus
+	}
+
+	return nil
+}
+
+func (h *handler) sendWhatsAppReaction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	accessToken := h.Server().Config().WhatsappAdminSystemUserToken
+
+	base, _ := url.Parse(graphURL)
+	path, _ := url.Parse(fmt.Sprintf("/%s/messages", msg.Channel().Address()))
+	wacPhoneURL := base.ResolveReference(path)
+
+	payload := whatsapp.SendRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               msg.URN().Path(),
+		Type:             "reaction",
+		Reaction:         &whatsapp.Reaction{MessageID: msg.ResponseToExternalID(), Emoji: msg.Reaction().Emoji},
+	}
+
+	return h.requestWAC(payload, accessToken, res, wacPhoneURL, clog)
+}
+
+func (h *handler) requestWAC(payload any, accessToken string, res *courier.SendResult, wacPhoneURL *url.URL, clog *courier.ChannelLog) error {
 	jsonBody := jsonx.MustMarshal(payload)
 
 	req, err := http.NewRequest(http.MethodPost, wacPhoneURL.String(), bytes.NewReader(jsonBody))
@@ -1086,9 +1329,8 @@ func (h *handler) requestWAC(payload whatsapp.SendRequest, accessToken string, r
 		return courier.ErrFailedWithReason(strconv.Itoa(respPayload.Error.Code), respPayload.Error.Message)
 	}
 
-	externalID := respPayload.Messages[0].ID
-	if externalID != "" {
-		res.AddExternalID(externalID)
+	if len(respPayload.Messages) > 0 && respPayload.Messages[0].ID != "" {
+		res.AddExternalID(respPayload.Messages[0].ID)
 	}
 	return nil
 }
@@ -1184,6 +1426,11 @@ func fbCalculateSignature(appSecret string, body []byte) (string, error) {
 	return hex.EncodeToString(mac.Sum(nil)), nil
 }
 
+// ResolveAttachment resolves the ID of media received by a WAC channel to the URL it can be downloaded from
+func (h *handler) ResolveAttachment(ctx context.Context, channel courier.Channel, mediaID string, clog *courier.ChannelLog) (string, error) {
+	return h.resolveMediaURL(mediaID, h.Server().Config().WhatsappAdminSystemUserToken, clog)
+}
+
 // BuildAttachmentRequest to download media for message attachment with Bearer token set
 func (h *handler) BuildAttachmentRequest(ctx context.Context, b courier.Backend, channel courier.Channel, attachmentURL string, clog *courier.ChannelLog) (*http.Request, error) {
 	token := h.Server().Config().WhatsappAdminSystemUserToken
@@ -1201,6 +1448,9 @@ func (h *handler) BuildAttachmentRequest(ctx context.Context, b courier.Backend,
 }
 
 var _ courier.AttachmentRequestBuilder = (*handler)(nil)
+var _ courier.AttachmentResolver = (*handler)(nil)
+var _ courier.ReactionSender = (*handler)(nil)
+var _ courier.ConversationActions = (*handler)(nil)
 
 func parseTimestamp(ts int64) time.Time {
 	// sometimes Facebook sends timestamps in seconds rather than milliseconds
@@ -43,6 +43,31 @@ type Attachment struct {
 	} `json:"payload"`
 }
 
+// see https://developers.facebook.com/docs/messenger-platform/send-messages/sender-actions
+//
+//	{
+//	  "recipient": {
+//	    "id":"<PSID>"
+//	  },
+//	  "sender_action": "react",
+//	  "payload": {
+//	    "message_id": "<MID>",
+//	    "reaction": "love"
+//	  }
+//	}
+type SenderActionRequest struct {
+	Recipient struct {
+		ID string `json:"id"`
+	} `json:"recipient"`
+	SenderAction string               `json:"sender_action"`
+	Payload      *SenderActionPayload `json:"payload,omitempty"`
+}
+
+type SenderActionPayload struct {
+	MessageID string `json:"message_id"`
+	Reaction  string `json:"reaction,omitempty"`
+}
+
 type QuickReply struct {
 	Title       string `json:"title"`
 	Payload     string `json:"payload"`
@@ -110,6 +135,7 @@ type Messaging struct {
 		IsDeleted   bool   `json:"is_deleted"`
 		Attachments []struct {
 			Type    string `json:"type"`
+			Title   string `json:"title"`
 			Payload *struct {
 				URL         string `json:"url"`
 				StickerID   int64  `json:"sticker_id"`
@@ -121,6 +147,13 @@ type Messaging struct {
 		} `json:"attachments"`
 	} `json:"message"`
 
+	Reaction *struct {
+		MID      string `json:"mid"`
+		Action   string `json:"action"`
+		Reaction string `json:"reaction"`
+		Emoji    string `json:"emoji"`
+	} `json:"reaction"`
+
 	Delivery *struct {
 		MIDs      []string `json:"mids"`
 		Watermark int64    `json:"watermark"`
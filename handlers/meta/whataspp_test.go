@@ -60,7 +60,7 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedMsgText:       Sp(""),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
-		ExpectedAttachments:   []string{"https://foo.bar/attachmentURL_Voice"},
+		ExpectedAttachments:   []string{"pending:id_voice"},
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:           addValidSignature,
 	},
@@ -75,6 +75,7 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedMsgText:       Sp("No"),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
+		ExpectedReplyTo:       "gBGGFmkiWVVPAgkgQkwi7IORac0",
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:           addValidSignature,
 	},
@@ -89,7 +90,7 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedMsgText:       Sp("80skaraokesonglistartist"),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
-		ExpectedAttachments:   []string{"https://foo.bar/attachmentURL_Document"},
+		ExpectedAttachments:   []string{"pending:id_document"},
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:           addValidSignature,
 	},
@@ -104,7 +105,7 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedMsgText:       Sp("Check out my new phone!"),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
-		ExpectedAttachments:   []string{"https://foo.bar/attachmentURL_Image"},
+		ExpectedAttachments:   []string{"pending:id_image"},
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:           addValidSignature,
 	},
@@ -119,7 +120,7 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedMsgText:       Sp("Check out my new phone!"),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
-		ExpectedAttachments:   []string{"https://foo.bar/attachmentURL_Video"},
+		ExpectedAttachments:   []string{"pending:id_video"},
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:           addValidSignature,
 	},
@@ -134,7 +135,7 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedMsgText:       Sp("Check out my new phone!"),
 		ExpectedURN:           "whatsapp:5678",
 		ExpectedExternalID:    "external_id",
-		ExpectedAttachments:   []string{"https://foo.bar/attachmentURL_Audio"},
+		ExpectedAttachments:   []string{"pending:id_audio"},
 		ExpectedDate:          time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:           addValidSignature,
 	},
@@ -146,11 +147,48 @@ var whatsappIncomingTests = []IncomingTestCase{
 		ExpectedBodyContains: `"type":"msg"`,
 		ExpectedMsgText:      Sp(""),
 		ExpectedAttachments:  []string{"geo:0.000000,1.000000"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: 0, Longitude: 1, Name: "Main Street Beach", Address: "Main Street Beach, Santa Cruz, CA"},
 		ExpectedURN:          "whatsapp:5678",
 		ExpectedExternalID:   "external_id",
 		ExpectedDate:         time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 		PrepRequest:          addValidSignature,
 	},
+	{
+		Label:                "Receive Valid Contacts Message",
+		URL:                  whatappReceiveURL,
+		Data:                 string(test.ReadFile("./testdata/wac/contacts.json")),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: `"type":"msg"`,
+		ExpectedMsgText:      Sp(""),
+		ExpectedAttachments:  []string{"text/vcard:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.vcf", "text/vcard:https://backend.com/attachments/547deaf7-7620-4434-95b3-58675999c4b7.vcf"},
+		ExpectedURN:          "whatsapp:5678",
+		ExpectedExternalID:   "external_id",
+		ExpectedDate:         time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
+		PrepRequest:          addValidSignature,
+	},
+	{
+		Label:                "Receive Reaction",
+		URL:                  whatappReceiveURL,
+		Data:                 string(test.ReadFile("./testdata/wac/reaction.json")),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Handled",
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "whatsapp:5678", Time: time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC), Extra: map[string]string{"emoji": "👍", "action": "add", "external_id": "wamid.HBgLMTY0NjcwNDM1OTUVAgARGBI1RjQyNUE3NEYxMzAzMzQ5MkEA"}},
+		},
+		ExpectedContactName: Sp("Kerry Fisher"),
+		PrepRequest:         addValidSignature,
+	},
+	{
+		Label:                "Receive Reaction Removed",
+		URL:                  whatappReceiveURL,
+		Data:                 string(test.ReadFile("./testdata/wac/reaction_removed.json")),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Handled",
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "whatsapp:5678", Time: time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC), Extra: map[string]string{"emoji": "", "action": "remove", "external_id": "wamid.HBgLMTY0NjcwNDM1OTUVAgARGBI1RjQyNUE3NEYxMzAzMzQ5MkEA"}},
+		},
+		PrepRequest: addValidSignature,
+	},
 	{
 		Label:                "Receive Invalid JSON",
 		URL:                  whatappReceiveURL,
@@ -371,6 +409,44 @@ var whatsappOutgoingTests = []OutgoingTestCase{
 		},
 		ExpectedExtIDs: []string{"157b5e14568e8"},
 	},
+	{
+		Label:          "Contact Send",
+		MsgText:        "here's bob",
+		MsgURN:         "whatsapp:250788123123",
+		MsgAttachments: []string{"text/vcard:https://foo.bar/bob.vcf"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://foo.bar/bob.vcf": {
+				httpx.NewMockResponse(200, nil, []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;Bob;;;\r\nFN:Bob Smith\r\nTEL;TYPE=CELL:+250788123123\r\nEND:VCARD\r\n")),
+			},
+			"*/12345_ID/messages": {
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e8"}] }`)),
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e9"}] }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Body: ""},
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"contacts","contacts":[{"name":{"formatted_name":"Bob Smith","first_name":"Bob","last_name":"Smith"},"phones":[{"phone":"+250788123123","type":"CELL"}]}]}`},
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"text","text":{"body":"here's bob","preview_url":false}}`},
+		},
+		ExpectedExtIDs: []string{"157b5e14568e8", "157b5e14568e9"},
+	},
+	{
+		Label:          "Location Send",
+		MsgText:        "meet here",
+		MsgURN:         "whatsapp:250788123123",
+		MsgAttachments: []string{"geo:-1.950000,30.058000"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/12345_ID/messages": {
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e8"}] }`)),
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e9"}] }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"location","location":{"latitude":-1.95,"longitude":30.058}}`},
+			{Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"text","text":{"body":"meet here","preview_url":false}}`},
+		},
+		ExpectedExtIDs: []string{"157b5e14568e8", "157b5e14568e9"},
+	},
 	{
 		Label:          "Video Send",
 		MsgText:        "video caption",
@@ -644,6 +720,64 @@ var whatsappOutgoingTests = []OutgoingTestCase{
 		},
 		ExpectedExtIDs: []string{"157b5e14568e8"},
 	},
+	{
+		Label:                   "Reaction",
+		MsgURN:                  "whatsapp:250788123123",
+		MsgReaction:             &courier.MsgReaction{Emoji: "👍"},
+		MsgResponseToExternalID: "wamid.123",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/12345_ID/messages": {
+				httpx.NewMockResponse(201, nil, []byte(`{ "messages": [{"id": "157b5e14568e8"}] }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{
+				Path: "/12345_ID/messages",
+				Body: `{"messaging_product":"whatsapp","recipient_type":"individual","to":"250788123123","type":"reaction","reaction":{"message_id":"wamid.123","emoji":"👍"}}`,
+			},
+		},
+		ExpectedExtIDs: []string{"157b5e14568e8"},
+	},
+	{
+		Label:                   "Mark as read",
+		MsgURN:                  "whatsapp:250788123123",
+		MsgConversationAction:   courier.ConversationActionMarkRead,
+		MsgResponseToExternalID: "wamid.123",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/12345_ID/messages": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "success": true }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{
+				Path: "/12345_ID/messages",
+				Body: `{"messaging_product":"whatsapp","status":"read","message_id":"wamid.123"}`,
+			},
+		},
+	},
+	{
+		Label:                   "Typing indicator",
+		MsgURN:                  "whatsapp:250788123123",
+		MsgConversationAction:   courier.ConversationActionTyping,
+		MsgResponseToExternalID: "wamid.123",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/12345_ID/messages": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "success": true }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{
+				Path: "/12345_ID/messages",
+				Body: `{"messaging_product":"whatsapp","status":"read","message_id":"wamid.123","typing_indicator":{"type":"text"}}`,
+			},
+		},
+	},
+	{
+		Label:                 "Typing indicator without message",
+		MsgURN:                "whatsapp:250788123123",
+		MsgConversationAction: courier.ConversationActionTyping,
+		ExpectedError:         courier.ErrConversationActionUnsupported,
+	},
 	{
 		Label:   "Error Bad JSON",
 		MsgText: "Error",
@@ -722,6 +856,29 @@ func TestWhatsAppBuildAttachmentRequest(t *testing.T) {
 	assert.Equal(t, "Bearer wac_admin_system_user_token", req.Header.Get("Authorization"))
 }
 
+func TestWhatsAppResolveAttachment(t *testing.T) {
+	graphURL = createMockGraphAPI().URL
+
+	mb := test.NewMockBackend()
+	handler := &handler{NewBaseHandler(courier.ChannelType("WAC"), "WhatsApp Cloud", DisableUUIDRouting())}
+	handler.Initialize(newServerWithWAC(mb))
+	clog := courier.NewChannelLog(courier.ChannelLogTypeAttachmentFetch, whatsappTestChannels[0], handler.RedactValues(whatsappTestChannels[0]))
+
+	mediaURL, err := handler.ResolveAttachment(context.Background(), whatsappTestChannels[0], "id_image", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://foo.bar/attachmentURL_Image", mediaURL)
+	assert.Len(t, clog.HTTPLogs(), 1)
+
+	// with an invalid token we can't resolve media
+	config := courier.NewDefaultConfig()
+	config.WhatsappAdminSystemUserToken = "invalid"
+	handler.Initialize(courier.NewServer(config, mb))
+
+	_, err = handler.ResolveAttachment(context.Background(), whatsappTestChannels[0], "id_image", clog)
+	assert.EqualError(t, err, "error resolving media URL")
+	assert.Len(t, clog.HTTPLogs(), 2)
+}
+
 func newServerWithWAC(backend courier.Backend) courier.Server {
 	config := courier.NewDefaultConfig()
 	config.WhatsappAdminSystemUserToken = "wac_admin_system_user_token"
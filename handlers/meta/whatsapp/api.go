@@ -1,6 +1,9 @@
 package whatsapp
 
-import "github.com/nyaruka/courier"
+import (
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/handlers"
+)
 
 // see https://developers.facebook.com/docs/whatsapp/cloud-api/webhooks/payload-examples#message-status-updates
 var StatusMapping = map[string]courier.MsgStatus{
@@ -51,11 +54,12 @@ type Change struct {
 			Text struct {
 				Body string `json:"body"`
 			} `json:"text"`
-			Image    *MOMedia `json:"image"`
-			Audio    *MOMedia `json:"audio"`
-			Video    *MOMedia `json:"video"`
-			Document *MOMedia `json:"document"`
-			Voice    *MOMedia `json:"voice"`
+			Image    *MOMedia   `json:"image"`
+			Audio    *MOMedia   `json:"audio"`
+			Video    *MOMedia   `json:"video"`
+			Document *MOMedia   `json:"document"`
+			Voice    *MOMedia   `json:"voice"`
+			Contacts []*Contact `json:"contacts"`
 			Location *struct {
 				Latitude  float64 `json:"latitude"`
 				Longitude float64 `json:"longitude"`
@@ -66,6 +70,10 @@ type Change struct {
 				Text    string `json:"text"`
 				Payload string `json:"payload"`
 			} `json:"button"`
+			Reaction *struct {
+				MessageID string `json:"message_id"`
+				Emoji     string `json:"emoji"`
+			} `json:"reaction"`
 			Interactive struct {
 				Type        string `json:"type"`
 				ButtonReply struct {
@@ -220,6 +228,112 @@ type SendRequest struct {
 	Interactive *Interactive `json:"interactive,omitempty"`
 
 	Template *Template `json:"template,omitempty"`
+
+	Reaction *Reaction `json:"reaction,omitempty"`
+
+	Location *Location `json:"location,omitempty"`
+
+	Contacts []*Contact `json:"contacts,omitempty"`
+}
+
+// see https://developers.facebook.com/docs/whatsapp/cloud-api/reference/messages#contacts-object
+type Contact struct {
+	Name struct {
+		FormattedName string `json:"formatted_name"`
+		FirstName     string `json:"first_name,omitempty"`
+		LastName      string `json:"last_name,omitempty"`
+	} `json:"name"`
+	Phones []ContactPhone `json:"phones,omitempty"`
+	Emails []ContactEmail `json:"emails,omitempty"`
+	Org    *ContactOrg    `json:"org,omitempty"`
+}
+
+type ContactPhone struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type,omitempty"`
+	WaID  string `json:"wa_id,omitempty"`
+}
+
+type ContactEmail struct {
+	Email string `json:"email"`
+	Type  string `json:"type,omitempty"`
+}
+
+type ContactOrg struct {
+	Company string `json:"company"`
+}
+
+// VCard converts this contact to a contact card
+func (c *Contact) VCard() *handlers.VCard {
+	card := &handlers.VCard{Name: c.Name.FormattedName, FirstName: c.Name.FirstName, LastName: c.Name.LastName}
+	for _, p := range c.Phones {
+		card.Phones = append(card.Phones, handlers.VCardPhone{Number: p.Phone, Type: p.Type, WaID: p.WaID})
+	}
+	for _, e := range c.Emails {
+		card.Emails = append(card.Emails, e.Email)
+	}
+	if c.Org != nil {
+		card.Org = c.Org.Company
+	}
+	return card
+}
+
+// ContactMediaSupport is the media support for contact cards which are sent as native contacts
+var ContactMediaSupport = map[handlers.MediaType]handlers.MediaTypeSupport{
+	handlers.MediaTypeContact: {Types: []string{"text/vcard", "text/x-vcard"}},
+}
+
+// GetContactPayload converts a contact card to a contact for sending
+func GetContactPayload(card *handlers.VCard) *Contact {
+	contact := &Contact{}
+	contact.Name.FormattedName = card.FormattedName()
+	contact.Name.FirstName = card.FirstName
+	contact.Name.LastName = card.LastName
+	for _, p := range card.Phones {
+		contact.Phones = append(contact.Phones, ContactPhone{Phone: p.Number, Type: p.Type, WaID: p.WaID})
+	}
+	for _, e := range card.Emails {
+		contact.Emails = append(contact.Emails, ContactEmail{Email: e})
+	}
+	if card.Org != "" {
+		contact.Org = &ContactOrg{Company: card.Org}
+	}
+	return contact
+}
+
+// see https://developers.facebook.com/docs/whatsapp/cloud-api/reference/messages#location-object
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// see https://developers.facebook.com/docs/whatsapp/cloud-api/reference/messages#reaction-object
+type Reaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// see https://developers.facebook.com/docs/whatsapp/cloud-api/guides/mark-message-as-read
+//
+//	{
+//	  "messaging_product": "whatsapp",
+//	  "status": "read",
+//	  "message_id": "<WHATSAPP_MESSAGE_ID>",
+//	  "typing_indicator": {
+//	    "type": "text"
+//	  }
+//	}
+type StatusRequest struct {
+	MessagingProduct string           `json:"messaging_product"`
+	Status           string           `json:"status"`
+	MessageID        string           `json:"message_id"`
+	TypingIndicator  *TypingIndicator `json:"typing_indicator,omitempty"`
+}
+
+type TypingIndicator struct {
+	Type string `json:"type"`
 }
 
 // see https://developers.facebook.com/docs/whatsapp/cloud-api/guides/send-messages#response-syntax
@@ -12,6 +12,7 @@ import (
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/handlers"
 	"github.com/nyaruka/gocommon/gsm7"
+	"github.com/shopspring/decimal"
 
 	"github.com/buger/jsonparser"
 )
@@ -21,12 +22,14 @@ const (
 	configNexmoAPISecret     = "nexmo_api_secret"
 	configNexmoAppID         = "nexmo_app_id"
 	configNexmoAppPrivateKey = "nexmo_app_private_key"
+	configNexmoCurrency      = "nexmo_currency" // currency the account is billed in, message prices aren't recorded without it
 )
 
 var (
 	maxMsgLength = 1600
 	sendURL      = "https://rest.nexmo.com/sms/json"
-	throttledRE  = regexp.MustCompile(`.*Throughput Rate Exceeded - please wait \[ (\d+) \] and retry.*`)
+
+	throttledRE = regexp.MustCompile(`.*Throughput Rate Exceeded - please wait \[ (\d+) \] and retry.*`)
 
 	// https://developer.vonage.com/messaging/sms/guides/troubleshooting-sms#sms-api-error-codes
 	sendErrorCodes = map[int]string{
@@ -172,6 +175,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 
 	nexmoAPIKey := msg.Channel().StringConfigForKey(configNexmoAPIKey, "")
 	nexmoAPISecret := msg.Channel().StringConfigForKey(configNexmoAPISecret, "")
+	currency := msg.Channel().StringConfigForKey(configNexmoCurrency, "")
 	if nexmoAPIKey == "" || nexmoAPISecret == "" {
 		return courier.ErrChannelConfig
 	}
@@ -237,6 +241,20 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 			res.AddExternalID(externalID)
 		}
 
+		// long messages are sent as multiple messages, each with its own price in the account currency
+		messageCount, _ := jsonparser.GetString(respBody, "message-count")
+		segments, _ := strconv.Atoi(messageCount)
+		res.SetSegments(res.Segments() + segments)
+
+		if currency != "" {
+			jsonparser.ArrayEach(respBody, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+				price, _ := jsonparser.GetString(value, "message-price")
+				if amount, err := decimal.NewFromString(price); err == nil {
+					res.AddCost(amount, currency)
+				}
+			}, "messages")
+		}
+
 	}
 
 	return nil
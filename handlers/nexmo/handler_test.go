@@ -154,8 +154,8 @@ var defaultSendTestCases = []OutgoingTestCase{
 		MsgURN:  "tel:+250788383383",
 		MockResponses: map[string][]*httpx.MockResponse{
 			"https://rest.nexmo.com/sms/json": {
-				httpx.NewMockResponse(200, nil, []byte(`{"messages":[{"status":"0","message-id":"1002"}]}`)),
-				httpx.NewMockResponse(200, nil, []byte(`{"messages":[{"status":"0","message-id":"1002"}]}`)),
+				httpx.NewMockResponse(200, nil, []byte(`{"message-count":"1","messages":[{"status":"0","message-id":"1002","message-price":"0.03330000"}]}`)),
+				httpx.NewMockResponse(200, nil, []byte(`{"message-count":"1","messages":[{"status":"0","message-id":"1002","message-price":"0.03330000"}]}`)),
 			},
 		},
 		ExpectedRequests: []ExpectedRequest{
@@ -166,7 +166,9 @@ var defaultSendTestCases = []OutgoingTestCase{
 				Form: url.Values{"text": {"I need to keep adding more things to make it work"}, "to": {"250788383383"}, "from": {"2020"}, "api_key": {"nexmo-api-key"}, "api_secret": {"nexmo-api-secret"}, "status-report-req": {"1"}, "type": {"text"}, "callback": {"https://localhost/c/nx/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/status"}},
 			},
 		},
-		ExpectedExtIDs: []string{"1002", "1002"},
+		ExpectedExtIDs:   []string{"1002", "1002"},
+		ExpectedSegments: 2,
+		ExpectedCost:     "0.0666 EUR",
 	},
 	{
 		Label:          "Send Attachment",
@@ -252,7 +254,42 @@ func TestOutgoing(t *testing.T) {
 			configNexmoAPISecret:     "nexmo-api-secret",
 			configNexmoAppID:         "nexmo-app-id",
 			configNexmoAppPrivateKey: "nexmo-app-private-key",
+			configNexmoCurrency:      "EUR",
 		})
 
 	RunOutgoingTestCases(t, defaultChannel, newHandler(), defaultSendTestCases, []string{"nexmo-api-secret", "nexmo-app-private-key"}, nil)
 }
+
+var noCurrencySendTestCases = []OutgoingTestCase{
+	{
+		Label:   "Send Without Currency",
+		MsgText: "Simple Message",
+		MsgURN:  "tel:+250788383383",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://rest.nexmo.com/sms/json": {
+				httpx.NewMockResponse(200, nil, []byte(`{"message-count":"1","messages":[{"status":"0","message-id":"1002","message-price":"0.03330000"}]}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{
+				Form: url.Values{"text": {"Simple Message"}, "to": {"250788383383"}, "from": {"2020"}, "api_key": {"nexmo-api-key"}, "api_secret": {"nexmo-api-secret"}, "status-report-req": {"1"}, "type": {"text"}, "callback": {"https://localhost/c/nx/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/status"}},
+			},
+		},
+		ExpectedExtIDs:   []string{"1002"},
+		ExpectedSegments: 1,
+	},
+}
+
+func TestOutgoingWithoutCurrency(t *testing.T) {
+	maxMsgLength = 160
+	var channel = test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "NX", "2020", "US",
+		map[string]any{
+			configNexmoAPIKey:        "nexmo-api-key",
+			configNexmoAPISecret:     "nexmo-api-secret",
+			configNexmoAppID:         "nexmo-app-id",
+			configNexmoAppPrivateKey: "nexmo-app-private-key",
+		})
+
+	// prices aren't recorded as costs if we don't know what currency the account is billed in
+	RunOutgoingTestCases(t, channel, newHandler(), noCurrencySendTestCases, []string{"nexmo-api-secret", "nexmo-app-private-key"}, nil)
+}
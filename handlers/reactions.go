@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/gocommon/urns"
+)
+
+// NewReactionEvent creates a new reaction channel event for the message with the given external ID
+func NewReactionEvent(b courier.Backend, ch courier.Channel, urn urns.URN, externalID string, emoji string, action courier.ReactionAction, clog *courier.ChannelLog) courier.ChannelEvent {
+	return b.NewChannelEvent(ch, courier.EventTypeReaction, urn, clog).WithExtra(map[string]string{
+		courier.ReactionKeyEmoji:      emoji,
+		courier.ReactionKeyAction:     string(action),
+		courier.ReactionKeyExternalID: externalID,
+	})
+}
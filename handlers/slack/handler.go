@@ -97,8 +97,39 @@ func (h *handler) receiveEvent(ctx context.Context, channel courier.Channel, w h
 			msg.WithAttachment(attURL)
 		}
 
+		// messages posted in a thread are replies to the message which started the thread
+		if payload.Event.ThreadTS != "" && payload.Event.ThreadTS != payload.Event.TS {
+			msg.WithReplyTo(payload.Event.ThreadTS)
+		}
+
 		return handlers.WriteMsgsAndResponse(ctx, h, []courier.MsgIn{msg}, w, r, clog)
 	}
+
+	// reactions to messages are written as channel events, slack gives us the name of the emoji rather than the emoji itself
+	// see https://api.slack.com/events/reaction_added and https://api.slack.com/events/reaction_removed
+	if (payload.Event.Type == "reaction_added" || payload.Event.Type == "reaction_removed") && payload.Event.Item != nil && payload.Event.Item.Type == "message" {
+		clog.SetType(courier.ChannelLogTypeEventReceive)
+
+		date := time.Unix(int64(payload.EventTime), 0)
+
+		urn, err := urns.NewURNFromParts(urns.SlackScheme, payload.Event.User, "", "")
+		if err != nil {
+			return nil, handlers.WriteAndLogRequestError(ctx, h, channel, w, r, err)
+		}
+
+		action := courier.ReactionActionAdd
+		if payload.Event.Type == "reaction_removed" {
+			action = courier.ReactionActionRemove
+		}
+
+		event := handlers.NewReactionEvent(h.Backend(), channel, urn, payload.Event.Item.TS, payload.Event.Reaction, action, clog).WithOccurredOn(date)
+		if err := h.Backend().WriteChannelEvent(ctx, event, clog); err != nil {
+			return nil, err
+		}
+
+		return []courier.Event{event}, courier.WriteChannelEventSuccess(w, event)
+	}
+
 	return nil, handlers.WriteAndLogRequestIgnored(ctx, h, channel, w, r, "Ignoring request, no message")
 }
 
@@ -166,16 +197,19 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 	}
 
 	if msg.Text() != "" {
-		err := h.sendTextMsgPart(msg, botToken, clog)
+		externalID, err := h.sendTextMsgPart(msg, botToken, clog)
 		if err != nil {
 			return err
 		}
+		if externalID != "" {
+			res.AddExternalID(externalID)
+		}
 	}
 
 	return nil
 }
 
-func (h *handler) sendTextMsgPart(msg courier.MsgOut, token string, clog *courier.ChannelLog) error {
+func (h *handler) sendTextMsgPart(msg courier.MsgOut, token string, clog *courier.ChannelLog) (string, error) {
 	sendURL := apiURL + "/chat.postMessage"
 
 	msgPayload := &mtPayload{
@@ -185,37 +219,40 @@ func (h *handler) sendTextMsgPart(msg courier.MsgOut, token string, clog *courie
 
 	body, err := json.Marshal(msgPayload)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req, err := http.NewRequest(http.MethodPost, sendURL, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
 	resp, respBody, err := h.RequestHTTP(req, clog)
 	if err != nil || resp.StatusCode/100 != 2 {
-		return courier.ErrConnectionFailed
+		return "", courier.ErrConnectionFailed
 	} else if resp.StatusCode/100 != 2 {
-		return courier.ErrResponseStatus
+		return "", courier.ErrResponseStatus
 	}
 
 	ok, err := jsonparser.GetBoolean(respBody, "ok")
 	if err != nil {
-		return courier.ErrResponseUnexpected
+		return "", courier.ErrResponseUnexpected
 	}
 
 	if !ok {
 		errDescription, err := jsonparser.GetString(respBody, "error")
 		if err != nil {
-			return courier.ErrResponseUnexpected
+			return "", courier.ErrResponseUnexpected
 		}
 		clog.Error(courier.NewChannelError("", "", errDescription))
-		return courier.ErrFailedWithReason("", errDescription)
+		return "", courier.ErrFailedWithReason("", errDescription)
 	}
-	return nil
+
+	// the timestamp of the posted message is its id within the channel
+	ts, _ := jsonparser.GetString(respBody, "ts")
+	return ts, nil
 }
 
 func (h *handler) parseAttachmentToFileParams(msg courier.MsgOut, attachment string, clog *courier.ChannelLog) (*FileParams, error) {
@@ -226,7 +263,7 @@ func (h *handler) parseAttachmentToFileParams(msg courier.MsgOut, attachment str
 		return nil, errors.Wrapf(err, "error building file request")
 	}
 
-	resp, respBody, err := h.RequestHTTP(req, clog)
+	resp, respBody, err := h.RequestAttachmentHTTP(req, clog)
 	if err != nil || resp.StatusCode/100 != 2 {
 		return nil, errors.New("error fetching attachment")
 	}
@@ -335,6 +372,14 @@ type moPayload struct {
 		ChannelType string `json:"channel_type,omitempty"`
 		Files       []File `json:"files"`
 		BotID       string `json:"bot_id,omitempty"`
+		TS          string `json:"ts,omitempty"`
+		ThreadTS    string `json:"thread_ts,omitempty"`
+		Reaction    string `json:"reaction,omitempty"`
+		Item        *struct {
+			Type    string `json:"type"`
+			Channel string `json:"channel"`
+			TS      string `json:"ts"`
+		} `json:"item,omitempty"`
 	} `json:"event,omitempty"`
 	Type      string `json:"type,omitempty"`
 	EventID   string `json:"event_id,omitempty"`
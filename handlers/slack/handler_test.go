@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/buger/jsonparser"
 	"github.com/nyaruka/courier"
@@ -123,6 +124,84 @@ const videoFileMsg = `{
 	"event_time": 1653427243
 }`
 
+const threadReplyMsg = `{
+	"token": "one-long-verification-token",
+	"team_id": "T061EG9R6",
+	"api_app_id": "A0PNCHHK2",
+	"event": {
+			"type": "message",
+			"channel": "U0123ABCDEF",
+			"user": "U0123ABCDEF",
+			"text": "Replying in thread",
+			"ts": "1355517600.000008",
+			"thread_ts": "1355517523.000005",
+			"event_ts": "1355517600.000008",
+			"channel_type": "im"
+	},
+	"type": "event_callback",
+	"event_id": "Ev0PV52K28",
+	"event_time": 1355517600
+}`
+
+const reactionAddedMsg = `{
+	"token": "one-long-verification-token",
+	"team_id": "T061EG9R6",
+	"api_app_id": "A0PNCHHK2",
+	"event": {
+		"type": "reaction_added",
+		"user": "U0123ABCDEF",
+		"reaction": "thumbsup",
+		"item_user": "U0G9QF9C6",
+		"item": {
+			"type": "message",
+			"channel": "D0123ABCDEF",
+			"ts": "1360782400.498405"
+		},
+		"event_ts": "1360782804.083113"
+	},
+	"type": "event_callback",
+	"event_id": "Ev0PV52K25",
+	"event_time": 1360782804
+}`
+
+const reactionRemovedMsg = `{
+	"token": "one-long-verification-token",
+	"team_id": "T061EG9R6",
+	"api_app_id": "A0PNCHHK2",
+	"event": {
+		"type": "reaction_removed",
+		"user": "U0123ABCDEF",
+		"reaction": "thumbsup",
+		"item_user": "U0G9QF9C6",
+		"item": {
+			"type": "message",
+			"channel": "D0123ABCDEF",
+			"ts": "1360782400.498405"
+		},
+		"event_ts": "1360782804.083113"
+	},
+	"type": "event_callback",
+	"event_id": "Ev0PV52K26",
+	"event_time": 1360782804
+}`
+
+const fileReactionMsg = `{
+	"token": "one-long-verification-token",
+	"event": {
+		"type": "reaction_added",
+		"user": "U0123ABCDEF",
+		"reaction": "thumbsup",
+		"item": {
+			"type": "file",
+			"file": "F0HS27V1Z"
+		},
+		"event_ts": "1360782804.083113"
+	},
+	"type": "event_callback",
+	"event_id": "Ev0PV52K27",
+	"event_time": 1360782804
+}`
+
 var handleTestCases = []IncomingTestCase{
 	{
 		Label:                "Receive Hello Msg",
@@ -135,6 +214,18 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedExternalID:   "Ev0PV52K21",
 	},
+	{
+		Label:                "Receive thread reply",
+		URL:                  receiveURL,
+		Headers:              map[string]string{},
+		Data:                 threadReplyMsg,
+		ExpectedURN:          "slack:U0123ABCDEF",
+		ExpectedMsgText:      Sp("Replying in thread"),
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedExternalID:   "Ev0PV52K28",
+		ExpectedReplyTo:      "1355517523.000005",
+	},
 	{
 		Label:                "Receive image file",
 		URL:                  receiveURL,
@@ -170,6 +261,36 @@ var handleTestCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedExternalID:   "Ev0PV52K21",
 	},
+	{
+		Label:                "Receive reaction added",
+		URL:                  receiveURL,
+		Headers:              map[string]string{},
+		Data:                 reactionAddedMsg,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "slack:U0123ABCDEF", Time: time.Unix(1360782804, 0), Extra: map[string]string{"emoji": "thumbsup", "action": "add", "external_id": "1360782400.498405"}},
+		},
+	},
+	{
+		Label:                "Receive reaction removed",
+		URL:                  receiveURL,
+		Headers:              map[string]string{},
+		Data:                 reactionRemovedMsg,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "slack:U0123ABCDEF", Time: time.Unix(1360782804, 0), Extra: map[string]string{"emoji": "thumbsup", "action": "remove", "external_id": "1360782400.498405"}},
+		},
+	},
+	{
+		Label:                "Receive reaction to file",
+		URL:                  receiveURL,
+		Headers:              map[string]string{},
+		Data:                 fileReactionMsg,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Ignoring",
+	},
 }
 
 var defaultSendTestCases = []OutgoingTestCase{
@@ -179,12 +300,13 @@ var defaultSendTestCases = []OutgoingTestCase{
 		MsgURN:  "slack:U0123ABCDEF",
 		MockResponses: map[string][]*httpx.MockResponse{
 			"*/chat.postMessage": {
-				httpx.NewMockResponse(200, nil, []byte(`{"ok":true,"channel":"U0123ABCDEF"}`)),
+				httpx.NewMockResponse(200, nil, []byte(`{"ok":true,"channel":"U0123ABCDEF","ts":"1503435956.000247"}`)),
 			},
 		},
 		ExpectedRequests: []ExpectedRequest{{
 			Body: `{"channel":"U0123ABCDEF","text":"Simple Message"}`,
 		}},
+		ExpectedExtIDs: []string{"1503435956.000247"},
 	},
 	{
 		Label:   "Unicode Send",
@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"bytes"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/utils"
+	"github.com/nyaruka/gocommon/urns"
 	"golang.org/x/exp/slices"
 )
 
@@ -75,23 +77,65 @@ func SplitMsg(m courier.MsgOut, opts SplitOptions) []MsgPart {
 func SplitMsgByChannel(channel courier.Channel, text string, maxLength int) []string {
 	max := channel.IntConfigForKey(courier.ConfigMaxLength, maxLength)
 
+	if channel.IsScheme(urns.TelScheme) {
+		return SplitSMS(text, max, channel.BoolConfigForKey(courier.ConfigTransliterate, false))
+	}
+
 	return SplitText(text, max)
 }
 
+// SplitSMS splits the passed in string into segments that are at most max septets if it's GSM7, or if it's UCS2 and max
+// is a single segment, the equivalent number of code units (e.g. 70 for a max of 160), first replacing characters with
+// GSM7 equivalents if transliterate is true
+func SplitSMS(text string, max int, transliterate bool) []string {
+	if transliterate {
+		text = utils.TransliterateGSM7(text)
+	}
+
+	enc := utils.DetectSMSEncoding(text)
+	if enc != utils.SMSEncodingGSM7 {
+		max = utils.ScaleSMSLength(max, enc)
+	}
+
+	return splitText(text, max, func(r rune) int { return utils.SMSRuneLength(r, enc) })
+}
+
 // SplitText splits the passed in string into segments that are at most max length
 func SplitText(text string, max int) []string {
+	return splitText(text, max, utf8.RuneLen)
+}
+
+func splitText(text string, max int, runeLen func(rune) int) []string {
+	length := 0
+	for _, r := range text {
+		length += runeLen(r)
+	}
+
 	// smaller than our max, just return it
-	if len(text) <= max {
+	if length <= max {
 		return []string{text}
 	}
 
 	parts := make([]string, 0, 2)
-	part := bytes.Buffer{}
+	part := strings.Builder{}
+	size := 0
 	for _, r := range text {
+		n := runeLen(r)
+
+		// if this character won't fit, it has to start the next part
+		if size > 0 && size+n > max {
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+			size = 0
+		}
+
 		part.WriteRune(r)
-		if part.Len() == max || (part.Len() > max-6 && r == ' ') {
+		size += n
+
+		if size >= max || (size > max-6 && r == ' ') {
 			parts = append(parts, strings.TrimSpace(part.String()))
 			part.Reset()
+			size = 0
 		}
 	}
 	if part.Len() > 0 {
@@ -1,11 +1,13 @@
 package handlers_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/handlers"
 	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/urns"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -76,6 +78,35 @@ func TestSplitMsgByChannel(t *testing.T) {
 	assert.Equal(t, []string{"This is a message", "longer than 10"}, handlers.SplitMsgByChannel(channelWithMaxLength, "This is a message   longer than 10", 20))
 }
 
+func TestSplitMsgByChannelSMS(t *testing.T) {
+	var channel = test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "AC", "2020", "US", nil)
+	var transliterating = test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "AC", "2020", "US", map[string]any{courier.ConfigTransliterate: true})
+
+	// GSM7 characters which are multi-byte in UTF-8 only take one septet
+	assert.Equal(t, []string{"Très bien, à mercredi"}, handlers.SplitMsgByChannel(channel, "Très bien, à mercredi", 21))
+
+	// but extension characters take two
+	assert.Equal(t, []string{"Costs €10 or €20", "or €30"}, handlers.SplitMsgByChannel(channel, "Costs €10 or €20 or €30", 20))
+
+	// a curly quote makes the whole message UCS2, which has smaller segments
+	assert.Equal(t, []string{"It’s ok"}, handlers.SplitMsgByChannel(channel, "It’s ok", 160))
+	assert.Equal(t, []string{strings.Repeat("ç", 70), strings.Repeat("ç", 30)}, handlers.SplitMsgByChannel(channel, strings.Repeat("ç", 100), 160))
+
+	// but a max which is a limit on concatenated messages is left to the provider to split into segments
+	assert.Equal(t, []string{strings.Repeat("ç", 1000)}, handlers.SplitMsgByChannel(channel, strings.Repeat("ç", 1000), 1600))
+
+	// unless the channel transliterates
+	assert.Equal(t, []string{"It's ok"}, handlers.SplitMsgByChannel(transliterating, "It’s ok", 160))
+	assert.Equal(t, []string{"Wait... \"what\" - it's fine"}, handlers.SplitMsgByChannel(transliterating, "Wait… «what» — it’s fine", 160))
+
+	// characters outside the BMP take two UCS2 code units
+	assert.Equal(t, []string{"😀😀😀", "😀😀"}, handlers.SplitMsgByChannel(channel, "😀😀😀😀😀", 16))
+
+	// non-SMS channels are still split by bytes
+	channel.SetScheme(urns.TelegramScheme)
+	assert.Equal(t, []string{"Très bien, ça va très", "bien"}, handlers.SplitMsgByChannel(channel, "Très bien, ça va très bien", 26))
+}
+
 func TestSplitText(t *testing.T) {
 	assert.Equal(t, []string{""}, handlers.SplitText("", 160))
 	assert.Equal(t, []string{"Simple message"}, handlers.SplitText("Simple message", 160))
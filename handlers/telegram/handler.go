@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -26,6 +27,7 @@ var mediaSupport = map[handlers.MediaType]handlers.MediaTypeSupport{
 	handlers.MediaTypeAudio:       {MaxBytes: 50 * 1024 * 1024},
 	handlers.MediaTypeVideo:       {MaxBytes: 50 * 1024 * 1024},
 	handlers.MediaTypeApplication: {Types: []string{"application/pdf"}, MaxBytes: 50 * 1024 * 1024},
+	handlers.MediaTypeContact:     {Types: []string{"text/vcard", "text/x-vcard"}},
 }
 
 func init() {
@@ -36,6 +38,10 @@ type handler struct {
 	handlers.BaseHandler
 }
 
+var _ courier.ReactionSender = (*handler)(nil)
+var _ courier.ConversationActions = (*handler)(nil)
+var _ courier.AttachmentResolver = (*handler)(nil)
+
 func newHandler() courier.ChannelHandler {
 	return &handler{handlers.NewBaseHandler(courier.ChannelType("TG"), "Telegram")}
 }
@@ -49,6 +55,11 @@ func (h *handler) Initialize(s courier.Server) error {
 
 // receiveMessage is our HTTP handler function for incoming messages
 func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w http.ResponseWriter, r *http.Request, payload *moPayload, clog *courier.ChannelLog) ([]courier.Event, error) {
+	// reactions to messages are written as channel events
+	if payload.MessageReaction != nil {
+		return h.receiveReaction(ctx, channel, w, r, payload, clog)
+	}
+
 	// no message? ignore this
 	if payload.Message.MessageID == 0 {
 		return nil, handlers.WriteAndLogRequestIgnored(ctx, h, channel, w, r, "Ignoring request, no message")
@@ -84,8 +95,9 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 		text = payload.Message.Caption
 	}
 
-	// deal with attachments
+	// deal with attachments, files being resolved and fetched once the message has been written
 	mediaURL := ""
+	var location *courier.MsgLocation
 	if len(payload.Message.Photo) > 0 {
 		// grab the largest photo less than 100k
 		photo := payload.Message.Photo[0]
@@ -95,32 +107,47 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 			}
 			photo = payload.Message.Photo[i]
 		}
-		mediaURL, err = h.resolveFileID(ctx, channel, photo.FileID, clog)
+		mediaURL = courier.PendingAttachment(photo.FileID)
 	} else if payload.Message.Video != nil {
-		mediaURL, err = h.resolveFileID(ctx, channel, payload.Message.Video.FileID, clog)
+		mediaURL = courier.PendingAttachment(payload.Message.Video.FileID)
 	} else if payload.Message.Voice != nil {
-		mediaURL, err = h.resolveFileID(ctx, channel, payload.Message.Voice.FileID, clog)
+		mediaURL = courier.PendingAttachment(payload.Message.Voice.FileID)
 	} else if payload.Message.Sticker != nil {
-		mediaURL, err = h.resolveFileID(ctx, channel, payload.Message.Sticker.Thumb.FileID, clog)
+		mediaURL = courier.PendingAttachment(payload.Message.Sticker.Thumb.FileID)
 	} else if payload.Message.Document != nil {
-		mediaURL, err = h.resolveFileID(ctx, channel, payload.Message.Document.FileID, clog)
+		mediaURL = courier.PendingAttachment(payload.Message.Document.FileID)
 	} else if payload.Message.Venue != nil {
-		text = utils.JoinNonEmpty(", ", payload.Message.Venue.Title, payload.Message.Venue.Address)
-		mediaURL = fmt.Sprintf("geo:%f,%f", payload.Message.Location.Latitude, payload.Message.Location.Longitude)
+		venueLocation := payload.Message.Venue.Location
+		if venueLocation == nil {
+			venueLocation = payload.Message.Location
+		}
+		if venueLocation != nil {
+			text = utils.JoinNonEmpty(", ", payload.Message.Venue.Title, payload.Message.Venue.Address)
+			location = &courier.MsgLocation{Latitude: venueLocation.Latitude, Longitude: venueLocation.Longitude, Name: payload.Message.Venue.Title, Address: payload.Message.Venue.Address}
+		}
 	} else if payload.Message.Location != nil {
 		text = fmt.Sprintf("%f,%f", payload.Message.Location.Latitude, payload.Message.Location.Longitude)
-		mediaURL = fmt.Sprintf("geo:%f,%f", payload.Message.Location.Latitude, payload.Message.Location.Longitude)
+		location = &courier.MsgLocation{Latitude: payload.Message.Location.Latitude, Longitude: payload.Message.Location.Longitude}
 	} else if payload.Message.Contact != nil {
 		phone := ""
 		if payload.Message.Contact.PhoneNumber != "" {
 			phone = fmt.Sprintf("(%s)", payload.Message.Contact.PhoneNumber)
 		}
 		text = utils.JoinNonEmpty(" ", payload.Message.Contact.FirstName, payload.Message.Contact.LastName, phone)
-	}
 
-	// we had an error downloading media
-	if err != nil && text == "" {
-		return nil, handlers.WriteAndLogRequestIgnored(ctx, h, channel, w, r, fmt.Sprintf("unable to resolve file: %s", err.Error()))
+		// use the contact's full vCard if we have one, otherwise build one from what we do have
+		card, cardErr := handlers.ParseVCard([]byte(payload.Message.Contact.VCard))
+		if cardErr != nil {
+			card = &handlers.VCard{FirstName: payload.Message.Contact.FirstName, LastName: payload.Message.Contact.LastName}
+			if payload.Message.Contact.PhoneNumber != "" {
+				card.Phones = []handlers.VCardPhone{{Number: payload.Message.Contact.PhoneNumber, Type: "CELL"}}
+			}
+		}
+
+		mediaURL, err = handlers.SaveVCard(ctx, h.Backend(), channel, card)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// build our msg
@@ -129,10 +156,82 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 	if mediaURL != "" {
 		msg.WithAttachment(mediaURL)
 	}
+	if location != nil {
+		handlers.AddLocation(msg, location.Latitude, location.Longitude, location.Name, location.Address)
+	}
+
+	// this is a reply to a previous message
+	if payload.Message.ReplyTo != nil && payload.Message.ReplyTo.MessageID != 0 {
+		msg.WithReplyTo(fmt.Sprintf("%d", payload.Message.ReplyTo.MessageID))
+	}
+
 	// and finally write our message
 	return handlers.WriteMsgsAndResponse(ctx, h, []courier.MsgIn{msg}, w, r, clog)
 }
 
+// receiveReaction handles a change to the reactions of a user on a message, writing an event for each emoji added or removed
+func (h *handler) receiveReaction(ctx context.Context, channel courier.Channel, w http.ResponseWriter, r *http.Request, payload *moPayload, clog *courier.ChannelLog) ([]courier.Event, error) {
+	clog.SetType(courier.ChannelLogTypeEventReceive)
+
+	reaction := payload.MessageReaction
+	date := time.Unix(reaction.Date, 0).UTC()
+	externalID := fmt.Sprintf("%d", reaction.MessageID)
+
+	urn, err := urns.NewTelegramURN(reaction.User.ContactID, strings.ToLower(reaction.User.Username))
+	if err != nil {
+		return nil, handlers.WriteAndLogRequestError(ctx, h, channel, w, r, err)
+	}
+	name := handlers.NameFromFirstLastUsername(reaction.User.FirstName, reaction.User.LastName, reaction.User.Username)
+
+	oldEmojis := emojisFromReactions(reaction.OldReaction)
+	newEmojis := emojisFromReactions(reaction.NewReaction)
+
+	events := make([]courier.Event, 0, 2)
+	data := make([]any, 0, 2)
+
+	addEvent := func(emoji string, action courier.ReactionAction) error {
+		event := handlers.NewReactionEvent(h.Backend(), channel, urn, externalID, emoji, action, clog).WithContactName(name).WithOccurredOn(date)
+		if err := h.Backend().WriteChannelEvent(ctx, event, clog); err != nil {
+			return err
+		}
+		events = append(events, event)
+		data = append(data, courier.NewEventReceiveData(event))
+		return nil
+	}
+
+	for _, emoji := range newEmojis {
+		if !slices.Contains(oldEmojis, emoji) {
+			if err := addEvent(emoji, courier.ReactionActionAdd); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, emoji := range oldEmojis {
+		if !slices.Contains(newEmojis, emoji) {
+			if err := addEvent(emoji, courier.ReactionActionRemove); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, handlers.WriteAndLogRequestIgnored(ctx, h, channel, w, r, "Ignoring request, no reaction changes")
+	}
+
+	return events, courier.WriteDataResponse(w, http.StatusOK, "Events Handled", data)
+}
+
+// emojisFromReactions returns the emojis of the given reactions, ignoring custom emoji reactions
+func emojisFromReactions(reactions []moReaction) []string {
+	emojis := make([]string, 0, len(reactions))
+	for _, r := range reactions {
+		if r.Type == "emoji" && r.Emoji != "" {
+			emojis = append(emojis, r.Emoji)
+		}
+	}
+	return emojis
+}
+
 type mtResponse struct {
 	Ok          bool   `json:"ok" validate:"required"`
 	ErrorCode   int    `json:"error_code"`
@@ -188,14 +287,17 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 		return courier.ErrChannelConfig
 	}
 
-	attachments, err := handlers.ResolveAttachments(ctx, h.Backend(), msg.Attachments(), mediaSupport, true, clog)
+	// locations are sent natively so don't need resolving as media
+	locations, others := handlers.SplitGeoAttachments(msg.Attachments())
+
+	attachments, err := handlers.ResolveAttachments(ctx, h.Backend(), h.Server().Config(), others, mediaSupport, true, clog)
 	if err != nil {
 		return errors.Wrap(err, "error resolving attachments")
 	}
 
-	// we only caption if there is only a single attachment
+	// we only caption if there is only a single attachment, and contacts can't have captions
 	caption := ""
-	if len(attachments) == 1 {
+	if len(attachments) == 1 && attachments[0].Type != handlers.MediaTypeContact {
 		caption = msg.Text()
 	}
 
@@ -209,7 +311,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 	// if we have text, send that if we aren't sending it as a caption
 	if msg.Text() != "" && caption == "" {
 		var msgKeyBoard *ReplyKeyboardMarkup
-		if len(attachments) == 0 {
+		if len(attachments) == 0 && len(locations) == 0 {
 			msgKeyBoard = keyboard
 		}
 
@@ -226,7 +328,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 	// send each attachment
 	for i, attachment := range attachments {
 		var attachmentKeyBoard *ReplyKeyboardMarkup
-		if i == len(msg.Attachments())-1 {
+		if i == len(attachments)-1 && len(locations) == 0 {
 			attachmentKeyBoard = keyboard
 		}
 
@@ -279,11 +381,134 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 			}
 			res.AddExternalID(externalID)
 
+		case handlers.MediaTypeContact:
+			card, err := h.FetchVCard(ctx, attachment.URL, clog)
+			if err != nil {
+				return err
+			}
+
+			// telegram can only share contacts which have a phone number
+			if len(card.Phones) == 0 {
+				clog.Error(courier.ErrorMediaUnsupported(attachment.ContentType))
+				break
+			}
+
+			firstName := card.FirstName
+			if firstName == "" {
+				firstName = card.FormattedName()
+			}
+
+			form := url.Values{
+				"chat_id":      []string{msg.URN().Path()},
+				"phone_number": []string{card.Phones[0].Number},
+				"first_name":   []string{firstName},
+				"last_name":    []string{card.LastName},
+				"vcard":        []string{string(card.Marshal())},
+			}
+			externalID, err := h.sendMsgPart(msg, authToken, "sendContact", form, attachmentKeyBoard, clog)
+			if err != nil {
+				return err
+			}
+			res.AddExternalID(externalID)
+
 		default:
 			clog.Error(courier.ErrorMediaUnsupported(attachment.ContentType))
 		}
 	}
 
+	// and finally each location
+	for i, location := range locations {
+		var locationKeyBoard *ReplyKeyboardMarkup
+		if i == len(locations)-1 {
+			locationKeyBoard = keyboard
+		}
+
+		form := url.Values{
+			"chat_id":   []string{msg.URN().Path()},
+			"latitude":  []string{strconv.FormatFloat(location.Latitude, 'f', -1, 64)},
+			"longitude": []string{strconv.FormatFloat(location.Longitude, 'f', -1, 64)},
+		}
+		externalID, err := h.sendMsgPart(msg, authToken, "sendLocation", form, locationKeyBoard, clog)
+		if err != nil {
+			return err
+		}
+		res.AddExternalID(externalID)
+	}
+
+	return nil
+}
+
+type actionResponse struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// SendReaction sets (or clears if the emoji is empty) the reaction of our bot on the message being responded to
+func (h *handler) SendReaction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	authToken := msg.Channel().StringConfigForKey(courier.ConfigAuthToken, "")
+	if authToken == "" {
+		return courier.ErrChannelConfig
+	}
+
+	reactions := []moReaction{}
+	if msg.Reaction().Emoji != "" {
+		reactions = append(reactions, moReaction{Type: "emoji", Emoji: msg.Reaction().Emoji})
+	}
+
+	form := url.Values{
+		"chat_id":    []string{msg.URN().Path()},
+		"message_id": []string{msg.ResponseToExternalID()},
+		"reaction":   []string{string(jsonx.MustMarshal(reactions))},
+	}
+
+	return h.sendAction(authToken, "setMessageReaction", form, clog)
+}
+
+// SendConversationAction shows a typing indicator in the chat, bots have no way to mark messages as read
+func (h *handler) SendConversationAction(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
+	if msg.ConversationAction() != courier.ConversationActionTyping {
+		return courier.ErrConversationActionUnsupported
+	}
+
+	authToken := msg.Channel().StringConfigForKey(courier.ConfigAuthToken, "")
+	if authToken == "" {
+		return courier.ErrChannelConfig
+	}
+
+	form := url.Values{
+		"chat_id": []string{msg.URN().Path()},
+		"action":  []string{"typing"},
+	}
+
+	return h.sendAction(authToken, "sendChatAction", form, clog)
+}
+
+// sendAction calls an API method which doesn't create a message and so just returns true on success
+func (h *handler) sendAction(token, path string, form url.Values, clog *courier.ChannelLog) error {
+	sendURL := fmt.Sprintf("%s/bot%s/%s", apiURL, token, path)
+	req, err := http.NewRequest(http.MethodPost, sendURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, respBody, err := h.RequestHTTP(req, clog)
+	if err != nil || resp.StatusCode/100 == 5 {
+		return courier.ErrConnectionFailed
+	}
+
+	response := &actionResponse{}
+	err = json.Unmarshal(respBody, response)
+	if err != nil || resp.StatusCode/100 != 2 || !response.Ok {
+		if response.ErrorCode == 403 && response.Description == "Forbidden: bot was blocked by the user" {
+			return courier.ErrContactStopped
+		} else if response.ErrorCode > 0 {
+			return courier.ErrFailedWithReason(strconv.Itoa(response.ErrorCode), response.Description)
+		}
+		return courier.ErrResponseStatus
+	}
+
 	return nil
 }
 
@@ -296,6 +521,11 @@ type fileResponse struct {
 	} `json:"result"`
 }
 
+// ResolveAttachment resolves the ID of a file received by a channel to the URL it can be downloaded from
+func (h *handler) ResolveAttachment(ctx context.Context, channel courier.Channel, fileID string, clog *courier.ChannelLog) (string, error) {
+	return h.resolveFileID(ctx, channel, fileID, clog)
+}
+
 func (h *handler) resolveFileID(ctx context.Context, channel courier.Channel, fileID string, clog *courier.ChannelLog) (string, error) {
 	confAuth := channel.ConfigForKey(courier.ConfigAuthToken, "")
 	authToken, isStr := confAuth.(string)
@@ -346,6 +576,19 @@ type moFile struct {
 	FileSize int    `json:"file_size"`
 }
 
+type moUser struct {
+	ContactID int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+// see https://core.telegram.org/bots/api#reactiontype
+type moReaction struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji,omitempty"`
+}
+
 type moLocation struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
@@ -374,14 +617,12 @@ type moLocation struct {
 type moPayload struct {
 	UpdateID int64 `json:"update_id" validate:"required"`
 	Message  struct {
-		MessageID int64 `json:"message_id"`
-		From      struct {
-			ContactID int64  `json:"id"`
-			FirstName string `json:"first_name"`
-			LastName  string `json:"last_name"`
-			Username  string `json:"username"`
-		} `json:"from"`
-		Date    int64  `json:"date"`
+		MessageID int64  `json:"message_id"`
+		From      moUser `json:"from"`
+		Date      int64  `json:"date"`
+		ReplyTo   *struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"reply_to_message"`
 		Text    string `json:"text"`
 		Caption string `json:"caption"`
 		Sticker *struct {
@@ -401,6 +642,14 @@ type moPayload struct {
 			PhoneNumber string `json:"phone_number"`
 			FirstName   string `json:"first_name"`
 			LastName    string `json:"last_name"`
+			VCard       string `json:"vcard"`
 		}
 	} `json:"message"`
+	MessageReaction *struct {
+		MessageID   int64        `json:"message_id"`
+		User        moUser       `json:"user"`
+		Date        int64        `json:"date"`
+		OldReaction []moReaction `json:"old_reaction"`
+		NewReaction []moReaction `json:"new_reaction"`
+	} `json:"message_reaction"`
 }
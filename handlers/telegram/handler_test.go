@@ -1,11 +1,11 @@
 package telegram
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +13,7 @@ import (
 	. "github.com/nyaruka/courier/handlers"
 	"github.com/nyaruka/courier/test"
 	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
 )
 
 var helloMsg = `{
@@ -36,6 +37,39 @@ var helloMsg = `{
   }
 }`
 
+var replyMsg = `{
+  "update_id": 174114375,
+  "message": {
+	"message_id": 42,
+	"from": {
+		"id": 3527065,
+		"first_name": "Nic",
+		"last_name": "Pottier",
+		"username": "nicpottier"
+	},
+	"chat": {
+		"id": 3527065,
+		"type": "private"
+	},
+	"date": 1454119029,
+	"reply_to_message": {
+		"message_id": 133,
+		"from": {
+			"id": 12345,
+			"is_bot": true,
+			"first_name": "Bot"
+		},
+		"chat": {
+			"id": 3527065,
+			"type": "private"
+		},
+		"date": 1454119000,
+		"text": "How are you?"
+	},
+	"text": "Fine thanks"
+  }
+}`
+
 var startMsg = `{
     "update_id": 174114370,
     "message": {
@@ -125,166 +159,6 @@ var invalidFileID = `
   }
 }`
 
-var notOkFile = `
-{
-  "update_id":174114373,
-  "message":{
-    "message_id":44,
-    "from":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier"
-    },
-    "chat":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier",
-      "type":"private"
-    },
-    "date":1454119668,
-    "sticker":{
-      "width":436,
-      "height":512,
-      "thumb":{
-        "file_id":"notok",
-        "file_size":2510,
-        "width":77,
-        "height":90
-      },
-      "file_id":"BQADAwADRQADyIsGAAHtBskMy6GoLAI",
-      "file_size":38440
-    }
-  }
-}`
-
-var noOkFile = `
-{
-  "update_id":174114373,
-  "message":{
-    "message_id":44,
-    "from":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier"
-    },
-    "chat":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier",
-      "type":"private"
-    },
-    "date":1454119668,
-    "sticker":{
-      "width":436,
-      "height":512,
-      "thumb":{
-        "file_id":"nook",
-        "file_size":2510,
-        "width":77,
-        "height":90
-      },
-      "file_id":"BQADAwADRQADyIsGAAHtBskMy6GoLAI",
-      "file_size":38440
-    }
-  }
-}`
-
-var invalidJsonFile = `
-{
-  "update_id":174114373,
-  "message":{
-    "message_id":44,
-    "from":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier"
-    },
-    "chat":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier",
-      "type":"private"
-    },
-    "date":1454119668,
-    "sticker":{
-      "width":436,
-      "height":512,
-      "thumb":{
-        "file_id":"invalidjson",
-        "file_size":2510,
-        "width":77,
-        "height":90
-      },
-      "file_id":"BQADAwADRQADyIsGAAHtBskMy6GoLAI",
-      "file_size":38440
-    }
-  }
-}`
-
-var errorFile = `
-{
-  "update_id":174114373,
-  "message":{
-    "message_id":44,
-    "from":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier"
-    },
-    "chat":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier",
-      "type":"private"
-    },
-    "date":1454119668,
-    "sticker":{
-      "width":436,
-      "height":512,
-      "thumb":{
-        "file_id":"error",
-        "file_size":2510,
-        "width":77,
-        "height":90
-      },
-      "file_id":"BQADAwADRQADyIsGAAHtBskMy6GoLAI",
-      "file_size":38440
-    }
-  }
-}`
-
-var noFile = `
-{
-  "update_id":174114373,
-  "message":{
-    "message_id":44,
-    "from":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier"
-    },
-    "chat":{
-      "id":3527065,
-      "first_name":"Nic",
-      "last_name":"Pottier",
-      "type":"private"
-    },
-    "date":1454119668,
-    "sticker":{
-      "width":436,
-      "height":512,
-      "thumb":{
-        "file_id":"nofile",
-        "file_size":2510,
-        "width":77,
-        "height":90
-      },
-      "file_id":"BQADAwADRQADyIsGAAHtBskMy6GoLAI",
-      "file_size":38440
-    }
-  }
-}`
-
 var photoMsg = `
 {
     "update_id": 900946525,
@@ -513,6 +387,49 @@ var contactMsg = `
     }
 }`
 
+var reactionMsg = `
+{
+    "update_id": 174114373,
+    "message_reaction": {
+        "chat": {
+            "id": 3527065,
+            "first_name": "Nic",
+            "last_name": "Pottier",
+            "type": "private"
+        },
+        "message_id": 41,
+        "user": {
+            "id": 3527065,
+            "first_name": "Nic",
+            "last_name": "Pottier",
+            "username": "nicpottier"
+        },
+        "date": 1454119029,
+        "old_reaction": [{"type": "emoji", "emoji": "👎"}],
+        "new_reaction": [{"type": "emoji", "emoji": "👍"}, {"type": "custom_emoji", "custom_emoji_id": "1234"}]
+    }
+}`
+
+var unchangedReactionMsg = `
+{
+    "update_id": 174114374,
+    "message_reaction": {
+        "chat": {
+            "id": 3527065,
+            "type": "private"
+        },
+        "message_id": 41,
+        "user": {
+            "id": 3527065,
+            "first_name": "Nic",
+            "username": "nicpottier"
+        },
+        "date": 1454119029,
+        "old_reaction": [],
+        "new_reaction": [{"type": "custom_emoji", "custom_emoji_id": "1234"}]
+    }
+}`
+
 var testCases = []IncomingTestCase{
 	{
 
@@ -527,6 +444,18 @@ var testCases = []IncomingTestCase{
 		ExpectedExternalID:   "41",
 		ExpectedDate:         time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
 	},
+	{
+		Label:                "Receive Reply Message",
+		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
+		Data:                 replyMsg,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Accepted",
+		ExpectedContactName:  Sp("Nic Pottier"),
+		ExpectedMsgText:      Sp("Fine thanks"),
+		ExpectedURN:          "telegram:3527065#nicpottier",
+		ExpectedExternalID:   "42",
+		ExpectedReplyTo:      "133",
+	},
 	{
 
 		Label:                "Receive Start Message",
@@ -539,6 +468,25 @@ var testCases = []IncomingTestCase{
 			{Type: courier.EventTypeNewConversation, URN: "telegram:3527065#nicpottier", Time: time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC)},
 		},
 	},
+	{
+		Label:                "Receive Reaction",
+		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
+		Data:                 reactionMsg,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Events Handled",
+		ExpectedContactName:  Sp("Nic Pottier"),
+		ExpectedEvents: []ExpectedEvent{
+			{Type: courier.EventTypeReaction, URN: "telegram:3527065#nicpottier", Time: time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC), Extra: map[string]string{"emoji": "👍", "action": "add", "external_id": "41"}},
+			{Type: courier.EventTypeReaction, URN: "telegram:3527065#nicpottier", Time: time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC), Extra: map[string]string{"emoji": "👎", "action": "remove", "external_id": "41"}},
+		},
+	},
+	{
+		Label:                "Receive Unchanged Reaction",
+		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
+		Data:                 unchangedReactionMsg,
+		ExpectedRespStatus:   200,
+		ExpectedBodyContains: "Ignoring request, no reaction changes",
+	},
 	{
 		Label:                "Receive No Params",
 		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
@@ -561,7 +509,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp(""),
-		ExpectedAttachments:  []string{"/file/bota123/sticker.jpg"},
+		ExpectedAttachments:  []string{"pending:AAQDABNW--sqAAS6easb1s1rNdJYAAIC"},
 		ExpectedURN:          "telegram:3527065",
 		ExpectedExternalID:   "44",
 		ExpectedDate:         time.Date(2016, 1, 30, 2, 07, 48, 0, time.UTC),
@@ -574,7 +522,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp("Photo Caption"),
-		ExpectedAttachments:  []string{"/file/bota123/photo.jpg"},
+		ExpectedAttachments:  []string{"pending:AgADAQADtKcxG4LRUUQSQVUjfJIiiF8G6C8ABF8Fy2sccmWmjHcBAAEC"},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "85",
 		ExpectedDate:         time.Date(2017, 5, 3, 20, 28, 38, 0, time.UTC),
@@ -587,7 +535,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp(""),
-		ExpectedAttachments:  []string{"/file/bota123/video.jpg"},
+		ExpectedAttachments:  []string{"pending:BAADAQADBgADgtFRRPFTAAHxLVw76wI"},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "86",
 		ExpectedDate:         time.Date(2017, 5, 3, 20, 29, 24, 0, time.UTC),
@@ -600,7 +548,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp(""),
-		ExpectedAttachments:  []string{"/file/bota123/voice.mp4"},
+		ExpectedAttachments:  []string{"pending:AwADAQADCQADgtFRRGn8KrC-0D_MAg"},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "91",
 		ExpectedDate:         time.Date(2017, 5, 3, 20, 50, 46, 0, time.UTC),
@@ -613,7 +561,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp(""),
-		ExpectedAttachments:  []string{"/file/bota123/document.xls"},
+		ExpectedAttachments:  []string{"pending:BQADAQADCgADgtFRRPrv9GQ95f8eAg"},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "92",
 		ExpectedDate:         time.Date(2017, 5, 3, 20, 58, 20, 0, time.UTC),
@@ -627,6 +575,7 @@ var testCases = []IncomingTestCase{
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp("-2.890287,-79.004333"),
 		ExpectedAttachments:  []string{"geo:-2.890287,-79.004333"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: -2.890287, Longitude: -79.004333},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "94",
 		ExpectedDate:         time.Date(2017, 5, 3, 21, 00, 44, 0, time.UTC),
@@ -640,6 +589,7 @@ var testCases = []IncomingTestCase{
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp("Cuenca, Provincia del Azuay"),
 		ExpectedAttachments:  []string{"geo:-2.898944,-79.006835"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: -2.898944, Longitude: -79.006835, Name: "Cuenca", Address: "Provincia del Azuay"},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "95",
 		ExpectedDate:         time.Date(2017, 5, 3, 21, 05, 20, 0, time.UTC),
@@ -652,6 +602,7 @@ var testCases = []IncomingTestCase{
 		ExpectedBodyContains: "Accepted",
 		ExpectedContactName:  Sp("Nic Pottier"),
 		ExpectedMsgText:      Sp("Adolf Taxi (0788531373)"),
+		ExpectedAttachments:  []string{"text/vcard:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.vcf"},
 		ExpectedURN:          "telegram:3527065#nicpottier",
 		ExpectedExternalID:   "96",
 		ExpectedDate:         time.Date(2017, 5, 3, 21, 9, 15, 0, time.UTC),
@@ -668,49 +619,16 @@ var testCases = []IncomingTestCase{
 		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
 		Data:                 invalidFileID,
 		ExpectedRespStatus:   200,
-		ExpectedBodyContains: "unable to resolve file",
-		ExpectedErrors:       []*courier.ChannelError{courier.ErrorResponseUnparseable("JSON")},
-	},
-	{
-		Label:                "Receive NoOk FileID",
-		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
-		Data:                 noOkFile,
-		ExpectedRespStatus:   200,
-		ExpectedBodyContains: "not present",
-	},
-	{
-		Label:                "Receive invalid JSON File response",
-		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
-		Data:                 invalidJsonFile,
-		ExpectedRespStatus:   200,
-		ExpectedBodyContains: "unable to resolve file",
-		ExpectedErrors:       []*courier.ChannelError{courier.ErrorResponseUnparseable("JSON")},
-	},
-	{
-		Label:                "Receive error File response",
-		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
-		Data:                 errorFile,
-		ExpectedRespStatus:   200,
-		ExpectedBodyContains: "unable to resolve file",
-		ExpectedErrors:       []*courier.ChannelError{courier.ErrorExternal("500", "error loading file")},
-	},
-	{
-		Label:                "Receive NotOk FileID",
-		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
-		Data:                 notOkFile,
-		ExpectedRespStatus:   200,
-		ExpectedBodyContains: "not present",
-	},
-	{
-		Label:                "Receive No FileID",
-		URL:                  "/c/tg/8eb23e93-5ecb-45ba-b726-3b064e0c568c/receive/",
-		Data:                 noFile,
-		ExpectedRespStatus:   200,
-		ExpectedBodyContains: "result.file_path",
+		ExpectedBodyContains: "Accepted",
+		ExpectedContactName:  Sp("Nic Pottier"),
+		ExpectedMsgText:      Sp(""),
+		ExpectedAttachments:  []string{"pending:invalid"},
+		ExpectedURN:          "telegram:3527065",
+		ExpectedExternalID:   "44",
 	},
 }
 
-func buildMockTelegramService(testCases []IncomingTestCase) *httptest.Server {
+func buildMockTelegramService() *httptest.Server {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fileID := r.FormValue("file_id")
 		defer r.Body.Close()
@@ -754,20 +672,49 @@ func buildMockTelegramService(testCases []IncomingTestCase) *httptest.Server {
 
 	apiURL = server.URL
 
-	// update our tests media urls
-	for _, tc := range testCases {
-		for i := range tc.ExpectedAttachments {
-			if !strings.HasPrefix(tc.ExpectedAttachments[i], "geo:") {
-				tc.ExpectedAttachments[i] = fmt.Sprintf("%s%s", apiURL, tc.ExpectedAttachments[i])
-			}
-		}
+	return server
+}
+
+func TestResolveAttachment(t *testing.T) {
+	telegramService := buildMockTelegramService()
+	defer telegramService.Close()
+
+	ch := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c568c", "TG", "2020", "US", map[string]any{"auth_token": "a123"})
+	h := newHandler().(*handler)
+	h.Initialize(courier.NewServer(courier.NewDefaultConfig(), test.NewMockBackend()))
+
+	tcs := []struct {
+		fileID         string
+		expectedURL    string
+		expectedError  string
+		expectedErrors []*courier.ChannelError
+	}{
+		{fileID: "AgADAQADtKcxG4LRUUQSQVUjfJIiiF8G6C8ABF8Fy2sccmWmjHcBAAEC", expectedURL: apiURL + "/file/bota123/photo.jpg"},
+		{fileID: "invalid", expectedError: "unable to resolve file", expectedErrors: []*courier.ChannelError{courier.ErrorResponseUnparseable("JSON")}},
+		{fileID: "notok", expectedError: "file id 'notok' not present"},
+		{fileID: "nook", expectedError: "file id 'nook' not present"},
+		{fileID: "invalidjson", expectedError: "unable to resolve file", expectedErrors: []*courier.ChannelError{courier.ErrorResponseUnparseable("JSON")}},
+		{fileID: "error", expectedError: "unable to resolve file", expectedErrors: []*courier.ChannelError{courier.ErrorExternal("500", "error loading file")}},
+		{fileID: "nofile", expectedError: "no 'result.file_path' in response"},
 	}
 
-	return server
+	for _, tc := range tcs {
+		clog := courier.NewChannelLogForAttachmentFetch(ch, h.RedactValues(ch))
+
+		mediaURL, err := h.ResolveAttachment(context.Background(), ch, tc.fileID, clog)
+		if tc.expectedError != "" {
+			assert.EqualError(t, err, tc.expectedError, "error mismatch for file %s", tc.fileID)
+		} else {
+			assert.NoError(t, err, "unexpected error for file %s", tc.fileID)
+			assert.Equal(t, tc.expectedURL, mediaURL, "URL mismatch for file %s", tc.fileID)
+		}
+		assert.Equal(t, tc.expectedErrors, clog.Errors(), "channel errors mismatch for file %s", tc.fileID)
+		assert.Len(t, clog.HTTPLogs(), 1)
+	}
 }
 
 func TestIncoming(t *testing.T) {
-	telegramService := buildMockTelegramService(testCases)
+	telegramService := buildMockTelegramService()
 	defer telegramService.Close()
 
 	chs := []courier.Channel{
@@ -843,6 +790,68 @@ var outgoingCases = []OutgoingTestCase{
 		},
 		ExpectedError: courier.ErrFailedWithReason("400", "Bot domain invalid."),
 	},
+	{
+		Label:                   "Reaction",
+		MsgURN:                  "telegram:12345",
+		MsgReaction:             &courier.MsgReaction{Emoji: "👍"},
+		MsgResponseToExternalID: "41",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/botauth_token/setMessageReaction": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": true }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Form: url.Values{"chat_id": {"12345"}, "message_id": {"41"}, "reaction": {`[{"type":"emoji","emoji":"👍"}]`}}},
+		},
+	},
+	{
+		Label:                   "Reaction removed",
+		MsgURN:                  "telegram:12345",
+		MsgReaction:             &courier.MsgReaction{Emoji: ""},
+		MsgResponseToExternalID: "41",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/botauth_token/setMessageReaction": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": true }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Form: url.Values{"chat_id": {"12345"}, "message_id": {"41"}, "reaction": {`[]`}}},
+		},
+	},
+	{
+		Label:                   "Reaction error",
+		MsgURN:                  "telegram:12345",
+		MsgReaction:             &courier.MsgReaction{Emoji: "🦄"},
+		MsgResponseToExternalID: "41",
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/botauth_token/setMessageReaction": {
+				httpx.NewMockResponse(400, nil, []byte(`{ "ok": false, "error_code": 400, "description": "Bad Request: REACTION_INVALID" }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Form: url.Values{"chat_id": {"12345"}, "message_id": {"41"}, "reaction": {`[{"type":"emoji","emoji":"🦄"}]`}}},
+		},
+		ExpectedError: courier.ErrFailedWithReason("400", "Bad Request: REACTION_INVALID"),
+	},
+	{
+		Label:                 "Typing indicator",
+		MsgURN:                "telegram:12345",
+		MsgConversationAction: courier.ConversationActionTyping,
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/botauth_token/sendChatAction": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": true }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Form: url.Values{"chat_id": {"12345"}, "action": {"typing"}}},
+		},
+	},
+	{
+		Label:                 "Mark as read",
+		MsgURN:                "telegram:12345",
+		MsgConversationAction: courier.ConversationActionMarkRead,
+		ExpectedError:         courier.ErrConversationActionUnsupported,
+	},
 	{
 		Label:   "Stopped Contact Code",
 		MsgText: "Stopped Contact",
@@ -917,6 +926,61 @@ var outgoingCases = []OutgoingTestCase{
 		},
 		ExpectedExtIDs: []string{"133"},
 	},
+	{
+		Label:           "Send Location",
+		MsgText:         "Meet here",
+		MsgURN:          "telegram:12345",
+		MsgAttachments:  []string{"geo:-1.950000,30.058000"},
+		MsgQuickReplies: []string{"OK"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"*/botauth_token/sendMessage": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": { "message_id": 133 } }`)),
+			},
+			"*/botauth_token/sendLocation": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": { "message_id": 134 } }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Form: url.Values{"text": {"Meet here"}, "chat_id": {"12345"}, "parse_mode": []string{"Markdown"}, "reply_markup": {`{"remove_keyboard":true}`}}},
+			{Form: url.Values{"chat_id": {"12345"}, "latitude": {"-1.95"}, "longitude": {"30.058"}, "parse_mode": []string{"Markdown"}, "reply_markup": {`{"keyboard":[[{"text":"OK"}]],"resize_keyboard":true,"one_time_keyboard":true}`}}},
+		},
+		ExpectedExtIDs: []string{"133", "134"},
+	},
+	{
+		Label:          "Send Contact",
+		MsgText:        "Here's Bob",
+		MsgURN:         "telegram:12345",
+		MsgAttachments: []string{"text/vcard:https://foo.bar/bob.vcf"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://foo.bar/bob.vcf": {
+				httpx.NewMockResponse(200, nil, []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;Bob;;;\r\nFN:Bob Smith\r\nTEL;TYPE=CELL:+250788123123\r\nEND:VCARD\r\n")),
+			},
+			"*/botauth_token/sendMessage": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": { "message_id": 133 } }`)),
+			},
+			"*/botauth_token/sendContact": {
+				httpx.NewMockResponse(200, nil, []byte(`{ "ok": true, "result": { "message_id": 134 } }`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{Form: url.Values{"text": {"Here's Bob"}, "chat_id": {"12345"}, "parse_mode": []string{"Markdown"}, "reply_markup": {`{"remove_keyboard":true}`}}},
+			{},
+			{Form: url.Values{"chat_id": {"12345"}, "phone_number": {"+250788123123"}, "first_name": {"Bob"}, "last_name": {"Smith"}, "vcard": {"BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;Bob;;;\r\nFN:Bob Smith\r\nTEL;TYPE=CELL:+250788123123\r\nEND:VCARD\r\n"}, "parse_mode": []string{"Markdown"}, "reply_markup": {`{"remove_keyboard":true}`}}},
+		},
+		ExpectedExtIDs: []string{"133", "134"},
+	},
+	{
+		Label:          "Send Contact Without Phone",
+		MsgURN:         "telegram:12345",
+		MsgAttachments: []string{"text/vcard:https://foo.bar/bob.vcf"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://foo.bar/bob.vcf": {
+				httpx.NewMockResponse(200, nil, []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bob\r\nEND:VCARD\r\n")),
+			},
+		},
+		ExpectedRequests:  []ExpectedRequest{{}},
+		ExpectedLogErrors: []*courier.ChannelError{courier.ErrorMediaUnsupported("text/vcard")},
+	},
 	{
 		Label:             "Unknown attachment type",
 		MsgText:           "My foo!",
@@ -22,6 +22,8 @@ import (
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +36,8 @@ type ExpectedStatus struct {
 	MsgID      courier.MsgID
 	ExternalID string
 	Status     courier.MsgStatus
+	Segments   int
+	Cost       string // amount and currency, e.g. "0.0075 USD"
 }
 
 // ExpectedEvent is an expected channel event
@@ -63,8 +67,10 @@ type IncomingTestCase struct {
 	ExpectedURN           urns.URN
 	ExpectedURNAuthTokens map[urns.URN]map[string]string
 	ExpectedAttachments   []string
+	ExpectedLocation      *courier.MsgLocation
 	ExpectedDate          time.Time
 	ExpectedExternalID    string
+	ExpectedReplyTo       string
 	ExpectedMsgID         int64
 	ExpectedStatuses      []ExpectedStatus
 	ExpectedEvents        []ExpectedEvent
@@ -157,12 +163,17 @@ func RunIncomingTestCases(t *testing.T, channels []courier.Channel, handler cour
 	}
 	handler.Initialize(s)
 
+	defer uuids.SetGenerator(uuids.DefaultGenerator)
+
 	for _, tc := range testCases {
 		t.Run(tc.Label, func(t *testing.T) {
 			require := require.New(t)
 
 			mb.Reset()
 
+			// so that URLs of any attachments saved to storage are predictable
+			uuids.SetGenerator(uuids.NewSeededGenerator(1234))
+
 			testHandlerRequest(t, s, tc.URL, tc.Headers, tc.Data, tc.MultipartForm, tc.ExpectedRespStatus, tc.ExpectedBodyContains, tc.PrepRequest)
 
 			if tc.ExpectedMsgText != nil || tc.ExpectedAttachments != nil {
@@ -181,6 +192,8 @@ func RunIncomingTestCases(t *testing.T, channels []courier.Channel, handler cour
 				if tc.ExpectedExternalID != "" {
 					assert.Equal(t, tc.ExpectedExternalID, msg.ExternalID())
 				}
+				assert.Equal(t, tc.ExpectedReplyTo, msg.ReplyToExternalID())
+				assert.Equal(t, tc.ExpectedLocation, msg.Location())
 				assert.Equal(t, tc.ExpectedURN, msg.URN())
 			} else {
 				assert.Empty(t, mb.WrittenMsgs(), "unexpected msg written")
@@ -197,6 +210,8 @@ func RunIncomingTestCases(t *testing.T, channels []courier.Channel, handler cour
 				assert.Equal(t, expectedStatus.MsgID, actualStatus.MsgID(), "msg id mismatch for update %d", i)
 				assert.Equal(t, expectedStatus.ExternalID, actualStatus.ExternalID(), "external id mismatch for update %d", i)
 				assert.Equal(t, expectedStatus.Status, actualStatus.Status(), "status value mismatch for update %d", i)
+				assert.Equal(t, expectedStatus.Segments, actualStatus.Segments(), "segments mismatch for update %d", i)
+				assert.Equal(t, expectedStatus.Cost, formatCost(actualStatus.Cost()), "cost mismatch for update %d", i)
 			}
 
 			actualEvents := mb.WrittenChannelEvents()
@@ -306,6 +321,8 @@ type OutgoingTestCase struct {
 	MsgMetadata             json.RawMessage
 	MsgFlow                 *courier.FlowReference
 	MsgOptIn                *courier.OptInReference
+	MsgReaction             *courier.MsgReaction
+	MsgConversationAction   courier.ConversationAction
 	MsgUserID               courier.UserID
 	MsgOrigin               courier.MsgOrigin
 	MsgContactLastSeenOn    *time.Time
@@ -318,6 +335,8 @@ type OutgoingTestCase struct {
 	ExpectedLogErrors   []*courier.ChannelError
 	ExpectedContactURNs map[string]bool
 	ExpectedNewURN      string
+	ExpectedSegments    int
+	ExpectedCost        string // amount and currency, e.g. "0.0075 USD"
 }
 
 // Msg creates the test message for this test case
@@ -346,6 +365,12 @@ func (tc *OutgoingTestCase) Msg(mb *test.MockBackend, ch courier.Channel) courie
 	if tc.MsgOptIn != nil {
 		m.WithOptIn(tc.MsgOptIn)
 	}
+	if tc.MsgReaction != nil {
+		m.WithReaction(tc.MsgReaction)
+	}
+	if tc.MsgConversationAction != "" {
+		m.WithConversationAction(tc.MsgConversationAction)
+	}
 	return m
 }
 
@@ -379,7 +404,15 @@ func RunOutgoingTestCases(t *testing.T, channel courier.Channel, handler courier
 			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
 
 			res := &courier.SendResult{}
-			serr := handler.Send(ctx, msg, res, clog)
+
+			var serr error
+			if msg.Reaction() != nil {
+				serr = handler.(courier.ReactionSender).SendReaction(ctx, msg, res, clog)
+			} else if msg.ConversationAction() != "" {
+				serr = handler.(courier.ConversationActions).SendConversationAction(ctx, msg, res, clog)
+			} else {
+				serr = handler.Send(ctx, msg, res, clog)
+			}
 			externalIDs := res.ExternalIDs()
 			resNewURN := res.GetNewURN()
 
@@ -407,6 +440,8 @@ func RunOutgoingTestCases(t *testing.T, channel courier.Channel, handler courier
 			assert.Equal(t, tc.ExpectedExtIDs, externalIDs, "external IDs mismatch")
 			assert.Equal(t, tc.ExpectedError, serr, "send method error mismatch")
 			assert.Equal(t, tc.ExpectedLogErrors, clog.Errors(), "channel log errors mismatch")
+			assert.Equal(t, tc.ExpectedSegments, res.Segments(), "segments mismatch")
+			assert.Equal(t, tc.ExpectedCost, formatCost(res.Cost()), "cost mismatch")
 
 			if tc.ExpectedContactURNs != nil {
 				var contactUUID courier.ContactUUID
@@ -476,3 +511,10 @@ func AssertChannelLogRedaction(t *testing.T, clog *courier.ChannelLog, vals []st
 
 // Sp is a utility method to get the pointer to the passed in string
 func Sp(s string) *string { return &s }
+
+func formatCost(amount decimal.Decimal, currency string) string {
+	if currency == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", amount, currency)
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/nyaruka/courier/utils"
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/shopspring/decimal"
 )
 
 const (
@@ -225,7 +226,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 
 	channel := msg.Channel()
 
-	attachments, err := handlers.ResolveAttachments(ctx, h.Backend(), msg.Attachments(), mediaSupport, true, clog)
+	attachments, err := handlers.ResolveAttachments(ctx, h.Backend(), h.Server().Config(), msg.Attachments(), mediaSupport, true, clog)
 	if err != nil {
 		return err
 	}
@@ -310,6 +311,17 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 			res.AddExternalID(externalID)
 		}
 
+		// and the segments and price if known, the latter being negative and often not yet available
+		if numSegments, _ := jsonparser.GetString(respBody, "num_segments"); numSegments != "" {
+			segments, _ := strconv.Atoi(numSegments)
+			res.SetSegments(res.Segments() + segments)
+		}
+		price, _ := jsonparser.GetString(respBody, "price")
+		priceUnit, _ := jsonparser.GetString(respBody, "price_unit")
+		if amount, err := decimal.NewFromString(price); err == nil && priceUnit != "" {
+			res.AddCost(amount.Abs(), priceUnit)
+		}
+
 	}
 
 	return nil
@@ -567,8 +567,8 @@ var defaultSendTestCases = []OutgoingTestCase{
 		MsgURN:  "tel:+250788383383",
 		MockResponses: map[string][]*httpx.MockResponse{
 			"https://api.twilio.com/2010-04-01/Accounts/accountSID/Messages.json": {
-				httpx.NewMockResponse(200, nil, []byte(`{ "sid": "1002" }`)),
-				httpx.NewMockResponse(200, nil, []byte(`{ "sid": "1002" }`)),
+				httpx.NewMockResponse(200, nil, []byte(`{ "sid": "1002", "num_segments": "1", "price": "-0.00790", "price_unit": "USD" }`)),
+				httpx.NewMockResponse(200, nil, []byte(`{ "sid": "1002", "num_segments": "1", "price": null, "price_unit": "USD" }`)),
 			},
 		},
 		ExpectedRequests: []ExpectedRequest{
@@ -583,7 +583,9 @@ var defaultSendTestCases = []OutgoingTestCase{
 				Form:    url.Values{"Body": {"I need to keep adding more things to make it work"}, "To": {"+250788383383"}, "From": {"2020"}, "StatusCallback": {"https://localhost/c/t/8eb23e93-5ecb-45ba-b726-3b064e0c56ab/status?id=10&action=callback"}},
 			},
 		},
-		ExpectedExtIDs: []string{"1002", "1002"},
+		ExpectedExtIDs:   []string{"1002", "1002"},
+		ExpectedSegments: 2,
+		ExpectedCost:     "0.0079 USD",
 	},
 	{
 		Label:   "Error Sending",
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/utils"
+	"github.com/pkg/errors"
+)
+
+// VCardContentType is the content type of saved contact card attachments
+const VCardContentType = "text/vcard"
+
+// VCard is a contact card shared in a message
+type VCard struct {
+	Name      string
+	FirstName string
+	LastName  string
+	Org       string
+	Phones    []VCardPhone
+	Emails    []string
+}
+
+// VCardPhone is a phone number on a contact card
+type VCardPhone struct {
+	Number string
+	Type   string
+	WaID   string
+}
+
+// FormattedName returns the display name of this card, falling back to the first and last names, or first phone number
+func (c *VCard) FormattedName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if name := utils.JoinNonEmpty(" ", c.FirstName, c.LastName); name != "" {
+		return name
+	}
+	if len(c.Phones) > 0 {
+		return c.Phones[0].Number
+	}
+	return ""
+}
+
+// Marshal encodes this card as a vCard 3.0
+func (c *VCard) Marshal() []byte {
+	b := &bytes.Buffer{}
+	line := func(s string) { b.WriteString(s + "\r\n") }
+
+	line("BEGIN:VCARD")
+	line("VERSION:3.0")
+	line(fmt.Sprintf("N:%s;%s;;;", escapeVCardValue(c.LastName), escapeVCardValue(c.FirstName)))
+	line("FN:" + escapeVCardValue(c.FormattedName()))
+	if c.Org != "" {
+		line("ORG:" + escapeVCardValue(c.Org))
+	}
+	for _, p := range c.Phones {
+		prop := "TEL"
+		if p.Type != "" {
+			prop += ";TYPE=" + strings.ToUpper(p.Type)
+		}
+		if p.WaID != "" {
+			prop += ";waid=" + p.WaID
+		}
+		line(prop + ":" + escapeVCardValue(p.Number))
+	}
+	for _, e := range c.Emails {
+		line("EMAIL:" + escapeVCardValue(e))
+	}
+	line("END:VCARD")
+
+	return b.Bytes()
+}
+
+// ParseVCard parses the first contact card in the given vCard data
+func ParseVCard(data []byte) (*VCard, error) {
+	// unfold any continuation lines, which start with a space or tab
+	lines := make([]string, 0, 10)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		l := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+			lines[len(lines)-1] += l[1:]
+		} else if strings.TrimSpace(l) != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	card := &VCard{}
+	started := false
+
+	for _, l := range lines {
+		nameAndParams, value, found := strings.Cut(l, ":")
+		if !found {
+			continue
+		}
+		params := strings.Split(nameAndParams, ";")
+		name := strings.ToUpper(params[0])
+
+		// strip any group prefix, e.g. item1.TEL
+		if _, after, grouped := strings.Cut(name, "."); grouped {
+			name = after
+		}
+
+		if name == "BEGIN" && strings.EqualFold(value, "VCARD") {
+			started = true
+			continue
+		}
+		if !started {
+			continue
+		}
+
+		switch name {
+		case "END":
+			return card, nil
+		case "FN":
+			card.Name = unescapeVCardValue(value)
+		case "N":
+			parts := splitVCardValue(value)
+			card.LastName = parts[0]
+			if len(parts) > 1 {
+				card.FirstName = parts[1]
+			}
+		case "ORG":
+			card.Org = splitVCardValue(value)[0]
+		case "TEL":
+			phone := VCardPhone{Number: unescapeVCardValue(value)}
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(p, "=")
+				switch strings.ToUpper(k) {
+				case "TYPE":
+					phone.Type = strings.ToUpper(strings.Split(v, ",")[0])
+				case "WAID":
+					phone.WaID = v
+				}
+			}
+			card.Phones = append(card.Phones, phone)
+		case "EMAIL":
+			card.Emails = append(card.Emails, unescapeVCardValue(value))
+		}
+	}
+
+	if !started {
+		return nil, errors.New("no vCard found in data")
+	}
+	return card, nil
+}
+
+// SaveVCard saves the given contact card to backend storage, returning it as a text/vcard attachment
+func SaveVCard(ctx context.Context, b courier.Backend, channel courier.Channel, card *VCard) (string, error) {
+	url, err := b.SaveAttachment(ctx, channel, VCardContentType, card.Marshal(), "vcf")
+	if err != nil {
+		return "", errors.Wrap(err, "error saving vCard")
+	}
+	return fmt.Sprintf("%s:%s", VCardContentType, url), nil
+}
+
+// FetchVCard fetches and parses the contact card at the given URL, logging the request but not the card itself
+func (h *BaseHandler) FetchVCard(ctx context.Context, url string, clog *courier.ChannelLog) (*VCard, error) {
+	fetchURL, err := courier.FetchableAttachmentURL(ctx, h.backend, h.server.Config(), url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching vCard from %s", url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the card is contact details which we don't want in the channel log, and as one of the message's attachments it's
+	// fetched even when sending on a sandboxed channel
+	resp, body, err := h.requestHTTP(h.backend.HttpClient(true), req, clog, false, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching vCard from %s", url)
+	}
+	if resp.StatusCode/100 == 5 {
+		return nil, errors.Wrapf(courier.ErrConnectionFailed, "error fetching vCard from %s", url)
+	} else if resp.StatusCode/100 != 2 {
+		return nil, errors.Wrapf(courier.ErrResponseStatus, "error fetching vCard from %s", url)
+	}
+
+	return ParseVCard(body)
+}
+
+// SplitVCardAttachments separates any text/vcard attachments in the passed in attachments from the others
+func SplitVCardAttachments(attachments []string) ([]string, []string) {
+	vcards := make([]string, 0)
+	others := make([]string, 0, len(attachments))
+
+	for _, a := range attachments {
+		contentType, _ := SplitAttachment(a)
+		if mediaType, _ := parseContentType(contentType); mediaType == MediaTypeContact {
+			vcards = append(vcards, a)
+		} else {
+			others = append(others, a)
+		}
+	}
+
+	return vcards, others
+}
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+var vcardUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";")
+
+func escapeVCardValue(v string) string {
+	return vcardEscaper.Replace(strings.ReplaceAll(v, "\r", ""))
+}
+
+func unescapeVCardValue(v string) string {
+	return vcardUnescaper.Replace(v)
+}
+
+// splits a structured value like N or ORG on unescaped semicolons
+func splitVCardValue(v string) []string {
+	parts := make([]string, 0, 5)
+	part := &strings.Builder{}
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			part.WriteByte(v[i])
+			part.WriteByte(v[i+1])
+			i++
+		} else if v[i] == ';' {
+			parts = append(parts, unescapeVCardValue(part.String()))
+			part.Reset()
+		} else {
+			part.WriteByte(v[i])
+		}
+	}
+	return append(parts, unescapeVCardValue(part.String()))
+}
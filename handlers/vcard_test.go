@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/handlers"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVCard(t *testing.T) {
+	card := &handlers.VCard{
+		Name:      "Bob Smith",
+		FirstName: "Bob",
+		LastName:  "Smith",
+		Org:       "Acme, Inc.",
+		Phones:    []handlers.VCardPhone{{Number: "+1 650-555-1234", Type: "cell", WaID: "16505551234"}, {Number: "+1 650-555-9999"}},
+		Emails:    []string{"bob@acme.com"},
+	}
+
+	assert.Equal(t, "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;Bob;;;\r\nFN:Bob Smith\r\nORG:Acme\\, Inc.\r\nTEL;TYPE=CELL;waid=16505551234:+1 650-555-1234\r\nTEL:+1 650-555-9999\r\nEMAIL:bob@acme.com\r\nEND:VCARD\r\n", string(card.Marshal()))
+
+	// should round trip
+	parsed, err := handlers.ParseVCard(card.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, &handlers.VCard{
+		Name:      "Bob Smith",
+		FirstName: "Bob",
+		LastName:  "Smith",
+		Org:       "Acme, Inc.",
+		Phones:    []handlers.VCardPhone{{Number: "+1 650-555-1234", Type: "CELL", WaID: "16505551234"}, {Number: "+1 650-555-9999"}},
+		Emails:    []string{"bob@acme.com"},
+	}, parsed)
+
+	// formatted name falls back to first and last names, then phone number
+	assert.Equal(t, "Bob Smith", (&handlers.VCard{FirstName: "Bob", LastName: "Smith"}).FormattedName())
+	assert.Equal(t, "+250788123123", (&handlers.VCard{Phones: []handlers.VCardPhone{{Number: "+250788123123"}}}).FormattedName())
+	assert.Equal(t, "", (&handlers.VCard{}).FormattedName())
+
+	// folded lines, grouped properties and vCard 2.1 style params
+	parsed, err = handlers.ParseVCard([]byte("BEGIN:VCARD\nVERSION:2.1\nN:Pottier;Nic\nFN:Nic \n Pottier\nitem1.TEL;type=HOME,VOICE:0788531373\nEND:VCARD\nBEGIN:VCARD\nFN:Other\nEND:VCARD\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, &handlers.VCard{Name: "Nic Pottier", FirstName: "Nic", LastName: "Pottier", Phones: []handlers.VCardPhone{{Number: "0788531373", Type: "HOME"}}}, parsed)
+
+	_, err = handlers.ParseVCard([]byte("hello"))
+	assert.EqualError(t, err, "no vCard found in data")
+
+	_, err = handlers.ParseVCard(nil)
+	assert.EqualError(t, err, "no vCard found in data")
+}
+
+func TestFetchVCard(t *testing.T) {
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://example.com/bob.vcf": {
+			httpx.NewMockResponse(200, nil, []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bob Smith\r\nTEL:+250788123123\r\nEND:VCARD\r\n")),
+			httpx.NewMockResponse(404, nil, []byte("not found")),
+			httpx.NewMockResponse(503, nil, []byte("unavailable")),
+			httpx.MockConnectionError,
+			httpx.NewMockResponse(200, nil, []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bob Smith\r\nTEL:+250788123123\r\nEND:VCARD\r\n")),
+		},
+	}))
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	mb := test.NewMockBackend()
+	mc := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "NX", "12345", "RW", map[string]any{})
+	clog := courier.NewChannelLog(courier.ChannelLogTypeAttachmentFetch, mc, nil)
+
+	h := handlers.NewBaseHandler("NX", "Test")
+	h.SetServer(test.NewMockServer(courier.NewDefaultConfig(), mb))
+
+	card, err := h.FetchVCard(context.Background(), "https://example.com/bob.vcf", clog)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob Smith", card.Name)
+	assert.Equal(t, []handlers.VCardPhone{{Number: "+250788123123"}}, card.Phones)
+
+	// request is logged but not the contact details in the response
+	require.Len(t, clog.HTTPLogs(), 1)
+	assert.Equal(t, 200, clog.HTTPLogs()[0].StatusCode)
+	assert.NotContains(t, clog.HTTPLogs()[0].Response, "Bob Smith")
+	assert.NotContains(t, clog.HTTPLogs()[0].Response, "+250788123123")
+
+	// failures are send errors so that the send log records why
+	_, err = h.FetchVCard(context.Background(), "https://example.com/bob.vcf", clog)
+	assert.EqualError(t, err, "error fetching vCard from https://example.com/bob.vcf: response status code")
+	assert.ErrorIs(t, err, courier.ErrResponseStatus)
+
+	_, err = h.FetchVCard(context.Background(), "https://example.com/bob.vcf", clog)
+	assert.ErrorIs(t, err, courier.ErrConnectionFailed)
+
+	_, err = h.FetchVCard(context.Background(), "https://example.com/bob.vcf", clog)
+	assert.EqualError(t, err, "error fetching vCard from https://example.com/bob.vcf: unable to connect to server")
+
+	// cards are fetched even when sending on a sandboxed channel
+	mc.SetConfig(courier.ConfigSandbox, true)
+	mm := mb.NewOutgoingMsg(mc, 123, urns.URN("tel:+1234"), "Hello World", false, nil, "", "", courier.MsgOriginChat, nil)
+
+	card, err = h.FetchVCard(context.Background(), "https://example.com/bob.vcf", courier.NewChannelLogForSend(mm, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob Smith", card.Name)
+}
+
+func TestSaveVCard(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	ch := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "WAC", "12345", "RW", nil)
+
+	att, err := handlers.SaveVCard(ctx, mb, ch, &handlers.VCard{FirstName: "Bob", Phones: []handlers.VCardPhone{{Number: "+250788123123"}}})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^text/vcard:https://backend\.com/attachments/[0-9a-f-]+\.vcf$`, att)
+
+	require.Len(t, mb.SavedAttachments(), 1)
+	assert.Equal(t, "text/vcard", mb.SavedAttachments()[0].ContentType)
+	assert.Equal(t, "vcf", mb.SavedAttachments()[0].Extension)
+	assert.Equal(t, "BEGIN:VCARD\r\nVERSION:3.0\r\nN:;Bob;;;\r\nFN:Bob\r\nTEL:+250788123123\r\nEND:VCARD\r\n", string(mb.SavedAttachments()[0].Data))
+}
+
+func TestSplitVCardAttachments(t *testing.T) {
+	vcards, others := handlers.SplitVCardAttachments([]string{"image/jpeg:https://example.com/test.jpg", "text/vcard:https://example.com/bob.vcf", "text/x-vcard:https://example.com/jim.vcf", "text/plain:https://example.com/test.txt"})
+	assert.Equal(t, []string{"text/vcard:https://example.com/bob.vcf", "text/x-vcard:https://example.com/jim.vcf"}, vcards)
+	assert.Equal(t, []string{"image/jpeg:https://example.com/test.jpg", "text/plain:https://example.com/test.txt"}, others)
+}
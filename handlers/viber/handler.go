@@ -101,6 +101,7 @@ type eventPayload struct {
 		Location struct {
 			Latitude  float64 `json:"lat"`
 			Longitude float64 `json:"lon"`
+			Address   string  `json:"address"`
 		}
 		Type         string `json:"type"`
 		TrackingData string `json:"tracking_data"`
@@ -227,6 +228,7 @@ func (h *handler) receiveEvent(ctx context.Context, channel courier.Channel, w h
 
 		text := payload.Message.Text
 		mediaURL := ""
+		var location *courier.MsgLocation
 
 		// process any attached media
 		messageType := payload.Message.Type
@@ -248,7 +250,7 @@ func (h *handler) receiveEvent(ctx context.Context, channel courier.Channel, w h
 			text = payload.Message.Media
 
 		case "location":
-			mediaURL = fmt.Sprintf("geo:%f,%f", payload.Message.Location.Latitude, payload.Message.Location.Longitude)
+			location = &courier.MsgLocation{Latitude: payload.Message.Location.Latitude, Longitude: payload.Message.Location.Longitude, Address: payload.Message.Location.Address}
 
 		case "text":
 			text = payload.Message.Text
@@ -257,7 +259,7 @@ func (h *handler) receiveEvent(ctx context.Context, channel courier.Channel, w h
 			return nil, handlers.WriteAndLogRequestError(ctx, h, channel, w, r, fmt.Errorf("unknown message type: %s", messageType))
 		}
 
-		if text == "" && mediaURL == "" {
+		if text == "" && mediaURL == "" && location == nil {
 			return nil, handlers.WriteAndLogRequestError(ctx, h, channel, w, r, fmt.Errorf("missing text or media in message in request body"))
 		}
 
@@ -266,6 +268,9 @@ func (h *handler) receiveEvent(ctx context.Context, channel courier.Channel, w h
 		if mediaURL != "" {
 			msg.WithAttachment(mediaURL)
 		}
+		if location != nil {
+			handlers.AddLocation(msg, location.Latitude, location.Longitude, location.Name, location.Address)
+		}
 		// and finally write our message
 		return handlers.WriteMsgsAndResponse(ctx, h, []courier.MsgIn{msg}, w, r, clog)
 	}
@@ -341,6 +346,12 @@ type mtPayload struct {
 	Size         int               `json:"size,omitempty"`
 	FileName     string            `json:"file_name,omitempty"`
 	Keyboard     *Keyboard         `json:"keyboard,omitempty"`
+	Location     *mtLocation       `json:"location,omitempty"`
+}
+
+type mtLocation struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
 }
 
 type mtResponse struct {
@@ -369,6 +380,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 		attURL := ""
 		filename := ""
 		msgText := ""
+		var location *mtLocation
 		var err error
 
 		if part.Type == handlers.MsgPartTypeAttachment || part.Type == handlers.MsgPartTypeCaptionedAttachment {
@@ -398,6 +410,15 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 				filename = "Audio"
 				msgText = ""
 
+			case "geo":
+				loc, isGeo := handlers.ParseGeoAttachment(part.Attachment)
+				if !isGeo {
+					clog.Error(courier.ErrorMediaUnsupported(mediaType))
+					break
+				}
+				msgType = "location"
+				location = &mtLocation{Latitude: loc.Latitude, Longitude: loc.Longitude}
+
 			default:
 				clog.Error(courier.ErrorMediaUnsupported(mediaType))
 			}
@@ -415,6 +436,7 @@ func (h *handler) Send(ctx context.Context, msg courier.MsgOut, res *courier.Sen
 			Media:        attURL,
 			FileName:     filename,
 			Keyboard:     keyboard,
+			Location:     location,
 		}
 		if attSize != -1 {
 			payload.Size = attSize
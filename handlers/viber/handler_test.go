@@ -30,6 +30,9 @@ func buildMockAttachmentService(testCases []OutgoingTestCase) *httptest.Server {
 		if len(testCases[c].MsgAttachments) > 0 {
 			for i, a := range testCases[c].MsgAttachments {
 				mediaType, mediaURL := SplitAttachment(a)
+				if mediaType == "geo" {
+					continue
+				}
 				parts := strings.Split(mediaURL, "/")
 				testCases[c].MsgAttachments[i] = fmt.Sprintf("%s:%s/%s", mediaType, server.URL, parts[len(parts)-1])
 			}
@@ -203,6 +206,28 @@ var defaultSendTestCases = []OutgoingTestCase{
 			},
 		},
 	},
+	{
+		Label:          "Send Location",
+		MsgText:        "Meet here",
+		MsgURN:         "viber:xy5/5y6O81+/kbWHpLhBoA==",
+		MsgAttachments: []string{"geo:-1.950000,30.058000"},
+		MockResponses: map[string][]*httpx.MockResponse{
+			"https://chatapi.viber.com/pa/send_message": {
+				httpx.NewMockResponse(200, nil, []byte(`{"status":0,"status_message":"ok","message_token":4987381194038857789}`)),
+				httpx.NewMockResponse(200, nil, []byte(`{"status":0,"status_message":"ok","message_token":4987381194038857789}`)),
+			},
+		},
+		ExpectedRequests: []ExpectedRequest{
+			{
+				Headers: map[string]string{"Content-Type": "application/json", "Accept": "application/json"},
+				Body:    `{"auth_token":"Token","receiver":"xy5/5y6O81+/kbWHpLhBoA==","type":"location","tracking_data":"10","location":{"lat":-1.95,"lon":30.058}}`,
+			},
+			{
+				Headers: map[string]string{"Content-Type": "application/json", "Accept": "application/json"},
+				Body:    `{"auth_token":"Token","receiver":"xy5/5y6O81+/kbWHpLhBoA==","text":"Meet here","type":"text","tracking_data":"10"}`,
+			},
+		},
+	},
 	{
 		Label:   "Got non-0 response",
 		MsgText: "Simple Message",
@@ -645,7 +670,8 @@ var testCases = []IncomingTestCase{
 
 	{Label: "Valid Location receive", URL: receiveURL, Data: validReceiveLocation, ExpectedRespStatus: 200, ExpectedBodyContains: "Accepted",
 		ExpectedMsgText: Sp("incoming msg"), ExpectedURN: "viber:xy5/5y6O81+/kbWHpLhBoA==", ExpectedExternalID: "4987381189870374000",
-		ExpectedAttachments: []string{"geo:1.200000,-1.300000"}, PrepRequest: addValidSignature},
+		ExpectedAttachments: []string{"geo:1.200000,-1.300000"}, ExpectedLocation: &courier.MsgLocation{Latitude: 1.2, Longitude: -1.3},
+		PrepRequest: addValidSignature},
 	{Label: "Valid Sticker", URL: receiveURL, Data: validSticker, ExpectedRespStatus: 200, ExpectedBodyContains: "Accepted",
 		ExpectedMsgText: Sp("incoming msg"), ExpectedURN: "viber:xy5/5y6O81+/kbWHpLhBoA==", ExpectedExternalID: "4987381189870374000",
 		ExpectedAttachments: []string{"https://viber.github.io/docs/img/stickers/40133.png"}, PrepRequest: addValidSignature},
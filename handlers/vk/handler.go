@@ -113,6 +113,9 @@ type moNewMessagePayload struct {
 					Lat float64 `json:"latitude"`
 					Lng float64 `json:"longitude"`
 				} `json:"coordinates"`
+				Place struct {
+					Title string `json:"title"`
+				} `json:"place"`
 			} `json:"geo"`
 			Payload string `json:"payload"`
 		} `json:"message" validate:"required"`
@@ -245,6 +248,8 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 
 	if attachment := takeFirstAttachmentUrl(*payload); attachment != "" {
 		msg.WithAttachment(attachment)
+	} else if geo := payload.Object.Message.Geo; geo.Coords.Lat != 0 && geo.Coords.Lng != 0 {
+		handlers.AddLocation(msg, geo.Coords.Lat, geo.Coords.Lng, geo.Place.Title, "")
 	}
 	// check for empty content
 	if msg.Text() == "" && len(msg.Attachments()) == 0 {
@@ -304,7 +309,7 @@ func buildApiBaseParams(channel courier.Channel) url.Values {
 	}
 }
 
-// takeFirstAttachmentUrl tries to take first attachment url, otherwise tries geolocation
+// takeFirstAttachmentUrl tries to take first attachment url
 func takeFirstAttachmentUrl(payload moNewMessagePayload) string {
 	jsonBytes, err := payload.Object.Message.Attachments.MarshalJSON()
 
@@ -314,13 +319,6 @@ func takeFirstAttachmentUrl(payload moNewMessagePayload) string {
 	attachments := &[]moAttachment{}
 
 	if err = json.Unmarshal(jsonBytes, attachments); err != nil || len(*attachments) == 0 {
-		// try take geolocation
-		lat := payload.Object.Message.Geo.Coords.Lat
-		lng := payload.Object.Message.Geo.Coords.Lng
-
-		if lat != 0 && lng != 0 {
-			return fmt.Sprintf("geo:%f,%f", lat, lng)
-		}
 		return ""
 	}
 	switch (*attachments)[0].Type {
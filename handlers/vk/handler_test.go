@@ -313,6 +313,7 @@ var testCases = []IncomingTestCase{
 		ExpectedExternalID:   "1",
 		ExpectedDate:         time.Date(2020, 1, 27, 11, 50, 0, 0, time.UTC),
 		ExpectedAttachments:  []string{"geo:-9.652278,-35.701095"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: -9.652278, Longitude: -35.701095},
 	},
 	{
 		Label:                "Valid secret",
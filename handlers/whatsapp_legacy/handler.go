@@ -145,8 +145,8 @@ type eventsPayload struct {
 		}
 		Location *struct {
 			Address   string  `json:"address"   validate:"required"`
-			Latitude  float32 `json:"latitude"  validate:"required"`
-			Longitude float32 `json:"longitude" validate:"required"`
+			Latitude  float64 `json:"latitude"  validate:"required"`
+			Longitude float64 `json:"longitude" validate:"required"`
 			Name      string  `json:"name"      validate:"required"`
 			URL       string  `json:"url"       validate:"required"`
 		} `json:"location"`
@@ -227,7 +227,7 @@ func (h *handler) receiveEvents(ctx context.Context, channel courier.Channel, w
 				text = msg.Interactive.ListReply.Title
 			}
 		} else if msg.Type == "location" && msg.Location != nil {
-			mediaURL = fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude)
+			// location is added to the message once it's created
 		} else if msg.Type == "video" && msg.Video != nil {
 			mediaURL, err = resolveMediaURL(channel, msg.Video.ID)
 		} else if msg.Type == "voice" && msg.Voice != nil {
@@ -248,6 +248,9 @@ func (h *handler) receiveEvents(ctx context.Context, channel courier.Channel, w
 		if mediaURL != "" {
 			event.WithAttachment(mediaURL)
 		}
+		if msg.Type == "location" && msg.Location != nil {
+			handlers.AddLocation(event, msg.Location.Latitude, msg.Location.Longitude, msg.Location.Name, msg.Location.Address)
+		}
 
 		err = h.Backend().WriteMsg(ctx, event, clog)
 		if err != nil {
@@ -849,7 +852,7 @@ func (h *handler) fetchMediaID(msg courier.MsgOut, mimeType, mediaURL string, cl
 		return "", errors.Wrapf(err, "error building media request")
 	}
 
-	resp, respBody, err := h.RequestHTTP(req, clog)
+	resp, respBody, err := h.RequestAttachmentHTTP(req, clog)
 	if err != nil || resp.StatusCode/100 != 2 {
 		failedMediaCache.Set(failKey, true, cache.DefaultExpiration)
 		return "", nil
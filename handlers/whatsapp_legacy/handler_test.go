@@ -403,6 +403,7 @@ var waTestCases = []IncomingTestCase{
 		ExpectedBodyContains: `"type":"msg"`,
 		ExpectedMsgText:      Sp(""),
 		ExpectedAttachments:  []string{"geo:0.000000,1.000000"},
+		ExpectedLocation:     &courier.MsgLocation{Latitude: 0, Longitude: 1, Name: "some name", Address: "some address"},
 		ExpectedURN:          "whatsapp:250788123123",
 		ExpectedExternalID:   "41",
 		ExpectedDate:         time.Date(2016, 1, 30, 1, 57, 9, 0, time.UTC),
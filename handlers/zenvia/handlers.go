@@ -50,8 +50,8 @@ type moContent struct {
 	FileMimeType string  `json:"fileMimeType"`
 	FileCaption  string  `json:"fileCaption"`
 	FileName     string  `json:"fileName"`
-	Longitude    float32 `json:"longitude"`
-	Latitude     float32 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Latitude     float64 `json:"latitude"`
 	Name         string  `json:"name"`
 	Address      string  `json:"address"`
 	URL          string  `json:"url"`
@@ -105,11 +105,12 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 
 		text := ""
 		mediaURL := ""
+		var location *courier.MsgLocation
 
 		if content.Type == "text" {
 			text = content.Text
 		} else if content.Type == "location" {
-			mediaURL = fmt.Sprintf("geo:%f,%f", content.Latitude, content.Longitude)
+			location = &courier.MsgLocation{Latitude: content.Latitude, Longitude: content.Longitude, Name: content.Name, Address: content.Address}
 		} else if content.Type == "file" {
 			mediaURL = content.FileURL
 		} else {
@@ -122,6 +123,9 @@ func (h *handler) receiveMessage(ctx context.Context, channel courier.Channel, w
 		if mediaURL != "" {
 			msg.WithAttachment(mediaURL)
 		}
+		if location != nil {
+			handlers.AddLocation(msg, location.Latitude, location.Longitude, location.Name, location.Address)
+		}
 		msgs = append(msgs, msg)
 	}
 
@@ -0,0 +1,169 @@
+package courier
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/random"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/pkg/errors"
+)
+
+// SendMiddlewareTrackLinks is the name of the send middleware which replaces links in outgoing messages with short
+// links which redirect via courier so that clicks can be tracked
+const SendMiddlewareTrackLinks = "track_links"
+
+const (
+	trackedLinkKey     = "link:%s" // link code
+	trackedLinkTTL     = 90 * 24 * time.Hour
+	trackedLinkCodeLen = 8
+
+	// number of codes we try before giving up, since a new code colliding with an existing one should be very rare
+	trackedLinkMaxAttempts = 5
+)
+
+var trackedLinkCodeChars = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+
+var linkRegex = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// trackLinks is our send middleware for replacing links in the text of outgoing messages with tracked short links
+func (s *server) trackLinks(ctx context.Context, msg MsgOut, content *SendContent, clog *ChannelLog) error {
+	rc := s.backend.RedisPool().Get()
+	defer rc.Close()
+
+	shortPrefix := s.linkURL("")
+	shortened := make(map[string]string)
+	var err error
+
+	content.Text = linkRegex.ReplaceAllStringFunc(content.Text, func(link string) string {
+		// don't include any trailing punctuation which is more likely part of the sentence
+		trimmed := strings.TrimRight(link, ".,;:!?)]}")
+		trailing := link[len(trimmed):]
+
+		if err != nil || strings.HasPrefix(trimmed, shortPrefix) {
+			return link
+		}
+
+		short, seen := shortened[trimmed]
+		if !seen {
+			var code string
+			code, err = saveTrackedLink(rc, msg, trimmed)
+			if err != nil {
+				return link
+			}
+			short = s.linkURL(code)
+			shortened[trimmed] = short
+		}
+		return short + trailing
+	})
+
+	if err != nil {
+		// better to send the message with its original links than not at all
+		clog.Error(NewChannelError("link_tracking_failed", "", "Unable to replace links with tracked links."))
+		slog.Error("error saving tracked link", "error", err, "msg_uuid", msg.UUID())
+	}
+	return nil
+}
+
+func (s *server) linkURL(code string) string {
+	return fmt.Sprintf("https://%s/c/l/%s", s.config.Domain, code)
+}
+
+var luaSaveTrackedLink = redis.NewScript(1, `-- KEYS: [LinkKey] ARGV: [TTL, URL, ChannelUUID, MsgID, MsgUUID, URN]
+	local key = KEYS[1]
+
+	-- never overwrite an existing link which may have already been sent
+	if redis.call("exists", key) == 1 then
+		return 0
+	end
+
+	redis.call("hset", key, "url", ARGV[2], "channel_uuid", ARGV[3], "msg_id", ARGV[4], "msg_uuid", ARGV[5], "urn", ARGV[6], "clicks", 0)
+	redis.call("expire", key, ARGV[1])
+	return 1
+`)
+
+// saves a new tracked link for the given message and URL, returning its code
+func saveTrackedLink(rc redis.Conn, msg MsgOut, url string) (string, error) {
+	for i := 0; i < trackedLinkMaxAttempts; i++ {
+		code := random.String(trackedLinkCodeLen, trackedLinkCodeChars)
+
+		saved, err := redis.Bool(luaSaveTrackedLink.Do(rc, fmt.Sprintf(trackedLinkKey, code),
+			int(trackedLinkTTL/time.Second), url, string(msg.Channel().UUID()), int64(msg.ID()), string(msg.UUID()), string(msg.URN()),
+		))
+		if err != nil {
+			return "", errors.Wrap(err, "error saving tracked link")
+		}
+		if saved {
+			return code, nil
+		}
+	}
+
+	return "", errors.Errorf("unable to find unused tracked link code after %d attempts", trackedLinkMaxAttempts)
+}
+
+// handleLinkRedirect records a click of a tracked link and redirects to its URL
+func (s *server) handleLinkRedirect(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+	defer cancel()
+
+	rc := s.backend.RedisPool().Get()
+	key := fmt.Sprintf(trackedLinkKey, chi.URLParam(r, "code"))
+	link, err := redis.StringMap(rc.Do("HGETALL", key))
+	clicks := 0
+	if err == nil && len(link) > 0 {
+		clicks, err = redis.Int(rc.Do("HINCRBY", key, "clicks", 1))
+	}
+	rc.Close()
+
+	if err != nil {
+		slog.Error("error looking up tracked link", "error", err)
+		WriteError(w, http.StatusInternalServerError, errors.New("error looking up link"))
+		return
+	}
+	if len(link) == 0 {
+		s.handle404(w, r)
+		return
+	}
+
+	if err := s.writeLinkClicked(ctx, link, clicks); err != nil {
+		slog.Error("error writing link clicked event", "error", err, "channel_uuid", link["channel_uuid"], "msg_uuid", link["msg_uuid"])
+	}
+
+	http.Redirect(w, r, link["url"], http.StatusFound)
+}
+
+// writes a link clicked event for the contact that the given tracked link was sent to
+func (s *server) writeLinkClicked(ctx context.Context, link map[string]string, clicks int) error {
+	channel, err := s.backend.GetChannel(ctx, AnyChannelType, ChannelUUID(link["channel_uuid"]))
+	if err != nil {
+		return errors.Wrap(err, "error looking up channel")
+	}
+
+	clog := NewChannelLog(ChannelLogTypeEventReceive, channel, nil)
+	event := s.backend.NewChannelEvent(channel, EventTypeLinkClicked, urns.URN(link["urn"]), clog).WithExtra(map[string]string{
+		"url":      link["url"],
+		"msg_id":   link["msg_id"],
+		"msg_uuid": link["msg_uuid"],
+		"clicks":   strconv.Itoa(clicks),
+	})
+
+	err = s.backend.WriteChannelEvent(ctx, event, clog)
+	if err != nil {
+		clog.RawError(err)
+	}
+
+	clog.End()
+	if err := s.backend.WriteChannelLog(ctx, clog); err != nil {
+		slog.Error("error writing channel log", "error", err)
+	}
+
+	return err
+}
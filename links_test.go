@@ -0,0 +1,109 @@
+package courier_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackLinks(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/send": {
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+		},
+	}))
+
+	defer random.SetGenerator(random.DefaultGenerator)
+	random.SetGenerator(random.NewSeededGenerator(123))
+
+	var sentText string
+	courier.RegisterSendMiddleware("test_record_text", func(ctx context.Context, msg courier.MsgOut, content *courier.SendContent, clog *courier.ChannelLog) error {
+		sentText = content.Text
+		return nil
+	})
+
+	config := testConfig()
+	config.Domain = "courier.example.com"
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+
+	s.Start()
+	defer s.Stop()
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigSendMiddleware: []any{courier.SendMiddlewareTrackLinks, "test_record_text"},
+	})
+	mb.AddChannel(mockChannel)
+
+	// links are replaced, with repeats of the same link getting the same short link
+	msg := test.NewMockMsg(courier.MsgID(101), "0191e5b3-4b36-7a3b-8b55-e1e1d2b2a3c4", mockChannel, "tel:+250788383383", "Read https://example.com/health?topic=malaria&lang=en. Or http://example.com/faq (again: https://example.com/health?topic=malaria&lang=en)", nil)
+	sendAndWait(mb, msg)
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+	assert.Equal(t, "Read https://courier.example.com/c/l/BLP7RVN3. Or https://courier.example.com/c/l/hbl6MN05 (again: https://courier.example.com/c/l/BLP7RVN3)", sentText)
+	mb.Reset()
+
+	// already shortened links and messages without links are left alone
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(102), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "Still https://courier.example.com/c/l/BLP7RVN3", nil))
+	assert.Equal(t, "Still https://courier.example.com/c/l/BLP7RVN3", sentText)
+	mb.Reset()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	click := func(code string) *http.Response {
+		resp, err := client.Get("http://localhost:8080/c/l/" + code)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// clicking a link redirects to the original URL and records a click event
+	resp := click("BLP7RVN3")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://example.com/health?topic=malaria&lang=en", resp.Header.Get("Location"))
+
+	require.Len(t, mb.WrittenChannelEvents(), 1)
+	event := mb.WrittenChannelEvents()[0]
+	assert.Equal(t, courier.EventTypeLinkClicked, event.EventType())
+	assert.Equal(t, mockChannel.UUID(), event.ChannelUUID())
+	assert.Equal(t, "tel:+250788383383", event.URN().String())
+	assert.Equal(t, map[string]string{"url": "https://example.com/health?topic=malaria&lang=en", "msg_id": "101", "msg_uuid": "0191e5b3-4b36-7a3b-8b55-e1e1d2b2a3c4", "clicks": "1"}, event.Extra())
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	assert.Equal(t, courier.ChannelLogTypeEventReceive, mb.WrittenChannelLogs()[0].Type())
+
+	// clicks are counted
+	click("BLP7RVN3")
+	require.Len(t, mb.WrittenChannelEvents(), 2)
+	assert.Equal(t, "2", mb.WrittenChannelEvents()[1].Extra()["clicks"])
+
+	resp = click("hbl6MN05")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "http://example.com/faq", resp.Header.Get("Location"))
+
+	// unknown codes are a 404
+	resp = click("xxxxxxxx")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Len(t, mb.WrittenChannelEvents(), 3)
+	mb.Reset()
+
+	// new codes which collide with existing ones are regenerated rather than overwriting them
+	random.SetGenerator(random.NewSeededGenerator(123))
+
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(103), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "New https://example.com/new", nil))
+	assert.Equal(t, "New https://courier.example.com/c/l/bxucs8wH", sentText)
+
+	resp = click("BLP7RVN3")
+	assert.Equal(t, "https://example.com/health?topic=malaria&lang=en", resp.Header.Get("Location"))
+}
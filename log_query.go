@@ -0,0 +1,184 @@
+package courier
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/pkg/errors"
+)
+
+const (
+	channelLogsDefaultLimit = 50
+	channelLogsMaxLimit     = 500
+	channelLogsMaxRange     = 7 * 24 * time.Hour
+)
+
+// StoredChannelLog is a channel log as read back from the backend
+type StoredChannelLog struct {
+	UUID      ChannelLogUUID       `json:"uuid"`
+	Type      ChannelLogType       `json:"type"`
+	HTTPLogs  []*httpx.Log         `json:"http_logs"`
+	Errors    []StoredChannelError `json:"errors"`
+	ElapsedMS int                  `json:"elapsed_ms"`
+	CreatedOn time.Time            `json:"created_on"`
+}
+
+// StoredChannelError is an error in a channel log read back from the backend
+type StoredChannelError struct {
+	Code    string `json:"code"`
+	ExtCode string `json:"ext_code,omitempty"`
+	Message string `json:"message"`
+}
+
+// Redact redacts values from the HTTP logs and errors of this channel log
+func (l *StoredChannelLog) Redact(r stringsx.Redactor) {
+	for _, h := range l.HTTPLogs {
+		h.URL = r(h.URL)
+		h.Request = r(h.Request)
+		h.Response = r(h.Response)
+	}
+	for i := range l.Errors {
+		l.Errors[i].Message = r(l.Errors[i].Message)
+	}
+}
+
+// ChannelLogQuery is a query for the channel logs of a channel created in the given time range, and optionally of the
+// given type or with an error with the given code
+type ChannelLogQuery struct {
+	Since     time.Time
+	Until     time.Time
+	Type      ChannelLogType
+	ErrorCode string
+	Limit     int
+}
+
+type channelLogsResponse struct {
+	ChannelUUID ChannelUUID         `json:"channel_uuid"`
+	Logs        []*StoredChannelLog `json:"logs"`
+	Unreadable  []ChannelLogUUID    `json:"unreadable"`
+}
+
+// handleChannelLog returns a single channel log, e.g. /c/_logs/<uuid>?channel=<uuid>
+func (s *server) handleChannelLog(w http.ResponseWriter, r *http.Request) {
+	channel, redactor, ok := s.channelForLogs(w, r)
+	if !ok {
+		return
+	}
+
+	logUUID := ChannelLogUUID(chi.URLParam(r, "uuid"))
+	if !uuids.IsV4(string(logUUID)) {
+		WriteError(w, http.StatusBadRequest, errors.Errorf("invalid log UUID: %s", logUUID))
+		return
+	}
+
+	clog, err := s.backend.GetChannelLog(r.Context(), channel, logUUID)
+	if err != nil {
+		slog.Error("error reading channel log", "error", err, "channel_uuid", channel.UUID(), "log_uuid", logUUID)
+		WriteError(w, http.StatusInternalServerError, errors.New("error reading channel log"))
+		return
+	}
+	if clog == nil {
+		WriteError(w, http.StatusNotFound, errors.New("channel log not found"))
+		return
+	}
+
+	clog.Redact(redactor)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonx.MustMarshal(clog))
+}
+
+// handleChannelLogs returns the most recent channel logs of a channel matching a query, and the UUIDs of any logs which
+// couldn't be read, e.g.
+// /c/_logs?channel=<uuid>&since=2024-03-01T00:00:00Z&until=2024-03-02T00:00:00Z&type=msg_send&error=response_status_code&limit=50
+func (s *server) handleChannelLogs(w http.ResponseWriter, r *http.Request) {
+	channel, redactor, ok := s.channelForLogs(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := &ChannelLogQuery{
+		Until:     dates.Now().UTC(),
+		Type:      ChannelLogType(params.Get("type")),
+		ErrorCode: params.Get("error"),
+		Limit:     channelLogsDefaultLimit,
+	}
+	var err error
+
+	if v := params.Get("until"); v != "" {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			WriteError(w, http.StatusBadRequest, errors.Errorf("invalid until time: %s", v))
+			return
+		}
+	}
+	query.Since = query.Until.Add(-24 * time.Hour)
+	if v := params.Get("since"); v != "" {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			WriteError(w, http.StatusBadRequest, errors.Errorf("invalid since time: %s", v))
+			return
+		}
+	}
+	if !query.Until.After(query.Since) || query.Until.Sub(query.Since) > channelLogsMaxRange {
+		WriteError(w, http.StatusBadRequest, errors.Errorf("time range must be no more than %d days", channelLogsMaxRange/(24*time.Hour)))
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 1 || query.Limit > channelLogsMaxLimit {
+			WriteError(w, http.StatusBadRequest, errors.Errorf("limit must be between 1 and %d", channelLogsMaxLimit))
+			return
+		}
+	}
+
+	logs, unreadable, err := s.backend.QueryChannelLogs(r.Context(), channel, query)
+	if err != nil {
+		slog.Error("error querying channel logs", "error", err, "channel_uuid", channel.UUID())
+		WriteError(w, http.StatusInternalServerError, errors.New("error querying channel logs"))
+		return
+	}
+
+	for _, l := range logs {
+		l.Redact(redactor)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonx.MustMarshal(&channelLogsResponse{ChannelUUID: channel.UUID(), Logs: logs, Unreadable: unreadable}))
+}
+
+// looks up the channel whose logs are being read, and a redactor of its secrets since the logs may have been written
+// before they were configured
+func (s *server) channelForLogs(w http.ResponseWriter, r *http.Request) (Channel, stringsx.Redactor, bool) {
+	channelUUID := ChannelUUID(r.URL.Query().Get("channel"))
+	if channelUUID == "" {
+		WriteError(w, http.StatusBadRequest, errors.New("missing channel"))
+		return nil, nil, false
+	}
+
+	channel, err := s.backend.GetChannel(r.Context(), AnyChannelType, channelUUID)
+	if err != nil {
+		if errors.Is(err, ErrChannelNotFound) {
+			WriteError(w, http.StatusNotFound, errors.New("channel not found"))
+		} else {
+			slog.Error("error looking up channel", "error", err, "channel_uuid", channelUUID)
+			WriteError(w, http.StatusInternalServerError, errors.New("error looking up channel"))
+		}
+		return nil, nil, false
+	}
+
+	var redactVals []string
+	if handler := GetHandler(channel.ChannelType()); handler != nil {
+		redactVals = handler.RedactValues(channel)
+	}
+
+	return channel, stringsx.NewRedactor("**********", redactVals...), true
+}
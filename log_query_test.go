@@ -0,0 +1,152 @@
+package courier_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelLogQueries(t *testing.T) {
+	ctx := context.Background()
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/send?token=sesame": {httpx.NewMockResponse(401, nil, []byte(`{"error": "token sesame is invalid"}`))},
+	}))
+
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	setNow := func(h, m int) {
+		dates.SetNowSource(dates.NewFixedNowSource(time.Date(2024, 3, 15, h, m, 0, 0, time.UTC)))
+	}
+
+	config := testConfig()
+	config.AuthToken = "sesame"
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+
+	s.Start()
+	defer s.Stop()
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
+	otherChannel := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "MCK", "2021", "US", map[string]any{})
+	mb.AddChannel(mockChannel)
+	mb.AddChannel(otherChannel)
+
+	// logs written without redaction of the channel's secrets
+	setNow(10, 0)
+	req, _ := http.NewRequest(http.MethodGet, "http://mock.com/send?token=sesame", nil)
+	trace, err := httpx.DoTrace(http.DefaultClient, req, nil, nil, 0)
+	require.NoError(t, err)
+	clog1 := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, mockChannel, nil)
+	clog1.HTTP(trace)
+	clog1.Error(courier.ErrorExternal("E401", "Token sesame is invalid."))
+	require.NoError(t, mb.WriteChannelLog(ctx, clog1))
+
+	setNow(11, 0)
+	clog2 := courier.NewChannelLog(courier.ChannelLogTypeMsgReceive, mockChannel, nil)
+	require.NoError(t, mb.WriteChannelLog(ctx, clog2))
+
+	setNow(11, 15)
+	clog3 := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, otherChannel, nil)
+	require.NoError(t, mb.WriteChannelLog(ctx, clog3))
+
+	setNow(11, 30)
+	clog4 := courier.NewChannelLog(courier.ChannelLogTypeMsgSend, mockChannel, nil)
+	clog4.Error(courier.ErrorResponseStatusCode())
+	require.NoError(t, mb.WriteChannelLog(ctx, clog4))
+
+	setNow(12, 0)
+
+	get := func(path, token string) (int, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/c/"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	// fetching a single log by UUID redacts the channel's secrets
+	status, body := get("_logs/"+string(clog1.UUID())+"?channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "sesame")
+	assert.Equal(t, http.StatusOK, status)
+
+	stored := &courier.StoredChannelLog{}
+	require.NoError(t, json.Unmarshal(body, stored))
+	assert.Equal(t, clog1.UUID(), stored.UUID)
+	assert.Equal(t, courier.ChannelLogTypeMsgSend, stored.Type)
+	assert.Equal(t, time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC), stored.CreatedOn)
+	require.Len(t, stored.HTTPLogs, 1)
+	assert.Equal(t, "http://mock.com/send?token=**********", stored.HTTPLogs[0].URL)
+	assert.Equal(t, 401, stored.HTTPLogs[0].StatusCode)
+	assert.Contains(t, stored.HTTPLogs[0].Request, "GET /send?token=********** HTTP/1.1")
+	assert.Contains(t, stored.HTTPLogs[0].Response, `{"error": "token ********** is invalid"}`)
+	assert.Equal(t, []courier.StoredChannelError{{Code: "external", ExtCode: "E401", Message: "Token ********** is invalid."}}, stored.Errors)
+	assert.NotContains(t, string(body), "sesame")
+
+	// logs of other channels can't be fetched
+	status, _ = get("_logs/"+string(clog3.UUID())+"?channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "sesame")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = get("_logs/"+string(clog1.UUID())+"?channel=d1b8b1d2-d8d1-4b7b-9a1b-0b0e6a3b5d8f", "sesame")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = get("_logs/xyz?channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "sesame")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = get("_logs/"+string(clog1.UUID())+"?channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "xxxxx")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	query := func(params string) []courier.ChannelLogUUID {
+		status, body := get("_logs?channel=e4bb1578-29da-4fa5-a214-9da19dd24230"+params, "sesame")
+		require.Equal(t, http.StatusOK, status, "unexpected status for query %s: %s", params, body)
+
+		resp := &struct {
+			ChannelUUID courier.ChannelUUID         `json:"channel_uuid"`
+			Logs        []*courier.StoredChannelLog `json:"logs"`
+			Unreadable  []courier.ChannelLogUUID    `json:"unreadable"`
+		}{}
+		require.NoError(t, json.Unmarshal(body, resp))
+		assert.Equal(t, mockChannel.UUID(), resp.ChannelUUID)
+		assert.Equal(t, []courier.ChannelLogUUID{}, resp.Unreadable)
+		assert.NotContains(t, string(body), "sesame")
+
+		uuids := make([]courier.ChannelLogUUID, len(resp.Logs))
+		for i, l := range resp.Logs {
+			uuids[i] = l.UUID
+		}
+		return uuids
+	}
+
+	// by default we get the last day of logs, most recent first
+	assert.Equal(t, []courier.ChannelLogUUID{clog4.UUID(), clog2.UUID(), clog1.UUID()}, query(""))
+	assert.Equal(t, []courier.ChannelLogUUID{clog4.UUID(), clog2.UUID()}, query("&limit=2"))
+	assert.Equal(t, []courier.ChannelLogUUID{clog2.UUID()}, query("&since=2024-03-15T10:30:00Z&until=2024-03-15T11:30:00Z"))
+	assert.Equal(t, []courier.ChannelLogUUID{clog4.UUID(), clog1.UUID()}, query("&type=msg_send"))
+	assert.Equal(t, []courier.ChannelLogUUID{clog1.UUID()}, query("&error=external"))
+	assert.Equal(t, []courier.ChannelLogUUID{}, query("&type=msg_receive&error=external"))
+	assert.Equal(t, []courier.ChannelLogUUID{}, query("&until=2024-03-15T09:00:00Z"))
+
+	// invalid queries
+	for _, params := range []string{"&since=yesterday", "&until=2024-03-15", "&since=2024-03-15T12:00:00Z&until=2024-03-15T11:00:00Z", "&since=2024-03-01T00:00:00Z", "&limit=0", "&limit=1000"} {
+		status, _ = get("_logs?channel=e4bb1578-29da-4fa5-a214-9da19dd24230"+params, "sesame")
+		assert.Equal(t, http.StatusBadRequest, status, "expected bad request for query %s", params)
+	}
+
+	status, _ = get("_logs", "sesame")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = get("_logs?channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "xxxxx")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
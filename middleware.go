@@ -0,0 +1,91 @@
+package courier
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// SendContent is the content of an outgoing message which send middleware can rewrite
+type SendContent struct {
+	Text         string
+	Attachments  []string
+	QuickReplies []string
+}
+
+// SendMiddleware is called for an outgoing message before it's passed to its channel handler. It can rewrite the
+// content of the message, annotate the channel log, or veto sending by returning an error, which should be a
+// *SendError such as ErrSendVetoed to control whether the message is failed or retried.
+type SendMiddleware func(ctx context.Context, msg MsgOut, content *SendContent, clog *ChannelLog) error
+
+// RegisterSendMiddleware adds a new send middleware with the given name, which channels and orgs can enable by name. It
+// should be called from an init() func, as middleware which need the server are instead registered on the server itself.
+func RegisterSendMiddleware(name string, mw SendMiddleware) {
+	registeredSendMiddleware[name] = mw
+}
+
+var registeredSendMiddleware = make(map[string]SendMiddleware)
+
+// applySendMiddleware runs any send middleware enabled for the given message's channel, looking for them first in the
+// given server middleware and then the registered middleware, and returns the message with its content rewritten if it
+// was changed
+func applySendMiddleware(ctx context.Context, cfg *Config, serverMiddleware map[string]SendMiddleware, msg MsgOut, clog *ChannelLog) (MsgOut, error) {
+	names := sendMiddlewareNames(cfg, msg.Channel())
+	if len(names) == 0 {
+		return msg, nil
+	}
+
+	content := &SendContent{
+		Text:         msg.Text(),
+		Attachments:  slices.Clone(msg.Attachments()),
+		QuickReplies: slices.Clone(msg.QuickReplies()),
+	}
+
+	for _, name := range names {
+		mw := serverMiddleware[name]
+		if mw == nil {
+			mw = registeredSendMiddleware[name]
+		}
+		if mw == nil {
+			slog.Error("no such send middleware", "name", name, "channel_uuid", msg.Channel().UUID())
+			continue
+		}
+
+		if err := mw(ctx, msg, content, clog); err != nil {
+			return msg, err
+		}
+	}
+
+	if content.Text == msg.Text() && slices.Equal(content.Attachments, msg.Attachments()) && slices.Equal(content.QuickReplies, msg.QuickReplies()) {
+		return msg, nil
+	}
+
+	return &rewrittenMsg{MsgOut: msg, content: content}, nil
+}
+
+// gets the names of the send middleware enabled for the given channel, from its org's config and its own. If attachments
+// are private, their URLs are always signed as there's no other way they can be fetched.
+func sendMiddlewareNames(cfg *Config, channel Channel) []string {
+	names := make([]string, 0)
+	if cfg.PrivateAttachments {
+		names = append(names, SendMiddlewareSignURLs)
+	}
+	for _, config := range []any{channel.OrgConfigForKey(ConfigSendMiddleware, nil), channel.ConfigForKey(ConfigSendMiddleware, nil)} {
+		for _, name := range configStrings(config) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// rewrittenMsg is an outgoing message whose content has been rewritten by send middleware
+type rewrittenMsg struct {
+	MsgOut
+	content *SendContent
+}
+
+func (m *rewrittenMsg) Text() string           { return m.content.Text }
+func (m *rewrittenMsg) Attachments() []string  { return m.content.Attachments }
+func (m *rewrittenMsg) QuickReplies() []string { return m.content.QuickReplies }
@@ -0,0 +1,96 @@
+package courier_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendMiddleware(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/send": {
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+		},
+	}))
+
+	seen := make([]courier.SendContent, 0)
+
+	courier.RegisterSendMiddleware("test_no_links", func(ctx context.Context, msg courier.MsgOut, content *courier.SendContent, clog *courier.ChannelLog) error {
+		if strings.Contains(content.Text, "http") {
+			return courier.ErrSendVetoed("links_blocked", "Links are not allowed.")
+		}
+		return nil
+	})
+	courier.RegisterSendMiddleware("test_footer", func(ctx context.Context, msg courier.MsgOut, content *courier.SendContent, clog *courier.ChannelLog) error {
+		content.Text += "\n-- Acme"
+		content.QuickReplies = append(content.QuickReplies, "STOP")
+		clog.Error(courier.NewChannelError("footer_added", "", "Added footer to message."))
+		return nil
+	})
+	courier.RegisterSendMiddleware("test_record", func(ctx context.Context, msg courier.MsgOut, content *courier.SendContent, clog *courier.ChannelLog) error {
+		seen = append(seen, *content)
+		return nil
+	})
+	courier.RegisterSendMiddleware("test_config_error", func(ctx context.Context, msg courier.MsgOut, content *courier.SendContent, clog *courier.ChannelLog) error {
+		content.Text = "err:config" // mock handler fails messages with this text
+		return nil
+	})
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(testConfig(), mb)
+
+	s.Start()
+	defer s.Stop()
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigSendMiddleware: []any{"test_footer", "test_no_links", "xxxx", "test_record"},
+	})
+	mockChannel.SetOrgConfig(courier.ConfigSendMiddleware, []any{"test_no_links"})
+	mb.AddChannel(mockChannel)
+
+	// middleware is applied in order, with org middleware first and unknown middleware ignored
+	msg := mb.NewOutgoingMsg(mockChannel, 101, "tel:+250788383383", "hello", false, []string{"Yes", "No"}, "", "", courier.MsgOriginFlow, nil)
+	sendAndWait(mb, msg)
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+	assert.Equal(t, []courier.SendContent{{Text: "hello\n-- Acme", QuickReplies: []string{"Yes", "No", "STOP"}}}, seen)
+
+	// and the original message isn't modified
+	assert.Equal(t, "hello", msg.Text())
+	assert.Equal(t, []string{"Yes", "No"}, msg.QuickReplies())
+
+	// middleware can annotate the channel log
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	assert.Equal(t, []*courier.ChannelError{
+		courier.NewChannelError("footer_added", "", "Added footer to message."),
+		courier.NewChannelError("seeds", "", "contains ********** seeds"),
+	}, mb.WrittenChannelLogs()[0].Errors())
+	mb.Reset()
+
+	// and veto sending, in which case the handler isn't called
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(102), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "visit http://spam.com", nil))
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusFailed, mb.WrittenMsgStatuses()[0].Status())
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	assert.Equal(t, []*courier.ChannelError{courier.NewChannelError("links_blocked", "", "Links are not allowed.")}, mb.WrittenChannelLogs()[0].Errors())
+	assert.Len(t, mb.WrittenChannelLogs()[0].HTTPLogs(), 0)
+	mb.Reset()
+
+	// handlers send the rewritten message
+	mockChannel.SetConfig(courier.ConfigSendMiddleware, []any{"test_config_error"})
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(103), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "hello", nil))
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusFailed, mb.WrittenMsgStatuses()[0].Status())
+	mb.Reset()
+}
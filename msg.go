@@ -42,6 +42,37 @@ type OptInReference struct {
 	Name string `json:"name" validate:"required"`
 }
 
+// MsgReaction is a reaction to a previously received message, sent in place of a normal outgoing message. The
+// message being reacted to is identified by the ResponseToExternalID of the outgoing message and an empty emoji
+// removes any existing reaction.
+type MsgReaction struct {
+	Emoji string `json:"emoji"`
+}
+
+// MsgLocation is a location shared by a contact in an incoming message
+type MsgLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// ConversationAction is an action such as showing a typing indicator which can be sent in place of a normal outgoing
+// message. Actions which apply to a particular received message, like marking it as read, identify that message by the
+// ResponseToExternalID of the outgoing message.
+type ConversationAction string
+
+const (
+	ConversationActionTyping   ConversationAction = "typing"
+	ConversationActionMarkRead ConversationAction = "mark_read"
+)
+
+// MsgReroute records where an outgoing message was rerouted from after failing to send on its original channel
+type MsgReroute struct {
+	ChannelUUID ChannelUUID    `json:"channel_uuid"`
+	LogUUID     ChannelLogUUID `json:"log_uuid"`
+}
+
 type UserID int
 
 type MsgOrigin string
@@ -87,9 +118,12 @@ type MsgOut interface {
 	IsResend() bool
 	Flow() *FlowReference
 	OptIn() *OptInReference
+	Reaction() *MsgReaction
+	ConversationAction() ConversationAction
 	UserID() UserID
 	SessionStatus() string
 	HighPriority() bool
+	ReroutedFrom() *MsgReroute
 }
 
 // MsgIn is our interface to represent an incoming
@@ -98,8 +132,13 @@ type MsgIn interface {
 
 	// incoming specific
 	ReceivedOn() *time.Time
+	ReplyToExternalID() string
+	Location() *MsgLocation
 	WithAttachment(url string) MsgIn
 	WithContactName(name string) MsgIn
 	WithURNAuthTokens(tokens map[string]string) MsgIn
 	WithReceivedOn(date time.Time) MsgIn
+	WithReplyTo(externalID string) MsgIn
+	WithLocation(loc *MsgLocation) MsgIn
+	WithChannel(channel Channel) MsgIn
 }
@@ -0,0 +1,67 @@
+package courier
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/pkg/errors"
+)
+
+// checks whether the errors in the given channel log mean the message should be rerouted to the channel's fallback
+func shouldReroute(channel Channel, clog *ChannelLog) bool {
+	codes := configStrings(channel.ConfigForKey(ConfigFallbackErrors, nil))
+	if len(codes) == 0 {
+		return false
+	}
+
+	for _, e := range clog.Errors() {
+		if slices.Contains(codes, e.Code()) || (e.ExtCode() != "" && slices.Contains(codes, e.Code()+":"+e.ExtCode())) {
+			return true
+		}
+	}
+	return false
+}
+
+// reroutes the given message which has failed to send to its channel's fallback channel, returning that channel and
+// the URN the message will be sent to on it
+func (w *Sender) reroute(ctx context.Context, msg MsgOut, clog *ChannelLog) (Channel, urns.URN, error) {
+	backend := w.foreman.server.Backend()
+
+	fallbackUUID := msg.Channel().StringConfigForKey(ConfigFallbackChannel, "")
+	fallback, err := backend.GetChannel(ctx, AnyChannelType, ChannelUUID(fallbackUUID))
+	if err != nil {
+		return nil, urns.NilURN, errors.Wrapf(err, "error looking up fallback channel %s", fallbackUUID)
+	}
+
+	urn, err := convertURNForChannel(msg.URN(), fallback)
+	if err != nil {
+		return nil, urns.NilURN, err
+	}
+
+	from := &MsgReroute{ChannelUUID: msg.Channel().UUID(), LogUUID: clog.UUID()}
+
+	if err := backend.RerouteOutgoingMsg(ctx, msg, fallback, urn, from); err != nil {
+		return nil, urns.NilURN, errors.Wrap(err, "error rerouting message")
+	}
+
+	return fallback, urn, nil
+}
+
+// converts the given URN to one the given channel can send to, e.g. a WhatsApp URN to a phone number
+func convertURNForChannel(urn urns.URN, channel Channel) (urns.URN, error) {
+	scheme, path, _, _ := urn.ToParts()
+	if channel.IsScheme(scheme) {
+		return urn.Identity(), nil
+	}
+
+	switch {
+	case scheme == urns.WhatsAppScheme && channel.IsScheme(urns.TelScheme):
+		return urns.NewTelURNForCountry("+"+path, channel.Country())
+	case scheme == urns.TelScheme && channel.IsScheme(urns.WhatsAppScheme):
+		return urns.NewWhatsAppURN(strings.TrimPrefix(path, "+"))
+	}
+
+	return urns.NilURN, errors.Errorf("can't convert %s URN for channel with schemes %s", scheme, strings.Join(channel.Schemes(), ","))
+}
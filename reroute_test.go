@@ -0,0 +1,98 @@
+package courier_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReroute(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/send": {
+			httpx.NewMockResponse(400, nil, []byte(`131026`)), // not on WhatsApp
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),   // sent on fallback
+			httpx.NewMockResponse(400, nil, []byte(`470`)),    // some other error
+			httpx.NewMockResponse(400, nil, []byte(`131026`)), // not on WhatsApp
+			httpx.NewMockResponse(400, nil, []byte(`131026`)), // rejected by fallback too
+		},
+	}))
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(testConfig(), mb)
+
+	s.Start()
+	defer s.Stop()
+
+	waChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigFallbackChannel: "5a2b8e7c-6f1d-4c3e-9b0a-2d4f6e8c1a3b",
+		courier.ConfigFallbackErrors:  []any{"external:131026", "external:131047"},
+	})
+	waChannel.SetScheme(urns.WhatsAppScheme)
+	mb.AddChannel(waChannel)
+
+	smsChannel := test.NewMockChannel("5a2b8e7c-6f1d-4c3e-9b0a-2d4f6e8c1a3b", "MCK", "2021", "RW", map[string]any{
+		courier.ConfigFallbackChannel: "e4bb1578-29da-4fa5-a214-9da19dd24230",
+		courier.ConfigFallbackErrors:  []any{"external:131026"},
+	})
+	mb.AddChannel(smsChannel)
+
+	// a failure with one of the configured errors reroutes the message to the fallback channel as a phone number
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(101), courier.NilMsgUUID, waChannel, "whatsapp:250788383383", "hello", nil))
+
+	require.Len(t, mb.ReroutedMsgs(), 1)
+	rerouted := mb.ReroutedMsgs()[0]
+	assert.Equal(t, courier.MsgID(101), rerouted.ID())
+	assert.Equal(t, smsChannel, rerouted.Channel())
+	assert.Equal(t, urns.URN("tel:+250788383383"), rerouted.URN())
+
+	// and the rerouted message is then sent on that channel
+	require.Eventually(t, func() bool { return len(mb.WrittenChannelLogs()) == 2 }, time.Second, time.Millisecond*25)
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgID(101), mb.WrittenMsgStatuses()[0].MsgID())
+	assert.Equal(t, smsChannel.UUID(), mb.WrittenMsgStatuses()[0].ChannelUUID())
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+
+	// with the logs of the failure and the fallback send linked
+	require.Len(t, mb.WrittenChannelLogs(), 2)
+	failLog, sendLog := mb.WrittenChannelLogs()[0], mb.WrittenChannelLogs()[1]
+	assert.Equal(t, waChannel, failLog.Channel())
+	assert.Equal(t, []string{"external", "response_status", "rerouted"}, errorCodes(failLog))
+	assert.Nil(t, failLog.ReroutedFrom())
+	assert.Equal(t, smsChannel, sendLog.Channel())
+	assert.Equal(t, &courier.MsgReroute{ChannelUUID: waChannel.UUID(), LogUUID: failLog.UUID()}, sendLog.ReroutedFrom())
+	assert.Equal(t, rerouted.ReroutedFrom(), sendLog.ReroutedFrom())
+	mb.Reset()
+
+	// other errors fail the message as normal
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(102), courier.NilMsgUUID, waChannel, "whatsapp:250788383383", "hello", nil))
+
+	assert.Len(t, mb.ReroutedMsgs(), 0)
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusFailed, mb.WrittenMsgStatuses()[0].Status())
+	mb.Reset()
+
+	// and messages are only rerouted once, even if the fallback channel has its own fallback
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(103), courier.NilMsgUUID, waChannel, "whatsapp:250788383383", "hello", nil))
+	require.Eventually(t, func() bool { return len(mb.WrittenChannelLogs()) == 2 }, time.Second, time.Millisecond*25)
+
+	assert.Len(t, mb.ReroutedMsgs(), 1)
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, smsChannel.UUID(), mb.WrittenMsgStatuses()[0].ChannelUUID())
+	assert.Equal(t, courier.MsgStatusFailed, mb.WrittenMsgStatuses()[0].Status())
+}
+
+func errorCodes(clog *courier.ChannelLog) []string {
+	codes := make([]string, len(clog.Errors()))
+	for i, e := range clog.Errors() {
+		codes[i] = e.Code()
+	}
+	return codes
+}
@@ -0,0 +1,142 @@
+package courier
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	stickyRouteKey = "keyword_route:%s:%s" // channel UUID and URN identity
+	stickyRouteTTL = 30 * 24 * time.Hour
+)
+
+// KeywordRouter routes the incoming messages of a channel shared between several programs, such as a short code, to
+// other channels based on the first keyword of their text
+type KeywordRouter struct {
+	channel      Channel
+	routes       map[string]ChannelUUID
+	defaultRoute ChannelUUID
+	sticky       bool
+}
+
+// NewKeywordRouter creates a router from the keyword routing config of the given channel, returning nil if the
+// channel isn't configured for keyword routing
+func NewKeywordRouter(channel Channel) *KeywordRouter {
+	if channel == nil {
+		return nil
+	}
+
+	routes := make(map[string]ChannelUUID)
+	switch config := channel.ConfigForKey(ConfigKeywordRoutes, nil).(type) {
+	case map[string]any:
+		for keyword, uuid := range config {
+			if s, isStr := uuid.(string); isStr && s != "" {
+				routes[strings.ToLower(keyword)] = ChannelUUID(s)
+			}
+		}
+	case map[string]string:
+		for keyword, uuid := range config {
+			if uuid != "" {
+				routes[strings.ToLower(keyword)] = ChannelUUID(uuid)
+			}
+		}
+	}
+
+	defaultRoute := ChannelUUID(channel.StringConfigForKey(ConfigKeywordRouteDefault, ""))
+
+	if len(routes) == 0 && defaultRoute == NilChannelUUID {
+		return nil
+	}
+
+	return &KeywordRouter{
+		channel:      channel,
+		routes:       routes,
+		defaultRoute: defaultRoute,
+		sticky:       channel.BoolConfigForKey(ConfigKeywordRouteSticky, false),
+	}
+}
+
+// Route returns the channel that the given incoming message should be written to. Messages matching a keyword go to
+// that keyword's channel, otherwise if routing is sticky, to the channel the URN was last routed to by keyword, and
+// otherwise to the default channel.
+func (r *KeywordRouter) Route(ctx context.Context, b Backend, msg MsgIn) (Channel, error) {
+	rc := b.RedisPool().Get()
+	defer rc.Close()
+
+	stickyKey := fmt.Sprintf(stickyRouteKey, r.channel.UUID(), msg.URN().Identity())
+	target, matched := r.routes[firstKeyword(msg.Text())]
+
+	if matched {
+		if r.sticky {
+			if _, err := rc.Do("SET", stickyKey, string(target), "EX", int(stickyRouteTTL/time.Second)); err != nil {
+				return nil, errors.Wrap(err, "error saving sticky keyword route")
+			}
+		}
+	} else {
+		if r.sticky {
+			last, err := redis.String(rc.Do("GET", stickyKey))
+			if err != nil && err != redis.ErrNil {
+				return nil, errors.Wrap(err, "error looking up sticky keyword route")
+			}
+			target = ChannelUUID(last)
+		}
+		if target == NilChannelUUID {
+			target = r.defaultRoute
+		}
+	}
+
+	if target == NilChannelUUID || target == r.channel.UUID() {
+		return r.channel, nil
+	}
+
+	channel, err := b.GetChannel(ctx, AnyChannelType, target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up routed channel %s", target)
+	}
+	return channel, nil
+}
+
+// returns the lowercased first word of the given text, ignoring any surrounding punctuation
+func firstKeyword(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimFunc(fields[0], func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }))
+}
+
+// routingBackend wraps our backend so that incoming messages written to channels with keyword routes, whether during
+// requests or in the background such as flushes of concatenated messages, are written to their routed channel, and any
+// compliance keywords in them are handled
+type routingBackend struct {
+	Backend
+}
+
+func (b *routingBackend) WriteMsg(ctx context.Context, m MsgIn, clog *ChannelLog) error {
+	if router := NewKeywordRouter(m.Channel()); router != nil {
+		channel, err := router.Route(ctx, b.Backend, m)
+		if err != nil {
+			// better to write the message to the receiving channel than lose it
+			slog.Error("error routing incoming message by keyword", "error", err, "channel_uuid", router.channel.UUID())
+		} else if channel.UUID() != m.Channel().UUID() {
+			m = m.WithChannel(channel)
+		}
+	}
+
+	if err := b.Backend.WriteMsg(ctx, m, clog); err != nil {
+		return err
+	}
+
+	if err := handleComplianceKeyword(ctx, b.Backend, m, clog); err != nil {
+		slog.Error("error handling compliance keyword", "error", err, "channel_uuid", m.Channel().UUID())
+	}
+
+	return nil
+}
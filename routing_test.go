@@ -0,0 +1,102 @@
+package courier_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeywordRouter(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+
+	shared := test.NewMockChannel("95710b36-855d-4832-a723-5f71f73688a0", "KN", "2020", "RW", map[string]any{
+		courier.ConfigKeywordRoutes:      map[string]any{"JOIN": "e4bb1578-29da-4fa5-a214-9da19dd24230", "quiz": "c1b4b4b2-8b5e-4f4a-9d8a-3b1b1b1b1b1b"},
+		courier.ConfigKeywordRouteSticky: true,
+	})
+	joinCh := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "KN", "2020", "RW", nil)
+	quizCh := test.NewMockChannel("c1b4b4b2-8b5e-4f4a-9d8a-3b1b1b1b1b1b", "KN", "2020", "RW", nil)
+	mb.AddChannel(shared)
+	mb.AddChannel(joinCh)
+	mb.AddChannel(quizCh)
+
+	// channels without any routing config don't have a router
+	assert.Nil(t, courier.NewKeywordRouter(joinCh))
+	assert.Nil(t, courier.NewKeywordRouter(nil))
+
+	router := courier.NewKeywordRouter(shared)
+	require.NotNil(t, router)
+
+	route := func(urn urns.URN, text string) courier.ChannelUUID {
+		ch, err := router.Route(ctx, mb, mb.NewIncomingMsg(shared, urn, text, "", nil))
+		require.NoError(t, err)
+		return ch.UUID()
+	}
+
+	bob := urns.URN("tel:+250788000001")
+	jim := urns.URN("tel:+250788000002")
+
+	// no keyword match and no previous route, falls back to the receiving channel
+	assert.Equal(t, shared.UUID(), route(bob, "hello"))
+	assert.Equal(t, shared.UUID(), route(bob, ""))
+
+	// keywords are matched case insensitively, ignoring punctuation
+	assert.Equal(t, joinCh.UUID(), route(bob, "join now"))
+	assert.Equal(t, quizCh.UUID(), route(jim, "Quiz!"))
+
+	// replies without a keyword stick to the channel of the last keyword
+	assert.Equal(t, joinCh.UUID(), route(bob, "yes please"))
+	assert.Equal(t, quizCh.UUID(), route(jim, "B"))
+
+	// until a different keyword is matched
+	assert.Equal(t, quizCh.UUID(), route(bob, "QUIZ"))
+	assert.Equal(t, quizCh.UUID(), route(bob, "A"))
+
+	// with a default route and without stickiness
+	shared = test.NewMockChannel("95710b36-855d-4832-a723-5f71f73688a0", "KN", "2020", "RW", map[string]any{
+		courier.ConfigKeywordRoutes:       map[string]any{"quiz": "c1b4b4b2-8b5e-4f4a-9d8a-3b1b1b1b1b1b"},
+		courier.ConfigKeywordRouteDefault: "e4bb1578-29da-4fa5-a214-9da19dd24230",
+	})
+	router = courier.NewKeywordRouter(shared)
+
+	assert.Equal(t, quizCh.UUID(), route(bob, "quiz"))
+	assert.Equal(t, joinCh.UUID(), route(bob, "A"))
+
+	// routing to a channel which doesn't exist is an error
+	shared = test.NewMockChannel("95710b36-855d-4832-a723-5f71f73688a0", "KN", "2020", "RW", map[string]any{
+		courier.ConfigKeywordRoutes: map[string]any{"quiz": "2a8bc1c9-5e5b-4ee4-a4c4-4a1d4f5e1f0a"},
+	})
+	router = courier.NewKeywordRouter(shared)
+
+	_, err := router.Route(ctx, mb, mb.NewIncomingMsg(shared, bob, "quiz", "", nil))
+	assert.EqualError(t, err, "error looking up routed channel 2a8bc1c9-5e5b-4ee4-a4c4-4a1d4f5e1f0a: channel not found")
+}
+
+func TestRoutingBackend(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+
+	shared := test.NewMockChannel("95710b36-855d-4832-a723-5f71f73688a0", "KN", "2020", "RW", map[string]any{
+		courier.ConfigKeywordRoutes: map[string]any{"join": "e4bb1578-29da-4fa5-a214-9da19dd24230"},
+	})
+	joinCh := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "KN", "2020", "RW", nil)
+	mb.AddChannel(shared)
+	mb.AddChannel(joinCh)
+
+	// messages written outside of a request, e.g. flushed partial messages, are routed too
+	b := courier.NewServer(courier.NewDefaultConfig(), mb).Backend()
+
+	require.NoError(t, b.WriteMsg(ctx, mb.NewIncomingMsg(shared, "tel:+250788000001", "join now", "", nil), nil))
+	require.NoError(t, b.WriteMsg(ctx, mb.NewIncomingMsg(shared, "tel:+250788000001", "hello", "", nil), nil))
+	require.NoError(t, b.WriteMsg(ctx, mb.NewIncomingMsg(joinCh, "tel:+250788000001", "join", "", nil), nil))
+
+	require.Len(t, mb.WrittenMsgs(), 3)
+	assert.Equal(t, joinCh.UUID(), mb.WrittenMsgs()[0].Channel().UUID())
+	assert.Equal(t, shared.UUID(), mb.WrittenMsgs()[1].Channel().UUID())
+	assert.Equal(t, joinCh.UUID(), mb.WrittenMsgs()[2].Channel().UUID())
+}
@@ -0,0 +1,108 @@
+package courier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+)
+
+// how long after a sandboxed message is wired that we mark it as delivered
+const sandboxDeliveryDelay = time.Second
+
+// IsSandboxed returns whether the given channel is in sandbox mode, i.e. outgoing messages aren't actually sent
+func IsSandboxed(channel Channel) bool {
+	return channel.BoolConfigForKey(ConfigSandbox, false)
+}
+
+// SandboxTrace records the given request without making it, returning a trace with a response synthesized from the
+// channel's sandbox response config
+func SandboxTrace(channel Channel, request *http.Request) (*httpx.Trace, error) {
+	requestTrace, err := httputil.DumpRequestOut(request, true)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "application/json"
+	body := []byte(`{}`)
+
+	switch r := channel.ConfigForKey(ConfigSandboxResponse, nil).(type) {
+	case nil:
+	case string:
+		body = []byte(r)
+		if !json.Valid(body) {
+			contentType = "text/plain; charset=utf-8"
+		}
+	default:
+		body = jsonx.MustMarshal(r)
+	}
+
+	response := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}, "X-Courier-Sandbox": {"true"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+
+	responseTrace, err := httputil.DumpResponse(response, false)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	now := dates.Now()
+	return &httpx.Trace{
+		Request:       request,
+		RequestTrace:  requestTrace,
+		Response:      response,
+		ResponseTrace: responseTrace,
+		ResponseBody:  body,
+		StartTime:     now,
+		EndTime:       now,
+	}, nil
+}
+
+// writes a delivered status for a sandboxed message after a delay, as the channel would have done
+func (w *Sender) writeSandboxDelivered(msg MsgOut) {
+	server := w.foreman.server
+	server.WaitGroup().Add(1)
+
+	go func() {
+		defer server.WaitGroup().Done()
+
+		select {
+		case <-server.StopChan():
+			return
+		case <-time.After(sandboxDeliveryDelay):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		backend := server.Backend()
+		clog := NewChannelLog(ChannelLogTypeMsgStatus, msg.Channel(), nil)
+		status := backend.NewStatusUpdate(msg.Channel(), msg.ID(), MsgStatusDelivered, clog)
+
+		if err := backend.WriteStatusUpdate(ctx, status); err != nil {
+			slog.Error("error writing sandbox delivered status", "error", err, "msg_id", msg.ID())
+		}
+
+		clog.End()
+		if err := backend.WriteChannelLog(ctx, clog); err != nil {
+			slog.Error("error writing channel log", "error", err)
+		}
+	}()
+}
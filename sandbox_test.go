@@ -0,0 +1,88 @@
+package courier_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandbox(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{})
+	httpx.SetRequestor(mocks)
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(testConfig(), mb)
+
+	s.Start()
+	defer s.Stop()
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigSandbox:         true,
+		courier.ConfigSandboxResponse: map[string]any{"id": "123"},
+	})
+	mb.AddChannel(mockChannel)
+
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(101), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "hello", nil))
+
+	// no request is actually made
+	assert.Len(t, mocks.Requests(), 0)
+
+	// but the rendered request is logged with the synthesized response
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	clog := mb.WrittenChannelLogs()[0]
+	require.Len(t, clog.HTTPLogs(), 1)
+	assert.Equal(t, "http://mock.com/send", clog.HTTPLogs()[0].URL)
+	assert.Contains(t, clog.HTTPLogs()[0].Request, "Authorization: Token **********")
+	assert.Equal(t, 200, clog.HTTPLogs()[0].StatusCode)
+	assert.Contains(t, clog.HTTPLogs()[0].Response, "X-Courier-Sandbox: true")
+	assert.Contains(t, clog.HTTPLogs()[0].Response, `{"id":"123"}`)
+
+	// and the message is wired...
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+
+	// then delivered, without counting towards usage
+	time.Sleep(time.Millisecond * 1500)
+
+	require.Len(t, mb.WrittenMsgStatuses(), 2)
+	assert.Equal(t, courier.MsgID(101), mb.WrittenMsgStatuses()[1].MsgID())
+	assert.Equal(t, courier.MsgStatusDelivered, mb.WrittenMsgStatuses()[1].Status())
+	require.Len(t, mb.WrittenChannelLogs(), 2)
+	assert.Equal(t, courier.ChannelLogTypeMsgStatus, mb.WrittenChannelLogs()[1].Type())
+	mb.Reset()
+
+	rc := mb.RedisPool().Get()
+	usage, err := courier.GetChannelUsage(rc, mockChannel.UUID(), time.Now().UTC(), time.Now().UTC())
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 0, usage[0].Msgs)
+
+	// responses can also be plain text
+	mockChannel.SetConfig(courier.ConfigSandboxResponse, "OK")
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(102), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "hello", nil))
+
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	assert.Contains(t, mb.WrittenChannelLogs()[0].HTTPLogs()[0].Response, "Content-Type: text/plain; charset=utf-8")
+	assert.Len(t, mocks.Requests(), 0)
+	mb.Reset()
+
+	// the handler not understanding the synthesized response doesn't fail the message
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(103), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "err:unparseable", nil))
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+	mb.Reset()
+
+	// but other errors still do
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(104), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "err:config", nil))
+
+	require.GreaterOrEqual(t, len(mb.WrittenMsgStatuses()), 1)
+	assert.Equal(t, courier.MsgID(104), mb.WrittenMsgStatuses()[0].MsgID())
+	assert.Equal(t, courier.MsgStatusFailed, mb.WrittenMsgStatuses()[0].Status())
+}
@@ -0,0 +1,126 @@
+package courier
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ScanResult is the result of scanning an attachment for malware
+type ScanResult struct {
+	Infected  bool
+	Signature string // name of the malware found if infected
+}
+
+// AttachmentScanner scans the content of an incoming attachment for malware
+type AttachmentScanner func(ctx context.Context, body io.Reader) (*ScanResult, error)
+
+// ScanPolicy is which attachments are scanned and what happens to those that can't be
+type ScanPolicy struct {
+	MaxBytes   int  // attachments larger than this aren't scanned, zero meaning no limit
+	FailClosed bool // whether attachments which aren't scanned are dropped rather than saved
+}
+
+// AttachmentScanner returns the scanner for incoming attachments and the policy for using it, or a nil scanner if
+// attachments aren't scanned
+func (c *Config) AttachmentScanner() (AttachmentScanner, ScanPolicy) {
+	if c.ClamdAddress == "" {
+		return nil, ScanPolicy{}
+	}
+	return NewClamdScanner(c.ClamdAddress), ScanPolicy{MaxBytes: c.ClamdMaxBytes, FailClosed: c.ScanFailClosed}
+}
+
+const (
+	clamdChunkSize = 64 * 1024
+	clamdTimeout   = 30 * time.Second
+)
+
+// NewClamdScanner returns a scanner which streams content to a ClamAV daemon at the given address, which can be a
+// TCP address like tcp://localhost:3310 or a unix socket like unix:///var/run/clamav/clamd.ctl
+func NewClamdScanner(address string) AttachmentScanner {
+	return func(ctx context.Context, body io.Reader) (*ScanResult, error) {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid clamd address")
+		}
+		network, addr := u.Scheme, u.Host
+		if network == "unix" {
+			addr = u.Path
+		}
+
+		dialer := &net.Dialer{Timeout: clamdTimeout}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "error connecting to clamd")
+		}
+		defer conn.Close()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(clamdTimeout)
+		}
+		conn.SetDeadline(deadline)
+
+		if err := clamdInstream(conn, body); err != nil {
+			return nil, err
+		}
+
+		reply, err := bufio.NewReader(conn).ReadString(0)
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "error reading clamd reply")
+		}
+
+		return parseClamdReply(reply)
+	}
+}
+
+// sends content using the INSTREAM command, i.e. as chunks prefixed with their length and terminated by an empty chunk
+func clamdInstream(w io.Writer, body io.Reader) error {
+	if _, err := w.Write([]byte("zINSTREAM\x00")); err != nil {
+		return errors.Wrap(err, "error writing clamd command")
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := w.Write(append(size, buf[:n]...)); werr != nil {
+				return errors.Wrap(werr, "error writing to clamd")
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "error reading content to scan")
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return errors.Wrap(err, "error writing to clamd")
+}
+
+// parses a reply to INSTREAM, e.g. "stream: OK" or "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case result == "OK":
+		return &ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &ScanResult{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return nil, errors.Errorf("clamd error: %s", reply)
+	}
+}
@@ -0,0 +1,111 @@
+package courier_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the standard anti-virus test file which scanners detect as malware
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// starts a stand-in for clamd on the given listener which finds the EICAR test file and rejects content over maxBytes
+func startMockClamd(t *testing.T, l net.Listener, maxBytes int) {
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+
+				cmd, err := r.ReadString(0)
+				if err != nil || cmd != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+
+				content := &bytes.Buffer{}
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(content, r, int64(n)); err != nil {
+						return
+					}
+					if content.Len() > maxBytes {
+						conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+						return
+					}
+				}
+
+				if strings.Contains(content.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+}
+
+func TestClamdScanner(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startMockClamd(t, l, 100*1024)
+
+	scan := courier.NewClamdScanner("tcp://" + l.Addr().String())
+
+	result, err := scan(ctx, strings.NewReader("hello world"))
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.ScanResult{}, result)
+
+	result, err = scan(ctx, strings.NewReader(eicar))
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, result)
+
+	// content sent in multiple chunks
+	result, err = scan(ctx, io.MultiReader(bytes.NewReader(make([]byte, 70*1024)), strings.NewReader(eicar)))
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, result)
+
+	// errors from clamd are returned as errors
+	_, err = scan(ctx, bytes.NewReader(make([]byte, 200*1024)))
+	assert.EqualError(t, err, "clamd error: INSTREAM size limit exceeded. ERROR")
+
+	// as are connection errors
+	_, err = courier.NewClamdScanner("tcp://127.0.0.1:1")(ctx, strings.NewReader("hello world"))
+	assert.ErrorContains(t, err, "error connecting to clamd")
+
+	// clamd can also be reached over a unix socket
+	socket := filepath.Join(t.TempDir(), "clamd.ctl")
+	l, err = net.Listen("unix", socket)
+	require.NoError(t, err)
+	startMockClamd(t, l, 100*1024)
+
+	result, err = courier.NewClamdScanner("unix://"+socket)(ctx, strings.NewReader(eicar))
+	assert.NoError(t, err)
+	assert.Equal(t, &courier.ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, result)
+}
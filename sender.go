@@ -6,14 +6,19 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/nyaruka/courier/utils"
 	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 )
 
 type SendResult struct {
 	externalIDs []string
 	newURN      urns.URN
+	segments    int
+	cost        decimal.Decimal
+	currency    string
 }
 
 func (r *SendResult) AddExternalID(id string) {
@@ -24,6 +29,25 @@ func (r *SendResult) ExternalIDs() []string {
 	return r.externalIDs
 }
 
+// SetSegments sets the number of SMS segments the message was sent as, if the channel reports it
+func (r *SendResult) SetSegments(n int) {
+	r.segments = n
+}
+
+func (r *SendResult) Segments() int {
+	return r.segments
+}
+
+// AddCost adds to what the channel charged to send the message, e.g. for each part of it sent
+func (r *SendResult) AddCost(amount decimal.Decimal, currency string) {
+	r.cost = r.cost.Add(amount)
+	r.currency = currency
+}
+
+func (r *SendResult) Cost() (decimal.Decimal, string) {
+	return r.cost, r.currency
+}
+
 func (r *SendResult) SetNewURN(u urns.URN) {
 	r.newURN = u
 }
@@ -110,6 +134,34 @@ var ErrContactStopped error = &SendError{
 	clogMsg:   "Contact has opted-out of messages from this channel.",
 }
 
+// ErrReactionUnsupported should be returned when a reaction is sent on a channel which can't send reactions
+var ErrReactionUnsupported error = &SendError{
+	msg:       "reactions not supported",
+	retryable: false,
+	loggable:  false,
+	clogCode:  "reaction_unsupported",
+	clogMsg:   "Channel does not support sending reactions to messages.",
+}
+
+// ErrConversationActionUnsupported should be returned when a conversation action is sent on a channel which can't perform it
+var ErrConversationActionUnsupported error = &SendError{
+	msg:       "conversation action not supported",
+	retryable: false,
+	loggable:  false,
+	clogCode:  "conversation_action_unsupported",
+	clogMsg:   "Channel does not support this conversation action.",
+}
+
+// ErrURLSigningFailed is returned by the URL signing send middleware when attachment URLs can't be signed, which is
+// due to configuration rather than anything that will resolve itself by retrying
+var ErrURLSigningFailed error = &SendError{
+	msg:       "attachment URL signing failed",
+	retryable: false,
+	loggable:  true,
+	clogCode:  "url_signing_failed",
+	clogMsg:   "Unable to sign attachment URLs.",
+}
+
 func ErrFailedWithReason(code, desc string) *SendError {
 	return &SendError{
 		msg:         "channel rejected send with reason",
@@ -121,12 +173,26 @@ func ErrFailedWithReason(code, desc string) *SendError {
 	}
 }
 
+// ErrSendVetoed should be returned by send middleware to fail a message with the given reason rather than send it
+func ErrSendVetoed(code, desc string) *SendError {
+	return &SendError{
+		msg:       "send vetoed by middleware",
+		retryable: false,
+		loggable:  false,
+		clogCode:  code,
+		clogMsg:   desc,
+	}
+}
+
 // Foreman takes care of managing our set of sending workers and assigns msgs for each to send
 type Foreman struct {
 	server           Server
 	senders          []*Sender
 	availableSenders chan *Sender
 	quit             chan bool
+
+	// send middleware of our server, in addition to those registered globally
+	sendMiddleware map[string]SendMiddleware
 }
 
 // NewForeman creates a new Foreman for the passed in server with the number of max senders
@@ -266,8 +332,8 @@ func (w *Sender) sendMessage(msg MsgOut) {
 	server := w.foreman.server
 	backend := server.Backend()
 
-	// we don't want any individual send taking more than 35s
-	sendCTX, cancel := context.WithTimeout(context.Background(), time.Second*35)
+	// allow a little more than the channel's send timeout so that a handler whose request times out can still log it
+	sendCTX, cancel := context.WithTimeout(context.Background(), server.Config().SendTimeoutFor(msg.Channel())+time.Second*5)
 	defer cancel()
 
 	log = log.With("msg_id", msg.ID(), "msg_text", msg.Text(), "msg_urn", msg.URN().Identity())
@@ -298,12 +364,14 @@ func (w *Sender) sendMessage(msg MsgOut) {
 
 	var status StatusUpdate
 	var redactValues []string
+	var sentMsg bool // whether we actually sent a message, rather than a reaction or conversation action
 	handler := server.GetHandler(msg.Channel())
 	if handler != nil {
 		redactValues = handler.RedactValues(msg.Channel())
 	}
 
 	clog := NewChannelLogForSend(msg, redactValues)
+	clog.SetReroutedFrom(msg.ReroutedFrom())
 
 	if handler == nil {
 		// if there's no handler, create a FAILED status for it
@@ -318,6 +386,7 @@ func (w *Sender) sendMessage(msg MsgOut) {
 	} else {
 
 		status = w.sendByHandler(sendCTX, handler, msg, clog, log)
+		sentMsg = msg.Reaction() == nil && msg.ConversationAction() == ""
 
 		duration := time.Since(start)
 		secondDuration := float64(duration) / float64(time.Second)
@@ -335,9 +404,24 @@ func (w *Sender) sendMessage(msg MsgOut) {
 	writeCTX, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	err = backend.WriteStatusUpdate(writeCTX, status)
-	if err != nil {
-		log.Info("error writing msg status", "error", err)
+	// a rerouted message has already had its status updated by the backend when it was queued on its new channel
+	if status.Status() != MsgStatusQueued {
+		err = backend.WriteStatusUpdate(writeCTX, status)
+		if err != nil {
+			log.Info("error writing msg status", "error", err)
+		}
+	}
+
+	// sandboxed messages don't count towards usage but should still appear to be delivered
+	if IsSandboxed(msg.Channel()) && status.Status() == MsgStatusWired {
+		w.writeSandboxDelivered(msg)
+	} else if sentMsg && (status.Status() == MsgStatusWired || status.Status() == MsgStatusSent) {
+		if err := recordUsage(backend.RedisPool(), msg.Channel(), 1, status.Segments()); err != nil {
+			log.Error("error recording channel usage", "error", err)
+		}
+		if err := recordCost(backend.RedisPool(), msg.Channel(), status); err != nil {
+			log.Error("error recording channel cost", "error", err)
+		}
 	}
 
 	clog.End()
@@ -352,10 +436,37 @@ func (w *Sender) sendMessage(msg MsgOut) {
 	backend.MarkOutgoingMsgComplete(writeCTX, msg, status)
 }
 
+// returns whether the given send error is from the handler not understanding a synthesized sandbox response
+func isSandboxResponseError(ch Channel, err error, clog *ChannelLog) bool {
+	if err == nil || !IsSandboxed(ch) || len(clog.HTTPLogs()) == 0 {
+		return false
+	}
+	return err == ErrResponseUnparseable || err == ErrResponseUnexpected
+}
+
 func (w *Sender) sendByHandler(ctx context.Context, h ChannelHandler, m MsgOut, clog *ChannelLog, log *slog.Logger) StatusUpdate {
 	backend := w.foreman.server.Backend()
 	res := &SendResult{newURN: urns.NilURN}
-	err := h.Send(ctx, m, res, clog)
+
+	// give any send middleware a chance to rewrite or veto the message
+	sm, err := applySendMiddleware(ctx, w.foreman.server.Config(), w.foreman.sendMiddleware, m, clog)
+	if err == nil {
+		if m.Reaction() != nil {
+			err = sendReaction(ctx, h, sm, res, clog)
+		} else if m.ConversationAction() != "" {
+			err = sendConversationAction(ctx, h, sm, res, clog)
+		} else {
+			recordSegments(sm, clog)
+			err = h.Send(ctx, sm, res, clog)
+		}
+	}
+
+	// a sandboxed channel only renders its requests, so once the handler has made them an error parsing the synthesized
+	// response doesn't mean the send failed, but any other error (e.g. invalid config) is still real
+	if isSandboxResponseError(m.Channel(), err, clog) {
+		log.Debug("ignoring send error on sandboxed channel", "error", err)
+		err = nil
+	}
 
 	status := backend.NewStatusUpdate(m.Channel(), m.ID(), MsgStatusWired, clog)
 
@@ -364,6 +475,16 @@ func (w *Sender) sendByHandler(ctx context.Context, h ChannelHandler, m MsgOut,
 		status.SetExternalID(res.ExternalIDs()[0])
 	}
 
+	// prefer the segment count reported by the channel over our own
+	if res.segments > 0 {
+		status.SetSegments(res.segments)
+	} else {
+		status.SetSegments(clog.Segments())
+	}
+	if res.currency != "" {
+		status.SetCost(res.cost, res.currency)
+	}
+
 	if res.newURN != urns.NilURN {
 		urnErr := status.SetURNUpdate(m.URN(), res.newURN)
 		if urnErr != nil {
@@ -400,5 +521,49 @@ func (w *Sender) sendByHandler(ctx context.Context, h ChannelHandler, m MsgOut,
 		clog.Error(NewChannelError("internal_error", "", "An internal error occured."))
 	}
 
+	// if the failure is one that the channel's fallback channel might not have, give that a try, but only once
+	if status.Status() == MsgStatusFailed && m.ReroutedFrom() == nil && shouldReroute(m.Channel(), clog) {
+		fallback, urn, err := w.reroute(ctx, m, clog)
+		if err != nil {
+			log.Error("error rerouting message to fallback channel", "error", err)
+		} else {
+			status.SetStatus(MsgStatusQueued)
+			clog.Error(NewChannelError("rerouted", "", "Message rerouted to fallback channel %s as %s.", fallback.UUID(), urn))
+		}
+	}
+
 	return status
 }
+
+// sends the reaction in the passed in msg, if the handler supports reactions and we know which message is being reacted to
+func sendReaction(ctx context.Context, h ChannelHandler, m MsgOut, res *SendResult, clog *ChannelLog) error {
+	rs, isReactionSender := h.(ReactionSender)
+	if !isReactionSender || m.ResponseToExternalID() == "" {
+		return ErrReactionUnsupported
+	}
+	return rs.SendReaction(ctx, m, res, clog)
+}
+
+// sends the conversation action in the passed in msg, if the handler supports conversation actions
+func sendConversationAction(ctx context.Context, h ChannelHandler, m MsgOut, res *SendResult, clog *ChannelLog) error {
+	ca, isConversationActions := h.(ConversationActions)
+	if !isConversationActions {
+		return ErrConversationActionUnsupported
+	}
+	return ca.SendConversationAction(ctx, m, res, clog)
+}
+
+// records in the channel log how many segments the given message will be sent as if it's an SMS
+func recordSegments(msg MsgOut, clog *ChannelLog) {
+	channel := msg.Channel()
+	if !channel.IsScheme(urns.TelScheme) || msg.Text() == "" {
+		return
+	}
+
+	text := msg.Text()
+	if channel.BoolConfigForKey(ConfigTransliterate, false) {
+		text = utils.TransliterateGSM7(text)
+	}
+
+	clog.SetSegments(utils.SMSSegments(text))
+}
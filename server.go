@@ -76,7 +76,7 @@ func NewServerWithLogger(config *Config, backend Backend, logger *slog.Logger) S
 
 	return &server{
 		config:  config,
-		backend: backend,
+		backend: &routingBackend{Backend: backend},
 
 		router:       router,
 		publicRouter: publicRouter,
@@ -114,6 +114,23 @@ func (s *server) Start() error {
 	s.router.Get("/", s.handleIndex)
 	s.router.Get("/status", s.basicAuthRequired(s.handleStatus))
 	s.publicRouter.Post("/_fetch-attachment", s.tokenAuthRequired(s.handleFetchAttachment)) // becomes /c/_fetch-attachment
+	s.publicRouter.Get("/_usage", s.tokenAuthRequired(s.handleUsage))                       // becomes /c/_usage
+	s.publicRouter.Get("/_logs", s.tokenAuthRequired(s.handleChannelLogs))                  // becomes /c/_logs
+	s.publicRouter.Get("/_logs/{uuid}", s.tokenAuthRequired(s.handleChannelLog))            // becomes /c/_logs/{uuid}
+	s.publicRouter.Get("/l/{code:[a-zA-Z0-9]+}", s.handleLinkRedirect)                      // becomes /c/l/{code}
+
+	// signed URLs of outgoing attachments which we proxy
+	s.publicRouter.Get("/media/{expires:[0-9]+}/{signature:[0-9a-f]+}/{name}", s.handleSignedMedia) // becomes /c/media/...
+
+	// if attachments are stored locally, we serve them ourselves, unless they're private and only served via signed URLs
+	if s.config.ActiveStorageDriver() == StorageDriverFS && !s.config.PrivateAttachments {
+		s.publicRouter.Get("/storage/attachments/*", s.handleStoredAttachment) // becomes /c/storage/attachments/...
+	}
+
+	// and our signer of proxied media URLs if configured
+	if s.config.SignedURLSecret != "" {
+		SetURLSigner(NewURLSigner(s.config.Domain, s.config.SignedURLSecret))
+	}
 
 	// initialize our handlers
 	s.initializeChannelHandlers()
@@ -122,8 +139,8 @@ func (s *server) Start() error {
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.Address, s.config.Port),
 		Handler:      s.router,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 45 * time.Second,
+		ReadTimeout:  time.Duration(s.config.HTTPReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(s.config.HTTPWriteTimeout) * time.Second,
 		IdleTimeout:  90 * time.Second,
 	}
 
@@ -166,6 +183,7 @@ func (s *server) Start() error {
 
 	// start our foreman for outgoing messages
 	s.foreman = NewForeman(s, s.config.MaxWorkers)
+	s.foreman.sendMiddleware = s.sendMiddleware()
 	s.foreman.Start()
 
 	return nil
@@ -233,6 +251,14 @@ type server struct {
 	chanRoutes []string // used for index page
 }
 
+// returns our send middleware which need the server, and so are provided by it rather than registered globally
+func (s *server) sendMiddleware() map[string]SendMiddleware {
+	return map[string]SendMiddleware{
+		SendMiddlewareTrackLinks: s.trackLinks,
+		SendMiddlewareSignURLs:   s.signURLs,
+	}
+}
+
 func (s *server) initializeChannelHandlers() {
 	includes := s.config.IncludeChannels
 	excludes := s.config.ExcludeChannels
@@ -334,6 +360,7 @@ func (s *server) channelHandleWrapper(handler ChannelHandler, handlerFunc Channe
 					clog.SetAttached(true)
 					analytics.Gauge(fmt.Sprintf("courier.msg_status_%s", channel.ChannelType()), secondDuration)
 					LogMsgStatusReceived(r, e)
+					s.recordStatusCost(channel, e)
 				case ChannelEvent:
 					analytics.Gauge(fmt.Sprintf("courier.evt_receive_%s", channel.ChannelType()), secondDuration)
 					LogChannelEventReceived(r, e)
@@ -396,7 +423,7 @@ func (s *server) handleFetchAttachment(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*1)
 	defer cancel()
 
-	resp, err := fetchAttachment(ctx, s.backend, r)
+	resp, err := fetchAttachment(ctx, s.backend, s.config, r)
 	if err != nil {
 		slog.Error("error fetching attachment", "error", err)
 		WriteError(w, http.StatusBadRequest, err)
@@ -1,7 +1,6 @@
 package courier_test
 
 import (
-	"context"
 	"io"
 	"log/slog"
 	"net/http"
@@ -151,6 +150,7 @@ func TestOutgoing(t *testing.T) {
 	assert.Len(t, mb.WrittenChannelLogs(), 1)
 	clog := mb.WrittenChannelLogs()[0]
 	assert.Equal(t, []*courier.ChannelError{courier.NewChannelError("seeds", "", "contains ********** seeds")}, clog.Errors())
+	assert.Equal(t, 1, clog.Segments())
 
 	assert.Len(t, clog.HTTPLogs(), 1)
 
@@ -218,6 +218,7 @@ func TestFetchAttachment(t *testing.T) {
 		},
 		"http://mock.com/media/hello.mp3": {
 			httpx.NewMockResponse(404, nil, []byte(`No such file`)),
+			httpx.NewMockResponse(404, nil, []byte(`No such file`)),
 		},
 		"http://mock.com/media/hello.pdf": {
 			httpx.MockConnectionError,
@@ -295,19 +296,29 @@ func TestFetchAttachment(t *testing.T) {
 	statusCode, respBody = submit(`{"channel_uuid": "e4bb1578-29da-4fa5-a214-9da19dd24230", "channel_type": "MCK", "url": "http://mock.com/media/hello.pdf"}`, "sesame")
 	assert.Equal(t, 200, statusCode)
 	assert.JSONEq(t, `{"attachment": {"content_type": "unavailable", "url": "http://mock.com/media/hello.pdf", "size": 0}, "log_uuid": "338ff339-5663-49ed-8ef6-384876655d1b"}`, string(respBody))
+
+	// repeating a successful fetch within the window gets the same attachment without fetching it again
+	statusCode, respBody = submit(`{"channel_uuid": "e4bb1578-29da-4fa5-a214-9da19dd24230", "channel_type": "MCK", "url": "http://mock.com/media/hello.jpg"}`, "sesame")
+	assert.Equal(t, 200, statusCode)
+	assert.JSONEq(t, `{"attachment": {"content_type": "image/jpeg", "url": "https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.jpg", "size": 17301}, "log_uuid": "c00e5d67-c275-4389-aded-7d8b151cbd5b"}`, string(respBody))
+	assert.Len(t, mb.SavedAttachments(), 1)
+	assert.Len(t, mb.WrittenChannelLogs(), 3)
+
+	// but unavailable attachments are fetched again
+	statusCode, respBody = submit(`{"channel_uuid": "e4bb1578-29da-4fa5-a214-9da19dd24230", "channel_type": "MCK", "url": "http://mock.com/media/hello.mp3"}`, "sesame")
+	assert.Equal(t, 200, statusCode)
+	assert.JSONEq(t, `{"attachment": {"content_type": "unavailable", "url": "http://mock.com/media/hello.mp3", "size": 0}, "log_uuid": "9b955e36-ac16-4c6b-8ab6-9b9af5cd042a"}`, string(respBody))
+	assert.Len(t, mb.WrittenChannelLogs(), 4)
 }
 
 // utility to send a message on a mocked backend and block until it's marked as sent
 func sendAndWait(mb *test.MockBackend, m courier.MsgOut) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
 	mb.PushOutgoingMsg(m)
 
 	for {
 		time.Sleep(time.Millisecond * 25)
 
-		if sent, _ := mb.WasMsgSent(ctx, m.ID()); sent {
+		if mb.WasMsgCompleted(m.ID()) {
 			return
 		}
 	}
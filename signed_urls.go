@@ -0,0 +1,257 @@
+package courier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/pkg/errors"
+)
+
+// SendMiddlewareSignURLs is the name of the send middleware which replaces the URLs of outgoing attachments with
+// signed URLs that expire, either presigned by backend storage or proxied by courier
+const SendMiddlewareSignURLs = "sign_urls"
+
+// format of the X-Amz-Date param of S3 presigned URLs
+const amzDateFormat = "20060102T150405Z"
+
+// how long the URLs which courier signs to fetch private attachments itself are valid for
+const fetchURLLifetime = 5 * time.Minute
+
+var urlSigner *URLSigner
+
+// SetURLSigner sets the signer used for URLs of media proxied by courier, nil meaning they can't be signed
+func SetURLSigner(s *URLSigner) {
+	urlSigner = s
+}
+
+// URLSigner signs the URLs of media proxied by courier so that they can only be fetched until they expire
+type URLSigner struct {
+	domain string
+	secret []byte
+}
+
+// NewURLSigner creates a new signer of proxied media URLs on the given domain
+func NewURLSigner(domain, secret string) *URLSigner {
+	return &URLSigner{domain: domain, secret: []byte(secret)}
+}
+
+// Sign returns a URL which proxies the given media URL until the given time
+func (s *URLSigner) Sign(mediaURL string, expires time.Time) string {
+	exp := expires.Unix()
+
+	return fmt.Sprintf("%s%d/%s/%s?url=%s", s.prefix(), exp, s.signature(mediaURL, exp), url.PathEscape(mediaName(mediaURL)), url.QueryEscape(mediaURL))
+}
+
+// Verify checks the signature of a proxied media URL
+func (s *URLSigner) Verify(mediaURL string, expires int64, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(s.signature(mediaURL, expires)))
+}
+
+// parses a URL returned by Sign, returning the media URL it proxies and when it expires
+func (s *URLSigner) parse(signedURL string) (string, time.Time, bool) {
+	rest, isProxied := strings.CutPrefix(signedURL, s.prefix())
+	if !isProxied {
+		return "", time.Time{}, false
+	}
+
+	exp, _, _ := strings.Cut(rest, "/")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	u, err := url.Parse(signedURL)
+	if err != nil || u.Query().Get("url") == "" {
+		return "", time.Time{}, false
+	}
+
+	return u.Query().Get("url"), time.Unix(expires, 0), true
+}
+
+func (s *URLSigner) prefix() string {
+	return fmt.Sprintf("https://%s/c/media/", s.domain)
+}
+
+func (s *URLSigner) signature(mediaURL string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d|%s", expires, mediaURL)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// gets the name to include in a proxied URL so that providers which look at the path still see the original filename
+func mediaName(mediaURL string) string {
+	if u, err := url.Parse(mediaURL); err == nil {
+		if name := path.Base(u.Path); name != "/" && name != "." {
+			return name
+		}
+	}
+	return "media"
+}
+
+// SignAttachmentURL returns a URL for the given attachment URL which expires at the given time, presigned by backend
+// storage if the attachment is stored there, otherwise proxied by courier
+func SignAttachmentURL(ctx context.Context, b Backend, attURL string, expires time.Time) (string, error) {
+	presigned, err := b.PresignAttachmentURL(ctx, attURL, expires)
+	if err != nil {
+		return "", errors.Wrap(err, "error presigning attachment URL")
+	}
+	if presigned != "" {
+		return presigned, nil
+	}
+
+	if urlSigner == nil {
+		return "", errors.New("no secret configured for signing attachment URLs")
+	}
+
+	return urlSigner.Sign(attURL, expires), nil
+}
+
+// FetchableAttachmentURL returns a URL from which courier itself can fetch the given attachment. If attachments are
+// private, attachments in storage are fetched via short lived signed URLs.
+func FetchableAttachmentURL(ctx context.Context, b Backend, cfg *Config, attURL string) (string, error) {
+	if !cfg.PrivateAttachments {
+		return attURL, nil
+	}
+	if _, _, isSigned := UnsignAttachmentURL(attURL); isSigned {
+		return attURL, nil
+	}
+
+	expires := dates.Now().Add(fetchURLLifetime)
+
+	presigned, err := b.PresignAttachmentURL(ctx, attURL, expires)
+	if err != nil {
+		return "", errors.Wrap(err, "error presigning attachment URL")
+	}
+	if presigned != "" {
+		return presigned, nil
+	}
+
+	if urlSigner != nil && strings.HasPrefix(attURL, LocalAttachmentsURL(cfg.Domain)) {
+		return urlSigner.Sign(attURL, expires), nil
+	}
+	return attURL, nil
+}
+
+// UnsignAttachmentURL returns the original URL of an attachment URL signed by SignAttachmentURL and when it expires
+func UnsignAttachmentURL(signedURL string) (string, time.Time, bool) {
+	if urlSigner != nil {
+		if mediaURL, expires, isProxied := urlSigner.parse(signedURL); isProxied {
+			return mediaURL, expires, true
+		}
+	}
+
+	// S3 presigned URLs are the original URL with the signature and its validity period as query params
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	q := u.Query()
+	if q.Get("X-Amz-Signature") == "" {
+		return "", time.Time{}, false
+	}
+
+	signedOn, err := time.Parse(amzDateFormat, q.Get("X-Amz-Date"))
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	lifetime, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	u.RawQuery = ""
+	return u.String(), signedOn.Add(time.Duration(lifetime) * time.Second), true
+}
+
+// signURLs is our send middleware for replacing the URLs of outgoing attachments with signed URLs that expire
+func (s *server) signURLs(ctx context.Context, msg MsgOut, content *SendContent, clog *ChannelLog) error {
+	lifetime := msg.Channel().IntConfigForKey(ConfigSignedURLLifetime, s.config.SignedURLLifetime)
+	expires := dates.Now().Add(time.Duration(lifetime) * time.Second)
+
+	for i, a := range content.Attachments {
+		contentType, attURL, _ := strings.Cut(a, ":")
+		if !strings.HasPrefix(attURL, "http://") && !strings.HasPrefix(attURL, "https://") {
+			continue
+		}
+
+		signed, err := SignAttachmentURL(ctx, s.backend, attURL, expires)
+		if err != nil {
+			// better to fail than to send an attachment URL which never expires or which can't be fetched
+			slog.Error("error signing attachment URL", "error", err, "msg", msg.UUID(), "url", attURL)
+			return ErrURLSigningFailed
+		}
+
+		content.Attachments[i] = contentType + ":" + signed
+	}
+
+	return nil
+}
+
+// handleSignedMedia serves the media proxied by a signed URL, so long as its signature is valid and it hasn't expired
+func (s *server) handleSignedMedia(w http.ResponseWriter, r *http.Request) {
+	expires, _ := strconv.ParseInt(chi.URLParam(r, "expires"), 10, 64)
+	mediaURL := r.URL.Query().Get("url")
+
+	if urlSigner == nil || mediaURL == "" || !urlSigner.Verify(mediaURL, expires, chi.URLParam(r, "signature")) {
+		WriteError(w, http.StatusForbidden, errors.New("invalid signature"))
+		return
+	}
+	if dates.Now().Unix() > expires {
+		WriteError(w, http.StatusForbidden, errors.New("URL has expired"))
+		return
+	}
+
+	// attachments in local storage can be served directly
+	if s.config.ActiveStorageDriver() == StorageDriverFS {
+		if path, isLocal := strings.CutPrefix(mediaURL, LocalAttachmentsURL(s.config.Domain)); isLocal {
+			s.serveStoredAttachment(w, r, path)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, errors.Wrap(err, "invalid media URL"))
+		return
+	}
+
+	resp, err := httpx.Do(s.backend.HttpClient(true), req, nil, s.backend.HttpAccess())
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, errors.Wrap(err, "error fetching media"))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		WriteError(w, http.StatusBadGateway, errors.Errorf("error fetching media, got status %d", resp.StatusCode))
+		return
+	}
+
+	for _, h := range []string{"Content-Type", "Content-Length", "Last-Modified"} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		slog.Error("error proxying media", "error", err, "url", mediaURL)
+	}
+}
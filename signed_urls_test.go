@@ -0,0 +1,252 @@
+package courier_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSigner(t *testing.T) {
+	defer courier.SetURLSigner(nil)
+
+	signer := courier.NewURLSigner("courier.example.com", "sesame")
+	expires := time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)
+
+	signed := signer.Sign("https://example.com/media/photo 1.jpg?size=large", expires)
+	assert.Equal(t, "https://courier.example.com/c/media/1792414800/5b79517c874bded62de73fa32edc8cb2d83b4221af84e73365d2a2fabe11ca17/photo%201.jpg?url=https%3A%2F%2Fexample.com%2Fmedia%2Fphoto+1.jpg%3Fsize%3Dlarge", signed)
+
+	// can only unsign proxied URLs if we have a signer
+	_, _, ok := courier.UnsignAttachmentURL(signed)
+	assert.False(t, ok)
+
+	courier.SetURLSigner(signer)
+
+	original, exp, ok := courier.UnsignAttachmentURL(signed)
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/media/photo 1.jpg?size=large", original)
+	assert.Equal(t, expires.Unix(), exp.Unix())
+
+	// proxied URLs from other signers aren't recognized
+	_, _, ok = courier.UnsignAttachmentURL(courier.NewURLSigner("other.example.com", "sesame").Sign("https://example.com/a.jpg", expires))
+	assert.False(t, ok)
+
+	// S3 presigned URLs are unsigned from their query params
+	original, exp, ok = courier.UnsignAttachmentURL("https://bucket.s3.amazonaws.com/attachments/a.jpg?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Date=20261019T120000Z&X-Amz-Expires=3600&X-Amz-Signature=abc")
+	assert.True(t, ok)
+	assert.Equal(t, "https://bucket.s3.amazonaws.com/attachments/a.jpg", original)
+	assert.Equal(t, expires, exp)
+
+	// other URLs aren't signed
+	_, _, ok = courier.UnsignAttachmentURL("https://example.com/a.jpg?X-Amz-Date=20261019T120000Z")
+	assert.False(t, ok)
+	_, _, ok = courier.UnsignAttachmentURL("https://example.com/a.jpg")
+	assert.False(t, ok)
+}
+
+func TestSignURLs(t *testing.T) {
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)))
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/send": {
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+		},
+	}))
+
+	var sentAttachments []string
+	courier.RegisterSendMiddleware("test_record_attachments", func(ctx context.Context, msg courier.MsgOut, content *courier.SendContent, clog *courier.ChannelLog) error {
+		sentAttachments = content.Attachments
+		return nil
+	})
+
+	config := testConfig()
+	config.Domain = "courier.example.com"
+	config.SignedURLSecret = "sesame"
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+
+	s.Start()
+	defer s.Stop()
+	defer courier.SetURLSigner(nil)
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{
+		courier.ConfigSendMiddleware:    []any{courier.SendMiddlewareSignURLs, "test_record_attachments"},
+		courier.ConfigSignedURLLifetime: 600,
+	})
+	mb.AddChannel(mockChannel)
+
+	signer := courier.NewURLSigner("courier.example.com", "sesame")
+	expires := time.Date(2026, 10, 19, 12, 10, 0, 0, time.UTC)
+
+	// attachments in backend storage are presigned, others are proxied, and geo locations are left alone
+	msg := test.NewMockMsg(courier.MsgID(101), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "Look", []string{
+		"image/jpeg:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.jpg",
+		"audio/mp3:https://example.com/song.mp3",
+		"geo:-1.9,30.1",
+	})
+	sendAndWait(mb, msg)
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+	assert.Equal(t, []string{
+		"image/jpeg:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.jpg?X-Amz-Date=20261019T120000Z&X-Amz-Expires=600&X-Amz-Signature=sesame",
+		"audio/mp3:" + signer.Sign("https://example.com/song.mp3", expires),
+		"geo:-1.9,30.1",
+	}, sentAttachments)
+	mb.Reset()
+
+	// if attachments can't be signed, the send fails rather than sending unsigned URLs or retrying forever
+	courier.SetURLSigner(nil)
+
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(102), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "Look", []string{"audio/mp3:https://example.com/song.mp3"}))
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusFailed, mb.WrittenMsgStatuses()[0].Status())
+	require.Len(t, mb.WrittenChannelLogs(), 1)
+	assert.Equal(t, []*courier.ChannelError{courier.NewChannelError("url_signing_failed", "", "Unable to sign attachment URLs.")}, mb.WrittenChannelLogs()[0].Errors())
+	mb.Reset()
+
+	// if attachments are private, their URLs are signed on all channels
+	courier.SetURLSigner(signer)
+	config.PrivateAttachments = true
+
+	otherChannel := test.NewMockChannel("8eb23e93-5ecb-45ba-b726-3b064e0c56ab", "MCK", "2021", "US", map[string]any{
+		courier.ConfigSendMiddleware: []any{"test_record_attachments"},
+	})
+	mb.AddChannel(otherChannel)
+
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(103), courier.NilMsgUUID, otherChannel, "tel:+250788383383", "Look", []string{"image/jpeg:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.jpg"}))
+
+	require.Len(t, mb.WrittenMsgStatuses(), 1)
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[0].Status())
+	assert.Equal(t, []string{
+		"image/jpeg:https://backend.com/attachments/cdf7ed27-5ad5-4028-b664-880fc7581c77.jpg?X-Amz-Date=20261019T120000Z&X-Amz-Expires=3600&X-Amz-Signature=sesame",
+	}, sentAttachments)
+}
+
+func TestFetchableAttachmentURL(t *testing.T) {
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)))
+
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	config := courier.NewDefaultConfig()
+
+	fetchable := func(attURL string) string {
+		u, err := courier.FetchableAttachmentURL(ctx, mb, config, attURL)
+		require.NoError(t, err)
+		return u
+	}
+
+	// public attachments are fetched as is
+	assert.Equal(t, "https://backend.com/attachments/a.jpg", fetchable("https://backend.com/attachments/a.jpg"))
+
+	// private attachments in storage are presigned
+	config.PrivateAttachments = true
+	assert.Equal(t, "https://backend.com/attachments/a.jpg?X-Amz-Date=20261019T120000Z&X-Amz-Expires=300&X-Amz-Signature=sesame", fetchable("https://backend.com/attachments/a.jpg"))
+
+	// unless they've already been signed
+	presigned := "https://backend.com/attachments/a.jpg?X-Amz-Date=20261019T120000Z&X-Amz-Expires=600&X-Amz-Signature=sesame"
+	assert.Equal(t, presigned, fetchable(presigned))
+
+	// private attachments in local storage are proxied by us
+	signer := courier.NewURLSigner(config.Domain, "sesame")
+	courier.SetURLSigner(signer)
+	defer courier.SetURLSigner(nil)
+
+	localURL := courier.LocalAttachmentsURL(config.Domain) + "media/1/test.jpg"
+	assert.Equal(t, signer.Sign(localURL, time.Date(2026, 10, 19, 12, 5, 0, 0, time.UTC)), fetchable(localURL))
+
+	// and anything else is fetched as is
+	assert.Equal(t, "https://example.com/a.jpg", fetchable("https://example.com/a.jpg"))
+}
+
+func TestSignedMedia(t *testing.T) {
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)))
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://example.com/song.mp3": {httpx.NewMockResponse(200, map[string]string{"Content-Type": "audio/mp3"}, []byte(`MP3`))},
+		"https://example.com/gone.mp3": {httpx.NewMockResponse(404, nil, []byte(`not found`))},
+	}))
+
+	testJPG := test.ReadFile("test/testdata/test.jpg")
+
+	config := testConfig()
+	config.SignedURLSecret = "sesame"
+	config.StorageDriver = courier.StorageDriverFS
+	config.StorageDir = t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(config.StorageDir, "attachments/media/1"), 0766))
+	require.NoError(t, os.WriteFile(filepath.Join(config.StorageDir, "attachments/media/1/test.jpg"), testJPG, 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(config.StorageDir, "secret.txt"), []byte(`secret`), 0666))
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+	s.Start()
+	defer s.Stop()
+	defer courier.SetURLSigner(nil)
+
+	// wait for server to come up
+	time.Sleep(100 * time.Millisecond)
+
+	signer := courier.NewURLSigner(config.Domain, "sesame")
+	expires := time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)
+
+	get := func(signedURL string) (*http.Response, []byte) {
+		resp, err := http.Get("http://localhost:8080" + signedURL[len("https://"+config.Domain):])
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	// external media is proxied
+	resp, body := get(signer.Sign("https://example.com/song.mp3", expires))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "audio/mp3", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []byte(`MP3`), body)
+
+	// media in local storage is served directly
+	resp, body = get(signer.Sign(courier.LocalAttachmentsURL(config.Domain)+"media/1/test.jpg", expires))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, testJPG, body)
+
+	// but directories, missing files and files outside of the attachments directory are all not found
+	resp, _ = get(signer.Sign(courier.LocalAttachmentsURL(config.Domain)+"media/1/", expires))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get(signer.Sign(courier.LocalAttachmentsURL(config.Domain)+"media/1/missing.jpg", expires))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get(signer.Sign(courier.LocalAttachmentsURL(config.Domain)+"../secret.txt", expires))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// media which can't be fetched is a bad gateway
+	resp, _ = get(signer.Sign("https://example.com/gone.mp3", expires))
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// expired URLs are forbidden
+	resp, _ = get(signer.Sign("https://example.com/song.mp3", time.Date(2026, 10, 19, 11, 59, 0, 0, time.UTC)))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// as are URLs with the wrong signature
+	resp, _ = get(courier.NewURLSigner(config.Domain, "wrong").Sign("https://example.com/song.mp3", expires))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
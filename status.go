@@ -1,6 +1,9 @@
 package courier
 
-import "github.com/nyaruka/gocommon/urns"
+import (
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/shopspring/decimal"
+)
 
 // MsgStatus is the status of a message
 type MsgStatus string
@@ -36,4 +39,10 @@ type StatusUpdate interface {
 
 	Status() MsgStatus
 	SetStatus(MsgStatus)
+
+	Segments() int
+	SetSegments(int)
+
+	Cost() (decimal.Decimal, string)
+	SetCost(decimal.Decimal, string)
 }
@@ -0,0 +1,41 @@
+package courier
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// LocalAttachmentsURL returns the base URL of attachments saved to local storage, which are served by courier itself
+// unless attachments are private, in which case they're only served through signed URLs
+func LocalAttachmentsURL(domain string) string {
+	return fmt.Sprintf("https://%s/c/storage/attachments/", domain)
+}
+
+// handleStoredAttachment serves an attachment file saved to local storage
+func (s *server) handleStoredAttachment(w http.ResponseWriter, r *http.Request) {
+	s.serveStoredAttachment(w, r, chi.URLParam(r, "*"))
+}
+
+// serves the attachment file at the given path in local storage
+func (s *server) serveStoredAttachment(w http.ResponseWriter, r *http.Request, path string) {
+	// http.Dir won't open anything outside of its directory
+	dir := http.Dir(filepath.Join(s.config.StorageDir, "attachments"))
+
+	f, err := dir.Open("/" + path)
+	if err != nil {
+		s.handle404(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		s.handle404(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,86 @@
+package courier_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoredAttachments(t *testing.T) {
+	testJPG := test.ReadFile("test/testdata/test.jpg")
+
+	config := testConfig()
+	config.StorageDriver = courier.StorageDriverFS
+	config.StorageDir = t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(config.StorageDir, "attachments/media/1"), 0766))
+	require.NoError(t, os.WriteFile(filepath.Join(config.StorageDir, "attachments/media/1/test.jpg"), testJPG, 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(config.StorageDir, "secret.txt"), []byte(`secret`), 0666))
+
+	assert.Equal(t, "https://localhost/c/storage/attachments/", courier.LocalAttachmentsURL(config.Domain))
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+	s.Start()
+	defer s.Stop()
+
+	// wait for server to come up
+	time.Sleep(100 * time.Millisecond)
+
+	get := func(path string) (*http.Response, []byte) {
+		resp, err := http.Get("http://localhost:8080/c/storage/attachments/" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, body := get("media/1/test.jpg")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, testJPG, body)
+
+	// directories, missing files and files outside of the attachments directory are all not found
+	resp, _ = get("media/1/")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get("media/1/missing.jpg")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get("..%2Fsecret.txt")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPrivateStoredAttachments(t *testing.T) {
+	config := testConfig()
+	config.StorageDriver = courier.StorageDriverFS
+	config.StorageDir = t.TempDir()
+	config.PrivateAttachments = true
+	config.SignedURLSecret = "sesame"
+
+	require.NoError(t, os.MkdirAll(filepath.Join(config.StorageDir, "attachments/media/1"), 0766))
+	require.NoError(t, os.WriteFile(filepath.Join(config.StorageDir, "attachments/media/1/test.jpg"), test.ReadFile("test/testdata/test.jpg"), 0666))
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+	s.Start()
+	defer s.Stop()
+	defer courier.SetURLSigner(nil)
+
+	// wait for server to come up
+	time.Sleep(100 * time.Millisecond)
+
+	// private attachments in local storage aren't publicly accessible, only via signed URLs
+	resp, err := http.Get("http://localhost:8080/c/storage/attachments/media/1/test.jpg")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -3,8 +3,14 @@ package test
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,6 +18,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/courier/utils"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/gocommon/uuids"
@@ -39,23 +46,26 @@ type MockBackend struct {
 	channelsByAddress map[courier.ChannelAddress]courier.Channel
 	contacts          map[urns.URN]courier.Contact
 	outgoingMsgs      []courier.MsgOut
+	reroutedMsgs      []courier.MsgOut
 	media             map[string]courier.Media // url -> Media
 	errorOnQueue      bool
 
 	mutex     sync.RWMutex
 	redisPool *redis.Pool
 
-	writtenMsgs          []courier.MsgIn
-	writtenMsgStatuses   []courier.StatusUpdate
-	writtenChannelEvents []courier.ChannelEvent
-	writtenChannelLogs   []*courier.ChannelLog
-	savedAttachments     []*SavedAttachment
-	storageError         error
+	writtenMsgs            []courier.MsgIn
+	writtenMsgStatuses     []courier.StatusUpdate
+	writtenChannelEvents   []courier.ChannelEvent
+	writtenChannelLogs     []*courier.ChannelLog
+	savedAttachments       []*SavedAttachment
+	quarantinedAttachments []*SavedAttachment
+	storageError           error
 
 	lastMsgID       courier.MsgID
 	lastContactName string
 	urnAuthTokens   map[urns.URN]map[string]string
 	sentMsgs        map[courier.MsgID]bool
+	completedMsgs   map[courier.MsgID]bool
 	seenExternalIDs map[string]courier.MsgUUID
 }
 
@@ -89,6 +99,7 @@ func NewMockBackend() *MockBackend {
 		contacts:          make(map[urns.URN]courier.Contact),
 		media:             make(map[string]courier.Media),
 		sentMsgs:          make(map[courier.MsgID]bool),
+		completedMsgs:     make(map[courier.MsgID]bool),
 		seenExternalIDs:   make(map[string]courier.MsgUUID),
 		redisPool:         redisPool,
 	}
@@ -170,12 +181,32 @@ func (mb *MockBackend) ClearMsgSent(ctx context.Context, id courier.MsgID) error
 	return nil
 }
 
+// RerouteOutgoingMsg queues a copy of the passed in msg to be sent on the given channel
+func (mb *MockBackend) RerouteOutgoingMsg(ctx context.Context, msg courier.MsgOut, channel courier.Channel, urn urns.URN, from *courier.MsgReroute) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	rerouted := *msg.(*MockMsg)
+	rerouted.channel = channel
+	rerouted.urn = urn
+	rerouted.urnAuth = ""
+	rerouted.reroutedFrom = from
+
+	mb.reroutedMsgs = append(mb.reroutedMsgs, &rerouted)
+	mb.outgoingMsgs = append(mb.outgoingMsgs, &rerouted)
+	return nil
+}
+
 // MarkOutgoingMsgComplete marks the passed msg as having been dealt with
 func (mb *MockBackend) MarkOutgoingMsgComplete(ctx context.Context, msg courier.MsgOut, s courier.StatusUpdate) {
 	mb.mutex.Lock()
 	defer mb.mutex.Unlock()
 
-	mb.sentMsgs[msg.ID()] = true
+	mb.completedMsgs[msg.ID()] = true
+
+	if s != nil && (s.Status() == courier.MsgStatusSent || s.Status() == courier.MsgStatusWired) {
+		mb.sentMsgs[msg.ID()] = true
+	}
 }
 
 // WriteChannelLog writes the passed in channel log to the DB
@@ -187,6 +218,63 @@ func (mb *MockBackend) WriteChannelLog(ctx context.Context, clog *courier.Channe
 	return nil
 }
 
+// GetChannelLog returns the written channel log of the given channel with the given UUID
+func (mb *MockBackend) GetChannelLog(ctx context.Context, ch courier.Channel, uuid courier.ChannelLogUUID) (*courier.StoredChannelLog, error) {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	for _, l := range mb.writtenChannelLogs {
+		if l.Channel().UUID() == ch.UUID() && l.UUID() == uuid {
+			return storedChannelLog(l), nil
+		}
+	}
+	return nil, nil
+}
+
+// QueryChannelLogs returns the most recently written channel logs of the given channel which match the given query
+func (mb *MockBackend) QueryChannelLogs(ctx context.Context, ch courier.Channel, q *courier.ChannelLogQuery) ([]*courier.StoredChannelLog, []courier.ChannelLogUUID, error) {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	logs := make([]*courier.StoredChannelLog, 0, q.Limit)
+
+	for i := len(mb.writtenChannelLogs) - 1; i >= 0 && len(logs) < q.Limit; i-- {
+		l := mb.writtenChannelLogs[i]
+
+		if l.Channel().UUID() != ch.UUID() || l.CreatedOn().Before(q.Since) || !l.CreatedOn().Before(q.Until) {
+			continue
+		}
+		if q.Type != "" && l.Type() != q.Type {
+			continue
+		}
+		if q.ErrorCode != "" && !slices.ContainsFunc(l.Errors(), func(e *courier.ChannelError) bool { return e.Code() == q.ErrorCode }) {
+			continue
+		}
+		logs = append(logs, storedChannelLog(l))
+	}
+	return logs, []courier.ChannelLogUUID{}, nil
+}
+
+// converts a written channel log to how it would be read back, copying the HTTP logs so they can be redacted
+func storedChannelLog(l *courier.ChannelLog) *courier.StoredChannelLog {
+	stored := &courier.StoredChannelLog{
+		UUID:      l.UUID(),
+		Type:      l.Type(),
+		HTTPLogs:  make([]*httpx.Log, len(l.HTTPLogs())),
+		Errors:    make([]courier.StoredChannelError, len(l.Errors())),
+		ElapsedMS: int(l.Elapsed() / time.Millisecond),
+		CreatedOn: l.CreatedOn(),
+	}
+	for i, h := range l.HTTPLogs() {
+		withoutTime := *h.LogWithoutTime
+		stored.HTTPLogs[i] = &httpx.Log{LogWithoutTime: &withoutTime, CreatedOn: h.CreatedOn}
+	}
+	for i, e := range l.Errors() {
+		stored.Errors[i] = courier.StoredChannelError{Code: e.Code(), ExtCode: e.ExtCode(), Message: e.Message()}
+	}
+	return stored
+}
+
 // SetErrorOnQueue is a mock method which makes the QueueMsg call throw the passed in error on next call
 func (mb *MockBackend) SetErrorOnQueue(shouldError bool) {
 	mb.errorOnQueue = shouldError
@@ -344,6 +432,45 @@ func (mb *MockBackend) SaveAttachment(ctx context.Context, ch courier.Channel, c
 	return fmt.Sprintf("https://backend.com/attachments/%s.%s", uuids.New(), extension), nil
 }
 
+// SaveAttachmentStream saves an attachment to backend storage as it's read from the given reader
+func (mb *MockBackend) SaveAttachmentStream(ctx context.Context, ch courier.Channel, contentType string, body io.Reader, extension string) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	return mb.SaveAttachment(ctx, ch, contentType, data, extension)
+}
+
+// PresignAttachmentURL presigns URLs of saved attachments in the same way as S3
+func (mb *MockBackend) PresignAttachmentURL(ctx context.Context, attURL string, expires time.Time) (string, error) {
+	if !strings.HasPrefix(attURL, "https://backend.com/attachments/") {
+		return "", nil
+	}
+
+	now := dates.Now().UTC()
+	query := url.Values{
+		"X-Amz-Date":      []string{now.Format("20060102T150405Z")},
+		"X-Amz-Expires":   []string{strconv.Itoa(int(expires.Sub(now) / time.Second))},
+		"X-Amz-Signature": []string{"sesame"},
+	}
+	return attURL + "?" + query.Encode(), nil
+}
+
+// QuarantineAttachment saves an infected attachment to private backend storage
+func (mb *MockBackend) QuarantineAttachment(ctx context.Context, ch courier.Channel, contentType string, body io.Reader, extension string) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	mb.quarantinedAttachments = append(mb.quarantinedAttachments, &SavedAttachment{
+		Channel: ch, ContentType: contentType, Data: data, Extension: extension,
+	})
+
+	return fmt.Sprintf("quarantine/%s.%s", uuids.New(), extension), nil
+}
+
 // ResolveMedia resolves the passed in media URL to a media object
 func (mb *MockBackend) ResolveMedia(ctx context.Context, mediaUrl string) (courier.Media, error) {
 	media := mb.media[mediaUrl]
@@ -354,6 +481,22 @@ func (mb *MockBackend) ResolveMedia(ctx context.Context, mediaUrl string) (couri
 	return media, nil
 }
 
+// SaveMediaAlternate saves the passed in transcoded media as an alternate of the given media
+func (mb *MockBackend) SaveMediaAlternate(ctx context.Context, ch courier.Channel, media courier.Media, t *courier.Transcoded) (courier.Media, error) {
+	url, err := mb.SaveAttachment(ctx, ch, t.ContentType, t.Data, t.Extension)
+	if err != nil {
+		return nil, err
+	}
+
+	alternate := NewMockMedia(path.Base(url), t.ContentType, url, len(t.Data), t.Width, t.Height, t.Duration, nil)
+
+	if m, ok := media.(*mockMedia); ok {
+		m.alternates = append(m.alternates, alternate)
+	}
+
+	return alternate, nil
+}
+
 func (mb *MockBackend) Health() string {
 	return ""
 }
@@ -388,11 +531,21 @@ func (mb *MockBackend) RedisPool() *redis.Pool {
 
 func (mb *MockBackend) WrittenMsgs() []courier.MsgIn                  { return mb.writtenMsgs }
 func (mb *MockBackend) WrittenMsgStatuses() []courier.StatusUpdate    { return mb.writtenMsgStatuses }
+func (mb *MockBackend) ReroutedMsgs() []courier.MsgOut                { return mb.reroutedMsgs }
 func (mb *MockBackend) WrittenChannelEvents() []courier.ChannelEvent  { return mb.writtenChannelEvents }
 func (mb *MockBackend) WrittenChannelLogs() []*courier.ChannelLog     { return mb.writtenChannelLogs }
 func (mb *MockBackend) SavedAttachments() []*SavedAttachment          { return mb.savedAttachments }
+func (mb *MockBackend) QuarantinedAttachments() []*SavedAttachment    { return mb.quarantinedAttachments }
 func (mb *MockBackend) URNAuthTokens() map[urns.URN]map[string]string { return mb.urnAuthTokens }
 
+// WasMsgCompleted returns whether the passed in msg has been marked as complete, regardless of whether it was sent
+func (mb *MockBackend) WasMsgCompleted(id courier.MsgID) bool {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	return mb.completedMsgs[id]
+}
+
 // LastContactName returns the contact name set on the last msg or channel event written
 func (mb *MockBackend) LastContactName() string {
 	return mb.lastContactName
@@ -421,10 +574,13 @@ func (mb *MockBackend) Reset() {
 	mb.seenExternalIDs = make(map[string]courier.MsgUUID)
 
 	mb.writtenMsgs = nil
+	mb.reroutedMsgs = nil
 	mb.writtenMsgStatuses = nil
 	mb.writtenChannelEvents = nil
 	mb.writtenChannelLogs = nil
 	mb.urnAuthTokens = nil
+	mb.savedAttachments = nil
+	mb.quarantinedAttachments = nil
 }
 
 // SetStorageError sets the error to return for operation that try to use storage
@@ -119,6 +119,11 @@ func (c *MockChannel) IntConfigForKey(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// SetOrgConfig sets the passed in org config parameter
+func (c *MockChannel) SetOrgConfig(key string, value any) {
+	c.orgConfig[key] = value
+}
+
 // OrgConfigForKey returns the org config value for the passed in key
 func (c *MockChannel) OrgConfigForKey(key string, defaultValue any) any {
 	value, found := c.orgConfig[key]
@@ -8,6 +8,7 @@ import (
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 )
 
 func init() {
@@ -31,6 +32,11 @@ func (h *mockHandler) UseChannelRouteUUID() bool             { return true }
 func (h *mockHandler) RedactValues(courier.Channel) []string { return []string{"sesame"} }
 
 func (h *mockHandler) GetChannel(ctx context.Context, r *http.Request) (courier.Channel, error) {
+	// use the backend's channel if one has been added so that tests can configure it
+	if ch, err := h.backend.GetChannel(ctx, h.ChannelType(), "e4bb1578-29da-4fa5-a214-9da19dd24230"); err == nil {
+		return ch, nil
+	}
+
 	dmChannel := NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
 	return dmChannel, nil
 }
@@ -40,6 +46,7 @@ func (h *mockHandler) Initialize(s courier.Server) error {
 	h.server = s
 	h.backend = s.Backend()
 	s.AddHandlerRoute(h, http.MethodGet, "receive", courier.ChannelLogTypeMsgReceive, h.receiveMsg)
+	s.AddHandlerRoute(h, http.MethodGet, "status", courier.ChannelLogTypeMsgStatus, h.receiveStatus)
 	return nil
 }
 
@@ -47,7 +54,13 @@ func (h *mockHandler) Initialize(s courier.Server) error {
 func (h *mockHandler) Send(ctx context.Context, msg courier.MsgOut, res *courier.SendResult, clog *courier.ChannelLog) error {
 	// log a request that contains a header value that should be redacted
 	req, _ := httpx.NewRequest("GET", "http://mock.com/send", nil, map[string]string{"Authorization": "Token sesame"})
-	trace, err := httpx.DoTrace(http.DefaultClient, req, nil, nil, 1024)
+	var trace *httpx.Trace
+	var err error
+	if courier.IsSandboxed(msg.Channel()) {
+		trace, err = courier.SandboxTrace(msg.Channel(), req)
+	} else {
+		trace, err = httpx.DoTrace(http.DefaultClient, req, nil, nil, 1024)
+	}
 	clog.HTTP(trace)
 
 	if err != nil || trace.Response.StatusCode/100 == 5 {
@@ -56,6 +69,10 @@ func (h *mockHandler) Send(ctx context.Context, msg courier.MsgOut, res *courier
 		return courier.ErrContactStopped
 	} else if trace.Response.StatusCode == 429 {
 		return courier.ErrConnectionThrottled
+	} else if trace.Response.StatusCode == 400 {
+		// mock rejections have the service's error code as their body
+		clog.Error(courier.ErrorExternal(string(trace.ResponseBody), ""))
+		return courier.ErrResponseStatus
 	}
 
 	// log an error than contains a value that should be redacted
@@ -63,6 +80,16 @@ func (h *mockHandler) Send(ctx context.Context, msg courier.MsgOut, res *courier
 
 	if msg.Text() == "err:config" {
 		return courier.ErrChannelConfig
+	} else if msg.Text() == "err:unparseable" {
+		return courier.ErrResponseUnparseable
+	}
+
+	// mock responses can include the external ID of the sent message and what it cost
+	if externalID := trace.Response.Header.Get("External-ID"); externalID != "" {
+		res.AddExternalID(externalID)
+	}
+	if price, err := decimal.NewFromString(trace.Response.Header.Get("Price")); err == nil {
+		res.AddCost(price, "USD")
 	}
 
 	return nil
@@ -84,6 +111,14 @@ func (h *mockHandler) WriteRequestIgnored(ctx context.Context, w http.ResponseWr
 	return courier.WriteIgnored(w, details)
 }
 
+// ResolveAttachment resolves media IDs to URLs on mock.com, with an ID of "missing" being unresolvable
+func (h *mockHandler) ResolveAttachment(ctx context.Context, channel courier.Channel, ref string, clog *courier.ChannelLog) (string, error) {
+	if ref == "missing" {
+		return "", errors.New("no such media")
+	}
+	return "http://mock.com/media/" + ref, nil
+}
+
 // ReceiveMsg sends the passed in message, returning any error
 func (h *mockHandler) receiveMsg(ctx context.Context, channel courier.Channel, w http.ResponseWriter, r *http.Request, clog *courier.ChannelLog) ([]courier.Event, error) {
 	r.ParseForm()
@@ -99,3 +134,22 @@ func (h *mockHandler) receiveMsg(ctx context.Context, channel courier.Channel, w
 	h.backend.WriteMsg(ctx, msg, clog)
 	return []courier.Event{msg}, nil
 }
+
+// receiveStatus receives a delivery report for a message by its external ID, which can include what it cost
+func (h *mockHandler) receiveStatus(ctx context.Context, channel courier.Channel, w http.ResponseWriter, r *http.Request, clog *courier.ChannelLog) ([]courier.Event, error) {
+	r.ParseForm()
+	externalID := r.Form.Get("id")
+	if externalID == "" {
+		return nil, errors.New("missing id")
+	}
+
+	status := h.backend.NewStatusUpdateByExternalID(channel, externalID, courier.MsgStatusDelivered, clog)
+	if price, err := decimal.NewFromString(r.Form.Get("price")); err == nil {
+		status.SetCost(price, "USD")
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("ok"))
+	h.backend.WriteStatusUpdate(ctx, status)
+	return []courier.Event{status}, nil
+}
@@ -27,16 +27,21 @@ type MockMsg struct {
 	contactLastSeenOn    *time.Time
 	topic                string
 	responseToExternalID string
+	replyToExternalID    string
+	location             *courier.MsgLocation
 	metadata             json.RawMessage
 	alreadyWritten       bool
 	isResend             bool
 
-	flow   *courier.FlowReference
-	optIn  *courier.OptInReference
-	userID courier.UserID
+	flow     *courier.FlowReference
+	optIn    *courier.OptInReference
+	reaction *courier.MsgReaction
+	action   courier.ConversationAction
+	userID   courier.UserID
 
-	receivedOn *time.Time
-	sentOn     *time.Time
+	receivedOn   *time.Time
+	sentOn       *time.Time
+	reroutedFrom *courier.MsgReroute
 }
 
 func NewMockMsg(id courier.MsgID, uuid courier.MsgUUID, channel courier.Channel, urn urns.URN, text string, attachments []string) *MockMsg {
@@ -60,24 +65,29 @@ func (m *MockMsg) URN() urns.URN            { return m.urn }
 func (m *MockMsg) Channel() courier.Channel { return m.channel }
 
 // outgoing specific
-func (m *MockMsg) QuickReplies() []string         { return m.quickReplies }
-func (m *MockMsg) Locale() i18n.Locale            { return m.locale }
-func (m *MockMsg) URNAuth() string                { return m.urnAuth }
-func (m *MockMsg) Origin() courier.MsgOrigin      { return m.origin }
-func (m *MockMsg) ContactLastSeenOn() *time.Time  { return m.contactLastSeenOn }
-func (m *MockMsg) Topic() string                  { return m.topic }
-func (m *MockMsg) Metadata() json.RawMessage      { return m.metadata }
-func (m *MockMsg) ResponseToExternalID() string   { return m.responseToExternalID }
-func (m *MockMsg) SentOn() *time.Time             { return m.sentOn }
-func (m *MockMsg) IsResend() bool                 { return m.isResend }
-func (m *MockMsg) Flow() *courier.FlowReference   { return m.flow }
-func (m *MockMsg) OptIn() *courier.OptInReference { return m.optIn }
-func (m *MockMsg) UserID() courier.UserID         { return m.userID }
-func (m *MockMsg) SessionStatus() string          { return "" }
-func (m *MockMsg) HighPriority() bool             { return m.highPriority }
+func (m *MockMsg) QuickReplies() []string                         { return m.quickReplies }
+func (m *MockMsg) Locale() i18n.Locale                            { return m.locale }
+func (m *MockMsg) URNAuth() string                                { return m.urnAuth }
+func (m *MockMsg) Origin() courier.MsgOrigin                      { return m.origin }
+func (m *MockMsg) ContactLastSeenOn() *time.Time                  { return m.contactLastSeenOn }
+func (m *MockMsg) Topic() string                                  { return m.topic }
+func (m *MockMsg) Metadata() json.RawMessage                      { return m.metadata }
+func (m *MockMsg) ResponseToExternalID() string                   { return m.responseToExternalID }
+func (m *MockMsg) SentOn() *time.Time                             { return m.sentOn }
+func (m *MockMsg) IsResend() bool                                 { return m.isResend }
+func (m *MockMsg) Flow() *courier.FlowReference                   { return m.flow }
+func (m *MockMsg) OptIn() *courier.OptInReference                 { return m.optIn }
+func (m *MockMsg) Reaction() *courier.MsgReaction                 { return m.reaction }
+func (m *MockMsg) ConversationAction() courier.ConversationAction { return m.action }
+func (m *MockMsg) UserID() courier.UserID                         { return m.userID }
+func (m *MockMsg) SessionStatus() string                          { return "" }
+func (m *MockMsg) HighPriority() bool                             { return m.highPriority }
+func (m *MockMsg) ReroutedFrom() *courier.MsgReroute              { return m.reroutedFrom }
 
 // incoming specific
-func (m *MockMsg) ReceivedOn() *time.Time { return m.receivedOn }
+func (m *MockMsg) ReceivedOn() *time.Time         { return m.receivedOn }
+func (m *MockMsg) ReplyToExternalID() string      { return m.replyToExternalID }
+func (m *MockMsg) Location() *courier.MsgLocation { return m.location }
 func (m *MockMsg) WithAttachment(url string) courier.MsgIn {
 	m.attachments = append(m.attachments, url)
 	return m
@@ -88,6 +98,12 @@ func (m *MockMsg) WithURNAuthTokens(tokens map[string]string) courier.MsgIn {
 	return m
 }
 func (m *MockMsg) WithReceivedOn(date time.Time) courier.MsgIn { m.receivedOn = &date; return m }
+func (m *MockMsg) WithReplyTo(externalID string) courier.MsgIn {
+	m.replyToExternalID = externalID
+	return m
+}
+func (m *MockMsg) WithLocation(loc *courier.MsgLocation) courier.MsgIn { m.location = loc; return m }
+func (m *MockMsg) WithChannel(channel courier.Channel) courier.MsgIn   { m.channel = channel; return m }
 
 // used to create outgoing messages for testing
 func (m *MockMsg) WithID(id courier.MsgID) courier.MsgOut       { m.id = id; return m }
@@ -98,6 +114,11 @@ func (m *MockMsg) WithMetadata(metadata json.RawMessage) courier.MsgOut {
 }
 func (m *MockMsg) WithFlow(f *courier.FlowReference) courier.MsgOut   { m.flow = f; return m }
 func (m *MockMsg) WithOptIn(o *courier.OptInReference) courier.MsgOut { m.optIn = o; return m }
-func (m *MockMsg) WithUserID(uid courier.UserID) courier.MsgOut       { m.userID = uid; return m }
-func (m *MockMsg) WithLocale(lc i18n.Locale) courier.MsgOut           { m.locale = lc; return m }
-func (m *MockMsg) WithURNAuth(token string) courier.MsgOut            { m.urnAuth = token; return m }
+func (m *MockMsg) WithReaction(r *courier.MsgReaction) courier.MsgOut { m.reaction = r; return m }
+func (m *MockMsg) WithConversationAction(a courier.ConversationAction) courier.MsgOut {
+	m.action = a
+	return m
+}
+func (m *MockMsg) WithUserID(uid courier.UserID) courier.MsgOut { m.userID = uid; return m }
+func (m *MockMsg) WithLocale(lc i18n.Locale) courier.MsgOut     { m.locale = lc; return m }
+func (m *MockMsg) WithURNAuth(token string) courier.MsgOut      { m.urnAuth = token; return m }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/nyaruka/courier"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/shopspring/decimal"
 )
 
 type MockStatusUpdate struct {
@@ -14,6 +15,9 @@ type MockStatusUpdate struct {
 	newURN     urns.URN
 	externalID string
 	status     courier.MsgStatus
+	segments   int
+	cost       decimal.Decimal
+	currency   string
 	createdOn  time.Time
 }
 
@@ -35,3 +39,12 @@ func (m *MockStatusUpdate) SetExternalID(id string) { m.externalID = id }
 
 func (m *MockStatusUpdate) Status() courier.MsgStatus          { return m.status }
 func (m *MockStatusUpdate) SetStatus(status courier.MsgStatus) { m.status = status }
+
+func (m *MockStatusUpdate) Segments() int     { return m.segments }
+func (m *MockStatusUpdate) SetSegments(n int) { m.segments = n }
+
+func (m *MockStatusUpdate) Cost() (decimal.Decimal, string) { return m.cost, m.currency }
+func (m *MockStatusUpdate) SetCost(amount decimal.Decimal, currency string) {
+	m.cost = amount
+	m.currency = currency
+}
@@ -0,0 +1,188 @@
+package courier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// ThumbnailMaxDimension is the maximum width and height of generated thumbnails
+const ThumbnailMaxDimension = 320
+
+const thumbnailQuality = 75
+
+// generated thumbnails are saved with this extension so that they can be told apart from other image alternates
+const thumbnailExtension = "thumb.jpg"
+
+// only one thumbnail is generated at a time for the same media, and failures are remembered for a while so that every
+// send of the same media doesn't refetch and retry it
+const (
+	thumbnailLockKey   = "thumbnail_lock:%s"
+	thumbnailLockTTL   = 5 * time.Minute
+	thumbnailFailedKey = "thumbnail_failed:%s"
+	thumbnailFailedTTL = time.Hour
+)
+
+// Thumbnailer generates a thumbnail image from media content of the given content type
+type Thumbnailer func(ctx context.Context, data []byte, contentType string) (*Transcoded, error)
+
+// Thumbnailer returns the thumbnailer for the given media type, e.g. video, or nil if thumbnails aren't generated for
+// media of that type
+func (c *Config) Thumbnailer(mediaType string) Thumbnailer {
+	if !c.ThumbnailMedia {
+		return nil
+	}
+
+	switch mediaType {
+	case "image":
+		return ThumbnailImage
+	case "video":
+		if c.FFmpegPath != "" {
+			return NewFFmpegThumbnailer(c.FFmpegPath)
+		}
+	}
+	return nil
+}
+
+// GenerateThumbnail tries to generate a thumbnail for the given media, saving it as a new alternate of that media. If
+// the config has no thumbnailer for the media type, or a thumbnail for the same media is already being generated, nil
+// is returned. Images which are already small enough are returned as their own thumbnails.
+func GenerateThumbnail(ctx context.Context, b Backend, cfg *Config, channel Channel, media Media) (Media, error) {
+	mediaType, _, _ := strings.Cut(media.ContentType(), "/")
+	thumbnailer := cfg.Thumbnailer(mediaType)
+	if thumbnailer == nil || channel == nil {
+		return nil, nil
+	}
+
+	if mediaType == "image" && media.Width() > 0 && media.Width() <= ThumbnailMaxDimension && media.Height() > 0 && media.Height() <= ThumbnailMaxDimension {
+		return media, nil
+	}
+
+	mediaHash := sha256Hex(media.URL())
+	failedKey := fmt.Sprintf(thumbnailFailedKey, mediaHash)
+	if hasMediaFailure(b.RedisPool(), failedKey) {
+		return nil, errors.Errorf("previous thumbnail of %s media failed", media.ContentType())
+	}
+
+	// the lock isn't released on success so that it covers callers who resolved the media before the thumbnail was saved
+	if !lockThumbnail(b.RedisPool(), fmt.Sprintf(thumbnailLockKey, mediaHash)) {
+		return nil, nil
+	}
+
+	thumbnail, err := generateThumbnail(ctx, b, cfg, channel, media, thumbnailer)
+
+	// don't remember failures which are just us running out of time
+	if err != nil && ctx.Err() == nil {
+		setMediaFailure(b.RedisPool(), failedKey, thumbnailFailedTTL)
+	}
+
+	return thumbnail, err
+}
+
+func generateThumbnail(ctx context.Context, b Backend, cfg *Config, channel Channel, media Media, thumbnailer Thumbnailer) (Media, error) {
+	data, err := fetchMedia(ctx, b, cfg, media)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail, err := thumbnailer(ctx, data, media.ContentType())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating thumbnail for %s media", media.ContentType())
+	}
+	thumbnail.Extension = thumbnailExtension
+
+	alternate, err := b.SaveMediaAlternate(ctx, channel, media, thumbnail)
+	return alternate, errors.Wrap(err, "error saving thumbnail")
+}
+
+// tries to take the lock on generating a thumbnail with the given key, returning whether it was taken
+func lockThumbnail(rp *redis.Pool, key string) bool {
+	rc := rp.Get()
+	defer rc.Close()
+
+	locked, err := redis.String(rc.Do("SET", key, "1", "NX", "EX", int(thumbnailLockTTL/time.Second)))
+	if err != nil && err != redis.ErrNil {
+		slog.Error("error locking thumbnail", "error", err, "key", key)
+	}
+	return locked == "OK"
+}
+
+// IsThumbnail returns whether the given alternate of the given media is a thumbnail, i.e. an image alternate of a
+// video, or an image alternate of an image which was saved as a thumbnail
+func IsThumbnail(media, alternate Media) bool {
+	mediaType, _, _ := strings.Cut(media.ContentType(), "/")
+	altType, _, _ := strings.Cut(alternate.ContentType(), "/")
+	if altType != "image" {
+		return false
+	}
+	if mediaType != "image" {
+		return true
+	}
+
+	return strings.HasSuffix(alternate.Name(), "."+thumbnailExtension)
+}
+
+// ThumbnailImage is a thumbnailer for images which scales them to fit within the thumbnail dimensions
+func ThumbnailImage(ctx context.Context, data []byte, contentType string) (*Transcoded, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding image")
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width > ThumbnailMaxDimension || height > ThumbnailMaxDimension {
+		if width >= height {
+			width, height = ThumbnailMaxDimension, max(1, height*ThumbnailMaxDimension/width)
+		} else {
+			width, height = max(1, width*ThumbnailMaxDimension/height), ThumbnailMaxDimension
+		}
+		img = scaleImage(img, width, height)
+	}
+
+	out := &bytes.Buffer{}
+	if err := jpeg.Encode(out, flattenImage(img), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, errors.Wrap(err, "error encoding thumbnail")
+	}
+
+	return &Transcoded{ContentType: "image/jpeg", Extension: "jpg", Data: out.Bytes(), Width: width, Height: height}, nil
+}
+
+// NewFFmpegThumbnailer returns a thumbnailer for video which uses the ffmpeg binary at the given path to extract a
+// representative frame
+func NewFFmpegThumbnailer(path string) Thumbnailer {
+	return func(ctx context.Context, data []byte, contentType string) (*Transcoded, error) {
+		dir, err := os.MkdirTemp("", "courier-thumbnail")
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating temp directory")
+		}
+		defer os.RemoveAll(dir)
+
+		inPath, outPath := filepath.Join(dir, "in"), filepath.Join(dir, "out.png")
+		if err := os.WriteFile(inPath, data, 0600); err != nil {
+			return nil, errors.Wrap(err, "error writing input file")
+		}
+
+		args := []string{"-y", "-loglevel", "error", "-i", inPath, "-vf", "thumbnail", "-frames:v", "1", outPath}
+		if out, err := exec.CommandContext(ctx, path, args...).CombinedOutput(); err != nil {
+			return nil, errors.Wrapf(err, "error running ffmpeg: %s", strings.TrimSpace(string(out)))
+		}
+
+		frame, err := os.ReadFile(outPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading output file")
+		}
+
+		return ThumbnailImage(ctx, frame, "image/png")
+	}
+}
@@ -0,0 +1,138 @@
+package courier_test
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThumbnailImage(t *testing.T) {
+	ctx := context.Background()
+
+	// large image is scaled down to fit
+	out, err := courier.ThumbnailImage(ctx, noisyPNG(t, 600, 400), "image/png")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", out.ContentType)
+	assert.Equal(t, "jpg", out.Extension)
+	assert.Equal(t, 320, out.Width)
+	assert.Equal(t, 213, out.Height)
+
+	img, err := jpeg.Decode(bytes.NewReader(out.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, 320, img.Bounds().Dx())
+	assert.Equal(t, 213, img.Bounds().Dy())
+
+	// as is a tall image
+	out, err = courier.ThumbnailImage(ctx, noisyPNG(t, 100, 640), "image/png")
+	assert.NoError(t, err)
+	assert.Equal(t, 50, out.Width)
+	assert.Equal(t, 320, out.Height)
+
+	// small image keeps its dimensions
+	out, err = courier.ThumbnailImage(ctx, noisyPNG(t, 120, 80), "image/png")
+	assert.NoError(t, err)
+	assert.Equal(t, 120, out.Width)
+	assert.Equal(t, 80, out.Height)
+
+	// not an image
+	_, err = courier.ThumbnailImage(ctx, []byte(`hello`), "image/png")
+	assert.EqualError(t, err, "error decoding image: image: unknown format")
+}
+
+func TestIsThumbnail(t *testing.T) {
+	bigImage := test.NewMockMedia("big.png", "image/png", "http://mock.com/1234/big.png", 1024*1024, 1200, 800, 0, nil)
+	video := test.NewMockMedia("clip.mp4", "video/mp4", "http://mock.com/2345/clip.mp4", 1024*1024, 640, 480, 10, nil)
+	thumbJPEG := test.NewMockMedia("c0dd06c4.thumb.jpg", "image/jpeg", "http://mock.com/3456/c0dd06c4.thumb.jpg", 1024, 320, 213, 0, nil)
+	smallJPEG := test.NewMockMedia("small.jpg", "image/jpeg", "http://mock.com/3456/small.jpg", 1024, 320, 213, 0, nil)
+	noDims := test.NewMockMedia("nodims.jpg", "image/jpeg", "http://mock.com/5678/nodims.jpg", 1024, 0, 0, 0, nil)
+	noDimsImage := test.NewMockMedia("nodims.png", "image/png", "http://mock.com/6789/nodims.png", 1024*1024, 0, 0, 0, nil)
+
+	assert.True(t, courier.IsThumbnail(bigImage, thumbJPEG))
+	assert.True(t, courier.IsThumbnail(noDimsImage, thumbJPEG)) // original size unknown
+	assert.False(t, courier.IsThumbnail(bigImage, smallJPEG))   // small but not saved as a thumbnail so a transcoding
+	assert.False(t, courier.IsThumbnail(noDimsImage, noDims))
+	assert.False(t, courier.IsThumbnail(bigImage, video))
+	assert.True(t, courier.IsThumbnail(video, thumbJPEG))
+	assert.True(t, courier.IsThumbnail(video, smallJPEG))
+	assert.True(t, courier.IsThumbnail(video, noDims))
+}
+
+func TestConfigThumbnailer(t *testing.T) {
+	cfg := courier.NewDefaultConfig()
+	assert.Nil(t, cfg.Thumbnailer("image"))
+
+	cfg.ThumbnailMedia = true
+	assert.NotNil(t, cfg.Thumbnailer("image"))
+	assert.NotNil(t, cfg.Thumbnailer("video"))
+	assert.Nil(t, cfg.Thumbnailer("audio"))
+
+	// videos need ffmpeg
+	cfg.FFmpegPath = ""
+	assert.NotNil(t, cfg.Thumbnailer("image"))
+	assert.Nil(t, cfg.Thumbnailer("video"))
+}
+
+func TestGenerateThumbnail(t *testing.T) {
+	ctx := context.Background()
+	mb := test.NewMockBackend()
+	channel := test.NewMockChannel("7a8ff1d4-f211-4492-9d05-e1905f6da8c8", "NX", "1234", "EC", map[string]any{})
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/1234/big.png":  {httpx.NewMockResponse(200, nil, noisyPNG(t, 600, 400))},
+		"http://mock.com/2345/gone.png": {httpx.NewMockResponse(404, nil, []byte(`not found`))},
+	}))
+
+	bigPNG := test.NewMockMedia("big.png", "image/png", "http://mock.com/1234/big.png", 1024*1024, 600, 400, 0, nil)
+	smallPNG := test.NewMockMedia("small.png", "image/png", "http://mock.com/3456/small.png", 1024, 120, 80, 0, nil)
+	gonePNG := test.NewMockMedia("gone.png", "image/png", "http://mock.com/2345/gone.png", 1024*1024, 600, 400, 0, nil)
+
+	// thumbnails not enabled
+	cfg := courier.NewDefaultConfig()
+	thumbnail, err := courier.GenerateThumbnail(ctx, mb, cfg, channel, bigPNG)
+	assert.NoError(t, err)
+	assert.Nil(t, thumbnail)
+
+	cfg.ThumbnailMedia = true
+
+	thumbnail, err = courier.GenerateThumbnail(ctx, mb, cfg, channel, bigPNG)
+	assert.NoError(t, err)
+	require.NotNil(t, thumbnail)
+	assert.Equal(t, "image/jpeg", thumbnail.ContentType())
+	assert.Equal(t, 320, thumbnail.Width())
+	assert.Equal(t, 213, thumbnail.Height())
+
+	// thumbnail saved as an alternate of the original which is identifiable as a thumbnail
+	require.Len(t, mb.SavedAttachments(), 1)
+	assert.Equal(t, "thumb.jpg", mb.SavedAttachments()[0].Extension)
+	require.Len(t, bigPNG.Alternates(), 1)
+	assert.Equal(t, thumbnail.URL(), bigPNG.Alternates()[0].URL())
+	assert.True(t, courier.IsThumbnail(bigPNG, thumbnail))
+
+	// another attempt for the same media while we still hold the lock doesn't generate another
+	thumbnail, err = courier.GenerateThumbnail(ctx, mb, cfg, channel, bigPNG)
+	assert.NoError(t, err)
+	assert.Nil(t, thumbnail)
+	assert.Len(t, mb.SavedAttachments(), 1)
+
+	// small images are their own thumbnails
+	thumbnail, err = courier.GenerateThumbnail(ctx, mb, cfg, channel, smallPNG)
+	assert.NoError(t, err)
+	assert.Equal(t, smallPNG, thumbnail)
+	assert.Len(t, mb.SavedAttachments(), 1)
+
+	// media can't be fetched
+	_, err = courier.GenerateThumbnail(ctx, mb, cfg, channel, gonePNG)
+	assert.EqualError(t, err, "error fetching media, got status 404")
+
+	// and that failure is remembered so the media isn't fetched again
+	_, err = courier.GenerateThumbnail(ctx, mb, cfg, channel, gonePNG)
+	assert.EqualError(t, err, "previous thumbnail of image/png media failed")
+}
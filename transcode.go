@@ -0,0 +1,340 @@
+package courier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register GIF decoding
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/pkg/errors"
+)
+
+// the most we'll read of media being transcoded
+const maxTranscodeBytes = 100 * 1024 * 1024
+
+// failed transcodes are remembered for a while so that every send of the same media doesn't refetch and retry it
+const transcodeFailedKey = "transcode_failed:%s"
+const transcodeFailedTTL = time.Hour
+
+// TranscodeTarget is what media needs to be transcoded to, i.e. one of the given content types (any if empty) and no
+// larger than the given number of bytes (any size if zero)
+type TranscodeTarget struct {
+	ContentTypes []string
+	MaxBytes     int
+}
+
+// Transcoded is the output of a transcoder
+type Transcoded struct {
+	ContentType string
+	Extension   string
+	Data        []byte
+	Width       int
+	Height      int
+	Duration    int
+}
+
+// Transcoder converts media content of the given content type to satisfy the given target
+type Transcoder func(ctx context.Context, data []byte, contentType string, target *TranscodeTarget) (*Transcoded, error)
+
+// Transcoder returns the transcoder for the given media type, e.g. image, or nil if media of that type isn't transcoded
+func (c *Config) Transcoder(mediaType string) Transcoder {
+	if !c.TranscodeMedia {
+		return nil
+	}
+
+	switch mediaType {
+	case "image":
+		return TranscodeImage
+	case "audio", "video":
+		if c.FFmpegPath != "" {
+			return NewFFmpegTranscoder(c.FFmpegPath)
+		}
+	}
+	return nil
+}
+
+// TranscodeMedia tries to transcode the given media to satisfy the given target, saving the result as a new alternate
+// of that media. If the config has no transcoder for the media type, nil is returned.
+func TranscodeMedia(ctx context.Context, b Backend, cfg *Config, channel Channel, media Media, target *TranscodeTarget) (Media, error) {
+	mediaType, _, _ := strings.Cut(media.ContentType(), "/")
+	transcoder := cfg.Transcoder(mediaType)
+	if transcoder == nil || channel == nil {
+		return nil, nil
+	}
+
+	failedKey := fmt.Sprintf(transcodeFailedKey, sha256Hex(fmt.Sprintf("%s|%s|%d", media.URL(), strings.Join(target.ContentTypes, ","), target.MaxBytes)))
+	if hasMediaFailure(b.RedisPool(), failedKey) {
+		return nil, errors.Errorf("previous transcode of %s media failed", media.ContentType())
+	}
+
+	alternate, err := transcodeMedia(ctx, b, cfg, channel, media, transcoder, target)
+
+	// don't remember failures which are just us running out of time
+	if err != nil && ctx.Err() == nil {
+		setMediaFailure(b.RedisPool(), failedKey, transcodeFailedTTL)
+	}
+
+	return alternate, err
+}
+
+func transcodeMedia(ctx context.Context, b Backend, cfg *Config, channel Channel, media Media, transcoder Transcoder, target *TranscodeTarget) (Media, error) {
+	data, err := fetchMedia(ctx, b, cfg, media)
+	if err != nil {
+		return nil, err
+	}
+
+	transcoded, err := transcoder(ctx, data, media.ContentType(), target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error transcoding %s media", media.ContentType())
+	}
+	if len(target.ContentTypes) > 0 && !slices.Contains(target.ContentTypes, transcoded.ContentType) {
+		return nil, errors.Errorf("transcoded media has unsupported content type %s", transcoded.ContentType)
+	}
+	if target.MaxBytes > 0 && len(transcoded.Data) > target.MaxBytes {
+		return nil, errors.Errorf("transcoded media is still larger than %d bytes", target.MaxBytes)
+	}
+
+	// transcoding doesn't change how long something is
+	if transcoded.Duration == 0 {
+		transcoded.Duration = media.Duration()
+	}
+
+	alternate, err := b.SaveMediaAlternate(ctx, channel, media, transcoded)
+	return alternate, errors.Wrap(err, "error saving transcoded media")
+}
+
+// checks whether a failure to transcode or thumbnail media has been recorded with the given key
+func hasMediaFailure(rp *redis.Pool, key string) bool {
+	rc := rp.Get()
+	defer rc.Close()
+
+	exists, err := redis.Bool(rc.Do("EXISTS", key))
+	if err != nil {
+		slog.Error("error looking up media failure", "error", err, "key", key)
+		return false
+	}
+	return exists
+}
+
+// records a failure to transcode or thumbnail media with the given key so that it isn't retried until it expires
+func setMediaFailure(rp *redis.Pool, key string, ttl time.Duration) {
+	rc := rp.Get()
+	defer rc.Close()
+
+	if _, err := rc.Do("SET", key, "1", "EX", int(ttl/time.Second)); err != nil {
+		slog.Error("error recording media failure", "error", err, "key", key)
+	}
+}
+
+// fetches the content of the given media
+func fetchMedia(ctx context.Context, b Backend, cfg *Config, media Media) ([]byte, error) {
+	mediaURL, err := FetchableAttachmentURL(ctx, b, cfg, media.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating media request")
+	}
+	trace, err := httpx.DoTrace(b.HttpClient(true), req, nil, b.HttpAccess(), maxTranscodeBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching media")
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return nil, errors.Errorf("error fetching media, got status %d", trace.Response.StatusCode)
+	}
+	return trace.ResponseBody, nil
+}
+
+// the smallest we'll shrink an image to when trying to make it fit
+const minTranscodedImageDimension = 64
+
+var imageEncodings = map[string]string{"image/jpeg": "jpg", "image/png": "png"}
+
+// TranscodeImage is a transcoder for images which re-encodes them as JPEG or PNG, reducing quality and then dimensions
+// until they fit within the target size
+func TranscodeImage(ctx context.Context, data []byte, contentType string, target *TranscodeTarget) (*Transcoded, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding image")
+	}
+
+	outType := ""
+	for _, t := range target.ContentTypes {
+		if imageEncodings[t] != "" {
+			outType = t
+			break
+		}
+	}
+	if outType == "" {
+		if len(target.ContentTypes) > 0 {
+			return nil, errors.Errorf("can't encode images as any of %s", strings.Join(target.ContentTypes, ", "))
+		}
+		outType = "image/jpeg"
+		if imageEncodings[contentType] != "" {
+			outType = contentType
+		}
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	quality := 90
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		out := &bytes.Buffer{}
+		if outType == "image/jpeg" {
+			err = jpeg.Encode(out, flattenImage(img), &jpeg.Options{Quality: quality})
+		} else {
+			err = png.Encode(out, img)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error encoding image")
+		}
+
+		if target.MaxBytes <= 0 || out.Len() <= target.MaxBytes {
+			return &Transcoded{ContentType: outType, Extension: imageEncodings[outType], Data: out.Bytes(), Width: width, Height: height}, nil
+		}
+
+		// try reducing quality before reducing size
+		if outType == "image/jpeg" && quality > 60 {
+			quality -= 15
+			continue
+		}
+
+		width, height = width*3/4, height*3/4
+		if width < minTranscodedImageDimension || height < minTranscodedImageDimension {
+			return nil, errors.Errorf("unable to reduce image to %d bytes", target.MaxBytes)
+		}
+		img = scaleImage(img, width, height)
+	}
+}
+
+// scales the given image to the given dimensions, with each destination pixel being the average of the source pixels
+// that it covers
+func scaleImage(src image.Image, width, height int) image.Image {
+	sb := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := sb.Min.Y+y*sb.Dy()/height, sb.Min.Y+(y+1)*sb.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := sb.Min.X+x*sb.Dx()/width, sb.Min.X+(x+1)*sb.Dx()/width
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(b / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// JPEG doesn't support transparency so draw the image onto a white background
+func flattenImage(src image.Image) image.Image {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
+
+type ffmpegFormat struct {
+	extension string
+	args      []string
+	attempts  [][]string // extra args for each attempt, each producing smaller output
+}
+
+var audioAttempts = [][]string{{"-b:a", "128k"}, {"-b:a", "64k"}, {"-b:a", "32k"}}
+var videoAttempts = [][]string{
+	{"-vf", "scale=-2:'min(720,ih)'", "-crf", "28", "-b:a", "96k"},
+	{"-vf", "scale=-2:'min(480,ih)'", "-crf", "32", "-b:a", "64k"},
+	{"-vf", "scale=-2:'min(360,ih)'", "-crf", "36", "-b:a", "32k"},
+}
+
+var ffmpegFormats = map[string]*ffmpegFormat{
+	"audio/mpeg": {"mp3", []string{"-vn", "-c:a", "libmp3lame"}, audioAttempts},
+	"audio/mp3":  {"mp3", []string{"-vn", "-c:a", "libmp3lame"}, audioAttempts},
+	"audio/ogg":  {"ogg", []string{"-vn", "-c:a", "libopus"}, audioAttempts},
+	"audio/aac":  {"aac", []string{"-vn", "-c:a", "aac"}, audioAttempts},
+	"audio/mp4":  {"m4a", []string{"-vn", "-c:a", "aac"}, audioAttempts},
+	"video/mp4":  {"mp4", []string{"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p", "-c:a", "aac", "-movflags", "+faststart"}, videoAttempts},
+}
+
+// NewFFmpegTranscoder returns a transcoder for audio and video which uses the ffmpeg binary at the given path,
+// re-encoding at lower bitrates and resolutions until the output fits within the target size
+func NewFFmpegTranscoder(path string) Transcoder {
+	return func(ctx context.Context, data []byte, contentType string, target *TranscodeTarget) (*Transcoded, error) {
+		mediaType, _, _ := strings.Cut(contentType, "/")
+
+		candidates := target.ContentTypes
+		if len(candidates) == 0 {
+			candidates = []string{contentType}
+		}
+
+		outType := ""
+		for _, t := range candidates {
+			if ffmpegFormats[t] != nil && strings.HasPrefix(t, mediaType+"/") {
+				outType = t
+				break
+			}
+		}
+		if outType == "" {
+			return nil, errors.Errorf("can't encode %s as any of %s", mediaType, strings.Join(candidates, ", "))
+		}
+		format := ffmpegFormats[outType]
+
+		dir, err := os.MkdirTemp("", "courier-transcode")
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating temp directory")
+		}
+		defer os.RemoveAll(dir)
+
+		inPath, outPath := filepath.Join(dir, "in"), filepath.Join(dir, "out."+format.extension)
+		if err := os.WriteFile(inPath, data, 0600); err != nil {
+			return nil, errors.Wrap(err, "error writing input file")
+		}
+
+		for _, attempt := range format.attempts {
+			args := append([]string{"-y", "-loglevel", "error", "-i", inPath}, format.args...)
+			args = append(args, attempt...)
+			args = append(args, outPath)
+
+			if out, err := exec.CommandContext(ctx, path, args...).CombinedOutput(); err != nil {
+				return nil, errors.Wrapf(err, "error running ffmpeg: %s", strings.TrimSpace(string(out)))
+			}
+
+			output, err := os.ReadFile(outPath)
+			if err != nil {
+				return nil, errors.Wrap(err, "error reading output file")
+			}
+
+			if target.MaxBytes <= 0 || len(output) <= target.MaxBytes {
+				return &Transcoded{ContentType: outType, Extension: format.extension, Data: output}, nil
+			}
+		}
+
+		return nil, errors.Errorf("unable to reduce %s to %d bytes", mediaType, target.MaxBytes)
+	}
+}
@@ -0,0 +1,93 @@
+package courier_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/nyaruka/courier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generates a PNG of random noise which won't compress well
+func noisyPNG(t *testing.T, width, height int) []byte {
+	rnd := rand.New(rand.NewSource(123))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+		}
+	}
+
+	b := &bytes.Buffer{}
+	require.NoError(t, png.Encode(b, img))
+	return b.Bytes()
+}
+
+func TestConfigTranscoder(t *testing.T) {
+	cfg := courier.NewDefaultConfig()
+	assert.Nil(t, cfg.Transcoder("image"))
+
+	cfg.TranscodeMedia = true
+	assert.NotNil(t, cfg.Transcoder("image"))
+	assert.NotNil(t, cfg.Transcoder("audio"))
+	assert.NotNil(t, cfg.Transcoder("video"))
+	assert.Nil(t, cfg.Transcoder("application"))
+
+	// audio and video need ffmpeg
+	cfg.FFmpegPath = ""
+	assert.NotNil(t, cfg.Transcoder("image"))
+	assert.Nil(t, cfg.Transcoder("audio"))
+	assert.Nil(t, cfg.Transcoder("video"))
+}
+
+func TestTranscodeImage(t *testing.T) {
+	ctx := context.Background()
+	data := noisyPNG(t, 600, 400)
+
+	// no target content types or size, stays as PNG
+	out, err := courier.TranscodeImage(ctx, data, "image/png", &courier.TranscodeTarget{})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", out.ContentType)
+	assert.Equal(t, "png", out.Extension)
+	assert.Equal(t, 600, out.Width)
+	assert.Equal(t, 400, out.Height)
+
+	// converted to JPEG
+	out, err = courier.TranscodeImage(ctx, data, "image/png", &courier.TranscodeTarget{ContentTypes: []string{"image/webp", "image/jpeg"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", out.ContentType)
+	assert.Equal(t, "jpg", out.Extension)
+	assert.Equal(t, 600, out.Width)
+
+	// converted to JPEG and shrunk to fit
+	out, err = courier.TranscodeImage(ctx, data, "image/png", &courier.TranscodeTarget{ContentTypes: []string{"image/jpeg"}, MaxBytes: 40_000})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", out.ContentType)
+	assert.LessOrEqual(t, len(out.Data), 40_000)
+	assert.Less(t, out.Width, 600)
+	assert.Less(t, out.Height, 400)
+
+	img, err := jpeg.Decode(bytes.NewReader(out.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, out.Width, img.Bounds().Dx())
+	assert.Equal(t, out.Height, img.Bounds().Dy())
+
+	// can't encode as any of the target types
+	_, err = courier.TranscodeImage(ctx, data, "image/png", &courier.TranscodeTarget{ContentTypes: []string{"image/webp"}})
+	assert.EqualError(t, err, "can't encode images as any of image/webp")
+
+	// can't shrink enough
+	_, err = courier.TranscodeImage(ctx, data, "image/png", &courier.TranscodeTarget{MaxBytes: 100})
+	assert.EqualError(t, err, "unable to reduce image to 100 bytes")
+
+	// not an image
+	_, err = courier.TranscodeImage(ctx, []byte(`hello`), "image/png", &courier.TranscodeTarget{})
+	assert.EqualError(t, err, "error decoding image: image: unknown format")
+}
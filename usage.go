@@ -0,0 +1,186 @@
+package courier
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	channelUsageKey     = "channel_usage:%s:%s" // channel UUID and date
+	channelUsageTTL     = 100 * 24 * time.Hour
+	channelUsageMaxDays = 93
+
+	// providers can report the cost of a message when it's sent and in later status updates
+	channelUsageCostedKey = "channel_usage_costed:%s:%s" // channel UUID and msg ID or external ID
+	channelUsageCostedTTL = 7 * 24 * time.Hour
+
+	usageCostField  = "cost:" // prefix of cost fields, which are in millionths of the currency that follows
+	usageCostPlaces = 6
+)
+
+// ChannelUsage is what a channel sent on a given day
+type ChannelUsage struct {
+	Date     string                     `json:"date"`
+	Msgs     int                        `json:"msgs"`
+	Segments int                        `json:"segments"`
+	Costs    map[string]decimal.Decimal `json:"costs"`
+}
+
+// records sent messages and segments against today's usage counters for the given channel
+func recordUsage(rp *redis.Pool, channel Channel, msgs, segments int) error {
+	key := fmt.Sprintf(channelUsageKey, channel.UUID(), dates.Now().UTC().Format(time.DateOnly))
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	rc.Send("MULTI")
+	rc.Send("HINCRBY", key, "msgs", msgs)
+	if segments > 0 {
+		rc.Send("HINCRBY", key, "segments", segments)
+	}
+	rc.Send("EXPIRE", key, int(channelUsageTTL/time.Second))
+	if _, err := rc.Do("EXEC"); err != nil {
+		return errors.Wrap(err, "error incrementing channel usage")
+	}
+	return nil
+}
+
+var luaRecordCost = redis.NewScript(-1, `-- KEYS: [UsageKey, CostedKey...] ARGV: [CostField, Cost, UsageTTL, CostedTTL]
+	-- only the first cost reported for a message is counted
+	for i = 2, #KEYS do
+		if redis.call("exists", KEYS[i]) == 1 then
+			return 0
+		end
+	end
+	for i = 2, #KEYS do
+		redis.call("set", KEYS[i], "1", "EX", ARGV[4])
+	end
+
+	redis.call("hincrby", KEYS[1], ARGV[1], ARGV[2])
+	redis.call("expire", KEYS[1], ARGV[3])
+	return 1
+`)
+
+// records the cost on the given status against today's usage counters for the given channel, unless a cost has already
+// been recorded for its message, which might be identified by its ID or external ID
+func recordCost(rp *redis.Pool, channel Channel, status StatusUpdate) error {
+	cost, currency := status.Cost()
+	if currency == "" {
+		return nil
+	}
+
+	keys := []any{fmt.Sprintf(channelUsageKey, channel.UUID(), dates.Now().UTC().Format(time.DateOnly))}
+	if status.MsgID() != NilMsgID {
+		keys = append(keys, fmt.Sprintf(channelUsageCostedKey, channel.UUID(), strconv.FormatInt(int64(status.MsgID()), 10)))
+	}
+	if status.ExternalID() != "" {
+		keys = append(keys, fmt.Sprintf(channelUsageCostedKey, channel.UUID(), status.ExternalID()))
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	args := append([]any{len(keys)}, keys...)
+	args = append(args, usageCostField+currency, cost.Shift(usageCostPlaces).Round(0).IntPart(), int(channelUsageTTL/time.Second), int(channelUsageCostedTTL/time.Second))
+
+	if _, err := luaRecordCost.Do(rc, args...); err != nil {
+		return errors.Wrap(err, "error incrementing channel usage cost")
+	}
+	return nil
+}
+
+// GetChannelUsage returns the usage of the given channel for each day in the given range
+func GetChannelUsage(rc redis.Conn, channelUUID ChannelUUID, since, until time.Time) ([]*ChannelUsage, error) {
+	usage := make([]*ChannelUsage, 0, 31)
+
+	for day := since; !day.After(until); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		vals, err := redis.StringMap(rc.Do("HGETALL", fmt.Sprintf(channelUsageKey, channelUUID, date)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading channel usage for %s", date)
+		}
+
+		u := &ChannelUsage{Date: date, Costs: make(map[string]decimal.Decimal)}
+		for field, val := range vals {
+			n, _ := strconv.ParseInt(val, 10, 64)
+
+			switch {
+			case field == "msgs":
+				u.Msgs = int(n)
+			case field == "segments":
+				u.Segments = int(n)
+			case strings.HasPrefix(field, usageCostField):
+				u.Costs[strings.TrimPrefix(field, usageCostField)] = decimal.New(n, -usageCostPlaces)
+			}
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, nil
+}
+
+type usageResponse struct {
+	ChannelUUID ChannelUUID     `json:"channel_uuid"`
+	Usage       []*ChannelUsage `json:"usage"`
+}
+
+// handleUsage returns the daily usage of a channel, e.g. /c/_usage?channel=<uuid>&since=2024-03-01&until=2024-03-31
+func (s *server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	channelUUID := ChannelUUID(r.URL.Query().Get("channel"))
+	if channelUUID == "" {
+		WriteError(w, http.StatusBadRequest, errors.New("missing channel"))
+		return
+	}
+
+	today := dates.Now().UTC().Truncate(24 * time.Hour)
+	since, until := today, today
+	var err error
+
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err = time.Parse(time.DateOnly, v); err != nil {
+			WriteError(w, http.StatusBadRequest, errors.Errorf("invalid since date: %s", v))
+			return
+		}
+	}
+	if v := r.URL.Query().Get("until"); v != "" {
+		if until, err = time.Parse(time.DateOnly, v); err != nil {
+			WriteError(w, http.StatusBadRequest, errors.Errorf("invalid until date: %s", v))
+			return
+		}
+	}
+	if until.Before(since) || until.Sub(since) >= channelUsageMaxDays*24*time.Hour {
+		WriteError(w, http.StatusBadRequest, errors.Errorf("date range must be between 1 and %d days", channelUsageMaxDays))
+		return
+	}
+
+	rc := s.backend.RedisPool().Get()
+	usage, err := GetChannelUsage(rc, channelUUID, since, until)
+	rc.Close()
+
+	if err != nil {
+		slog.Error("error reading channel usage", "error", err, "channel_uuid", channelUUID)
+		WriteError(w, http.StatusInternalServerError, errors.New("error reading channel usage"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonx.MustMarshal(&usageResponse{ChannelUUID: channelUUID, Usage: usage}))
+}
+
+// records the cost reported in a status update from a channel, its msgs and segments having been counted when sent
+func (s *server) recordStatusCost(channel Channel, status StatusUpdate) {
+	if err := recordCost(s.backend.RedisPool(), channel, status); err != nil {
+		slog.Error("error recording channel cost", "error", err, "channel_uuid", channel.UUID())
+	}
+}
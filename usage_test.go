@@ -0,0 +1,122 @@
+package courier_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/courier"
+	"github.com/nyaruka/courier/test"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelUsage(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://mock.com/send": {
+			httpx.NewMockResponse(200, map[string]string{"Price": "0.0075", "External-ID": "ext101"}, []byte(`SENT`)),
+			httpx.NewMockResponse(200, map[string]string{"Price": "0.0150"}, []byte(`SENT`)),
+			httpx.NewMockResponse(200, nil, []byte(`SENT`)),
+			httpx.NewMockResponse(500, nil, []byte(`ERROR`)),
+		},
+	}))
+
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)))
+
+	config := testConfig()
+	config.AuthToken = "sesame"
+
+	mb := test.NewMockBackend()
+	s := courier.NewServer(config, mb)
+
+	s.Start()
+	defer s.Stop()
+
+	mockChannel := test.NewMockChannel("e4bb1578-29da-4fa5-a214-9da19dd24230", "MCK", "2020", "US", map[string]any{})
+	mb.AddChannel(mockChannel)
+
+	// segments and cost are recorded on the status of each message sent
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(101), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "hello", nil))
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(102), courier.NilMsgUUID, mockChannel, "tel:+250788383383", strings.Repeat("x", 200), nil))
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(103), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "It’s free", nil))
+
+	// but not counted for messages which couldn't be sent
+	sendAndWait(mb, test.NewMockMsg(courier.MsgID(104), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "boom", nil))
+
+	statuses := mb.WrittenMsgStatuses()
+	require.Len(t, statuses, 4)
+	assert.Equal(t, 1, statuses[0].Segments())
+	assert.Equal(t, 2, statuses[1].Segments())
+	assert.Equal(t, 1, statuses[2].Segments())
+	cost, currency := statuses[1].Cost()
+	assert.Equal(t, "0.015", cost.String())
+	assert.Equal(t, "USD", currency)
+	_, currency = statuses[2].Cost()
+	assert.Equal(t, "", currency)
+	assert.Equal(t, courier.MsgStatusErrored, statuses[3].Status())
+
+	// or sends which were duplicates
+	mb.PushOutgoingMsg(test.NewMockMsg(courier.MsgID(101), courier.NilMsgUUID, mockChannel, "tel:+250788383383", "hello", nil))
+	for len(mb.WrittenMsgStatuses()) < 5 {
+		time.Sleep(time.Millisecond * 25)
+	}
+	assert.Equal(t, courier.MsgStatusWired, mb.WrittenMsgStatuses()[4].Status())
+
+	receiveStatus := func(query string) {
+		resp, err := http.Get("http://localhost:8080/c/mck/e4bb1578-29da-4fa5-a214-9da19dd24230/status?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// costs in status updates are only counted if we don't already have a cost for that message, and are rounded
+	receiveStatus("id=ext101&price=0.0075")
+	receiveStatus("id=ext105&price=0.0000005")
+	receiveStatus("id=ext105&price=0.0000005")
+
+	getUsage := func(query, token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/c/_usage?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := getUsage("channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "sesame")
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{
+		"channel_uuid": "e4bb1578-29da-4fa5-a214-9da19dd24230",
+		"usage": [{"date": "2024-03-15", "msgs": 3, "segments": 4, "costs": {"USD": "0.022501"}}]
+	}`, body)
+
+	status, body = getUsage("channel=e4bb1578-29da-4fa5-a214-9da19dd24230&since=2024-03-14&until=2024-03-16", "sesame")
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{
+		"channel_uuid": "e4bb1578-29da-4fa5-a214-9da19dd24230",
+		"usage": [
+			{"date": "2024-03-14", "msgs": 0, "segments": 0, "costs": {}},
+			{"date": "2024-03-15", "msgs": 3, "segments": 4, "costs": {"USD": "0.022501"}},
+			{"date": "2024-03-16", "msgs": 0, "segments": 0, "costs": {}}
+		]
+	}`, body)
+
+	status, _ = getUsage("channel=e4bb1578-29da-4fa5-a214-9da19dd24230", "xxxxx")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = getUsage("since=2024-03-14", "sesame")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = getUsage("channel=e4bb1578-29da-4fa5-a214-9da19dd24230&since=2024-03-16&until=2024-03-14", "sesame")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = getUsage("channel=e4bb1578-29da-4fa5-a214-9da19dd24230&since=2024-01-01&until=2024-06-01", "sesame")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/nyaruka/gocommon/gsm7"
+)
+
+// SMSEncoding is the encoding an SMS will be sent with
+type SMSEncoding string
+
+// the encodings an SMS can be sent with
+const (
+	SMSEncodingGSM7 SMSEncoding = "gsm7"
+	SMSEncodingUCS2 SMSEncoding = "ucs2"
+)
+
+// segment sizes for single and multipart messages in each encoding, multipart segments being smaller because of the
+// space taken by the UDH header
+var smsSegmentSizes = map[SMSEncoding][2]int{
+	SMSEncodingGSM7: {160, 153},
+	SMSEncodingUCS2: {70, 67},
+}
+
+// characters in the GSM7 extension table which must be preceded by an escape and so take two septets
+var gsm7Extended = map[rune]bool{'\f': true, '^': true, '{': true, '}': true, '\\': true, '[': true, '~': true, ']': true, '|': true, '€': true}
+
+// replacements for characters which aren't GSM7 but commonly find their way into messages, applied after those from
+// gsm7.ReplaceSubstitutions
+var gsm7Transliterations = strings.NewReplacer(
+	"…", "...",
+	"—", "-",
+	"\u2011", "-",
+	"«", "\"",
+	"»", "\"",
+	"„", "\"",
+	"‚", "'",
+	"′", "'",
+	"″", "\"",
+	"•", "-",
+	"\u200b", "",
+	"\ufeff", "",
+)
+
+// DetectSMSEncoding returns the encoding required to send the given text as an SMS
+func DetectSMSEncoding(text string) SMSEncoding {
+	if gsm7.IsValid(text) {
+		return SMSEncodingGSM7
+	}
+	return SMSEncodingUCS2
+}
+
+// SMSRuneLength returns the number of septets (GSM7) or 16-bit code units (UCS2) the given rune takes in an SMS
+func SMSRuneLength(r rune, enc SMSEncoding) int {
+	if enc == SMSEncodingGSM7 {
+		if gsm7Extended[r] {
+			return 2
+		}
+		return 1
+	}
+	if r > 0xFFFF {
+		return 2 // encoded as a surrogate pair
+	}
+	return 1
+}
+
+// SMSLength returns the length of the given text as an SMS in its encoding, i.e. in septets if it's GSM7 and in
+// 16-bit code units if it's UCS2
+func SMSLength(text string) (int, SMSEncoding) {
+	enc := DetectSMSEncoding(text)
+	length := 0
+	for _, r := range text {
+		length += SMSRuneLength(r, enc)
+	}
+	return length, enc
+}
+
+// ScaleSMSLength scales a maximum length given in GSM7 septets, such as a channel's max length, to the equivalent in the
+// given encoding, e.g. 160 septets is 70 UCS2 code units. Only a max of up to a single GSM7 segment is a limit on the
+// size of segments. Larger maxes are limits on concatenated messages, which providers split into segments themselves,
+// so those are returned as is.
+func ScaleSMSLength(max int, enc SMSEncoding) int {
+	if max > smsSegmentSizes[SMSEncodingGSM7][0] {
+		return max
+	}
+	return max * smsSegmentSizes[enc][0] / smsSegmentSizes[SMSEncodingGSM7][0]
+}
+
+// SMSSegments returns the number of segments it will take to send the given text as an SMS
+func SMSSegments(text string) int {
+	length, enc := SMSLength(text)
+	sizes := smsSegmentSizes[enc]
+	if length <= sizes[0] {
+		return 1
+	}
+
+	// characters which take two units can't be split across segments, so we can't just divide
+	segments, size := 1, 0
+	for _, r := range text {
+		n := SMSRuneLength(r, enc)
+		if size+n > sizes[1] {
+			segments++
+			size = 0
+		}
+		size += n
+	}
+	return segments
+}
+
+// TransliterateGSM7 replaces characters in the given text with GSM7 equivalents, e.g. curly quotes with straight ones
+// and accented letters with unaccented ones. If the result still isn't valid GSM7 then the text will have to be sent
+// as UCS2 anyway, so the original text is returned unchanged.
+func TransliterateGSM7(text string) string {
+	if gsm7.IsValid(text) {
+		return text
+	}
+
+	replaced := gsm7Transliterations.Replace(gsm7.ReplaceSubstitutions(text))
+	if gsm7.IsValid(replaced) {
+		return replaced
+	}
+	return text
+}
@@ -0,0 +1,66 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/courier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMSLength(t *testing.T) {
+	tcs := []struct {
+		text     string
+		length   int
+		encoding utils.SMSEncoding
+		segments int
+	}{
+		{"", 0, utils.SMSEncodingGSM7, 1},
+		{"hello world", 11, utils.SMSEncodingGSM7, 1},
+		{"Très bien", 9, utils.SMSEncodingGSM7, 1},
+		{"{€}", 6, utils.SMSEncodingGSM7, 1},
+		{"It’s", 4, utils.SMSEncodingUCS2, 1},
+		{"😀", 2, utils.SMSEncodingUCS2, 1},
+		{strings.Repeat("x", 160), 160, utils.SMSEncodingGSM7, 1},
+		{strings.Repeat("x", 161), 161, utils.SMSEncodingGSM7, 2},
+		{strings.Repeat("x", 306), 306, utils.SMSEncodingGSM7, 2},
+		{strings.Repeat("x", 307), 307, utils.SMSEncodingGSM7, 3},
+		{strings.Repeat("x", 80) + strings.Repeat("€", 40), 160, utils.SMSEncodingGSM7, 1},
+		{strings.Repeat("x", 152) + "€" + strings.Repeat("x", 152), 306, utils.SMSEncodingGSM7, 3}, // € can't be split across segments
+		{strings.Repeat("x", 159) + "’", 160, utils.SMSEncodingUCS2, 3},
+		{strings.Repeat("x", 70) + "’", 71, utils.SMSEncodingUCS2, 2},
+		{strings.Repeat("x", 69) + "’", 70, utils.SMSEncodingUCS2, 1},
+	}
+
+	for _, tc := range tcs {
+		length, encoding := utils.SMSLength(tc.text)
+		assert.Equal(t, tc.length, length, "length mismatch for '%s'", tc.text)
+		assert.Equal(t, tc.encoding, encoding, "encoding mismatch for '%s'", tc.text)
+		assert.Equal(t, tc.encoding, utils.DetectSMSEncoding(tc.text), "encoding mismatch for '%s'", tc.text)
+		assert.Equal(t, tc.segments, utils.SMSSegments(tc.text), "segments mismatch for '%s'", tc.text)
+	}
+}
+
+func TestScaleSMSLength(t *testing.T) {
+	assert.Equal(t, 160, utils.ScaleSMSLength(160, utils.SMSEncodingGSM7))
+	assert.Equal(t, 70, utils.ScaleSMSLength(160, utils.SMSEncodingUCS2))
+	assert.Equal(t, 1600, utils.ScaleSMSLength(1600, utils.SMSEncodingUCS2))
+	assert.Equal(t, 66, utils.ScaleSMSLength(153, utils.SMSEncodingUCS2))
+}
+
+func TestTransliterateGSM7(t *testing.T) {
+	assert.Equal(t, "", utils.TransliterateGSM7(""))
+	assert.Equal(t, "hello €", utils.TransliterateGSM7("hello €"))
+	assert.Equal(t, "It's \"fine\"", utils.TransliterateGSM7("It’s “fine”"))
+	assert.Equal(t, "Ola, tudo bem? Sao Paulo...", utils.TransliterateGSM7("Olá, tudo bem? São Paulo…"))
+	assert.Equal(t, "a - b", utils.TransliterateGSM7("a — b"))
+
+	// if the text still can't be GSM7, it's left alone
+	assert.Equal(t, "It’s 😀", utils.TransliterateGSM7("It’s 😀"))
+	assert.Equal(t, "Привет’", utils.TransliterateGSM7("Привет’"))
+
+	// a single curly quote no longer makes a message 3 segments
+	text := strings.Repeat("x", 159) + "’"
+	assert.Equal(t, 3, utils.SMSSegments(text))
+	assert.Equal(t, 1, utils.SMSSegments(utils.TransliterateGSM7(text)))
+}